@@ -14,9 +14,19 @@ import (
 
 var ErrTimeout = errors.New("timeout")
 
+// jobOutput is the machine-readable outcome of a command that
+// submits a job, written by await when a structured output format is
+// requested.
+type jobOutput struct {
+	JobID    job.ID        `json:"jobID"`
+	Revision string        `json:"revision,omitempty"`
+	Applied  bool          `json:"applied"`
+	Result   update.Report `json:"result"`
+}
+
 // await polls for a job to complete, then for the resulting commit to
 // be applied
-func await(ctx context.Context, stdout, stderr io.Writer, client api.Server, jobID job.ID, apply bool, verbosity int, timeout time.Duration) error {
+func await(ctx context.Context, stdout, stderr io.Writer, client api.Server, jobID job.ID, apply bool, opts outputOpts, timeout time.Duration) error {
 	result, err := awaitJob(ctx, client, jobID, timeout)
 	if err != nil {
 		if err == ErrTimeout {
@@ -29,14 +39,23 @@ is safe to retry operations.`)
 		}
 		return err
 	}
-	if result.Result != nil {
-		update.PrintResults(stdout, result.Result, verbosity)
+	structured := isStructuredOutput(opts.outputFormat)
+	output := jobOutput{
+		JobID:    jobID,
+		Revision: result.Revision,
+		Result:   update.NewReport(result.Result),
+	}
+	if result.Result != nil && !structured {
+		update.PrintResults(stdout, result.Result, opts.verbosity)
 	}
 	if result.Revision != "" {
 		fmt.Fprintf(stderr, "Commit pushed:\t%s\n", result.Revision[:7])
 	}
 	if result.Result == nil {
 		fmt.Fprintf(stderr, "Nothing to do\n")
+		if structured {
+			return outputStructured(stdout, opts.outputFormat, output)
+		}
 		return nil
 	}
 
@@ -50,13 +69,20 @@ applied. This does not necessarily mean there is a problem. Use
     fluxctl sync
 
 to run a sync interactively.`)
+				if structured {
+					return outputStructured(stdout, opts.outputFormat, output)
+				}
 				return nil
 			}
 			return err
 		}
 		fmt.Fprintf(stderr, "Commit applied:\t%s\n", result.Revision[:7])
+		output.Applied = true
 	}
 
+	if structured {
+		return outputStructured(stdout, opts.outputFormat, output)
+	}
 	return nil
 }
 
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/fluxcd/flux/pkg/api/v12"
+)
+
+type driftOpts struct {
+	*rootOpts
+	noHeaders    bool
+	outputFormat string
+}
+
+func newDrift(parent *rootOpts) *driftOpts {
+	return &driftOpts{rootOpts: parent}
+}
+
+func (opts *driftOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "drift",
+		Short: "Show resources that have been changed in the cluster since they were synced.",
+		Long: `
+Show the resources found, at the most recent check, to differ from what was
+applied from git; either because they have been deleted, or because fields
+given in their manifests have been changed (e.g., with kubectl edit).
+
+Drift detection must be enabled in fluxd with --drift-detection-interval.
+        `,
+		Example: makeExample(
+			"fluxctl drift",
+			"fluxctl drift -o json",
+		),
+		RunE: opts.RunE,
+	}
+	cmd.Flags().BoolVar(&opts.noHeaders, "no-headers", false, "Don't print headers (default print headers)")
+	AddOutputFormatFlag(cmd, &opts.outputFormat)
+	return cmd
+}
+
+func (opts *driftOpts) RunE(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errorWantedNoArgs
+	}
+	if !outputFormatIsValid(opts.outputFormat) {
+		return errorInvalidOutputFormat
+	}
+
+	status, err := opts.API.DriftStatus(context.Background())
+	if err != nil {
+		return err
+	}
+
+	if isStructuredOutput(opts.outputFormat) {
+		return outputStructured(cmd.OutOrStdout(), opts.outputFormat, status)
+	}
+	if !status.Enabled {
+		return fmt.Errorf("drift detection is not enabled; run fluxd with --drift-detection-interval")
+	}
+	if status.Error != "" {
+		fmt.Fprintf(cmd.OutOrStderr(), "Last drift check failed: %s\n", status.Error)
+	}
+	outputDriftTab(cmd.OutOrStdout(), status, opts.noHeaders)
+	return nil
+}
+
+func outputDriftTab(out io.Writer, status v12.DriftStatus, noHeaders bool) {
+	w := tabwriter.NewWriter(out, 0, 2, 2, ' ', 0)
+	if !noHeaders {
+		fmt.Fprintf(w, "RESOURCE\tREASON\tFIELDS\tACTION\tCHECKED\n")
+	}
+	for _, r := range status.Resources {
+		action := "report"
+		if r.Correct {
+			action = "correct"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.ResourceID, r.Reason, strings.Join(r.Fields, ","), action, status.CheckedAt.Local().Format(time.RFC822))
+	}
+	w.Flush()
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/fluxcd/flux/pkg/api/v12"
+	"github.com/fluxcd/flux/pkg/cluster"
+	transport "github.com/fluxcd/flux/pkg/http"
+	"github.com/fluxcd/flux/pkg/resource"
+)
+
+func testDriftArgs(t *testing.T, status v12.DriftStatus, args []string, shouldErr bool) (*genericMockRoundTripper, string) {
+	svc := &genericMockRoundTripper{
+		mockResponses: map[*mux.Route]interface{}{
+			transport.NewAPIRouter().Get("DriftStatus"): status,
+		},
+		requestHistory: make(map[string]*http.Request),
+	}
+	driftClient := newDrift(mockServiceOpts(svc))
+
+	out := &bytes.Buffer{}
+	cmd := driftClient.Command()
+	cmd.SetOut(out)
+	cmd.SetArgs(args)
+	if err := cmd.Execute(); (err == nil) == shouldErr {
+		t.Fatalf("%s: %v", args, err)
+	}
+	return svc, out.String()
+}
+
+func TestDriftCommand_Output(t *testing.T) {
+	status := v12.DriftStatus{
+		Enabled:   true,
+		CheckedAt: time.Now(),
+		Resources: []v12.ResourceDrift{
+			{
+				ResourceDrift: cluster.ResourceDrift{
+					ResourceID: resource.MustParseID("default:deployment/foo"),
+					Reason:     cluster.DriftModified,
+					Fields:     []string{"spec.replicas"},
+				},
+				Correct: true,
+			},
+		},
+	}
+	svc, out := testDriftArgs(t, status, []string{}, false)
+	if svc.calledURL("DriftStatus") == nil {
+		t.Fatal("Expecting fluxctl to request DriftStatus, but did not.")
+	}
+	for _, expected := range []string{"default:deployment/foo", "modified", "spec.replicas", "correct"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected %q in the output, got:\n%s", expected, out)
+		}
+	}
+}
+
+func TestDriftCommand_InputFailures(t *testing.T) {
+	enabled := v12.DriftStatus{Enabled: true}
+	for _, v := range []struct {
+		status v12.DriftStatus
+		args   []string
+	}{
+		{enabled, []string{"subcommand"}},
+		{enabled, []string{"-o", "xml"}},
+		{v12.DriftStatus{}, []string{}},
+	} {
+		testDriftArgs(t, v.status, v.args, true)
+	}
+}
@@ -8,9 +8,12 @@ import (
 	"os"
 	"strings"
 	"text/tabwriter"
+	"text/template"
 	"time"
 
+	"github.com/ghodss/yaml"
 	"github.com/pkg/errors"
+	"k8s.io/client-go/util/jsonpath"
 
 	"github.com/fluxcd/flux/pkg/registry"
 
@@ -20,18 +23,30 @@ import (
 )
 
 type outputOpts struct {
-	verbosity int
+	verbosity    int
+	outputFormat string
 }
 
 const (
-	outputFormatJson = "json"
-	outputFormatTab  = "tab"
+	outputFormatJson     = "json"
+	outputFormatTab      = "tab"
+	outputFormatYaml     = "yaml"
+	outputFormatTemplate = "template"
+	outputFormatJsonPath = "jsonpath"
 )
 
-var validOutputFormats = []string{outputFormatJson, outputFormatTab}
+var validOutputFormats = []string{outputFormatJson, outputFormatTab, outputFormatYaml, outputFormatTemplate, outputFormatJsonPath}
 
 func AddOutputFlags(cmd *cobra.Command, opts *outputOpts) {
 	cmd.Flags().CountVarP(&opts.verbosity, "verbose", "v", "include skipped (and ignored, with -vv) workloads in output")
+	AddOutputFormatFlag(cmd, &opts.outputFormat)
+}
+
+// AddOutputFormatFlag adds the --output-format flag shared by all
+// commands that can produce machine-readable output.
+func AddOutputFormatFlag(cmd *cobra.Command, format *string) {
+	cmd.Flags().StringVarP(format, "output-format", "o", outputFormatTab,
+		"Output format (tab, json, yaml, template=<go template> or jsonpath=<jsonpath expression>)")
 }
 
 func newTabwriter() *tabwriter.Writer {
@@ -46,44 +61,109 @@ func makeExample(examples ...string) string {
 	return strings.TrimSuffix(buf.String(), "\n")
 }
 
+// splitOutputFormat separates the name of an output format from its
+// argument, e.g., "jsonpath={.id}" gives "jsonpath" and "{.id}".
+func splitOutputFormat(format string) (string, string) {
+	parts := strings.SplitN(format, "=", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
 func outputFormatIsValid(format string) bool {
+	name, arg := splitOutputFormat(format)
 	for _, f := range validOutputFormats {
-		if f == format {
-			return true
+		if f == name {
+			switch name {
+			case outputFormatTemplate, outputFormatJsonPath:
+				return arg != ""
+			default:
+				return arg == ""
+			}
 		}
 	}
 	return false
 }
 
-// outputImagesJson sends the provided ImageStatus info to the io.Writer in JSON formatting, honoring limits in opts
-func outputImagesJson(images []v6.ImageStatus, out io.Writer, opts *imageListOpts) error {
-	if opts.limit < 0 {
+// isStructuredOutput reports whether the format is one meant for
+// machines rather than people, i.e., anything other than tab.
+func isStructuredOutput(format string) bool {
+	name, _ := splitOutputFormat(format)
+	return name != "" && name != outputFormatTab
+}
+
+// outputStructured writes v to the io.Writer in the given structured
+// format. YAML, templates and JSONPath expressions all operate on the
+// JSON encoding of v, so field names are the same whichever format is
+// chosen.
+func outputStructured(out io.Writer, format string, v interface{}) error {
+	name, arg := splitOutputFormat(format)
+	if name == outputFormatJson {
+		return json.NewEncoder(out).Encode(v)
+	}
+
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "encoding output")
+	}
+
+	switch name {
+	case outputFormatYaml:
+		y, err := yaml.JSONToYAML(bytes)
+		if err != nil {
+			return errors.Wrap(err, "encoding output as YAML")
+		}
+		_, err = out.Write(y)
+		return err
+	case outputFormatTemplate, outputFormatJsonPath:
+		var data interface{}
+		if err := json.Unmarshal(bytes, &data); err != nil {
+			return errors.Wrap(err, "decoding output")
+		}
+		if name == outputFormatTemplate {
+			tmpl, err := template.New("output").Parse(arg)
+			if err != nil {
+				return errors.Wrap(err, "parsing output template")
+			}
+			return tmpl.Execute(out, data)
+		}
+		path := jsonpath.New("output")
+		if err := path.Parse(arg); err != nil {
+			return errors.Wrap(err, "parsing JSONPath expression")
+		}
+		return path.Execute(out, data)
+	}
+	return errorInvalidOutputFormat
+}
+
+// limitAvailableImages truncates the Available container images to
+// honor the lesser of limit or the total number of Available; a limit
+// of 0 means no truncation.
+func limitAvailableImages(images []v6.ImageStatus, limit int) error {
+	if limit < 0 {
 		return errors.New("opts.limit cannot be less than 0")
 	}
-	var sliceLimit int
-
-	// Truncate the Available container images to honor the lesser of
-	// opts.limit or the total number of Available
-	for i := 0; i < len(images); i++ {
-		containerImages := images[i]
-		for i := 0; i < len(containerImages.Containers); i++ {
-			if opts.limit != 0 {
-				available := containerImages.Containers[i].Available
-				if len(available) < opts.limit {
-					sliceLimit = len(available)
-				} else {
-					sliceLimit = opts.limit
-				}
-				containerImages.Containers[i].Available = containerImages.Containers[i].Available[:sliceLimit]
+	if limit == 0 {
+		return nil
+	}
+	for i := range images {
+		containers := images[i].Containers
+		for j := range containers {
+			if available := containers[j].Available; len(available) > limit {
+				containers[j].Available = available[:limit]
 			}
 		}
 	}
+	return nil
+}
 
-	e := json.NewEncoder(out)
-	if err := e.Encode(images); err != nil {
+// outputImagesJson sends the provided ImageStatus info to the io.Writer in JSON formatting, honoring limits in opts
+func outputImagesJson(images []v6.ImageStatus, out io.Writer, opts *imageListOpts) error {
+	if err := limitAvailableImages(images, opts.limit); err != nil {
 		return err
 	}
-	return nil
+	return outputStructured(out, outputFormatJson, images)
 }
 
 // outputImagesTab sends the provided ImageStatus info to os.Stdout in tab formatting, honoring limits in opts
@@ -162,8 +242,7 @@ func outputImagesTab(images []v6.ImageStatus, opts *imageListOpts) {
 
 // outputWorkloadsJson sends the provided Workload data to the io.Writer as JSON
 func outputWorkloadsJson(workloads []v6.ControllerStatus, out io.Writer) error {
-	encoder := json.NewEncoder(out)
-	return encoder.Encode(workloads)
+	return outputStructured(out, outputFormatJson, workloads)
 }
 
 // outputWorkloadsTab sends the provided Workload data to STDOUT, formatted with tabs for CLI
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_outputFormatIsValid(t *testing.T) {
+	for format, valid := range map[string]bool{
+		"tab":              true,
+		"json":             true,
+		"yaml":             true,
+		"template={{.}}":   true,
+		"jsonpath={.id}":   true,
+		"template":         false,
+		"jsonpath=":        false,
+		"json=something":   false,
+		"xml":              false,
+		"":                 false,
+		"go-template={{}}": false,
+	} {
+		assert.Equal(t, valid, outputFormatIsValid(format), format)
+	}
+}
+
+func Test_outputStructured(t *testing.T) {
+	value := versionOutput{Version: "1.2.3"}
+
+	for format, expected := range map[string]string{
+		"json":                  `{"version":"1.2.3"}` + "\n",
+		"yaml":                  "version: 1.2.3\n",
+		"template={{.version}}": "1.2.3",
+		"jsonpath={.version}":   "1.2.3",
+	} {
+		t.Run(format, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			require.NoError(t, outputStructured(buf, format, value))
+			assert.Equal(t, expected, buf.String())
+		})
+	}
+
+	t.Run("bad template", func(t *testing.T) {
+		assert.Error(t, outputStructured(&bytes.Buffer{}, "template={{.version", value))
+	})
+
+	t.Run("bad jsonpath", func(t *testing.T) {
+		assert.Error(t, outputStructured(&bytes.Buffer{}, "jsonpath={.missing}", value))
+	})
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/fluxcd/flux/pkg/api/v12"
+	"github.com/fluxcd/flux/pkg/policy"
+	"github.com/fluxcd/flux/pkg/resource"
+)
+
+type workloadHistoryOpts struct {
+	*rootOpts
+	namespace    string
+	workload     string
+	before       string
+	limit        int
+	noHeaders    bool
+	outputFormat string
+}
+
+func newWorkloadHistory(parent *rootOpts) *workloadHistoryOpts {
+	return &workloadHistoryOpts{rootOpts: parent}
+}
+
+func (opts *workloadHistoryOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "Show the image and policy changes made to a workload, and when they were synced.",
+		Long: `
+Show the commits that changed a workload, most recent first.
+
+For changes made by Flux (releases, automated updates and policy changes) the
+images and policies changed, and who asked for it, are shown. The SYNCED column
+says when each commit was applied to the cluster; it says "yes" when the commit
+has been applied, but before the daemon last started.
+        `,
+		Example: makeExample(
+			"fluxctl history --workload=default:deployment/foo",
+			"fluxctl history --workload=default:deployment/foo --limit=50 --before=3f7e55d",
+		),
+		RunE: opts.RunE,
+	}
+	cmd.Flags().StringVarP(&opts.namespace, "namespace", "n", "", "Workload namespace")
+	cmd.Flags().StringVarP(&opts.workload, "workload", "w", "", "Show history for this workload")
+	cmd.Flags().StringVar(&opts.before, "before", "", "Only show changes made before this revision")
+	cmd.Flags().IntVar(&opts.limit, "limit", 0, "Maximum number of changes to show (default 20)")
+	cmd.Flags().BoolVar(&opts.noHeaders, "no-headers", false, "Don't print headers (default print headers)")
+	AddOutputFormatFlag(cmd, &opts.outputFormat)
+	return cmd
+}
+
+func (opts *workloadHistoryOpts) RunE(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errorWantedNoArgs
+	}
+	if opts.workload == "" {
+		return newUsageError("-w, --workload is required")
+	}
+	if opts.limit < 0 {
+		return newUsageError("--limit cannot be negative")
+	}
+	if !outputFormatIsValid(opts.outputFormat) {
+		return errorInvalidOutputFormat
+	}
+
+	ns := getKubeConfigContextNamespaceOrDefault(opts.namespace, "default", opts.Context)
+	id, err := resource.ParseIDOptionalNamespace(ns, opts.workload)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	history, err := opts.API.WorkloadHistory(ctx, v12.WorkloadHistoryOptions{
+		Workload: id,
+		Before:   opts.before,
+		Limit:    opts.limit,
+	})
+	if err != nil {
+		return err
+	}
+
+	if isStructuredOutput(opts.outputFormat) {
+		return outputStructured(cmd.OutOrStdout(), opts.outputFormat, history)
+	}
+	outputHistoryTab(cmd.OutOrStdout(), history, opts.noHeaders)
+	if history.Next != "" {
+		fmt.Fprintf(cmd.OutOrStderr(), "\nThere are more changes; use --before=%.7s to see them.\n", history.Next)
+	}
+	return nil
+}
+
+func outputHistoryTab(out io.Writer, history v12.WorkloadHistory, noHeaders bool) {
+	w := tabwriter.NewWriter(out, 0, 2, 2, ' ', 0)
+	if !noHeaders {
+		fmt.Fprintf(w, "REVISION\tTIME\tAUTHOR\tSYNCED\tCHANGE\n")
+	}
+	for _, entry := range history.Entries {
+		author := entry.Author
+		if entry.Cause.User != "" {
+			author = entry.Cause.User
+		}
+		changes := historyChanges(entry)
+		fmt.Fprintf(w, "%.7s\t%s\t%s\t%s\t%s\n", entry.Revision, entry.Time.Local().Format(time.RFC822), author, historySynced(entry), changes[0])
+		for _, change := range changes[1:] {
+			fmt.Fprintf(w, "\t\t\t\t%s\n", change)
+		}
+	}
+	w.Flush()
+}
+
+func historySynced(entry v12.HistoryEntry) string {
+	switch {
+	case entry.SyncedAt != nil:
+		return entry.SyncedAt.Local().Format(time.RFC822)
+	case entry.Synced:
+		return "yes"
+	default:
+		return "no"
+	}
+}
+
+// historyChanges describes what changed in a history entry, one line
+// per change; there is always at least one line.
+func historyChanges(entry v12.HistoryEntry) []string {
+	var changes []string
+	for _, c := range entry.Images {
+		changes = append(changes, fmt.Sprintf("%s: %s -> %s", c.Container, c.Current.String(), c.Target.Tag))
+	}
+	changes = append(changes, policyChanges("+", entry.Policies.Add)...)
+	changes = append(changes, policyChanges("-", entry.Policies.Remove)...)
+	if len(changes) == 0 {
+		message := entry.Message
+		if entry.Cause.Message != "" {
+			message = entry.Cause.Message
+		}
+		changes = append(changes, strings.SplitN(message, "\n", 2)[0])
+	}
+	return changes
+}
+
+func policyChanges(prefix string, set policy.Set) []string {
+	var changes []string
+	for p, v := range set {
+		if v == "" || v == "true" {
+			changes = append(changes, prefix+string(p))
+		} else {
+			changes = append(changes, fmt.Sprintf("%s%s=%s", prefix, p, v))
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
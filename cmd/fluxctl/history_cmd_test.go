@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/fluxcd/flux/pkg/api/v12"
+	transport "github.com/fluxcd/flux/pkg/http"
+	"github.com/fluxcd/flux/pkg/image"
+	"github.com/fluxcd/flux/pkg/policy"
+	"github.com/fluxcd/flux/pkg/resource"
+	"github.com/fluxcd/flux/pkg/update"
+)
+
+func newHistoryMockService(history v12.WorkloadHistory) *genericMockRoundTripper {
+	return &genericMockRoundTripper{
+		mockResponses: map[*mux.Route]interface{}{
+			transport.NewAPIRouter().Get("WorkloadHistory"): history,
+		},
+		requestHistory: make(map[string]*http.Request),
+	}
+}
+
+func testHistoryArgs(t *testing.T, args []string, shouldErr bool, errMsg string) (*genericMockRoundTripper, string) {
+	svc := newHistoryMockService(v12.WorkloadHistory{
+		Workload: resource.MustParseID("default:deployment/foo"),
+		Entries: []v12.HistoryEntry{
+			{
+				Revision: "3f7e55d0000000000000000000000000000000000",
+				Author:   "Jane",
+				Time:     time.Now(),
+				Message:  "Update foo",
+				Synced:   true,
+			},
+		},
+		Next: "3f7e55d0000000000000000000000000000000000",
+	})
+	historyClient := newWorkloadHistory(mockServiceOpts(svc))
+	getKubeConfigContextNamespace = func(s string, c string) string { return s }
+
+	out := &bytes.Buffer{}
+	cmd := historyClient.Command()
+	cmd.SetOut(out)
+	cmd.SetArgs(args)
+	if err := cmd.Execute(); (err == nil) == shouldErr {
+		if errMsg != "" {
+			t.Fatalf("%s: %s", args, errMsg)
+		} else {
+			t.Fatalf("%s: %v", args, err)
+		}
+	}
+	return svc, out.String()
+}
+
+func TestHistoryCommand_CLIConversion(t *testing.T) {
+	for _, v := range []struct {
+		args     []string
+		expected map[string]string
+	}{
+		{[]string{"--workload=deployment/foo"}, map[string]string{
+			"workload": "default:deployment/foo",
+			"before":   "",
+			"limit":    "0",
+		}},
+		{[]string{"--workload=deployment/foo", "--namespace=bar", "--limit=5", "--before=abc1234"}, map[string]string{
+			"workload": "bar:deployment/foo",
+			"before":   "abc1234",
+			"limit":    "5",
+		}},
+	} {
+		svc, out := testHistoryArgs(t, v.args, false, "")
+
+		method := "WorkloadHistory"
+		if svc.calledURL(method) == nil {
+			t.Fatalf("Expecting fluxctl to request %q, but did not.", method)
+		}
+		actual := map[string]string{}
+		for k, vs := range svc.calledURL(method).Query() {
+			actual[k] = strings.Join(vs, ",")
+		}
+		if !reflect.DeepEqual(v.expected, actual) {
+			t.Fatalf("Expected %#v but got %#v", v.expected, actual)
+		}
+		if !strings.Contains(out, "3f7e55d") || !strings.Contains(out, "Update foo") {
+			t.Errorf("expected the entry in the output, got:\n%s", out)
+		}
+		if !strings.Contains(out, "--before=3f7e55d") {
+			t.Errorf("expected a hint about the next page, got:\n%s", out)
+		}
+	}
+}
+
+func TestHistoryCommand_InputFailures(t *testing.T) {
+	for _, v := range []struct {
+		args []string
+		msg  string
+	}{
+		{[]string{}, "Should error when no workload given"},
+		{[]string{"--workload=invalid&workload"}, "Should error with invalid workload"},
+		{[]string{"--workload=deployment/foo", "--limit=-1"}, "Should error with negative limit"},
+		{[]string{"--workload=deployment/foo", "subcommand"}, "Should error when given subcommand"},
+		{[]string{"--workload=deployment/foo", "-o", "xml"}, "Should error with invalid output format"},
+	} {
+		testHistoryArgs(t, v.args, true, v.msg)
+	}
+}
+
+func TestHistoryChanges(t *testing.T) {
+	current, _ := image.ParseRef("quay.io/weaveworks/helloworld:3")
+	target, _ := image.ParseRef("quay.io/weaveworks/helloworld:2")
+	for _, v := range []struct {
+		entry    v12.HistoryEntry
+		expected []string
+	}{
+		{v12.HistoryEntry{Message: "Edit by hand\n\nWith details"}, []string{"Edit by hand"}},
+		{v12.HistoryEntry{Message: "Auto-release", Cause: update.Cause{Message: "Rolling out fix"}}, []string{"Rolling out fix"}},
+		{v12.HistoryEntry{
+			Images: []update.ContainerUpdate{{Container: "greeter", Current: current, Target: target}},
+		}, []string{"greeter: quay.io/weaveworks/helloworld:3 -> 2"}},
+		{v12.HistoryEntry{
+			Policies: resource.PolicyUpdate{
+				Add:    policy.Set{policy.Locked: "true", policy.LockedUser: "jane"},
+				Remove: policy.Set{policy.Automated: "true"},
+			},
+		}, []string{"+locked", "+locked_user=jane", "-automated"}},
+	} {
+		if actual := historyChanges(v.entry); !reflect.DeepEqual(v.expected, actual) {
+			t.Errorf("Expected %#v but got %#v", v.expected, actual)
+		}
+	}
+}
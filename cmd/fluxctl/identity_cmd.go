@@ -9,9 +9,10 @@ import (
 
 type identityOpts struct {
 	*rootOpts
-	regenerate  bool
-	fingerprint bool
-	visual      bool
+	regenerate   bool
+	fingerprint  bool
+	visual       bool
+	outputFormat string
 }
 
 func newIdentity(parent *rootOpts) *identityOpts {
@@ -27,14 +28,19 @@ func (opts *identityOpts) Command() *cobra.Command {
 	cmd.Flags().BoolVarP(&opts.regenerate, "regenerate", "r", false, `Generate a new identity`)
 	cmd.Flags().BoolVarP(&opts.fingerprint, "fingerprint", "l", false, `Show fingerprint of public key`)
 	cmd.Flags().BoolVarP(&opts.visual, "visual", "v", false, `Show ASCII art representation with fingerprint (implies -l)`)
+	AddOutputFormatFlag(cmd, &opts.outputFormat)
 	return cmd
 }
 
-func (opts *identityOpts) RunE(_ *cobra.Command, args []string) error {
+func (opts *identityOpts) RunE(cmd *cobra.Command, args []string) error {
 	if len(args) > 0 {
 		return errorWantedNoArgs
 	}
 
+	if !outputFormatIsValid(opts.outputFormat) {
+		return errorInvalidOutputFormat
+	}
+
 	ctx := context.Background()
 
 	repoConfig, err := opts.API.GitRepoConfig(ctx, opts.regenerate)
@@ -43,17 +49,22 @@ func (opts *identityOpts) RunE(_ *cobra.Command, args []string) error {
 	}
 	publicSSHKey := repoConfig.PublicSSHKey
 
+	if isStructuredOutput(opts.outputFormat) {
+		return outputStructured(cmd.OutOrStdout(), opts.outputFormat, publicSSHKey)
+	}
+
 	if opts.visual {
 		opts.fingerprint = true
 	}
 
+	out := cmd.OutOrStdout()
 	if opts.fingerprint {
-		fmt.Println(publicSSHKey.Fingerprints["md5"].Hash)
+		fmt.Fprintln(out, publicSSHKey.Fingerprints["md5"].Hash)
 		if opts.visual {
-			fmt.Print(publicSSHKey.Fingerprints["md5"].Randomart)
+			fmt.Fprint(out, publicSSHKey.Fingerprints["md5"].Randomart)
 		}
 	} else {
-		fmt.Print(publicSSHKey.Key)
+		fmt.Fprint(out, publicSSHKey.Key)
 	}
 	return nil
 }
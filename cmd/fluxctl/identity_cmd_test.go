@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	v6 "github.com/fluxcd/flux/pkg/api/v6"
+	transport "github.com/fluxcd/flux/pkg/http"
+	"github.com/fluxcd/flux/pkg/ssh"
+)
+
+func testIdentityArgs(t *testing.T, args []string, shouldErr bool) (*genericMockRoundTripper, string) {
+	svc := &genericMockRoundTripper{
+		mockResponses: map[*mux.Route]interface{}{
+			transport.NewAPIRouter().Get("GitRepoConfig"): v6.GitConfig{
+				PublicSSHKey: ssh.PublicKey{
+					Key: "ssh-rsa AAAAB3NzaC1yc2E flux\n",
+					Fingerprints: map[string]ssh.Fingerprint{
+						"md5": {Hash: "MD5:de:ad:be:ef"},
+					},
+				},
+			},
+		},
+		requestHistory: make(map[string]*http.Request),
+	}
+	identityClient := newIdentity(mockServiceOpts(svc))
+
+	out := &bytes.Buffer{}
+	cmd := identityClient.Command()
+	cmd.SetOut(out)
+	cmd.SetArgs(args)
+	if err := cmd.Execute(); (err == nil) == shouldErr {
+		t.Fatalf("%s: %v", args, err)
+	}
+	return svc, out.String()
+}
+
+func TestIdentityCommand_Output(t *testing.T) {
+	for _, v := range []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{}, "ssh-rsa AAAAB3NzaC1yc2E flux\n"},
+		{[]string{"-l"}, "MD5:de:ad:be:ef\n"},
+		{[]string{"-o", "json"}, `"key":"ssh-rsa AAAAB3NzaC1yc2E flux\n"`},
+	} {
+		svc, out := testIdentityArgs(t, v.args, false)
+		if svc.calledURL("GitRepoConfig") == nil {
+			t.Fatal("Expecting fluxctl to request GitRepoConfig, but did not.")
+		}
+		if !strings.Contains(out, v.expected) {
+			t.Errorf("%s: expected %q in the output, got:\n%s", v.args, v.expected, out)
+		}
+	}
+}
+
+func TestIdentityCommand_InputFailures(t *testing.T) {
+	for _, args := range [][]string{
+		{"subcommand"},
+		{"-o", "xml"},
+	} {
+		testIdentityArgs(t, args, true)
+	}
+}
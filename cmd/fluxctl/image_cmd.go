@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/fluxcd/flux/pkg/resource"
+	"github.com/fluxcd/flux/pkg/update"
+)
+
+type imageOpts struct {
+	*rootOpts
+}
+
+func newImage(parent *rootOpts) *imageOpts {
+	return &imageOpts{rootOpts: parent}
+}
+
+func (opts *imageOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "image",
+		Short: "Commands for managing the images Flux will release.",
+	}
+	cmd.AddCommand(newImageReject(opts.rootOpts).Command())
+	return cmd
+}
+
+type imageRejectOpts struct {
+	*rootOpts
+	namespace string
+	workload  string
+	container string
+	remove    bool
+	outputOpts
+	cause update.Cause
+}
+
+func newImageReject(parent *rootOpts) *imageRejectOpts {
+	return &imageRejectOpts{rootOpts: parent}
+}
+
+func (opts *imageRejectOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "reject IMAGE...",
+		Short: "Reject images, so that automation and releases pass over them.",
+		Long: `
+Reject images, so that automation and releases pass over them.
+
+Rejected images are recorded in the git repo. Images rejected for a workload are
+recorded in its fluxcd.io/reject.<container> annotations; otherwise they are
+recorded in the .flux.yaml at the top of the repo, and are rejected for every
+workload. Automation then releases the latest of the images that haven't been
+rejected, rather than stopping altogether as it would for a locked workload.
+
+Give image refs (e.g., org/app:1.2.0) or digests (sha256:... or
+org/app@sha256:...). With --container, plain tags can be given too. Use
+--remove to let rejected images be released again.
+        `,
+		Example: makeExample(
+			"fluxctl image reject --workload=default:deployment/foo --container=app 1.2.0",
+			"fluxctl image reject --workload=default:deployment/foo org/app:1.2.0",
+			"fluxctl image reject org/app@sha256:a3ed95caeb02ffe68cdd9fd84406680ae93d633cb16422d00e8a7c22955b46d4",
+			"fluxctl image reject --remove org/app:1.2.0",
+		),
+		RunE: opts.RunE,
+	}
+
+	AddOutputFlags(cmd, &opts.outputOpts)
+	AddCauseFlags(cmd, &opts.cause)
+	cmd.Flags().StringVarP(&opts.namespace, "namespace", "n", "", "Workload namespace")
+	cmd.Flags().StringVarP(&opts.workload, "workload", "w", "", "Workload to reject the images for (default all workloads)")
+	cmd.Flags().StringVarP(&opts.container, "container", "c", "", "Container of the workload to reject the images for")
+	cmd.Flags().BoolVar(&opts.remove, "remove", false, "Stop rejecting the images")
+	return cmd
+}
+
+func (opts *imageRejectOpts) RunE(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		return newUsageError("please supply at least one image")
+	}
+	if opts.container != "" && opts.workload == "" {
+		return newUsageError("-c, --container can only be given with -w, --workload")
+	}
+	if !outputFormatIsValid(opts.outputFormat) {
+		return errorInvalidOutputFormat
+	}
+
+	spec := update.RejectSpec{
+		Container: opts.container,
+		Images:    args,
+		Remove:    opts.remove,
+	}
+	if opts.workload != "" {
+		ns := getKubeConfigContextNamespaceOrDefault(opts.namespace, "default", opts.Context)
+		id, err := resource.ParseIDOptionalNamespace(ns, opts.workload)
+		if err != nil {
+			return err
+		}
+		spec.Workload = id
+	}
+	if err := spec.Validate(); err != nil {
+		return newUsageError(err.Error())
+	}
+
+	fmt.Fprintf(cmd.OutOrStderr(), "Submitting image rejection ...\n")
+	ctx := context.Background()
+	jobID, err := opts.API.UpdateManifests(ctx, update.Spec{
+		Type:  update.Reject,
+		Cause: opts.cause,
+		Spec:  spec,
+	})
+	if err != nil {
+		return err
+	}
+	return await(ctx, cmd.OutOrStdout(), cmd.OutOrStderr(), opts.API, jobID, false, opts.outputOpts, opts.Timeout)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/fluxcd/flux/pkg/resource"
+	"github.com/fluxcd/flux/pkg/update"
+)
+
+func testImageRejectArgs(t *testing.T, args []string, shouldErr bool, errMsg string) *genericMockRoundTripper {
+	svc := newMockService()
+	rejectClient := newImageReject(mockServiceOpts(svc))
+	getKubeConfigContextNamespace = func(s string, c string) string { return s }
+
+	cmd := rejectClient.Command()
+	cmd.SetOutput(ioutil.Discard)
+	cmd.SetArgs(args)
+	if err := cmd.Execute(); (err == nil) == shouldErr {
+		if errMsg != "" {
+			t.Fatalf("%s: %s", args, errMsg)
+		} else {
+			t.Fatalf("%s: %v", args, err)
+		}
+	}
+	return svc
+}
+
+func TestImageRejectCommand_CLIConversion(t *testing.T) {
+	for _, v := range []struct {
+		args         []string
+		expectedSpec update.RejectSpec
+	}{
+		{[]string{"--workload=deployment/foo", "--container=app", "1.2.0"}, update.RejectSpec{
+			Workload:  resource.MustParseID("default:deployment/foo"),
+			Container: "app",
+			Images:    []string{"1.2.0"},
+		}},
+		{[]string{"--workload=deployment/foo", "--namespace=bar", "org/app:1.2.0", "org/app:1.2.1"}, update.RejectSpec{
+			Workload: resource.MustParseID("bar:deployment/foo"),
+			Images:   []string{"org/app:1.2.0", "org/app:1.2.1"},
+		}},
+		{[]string{"--remove", "sha256:abc"}, update.RejectSpec{
+			Images: []string{"sha256:abc"},
+			Remove: true,
+		}},
+	} {
+		svc := testImageRejectArgs(t, v.args, false, "")
+
+		method := "UpdateManifests"
+		if svc.calledURL(method) == nil {
+			t.Fatalf("Expecting fluxctl to request %q, but did not.", method)
+		}
+		r := svc.calledRequest(method)
+		var actualSpec update.Spec
+		if err := json.NewDecoder(r.Body).Decode(&actualSpec); err != nil {
+			t.Fatal("Failed to decode spec")
+		}
+		if actualSpec.Type != update.Reject {
+			t.Fatalf("Expected spec type %q but got %q", update.Reject, actualSpec.Type)
+		}
+		if !reflect.DeepEqual(v.expectedSpec, actualSpec.Spec) {
+			t.Fatalf("Expected %#v but got %#v", v.expectedSpec, actualSpec.Spec)
+		}
+	}
+}
+
+func TestImageRejectCommand_InputFailures(t *testing.T) {
+	for _, v := range []struct {
+		args []string
+		msg  string
+	}{
+		{[]string{}, "Should error when no images given"},
+		{[]string{"--container=app", "1.2.0"}, "Should error with a container but no workload"},
+		{[]string{"1.2.0"}, "Should error with a tag but no container"},
+		{[]string{"--workload=invalid&workload", "org/app:1.2.0"}, "Should error with invalid workload"},
+		{[]string{"-o", "xml", "org/app:1.2.0"}, "Should error with invalid output format"},
+	} {
+		testImageRejectArgs(t, v.args, true, v.msg)
+	}
+}
@@ -40,7 +40,7 @@ func (opts *imageListOpts) Command() *cobra.Command {
 	cmd.Flags().StringVarP(&opts.workload, "workload", "w", "", "Show images for this workload")
 	cmd.Flags().IntVarP(&opts.limit, "limit", "l", 10, "Number of images to show (0 for all)")
 	cmd.Flags().BoolVar(&opts.noHeaders, "no-headers", false, "Don't print headers (default print headers)")
-	cmd.Flags().StringVarP(&opts.outputFormat, "output-format", "o", "tab", "Output format (tab or json)")
+	AddOutputFormatFlag(cmd, &opts.outputFormat)
 
 	// Deprecated
 	cmd.Flags().StringVarP(&opts.controller, "controller", "c", "", "Show images for this controller")
@@ -88,9 +88,14 @@ func (opts *imageListOpts) RunE(cmd *cobra.Command, args []string) error {
 
 	sort.Sort(imageStatusByName(images))
 
-	switch opts.outputFormat {
-	case outputFormatJson:
+	switch {
+	case opts.outputFormat == outputFormatJson:
 		return outputImagesJson(images, os.Stdout, opts)
+	case isStructuredOutput(opts.outputFormat):
+		if err := limitAvailableImages(images, opts.limit); err != nil {
+			return err
+		}
+		return outputStructured(os.Stdout, opts.outputFormat, images)
 	default:
 		outputImagesTab(images, opts)
 	}
@@ -37,7 +37,7 @@ func (opts *workloadListOpts) Command() *cobra.Command {
 	cmd.Flags().BoolVarP(&opts.allNamespaces, "all-namespaces", "a", false, "Query across all namespaces")
 	cmd.Flags().StringVarP(&opts.containerName, "container", "c", "", "Filter workloads by container name")
 	cmd.Flags().BoolVar(&opts.noHeaders, "no-headers", false, "Don't print headers (default print headers)")
-	cmd.Flags().StringVarP(&opts.outputFormat, "output-format", "o", "tab", "Output format (tab or json)")
+	AddOutputFormatFlag(cmd, &opts.outputFormat)
 	return cmd
 }
 
@@ -70,9 +70,11 @@ func (opts *workloadListOpts) RunE(cmd *cobra.Command, args []string) error {
 
 	sort.Sort(workloadStatusByName(workloads))
 
-	switch opts.outputFormat {
-	case outputFormatJson:
-		outputWorkloadsJson(workloads, os.Stdout)
+	switch {
+	case opts.outputFormat == outputFormatJson:
+		return outputWorkloadsJson(workloads, os.Stdout)
+	case isStructuredOutput(opts.outputFormat):
+		return outputStructured(os.Stdout, opts.outputFormat, workloads)
 	default:
 		outputWorkloadsTab(workloads, opts)
 	}
@@ -88,6 +88,7 @@ func newMockService() *genericMockRoundTripper {
 	return &genericMockRoundTripper{
 		mockResponses: map[*mux.Route]interface{}{
 			transport.NewAPIRouter().Get("UpdateManifests"): job.ID("here-is-a-job-id"),
+			transport.NewAPIRouter().Get("Rollback"):        job.ID("here-is-a-job-id"),
 			transport.NewAPIRouter().Get("JobStatus"): job.Status{
 				StatusString: job.StatusSucceeded,
 			},
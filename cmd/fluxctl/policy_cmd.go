@@ -91,6 +91,10 @@ func (opts *workloadPolicyOpts) RunE(cmd *cobra.Command, args []string) error {
 		opts.workload = opts.controller
 	}
 
+	if !outputFormatIsValid(opts.outputFormat) {
+		return errorInvalidOutputFormat
+	}
+
 	if opts.automate && opts.deautomate {
 		return newUsageError("automate and deautomate both specified")
 	}
@@ -121,7 +125,7 @@ func (opts *workloadPolicyOpts) RunE(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	return await(ctx, cmd.OutOrStdout(), cmd.OutOrStderr(), opts.API, jobID, false, opts.verbosity, opts.Timeout)
+	return await(ctx, cmd.OutOrStdout(), cmd.OutOrStderr(), opts.API, jobID, false, opts.outputOpts, opts.Timeout)
 }
 
 func calculatePolicyChanges(opts *workloadPolicyOpts) (resource.PolicyUpdate, error) {
@@ -81,6 +81,10 @@ func (opts *workloadReleaseOpts) RunE(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	if !outputFormatIsValid(opts.outputFormat) {
+		return errorInvalidOutputFormat
+	}
+
 	// Backwards compatibility with --controller until we remove it
 	opts.workloads = append(opts.workloads, opts.controllers...)
 
@@ -89,6 +93,10 @@ func (opts *workloadReleaseOpts) RunE(cmd *cobra.Command, args []string) error {
 		return newUsageError("please supply either --all, or at least one --workload=<workload>")
 	case opts.watch && opts.dryRun:
 		return newUsageError("cannot use --watch with --dry-run")
+	case opts.watch && isStructuredOutput(opts.outputFormat):
+		return newUsageError("cannot use --watch with a structured output format")
+	case opts.interactive && isStructuredOutput(opts.outputFormat):
+		return newUsageError("cannot use --interactive with a structured output format")
 	case opts.force && opts.allWorkloads && opts.allImages:
 		return newUsageError("--force has no effect when used with --all and --update-all-images")
 	case opts.force && opts.allWorkloads:
@@ -189,7 +197,7 @@ func (opts *workloadReleaseOpts) RunE(cmd *cobra.Command, args []string) error {
 		opts.dryRun = false
 	}
 
-	err = await(ctx, cmd.OutOrStdout(), cmd.OutOrStderr(), opts.API, jobID, !opts.dryRun, opts.verbosity, opts.Timeout)
+	err = await(ctx, cmd.OutOrStdout(), cmd.OutOrStderr(), opts.API, jobID, !opts.dryRun, opts.outputOpts, opts.Timeout)
 	if !opts.watch || err != nil {
 		return err
 	}
@@ -1,8 +1,10 @@
 package main //+integration
 
 import (
+	"bytes"
 	"encoding/json"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/fluxcd/flux/pkg/resource"
@@ -79,8 +81,38 @@ func TestReleaseCommand_InputFailures(t *testing.T) {
 		{[]string{"--update-all-images"}, "Should error when not specifying workload spec"},
 		{[]string{"--workload=invalid&workload", "--update-all-images"}, "Should error with invalid workload"},
 		{[]string{"subcommand"}, "Should error when given subcommand"},
+		{[]string{"--all", "--update-all-images", "-o", "xml"}, "Should error with invalid output format"},
+		{[]string{"--all", "--update-all-images", "-o", "json", "--watch"}, "Should error with --watch and structured output"},
 	} {
 		testArgs(t, v.args, true, v.msg)
 	}
 
 }
+
+func TestReleaseCommand_StructuredOutput(t *testing.T) {
+	svc := newMockService()
+	releaseClient := newWorkloadRelease(mockServiceOpts(svc))
+	getKubeConfigContextNamespace = func(s string, c string) string { return s }
+
+	buf := &bytes.Buffer{}
+	cmd := releaseClient.Command()
+	cmd.SetOut(buf)
+	cmd.SetArgs([]string{"--update-all-images", "--all", "-o", "json"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Progress messages go to the same writer as the output when
+	// one is set, so only the last line is the structured output
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	var output jobOutput
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &output); err != nil {
+		t.Fatalf("decoding output %q: %s", buf.String(), err)
+	}
+	if output.JobID != "here-is-a-job-id" {
+		t.Errorf("expected job ID in output, got %q", output.JobID)
+	}
+	if output.Result.Version != update.ReportVersion {
+		t.Errorf("expected report version %q, got %q", update.ReportVersion, output.Result.Version)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/fluxcd/flux/pkg/api/v12"
+	"github.com/fluxcd/flux/pkg/resource"
+	"github.com/fluxcd/flux/pkg/update"
+)
+
+type workloadRollbackOpts struct {
+	*rootOpts
+	namespace  string
+	workload   string
+	toRevision string
+	steps      int
+	outputOpts
+	cause update.Cause
+}
+
+func newWorkloadRollback(parent *rootOpts) *workloadRollbackOpts {
+	return &workloadRollbackOpts{rootOpts: parent}
+}
+
+func (opts *workloadRollbackOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rollback",
+		Short: "Roll back a workload to the images it had before an earlier release, and lock it.",
+		Long: `
+Roll back a workload to the images it had before an earlier release, and lock it.
+
+By default the most recent image change made by Flux is undone. Use --steps to
+undo more than one, or --to-revision to go back to the images the workload had
+as of a particular commit. The workload is locked afterwards, so that automation
+does not immediately release the newer images again; unlock it once the problem
+is fixed.
+        `,
+		Example: makeExample(
+			"fluxctl rollback --workload=default:deployment/foo",
+			"fluxctl rollback --workload=default:deployment/foo --steps=2",
+			"fluxctl rollback --workload=default:deployment/foo --to-revision=3f7e55d",
+		),
+		RunE: opts.RunE,
+	}
+
+	AddOutputFlags(cmd, &opts.outputOpts)
+	AddCauseFlags(cmd, &opts.cause)
+	cmd.Flags().StringVarP(&opts.namespace, "namespace", "n", "", "Workload namespace")
+	cmd.Flags().StringVarP(&opts.workload, "workload", "w", "", "Workload to roll back")
+	cmd.Flags().StringVar(&opts.toRevision, "to-revision", "", "Roll back to the images the workload had as of this revision")
+	cmd.Flags().IntVar(&opts.steps, "steps", 0, "Number of image changes to undo (default 1)")
+	return cmd
+}
+
+func (opts *workloadRollbackOpts) RunE(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errorWantedNoArgs
+	}
+	if opts.workload == "" {
+		return newUsageError("-w, --workload is required")
+	}
+	if opts.toRevision != "" && opts.steps != 0 {
+		return newUsageError("please supply only one of --to-revision or --steps")
+	}
+	if opts.steps < 0 {
+		return newUsageError("--steps cannot be negative")
+	}
+	if !outputFormatIsValid(opts.outputFormat) {
+		return errorInvalidOutputFormat
+	}
+
+	ns := getKubeConfigContextNamespaceOrDefault(opts.namespace, "default", opts.Context)
+	id, err := resource.ParseIDOptionalNamespace(ns, opts.workload)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(cmd.OutOrStderr(), "Submitting rollback ...\n")
+	ctx := context.Background()
+	jobID, err := opts.API.Rollback(ctx, v12.RollbackOptions{
+		RollbackSpec: update.RollbackSpec{
+			Workload:   id,
+			ToRevision: opts.toRevision,
+			Steps:      opts.steps,
+		},
+		Cause: opts.cause,
+	})
+	if err != nil {
+		return err
+	}
+	return await(ctx, cmd.OutOrStdout(), cmd.OutOrStderr(), opts.API, jobID, true, opts.outputOpts, opts.Timeout)
+}
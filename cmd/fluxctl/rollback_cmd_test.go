@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/fluxcd/flux/pkg/api/v12"
+	"github.com/fluxcd/flux/pkg/resource"
+	"github.com/fluxcd/flux/pkg/update"
+)
+
+func testRollbackArgs(t *testing.T, args []string, shouldErr bool, errMsg string) *genericMockRoundTripper {
+	svc := newMockService()
+	rollbackClient := newWorkloadRollback(mockServiceOpts(svc))
+	getKubeConfigContextNamespace = func(s string, c string) string { return s }
+
+	cmd := rollbackClient.Command()
+	cmd.SetOutput(ioutil.Discard)
+	cmd.SetArgs(args)
+	if err := cmd.Execute(); (err == nil) == shouldErr {
+		if errMsg != "" {
+			t.Fatalf("%s: %s", args, errMsg)
+		} else {
+			t.Fatalf("%s: %v", args, err)
+		}
+	}
+	return svc
+}
+
+func TestRollbackCommand_CLIConversion(t *testing.T) {
+	for _, v := range []struct {
+		args         []string
+		expectedSpec update.RollbackSpec
+	}{
+		{[]string{"--workload=deployment/foo"}, update.RollbackSpec{
+			Workload: resource.MustParseID("default:deployment/foo"),
+		}},
+		{[]string{"--workload=deployment/foo", "--namespace=bar", "--steps=2"}, update.RollbackSpec{
+			Workload: resource.MustParseID("bar:deployment/foo"),
+			Steps:    2,
+		}},
+		{[]string{"--workload=deployment/foo", "--to-revision=3f7e55d"}, update.RollbackSpec{
+			Workload:   resource.MustParseID("default:deployment/foo"),
+			ToRevision: "3f7e55d",
+		}},
+	} {
+		svc := testRollbackArgs(t, v.args, false, "")
+
+		method := "Rollback"
+		if svc.calledURL(method) == nil {
+			t.Fatalf("Expecting fluxctl to request %q, but did not.", method)
+		}
+		r := svc.calledRequest(method)
+		var actualOpts v12.RollbackOptions
+		if err := json.NewDecoder(r.Body).Decode(&actualOpts); err != nil {
+			t.Fatal("Failed to decode rollback options")
+		}
+		if !reflect.DeepEqual(v.expectedSpec, actualOpts.RollbackSpec) {
+			t.Fatalf("Expected %#v but got %#v", v.expectedSpec, actualOpts.RollbackSpec)
+		}
+
+		method = "JobStatus"
+		if svc.calledURL(method) == nil {
+			t.Fatalf("Expecting fluxctl to request %q, but did not.", method)
+		}
+	}
+}
+
+func TestRollbackCommand_InputFailures(t *testing.T) {
+	for _, v := range []struct {
+		args []string
+		msg  string
+	}{
+		{[]string{}, "Should error when no workload given"},
+		{[]string{"--workload=invalid&workload"}, "Should error with invalid workload"},
+		{[]string{"--workload=deployment/foo", "--steps=2", "--to-revision=3f7e55d"}, "Should error with both --steps and --to-revision"},
+		{[]string{"--workload=deployment/foo", "--steps=-1"}, "Should error with negative steps"},
+		{[]string{"--workload=deployment/foo", "subcommand"}, "Should error when given subcommand"},
+		{[]string{"--workload=deployment/foo", "-o", "xml"}, "Should error with invalid output format"},
+	} {
+		testRollbackArgs(t, v.args, true, v.msg)
+	}
+}
@@ -86,6 +86,7 @@ func (opts *rootOpts) Command() *cobra.Command {
 	cmd.AddCommand(
 		newVersionCommand(),
 		newImageList(opts).Command(),
+		newImage(opts).Command(),
 		newWorkloadList(opts).Command(),
 		newWorkloadRelease(opts).Command(),
 		newWorkloadAutomate(opts).Command(),
@@ -93,6 +94,9 @@ func (opts *rootOpts) Command() *cobra.Command {
 		newWorkloadLock(opts).Command(),
 		newWorkloadUnlock(opts).Command(),
 		newWorkloadPolicy(opts).Command(),
+		newWorkloadRollback(opts).Command(),
+		newWorkloadHistory(opts).Command(),
+		newDrift(opts).Command(),
 		newSave(opts).Command(),
 		newIdentity(opts).Command(),
 		newSync(opts).Command(),
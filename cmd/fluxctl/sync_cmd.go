@@ -13,6 +13,13 @@ import (
 
 type syncOpts struct {
 	*rootOpts
+	outputFormat string
+}
+
+// syncOutput is the machine-readable outcome of a sync.
+type syncOutput struct {
+	Branch   string `json:"branch"`
+	Revision string `json:"revision"`
 }
 
 func newSync(parent *rootOpts) *syncOpts {
@@ -25,6 +32,7 @@ func (opts *syncOpts) Command() *cobra.Command {
 		Short: "Synchronize the cluster with the git repository, now",
 		RunE:  opts.RunE,
 	}
+	AddOutputFormatFlag(cmd, &opts.outputFormat)
 	return cmd
 }
 
@@ -33,6 +41,10 @@ func (opts *syncOpts) RunE(cmd *cobra.Command, args []string) error {
 		return errorWantedNoArgs
 	}
 
+	if !outputFormatIsValid(opts.outputFormat) {
+		return errorInvalidOutputFormat
+	}
+
 	ctx := context.Background()
 
 	gitConfig, err := opts.API.GitRepoConfig(ctx, false)
@@ -80,6 +92,12 @@ func (opts *syncOpts) RunE(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	fmt.Fprintln(cmd.OutOrStderr(), "Done.")
+	if isStructuredOutput(opts.outputFormat) {
+		return outputStructured(cmd.OutOrStdout(), opts.outputFormat, syncOutput{
+			Branch:   gitConfig.Remote.Branch,
+			Revision: result.Revision,
+		})
+	}
 	return nil
 }
 
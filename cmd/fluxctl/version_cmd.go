@@ -8,19 +8,33 @@ import (
 
 var version string
 
+// versionOutput is the machine-readable form of the version.
+type versionOutput struct {
+	Version string `json:"version"`
+}
+
 func newVersionCommand() *cobra.Command {
-	return &cobra.Command{
+	var outputFormat string
+	cmd := &cobra.Command{
 		Use:   "version",
 		Short: "Output the version of fluxctl",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if len(args) != 0 {
 				return errorWantedNoArgs
 			}
+			if !outputFormatIsValid(outputFormat) {
+				return errorInvalidOutputFormat
+			}
 			if version == "" {
 				version = "unversioned"
 			}
+			if isStructuredOutput(outputFormat) {
+				return outputStructured(cmd.OutOrStdout(), outputFormat, versionOutput{Version: version})
+			}
 			fmt.Fprintln(cmd.OutOrStdout(), version)
 			return nil
 		},
 	}
+	AddOutputFormatFlag(cmd, &outputFormat)
+	return cmd
 }
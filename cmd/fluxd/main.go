@@ -1,9 +1,12 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	_ "net/http/pprof"
 	"net/url"
@@ -32,17 +35,23 @@ import (
 
 	helmopclient "github.com/fluxcd/helm-operator/pkg/client/clientset/versioned"
 
+	"github.com/fluxcd/flux/pkg/api"
+	"github.com/fluxcd/flux/pkg/canary"
 	"github.com/fluxcd/flux/pkg/checkpoint"
 	"github.com/fluxcd/flux/pkg/cluster"
 	"github.com/fluxcd/flux/pkg/cluster/kubernetes"
+	kresource "github.com/fluxcd/flux/pkg/cluster/kubernetes/resource"
 	"github.com/fluxcd/flux/pkg/daemon"
+	"github.com/fluxcd/flux/pkg/decrypt"
 	"github.com/fluxcd/flux/pkg/git"
 	"github.com/fluxcd/flux/pkg/gpg"
 	transport "github.com/fluxcd/flux/pkg/http"
 	"github.com/fluxcd/flux/pkg/http/client"
 	daemonhttp "github.com/fluxcd/flux/pkg/http/daemon"
+	"github.com/fluxcd/flux/pkg/http/webhook"
 	"github.com/fluxcd/flux/pkg/image"
 	"github.com/fluxcd/flux/pkg/job"
+	"github.com/fluxcd/flux/pkg/leader"
 	"github.com/fluxcd/flux/pkg/manifests"
 	"github.com/fluxcd/flux/pkg/registry"
 	"github.com/fluxcd/flux/pkg/registry/cache"
@@ -110,6 +119,8 @@ func main() {
 		logFormat         = fs.String("log-format", "fmt", "Change the log format.")
 		listenAddr        = fs.StringP("listen", "l", ":3030", "Listen address where /metrics and API will be served")
 		listenMetricsAddr = fs.String("listen-metrics", "", "Listen address for /metrics endpoint")
+		listenWebhookAddr = fs.String("listen-webhook", "", "Listen address for the /hook endpoint, which receives push webhooks from GitHub, GitLab, Bitbucket and Gitea; requires --webhook-secret-file")
+		webhookSecretFile = fs.String("webhook-secret-file", "", "File containing the secret shared with the git host, used to verify push webhooks")
 		kubernetesKubectl = fs.String("kubernetes-kubectl", "", "optional, Explicit path to kubectl tool")
 		versionFlag       = fs.Bool("version", false, "Get version number")
 		// Git repo & key etc.
@@ -123,6 +134,11 @@ func main() {
 		gitLabel     = fs.String("git-label", "", "Label to keep track of sync progress; overrides both --git-sync-tag and --git-notes-ref")
 		gitSecret    = fs.Bool("git-secret", false, "If set, git-secret will be run on every git checkout. A gpg key must be imported using  --git-gpg-key-import or by mounting a keyring containing it directly")
 		sopsEnabled  = fs.Bool("sops", false, "If set, decrypt SOPS-encrypted manifest files with before syncing them. Provide decryption keys in the same way you would provide them for the sops binary. Be aware that manifests generated with .flux.yaml are not automatically decrypted")
+
+		// Decrypting resources before syncing them
+		sopsAgeKeysSecret = fs.String("sops-age-keys-secret", "", "Name of a secret in fluxd's namespace holding age keys; if set, SOPS-encrypted resources are decrypted before syncing, and those that can't be are reported as sync errors rather than failing the sync. Cannot be used with --sops")
+		sopsLocalKMSKeys  = fs.String("sops-kms-local-keys", "", "Path to a file of keys with which to stand in for a key management service when decrypting SOPS-encrypted resources, as with --sops-age-keys-secret. Cannot be used with --sops")
+
 		// Old git config; still used if --git-label is not supplied, but --git-label is preferred.
 		gitSyncTag     = fs.String("git-sync-tag", defaultGitSyncTag, fmt.Sprintf("Tag to use to mark sync progress for this cluster (only relevant when --sync-state=%s)", fluxsync.GitTagStateMode))
 		gitNotesRef    = fs.String("git-notes-ref", defaultGitNotesRef, "Ref to use for keeping commit annotations in git notes")
@@ -131,11 +147,27 @@ func main() {
 
 		gitPollInterval = fs.Duration("git-poll-interval", 5*time.Minute, "Period at which to poll git repo for new commits")
 		gitTimeout      = fs.Duration("git-timeout", 20*time.Second, "Duration after which git operations time out")
+		gitBackend      = fs.String("git-backend", "exec", "How to carry out git operations: by running the git executable (exec), or in-process (go-git)")
+
+		// large repositories
+		gitDepth          = fs.Int("git-depth", 0, "Fetch only this many commits of history when cloning the git repo, fetching more as it's needed; 0 means fetch the full history")
+		gitSparseCheckout = fs.Bool("git-sparse-checkout", false, "Check out only the paths given with --git-path (and any .flux.yaml files above them) when working with the git repo")
+
+		// HTTPS git credentials
+		gitHTTPSUsername           = fs.String("git-https-username", "git", "Username to give with the token from --git-https-token-file")
+		gitHTTPSTokenFile          = fs.String("git-https-token-file", "", "File containing a token to authenticate to an HTTPS git URL; it is read again whenever it changes")
+		gitHTTPSCredentialsSecret  = fs.String("git-https-credentials-secret", "", "Name of a secret in fluxd's namespace, with username and password entries, to authenticate to an HTTPS git URL")
+		gitGitHubAppID             = fs.Int64("git-github-app-id", 0, "ID of a GitHub App with which to authenticate to an HTTPS git URL; requires --git-github-app-installation-id and --git-github-app-private-key-file")
+		gitGitHubAppInstallationID = fs.Int64("git-github-app-installation-id", 0, "ID of the installation of the GitHub App given with --git-github-app-id")
+		gitGitHubAppPrivateKeyFile = fs.String("git-github-app-private-key-file", "", "File containing the private key of the GitHub App given with --git-github-app-id")
+		gitGitHubAPIURL            = fs.String("git-github-api-url", git.DefaultGitHubAPIURL, "URL of the GitHub API from which to get GitHub App installation tokens; e.g., for GitHub Enterprise Server")
 
 		// GPG commit signing
 		gitImportGPG               = fs.StringSlice("git-gpg-key-import", []string{}, "Keys at the paths given will be imported for use of signing and verifying commits")
-		gitSigningKey              = fs.String("git-signing-key", "", "If set, commits Flux makes will be signed with this GPG key")
+		gitSigningKey              = fs.String("git-signing-key", "", "If set, commits Flux makes will be signed with this GPG key, or with --git-signing-format=ssh, the SSH private key at this path")
+		gitSigningFormat           = fs.String("git-signing-format", git.SigningFormatGPG, fmt.Sprintf("How to sign the commits and tags Flux makes (one of %s); with ssh, the deploy key is used unless --git-signing-key is given, and with sigstore, gitsign must be installed", strings.Join([]string{git.SigningFormatGPG, git.SigningFormatSSH, git.SigningFormatSigstore}, ",")))
 		gitVerifySignatures        = fs.Bool("git-verify-signatures", false, "(deprecated) Sets --git-verify-signatures-mode=all when set")
+		gitSSHAllowedSigners       = fs.String("git-ssh-allowed-signers", "", "Path to an allowed signers file (see ssh-keygen(1)) listing the SSH keys trusted to sign commits and tags; it is read each time a signature is verified")
 		gitVerifySignaturesModeStr = fs.String("git-verify-signatures-mode", fluxsync.VerifySignaturesModeDefault, fmt.Sprintf("If git-verify-signatures is set, which strategy to use for signature verification (one of %s)", strings.Join([]string{fluxsync.VerifySignaturesModeNone, fluxsync.VerifySignaturesModeAll, fluxsync.VerifySignaturesModeFirstParent}, ",")))
 
 		// syncing
@@ -145,6 +177,31 @@ func main() {
 		dryGC        = fs.Bool("sync-garbage-collection-dry", false, "Only log what would be garbage collected, rather than deleting. Implies --sync-garbage-collection")
 		syncState    = fs.String("sync-state", fluxsync.GitTagStateMode, fmt.Sprintf("Method used by flux for storing state (one of {%s})", strings.Join([]string{fluxsync.GitTagStateMode, fluxsync.NativeStateMode}, ",")))
 
+		syncGCMaxDeletions   = fs.Int("sync-garbage-collection-max-deletions", 100, "Don't delete anything during garbage collection if there are more than this many resources to delete; 0 means no limit")
+		syncGCProtectedKinds = fs.StringSlice("sync-garbage-collection-protected-kinds", kubernetes.DefaultGCProtectedKinds, "Kinds of resource not deleted by garbage collection, unless annotated with fluxcd.io/prune: enabled")
+
+		// drift
+		driftInterval   = fs.Duration("drift-detection-interval", 0, "Check this often for resources changed in the cluster since they were synced; 0 disables drift detection")
+		driftCorrection = fs.Bool("drift-correction", false, "Sync as soon as drift is detected, rather than waiting for the next sync; can be overridden per resource with the fluxcd.io/drift annotation")
+
+		// readiness
+		readinessInterval = fs.Duration("readiness-check-interval", time.Minute, "Check this often how far the synced resources have got with reconciling, for metrics; 0 means only after each sync")
+
+		// hooks
+		syncHookTimeout = fs.Duration("sync-hook-timeout", daemon.DefaultSyncHookTimeout, "Duration within which all the sync hooks (Jobs or Pods annotated with fluxcd.io/hook) of a sync have to finish; a hook that hasn't finished by then is taken to have failed")
+
+		// canaries
+		canaryAnalyses = fs.String("canary-analyses", "", "Path to a file listing analyses, and the Prometheus API to query for them, that automated workloads can name with fluxcd.io/canary to have new images tried out on a canary before they are released")
+
+		// leader election
+		leaderElection              = fs.Bool("leader-election", false, "Elect a leader among replicas of fluxd, using a Lease; only the leader syncs, runs jobs and scans image registries, and the others forward API calls that need the leader to it")
+		leaderElectionNamespace     = fs.String("leader-election-namespace", "", "Namespace of the Lease used for leader election; defaults to the namespace fluxd is running in")
+		leaderElectionLeaseName     = fs.String("leader-election-lease-name", "flux-leader", "Name of the Lease used for leader election")
+		leaderElectionAddress       = fs.String("leader-election-advertise-address", "", "host:port at which other replicas can reach the API of this one; defaults to $POD_IP with the port from --listen")
+		leaderElectionLeaseDuration = fs.Duration("leader-election-lease-duration", leader.DefaultLeaseDuration, "How long after the leader last renewed the Lease another replica may take it over")
+		leaderElectionRenewDeadline = fs.Duration("leader-election-renew-deadline", leader.DefaultRenewDeadline, "How long the leader keeps trying to renew the Lease before it gives up the leadership")
+		leaderElectionRetryPeriod   = fs.Duration("leader-election-retry-period", leader.DefaultRetryPeriod, "How often replicas try to acquire or renew the Lease")
+
 		// registry
 		memcachedHostname = fs.String("memcached-hostname", "memcached", "Hostname for memcached service.")
 		memcachedPort     = fs.Int("memcached-port", 11211, "Memcached service port.")
@@ -167,6 +224,12 @@ func main() {
 		registryAWSAccountIDs      = fs.StringSlice("registry-ecr-include-id", nil, "Restrict ECR scanning to these AWS account IDs; if not supplied, all account IDs that aren't excluded may be scanned")
 		registryAWSBlockAccountIDs = fs.StringSlice("registry-ecr-exclude-id", []string{registry.EKS_SYSTEM_ACCOUNT, registry.EKS_SYSTEM_ACCOUNT_CN}, "Do not scan ECR for images in these AWS account IDs; the default is to exclude the EKS system accounts")
 
+		// credential providers
+		registryCredentialHelpers = fs.StringSlice("registry-credential-helper", nil, "Get credentials for a registry host by running a docker credential helper, given as <host>=<helper> to run docker-credential-<helper>; a <host> of '*' means any host")
+		registryVaultAddr         = fs.String("registry-vault-addr", "", "Address of a Vault server, or anything serving its HTTP API, to read registry credentials from")
+		registryVaultPath         = fs.String("registry-vault-path", "", "Path of the Vault secret holding registry credentials, e.g., secret/data/registry")
+		registryVaultTokenFile    = fs.String("registry-vault-token-file", "", "Path to a file holding the token to authenticate to Vault with; read each time the secret is")
+
 		registryRequire = fs.StringSlice("registry-require", nil, fmt.Sprintf("Exit with an error if auto-authentication with any of the given registries is not possible (possible values: {%s})", strings.Join(RequireValues, ",")))
 
 		// k8s-secret backed ssh keyring configuration
@@ -181,6 +244,9 @@ func main() {
 		k8sDefaultNamespace   = fs.String("k8s-default-namespace", "", "The namespace to use for resources where a namespace is not specified")
 		k8sExcludeResource    = fs.StringSlice("k8s-unsafe-exclude-resource", []string{"*metrics.k8s.io/*", "webhook.certmanager.k8s.io/*", "v1/Event"}, "Do not attempt to obtain cluster resources whose group/version/kind matches these glob expressions. Potentially unsafe, please read its documentation first")
 		k8sVerbosity          = fs.Int("k8s-verbosity", 0, "Klog verbosity level")
+		k8sWorkloadKinds      = fs.String("k8s-workload-kinds", "", "Path to a file listing other kinds of resource to treat as workloads, with the paths to their containers and rollout status")
+		k8sWatchResources     = fs.Bool("k8s-watch-resources", false, "Keep a view of the cluster's resources in memory, updated by watching them, rather than listing them from the API server each time they're needed")
+		k8sTenants            = fs.String("k8s-tenants", "", "Path to a file listing tenants, each with paths in the git repo, the namespaces their manifests may be for, and a service account to apply them as")
 
 		// SSH key generation
 		sshKeyBits   = optionalVar(fs, &ssh.KeyBitsValue{}, "ssh-keygen-bits", "-b argument to ssh-keygen (default unspecified)")
@@ -348,6 +414,23 @@ func main() {
 		}
 	}
 
+	var webhookSecret []byte
+	if *listenWebhookAddr != "" {
+		if *webhookSecretFile == "" {
+			logger.Log("err", "--listen-webhook requires --webhook-secret-file")
+			os.Exit(1)
+		}
+		secret, err := ioutil.ReadFile(*webhookSecretFile)
+		if err != nil {
+			logger.Log("err", err)
+			os.Exit(1)
+		}
+		if webhookSecret = bytes.TrimSpace(secret); len(webhookSecret) == 0 {
+			logger.Log("err", fmt.Sprintf("webhook secret file %s is empty", *webhookSecretFile))
+			os.Exit(1)
+		}
+	}
+
 	// Used to determine if we need to generate a SSH key and setup a keyring
 	var httpGitURL bool
 	if pURL, err := url.Parse(*gitURL); err == nil {
@@ -383,6 +466,114 @@ func main() {
 		logger.Log("warning", fmt.Sprintf("--git-secret is enabled but there is no GPG key(s) provided using --git-gpg-key-import, we assume you mounted the keyring directly and continue"))
 	}
 
+	switch *gitBackend {
+	case "exec":
+	case "go-git":
+		if *gitSecret {
+			logger.Log("err", "--git-secret is not supported with --git-backend=go-git")
+			os.Exit(1)
+		}
+	default:
+		logger.Log("err", fmt.Sprintf("--git-backend value %q is not one of exec, go-git", *gitBackend))
+		os.Exit(1)
+	}
+
+	if *gitDepth < 0 {
+		logger.Log("err", "--git-depth must not be negative")
+		os.Exit(1)
+	}
+	if *gitBackend == "go-git" && (*gitDepth > 0 || *gitSparseCheckout) {
+		logger.Log("err", "--git-depth and --git-sparse-checkout are not supported with --git-backend=go-git")
+		os.Exit(1)
+	}
+	if *gitSparseCheckout && *gitSecret {
+		logger.Log("err", "--git-sparse-checkout cannot be used with --git-secret, which needs the whole repo checked out")
+		os.Exit(1)
+	}
+
+	switch *gitSigningFormat {
+	case git.SigningFormatGPG, git.SigningFormatSSH:
+	case git.SigningFormatSigstore:
+		if *gitBackend == "go-git" {
+			logger.Log("err", "--git-signing-format=sigstore is not supported with --git-backend=go-git")
+			os.Exit(1)
+		}
+		if _, err := exec.LookPath("gitsign"); err != nil {
+			logger.Log("err", "--git-signing-format=sigstore needs gitsign to be installed", "detail", err)
+			os.Exit(1)
+		}
+	default:
+		logger.Log("err", fmt.Sprintf("--git-signing-format value %q is not one of %s, %s, %s", *gitSigningFormat, git.SigningFormatGPG, git.SigningFormatSSH, git.SigningFormatSigstore))
+		os.Exit(1)
+	}
+	if *gitBackend != "go-git" && (*gitSigningFormat == git.SigningFormatSSH || *gitSSHAllowedSigners != "") {
+		ctx, cancel := context.WithTimeout(context.Background(), *gitTimeout)
+		err := git.CheckSSHSigningSupport(ctx)
+		cancel()
+		if err != nil {
+			logger.Log("err", err)
+			os.Exit(1)
+		}
+	}
+
+	var gitCredentials git.Credentials
+	{
+		var sources []string
+		if *gitHTTPSTokenFile != "" {
+			sources = append(sources, "--git-https-token-file")
+		}
+		if *gitHTTPSCredentialsSecret != "" {
+			sources = append(sources, "--git-https-credentials-secret")
+		}
+		if *gitGitHubAppID != 0 {
+			sources = append(sources, "--git-github-app-id")
+		}
+		if len(sources) > 1 {
+			logger.Log("err", fmt.Sprintf("only one source of git credentials may be given, got %s", strings.Join(sources, ", ")))
+			os.Exit(1)
+		}
+		if len(sources) > 0 && !httpGitURL {
+			logger.Log("err", fmt.Sprintf("%s can only be used with an HTTP(S) --git-url", sources[0]))
+			os.Exit(1)
+		}
+
+		switch {
+		case *gitHTTPSTokenFile != "":
+			gitCredentials = git.NewTokenFile(*gitHTTPSUsername, *gitHTTPSTokenFile)
+		case *gitGitHubAppID != 0:
+			if *gitGitHubAppInstallationID == 0 || *gitGitHubAppPrivateKeyFile == "" {
+				logger.Log("err", "--git-github-app-id requires --git-github-app-installation-id and --git-github-app-private-key-file")
+				os.Exit(1)
+			}
+			privateKey, err := ioutil.ReadFile(*gitGitHubAppPrivateKeyFile)
+			if err != nil {
+				logger.Log("err", err)
+				os.Exit(1)
+			}
+			app, err := git.NewGitHubApp(*gitGitHubAppID, *gitGitHubAppInstallationID, privateKey, *gitGitHubAPIURL)
+			if err != nil {
+				logger.Log("err", err)
+				os.Exit(1)
+			}
+			gitCredentials = app
+		}
+	}
+
+	decryptEnabled := *sopsAgeKeysSecret != "" || *sopsLocalKMSKeys != ""
+	if decryptEnabled && *sopsEnabled {
+		logger.Log("err", "--sops decrypts manifests when they are loaded, so cannot be used with --sops-age-keys-secret or --sops-kms-local-keys")
+		os.Exit(1)
+	}
+	var sopsKMS decrypt.KMS
+	if *sopsLocalKMSKeys != "" {
+		localKMS, err := decrypt.ReadLocalKMS(*sopsLocalKMSKeys)
+		if err != nil {
+			logger.Log("err", err)
+			os.Exit(1)
+		}
+		sopsKMS = localKMS
+	}
+
 	if *sopsEnabled && len(*gitImportGPG) == 0 {
 		logger.Log("warning", fmt.Sprintf("--sops is enabled but there is no GPG key(s) provided using --git-gpg-key-import, we assume that the means of decryption has been provided in another way"))
 	}
@@ -429,7 +620,9 @@ func main() {
 	var sshKeyRing ssh.KeyRing
 	var k8s cluster.Cluster
 	var k8sManifests manifests.Manifests
+	var decrypter *decrypt.Decrypter
 	var imageCreds func() registry.ImageCreds
+	var leaderElector *leader.Elector
 	{
 		clientset, err := k8sclient.NewForConfig(restClientConfig)
 		if err != nil {
@@ -460,6 +653,20 @@ func main() {
 		}
 		discoClientset := kubernetes.MakeCachedDiscovery(clientset.Discovery(), crdClient, shutdown)
 
+		if *k8sWorkloadKinds != "" {
+			kinds, err := kresource.ReadWorkloadKinds(*k8sWorkloadKinds)
+			if err == nil {
+				err = kubernetes.RegisterWorkloadKinds(kinds)
+			}
+			if err != nil {
+				logger.Log("err", err)
+				os.Exit(1)
+			}
+			for _, k := range kinds {
+				logger.Log("workload-kind", k.Kind, "api-version", k.APIVersion)
+			}
+		}
+
 		serverVersion, err := clientset.ServerVersion()
 		if err != nil {
 			logger.Log("err", err)
@@ -500,6 +707,22 @@ func main() {
 			sshKeyRing = ssh.NewNopSSHKeyRing()
 		}
 
+		if *gitHTTPSCredentialsSecret != "" {
+			if !isInCluster {
+				logger.Log("err", "--git-https-credentials-secret can only be used when running in a cluster")
+				os.Exit(1)
+			}
+			namespace, err := ioutil.ReadFile(filepath.Join(k8sInClusterSecretsBaseDir, "serviceaccount/namespace"))
+			if err != nil {
+				logger.Log("err", err)
+				os.Exit(1)
+			}
+			gitCredentials = kubernetes.GitCredentialsSecret{
+				SecretAPI:  clientset.CoreV1().Secrets(string(namespace)),
+				SecretName: *gitHTTPSCredentialsSecret,
+			}
+		}
+
 		logger.Log("host", restClientConfig.Host, "version", clusterVersion)
 
 		kubectl := *kubernetesKubectl
@@ -525,6 +748,22 @@ func main() {
 		k8sInst := kubernetes.NewCluster(client, kubectlApplier, sshKeyRing, logger, allowedNamespaces, imageIncluder, *k8sExcludeResource)
 		k8sInst.GC = *syncGC
 		k8sInst.DryGC = *dryGC
+		k8sInst.GCMaxDeletions = *syncGCMaxDeletions
+		k8sInst.GCProtectedKinds = *syncGCProtectedKinds
+		if *k8sTenants != "" {
+			tenants, err := kubernetes.ReadTenants(*k8sTenants)
+			if err != nil {
+				logger.Log("err", err)
+				os.Exit(1)
+			}
+			for _, t := range tenants {
+				logger.Log("tenant", t.Name, "paths", strings.Join(t.Paths, ","), "namespaces", strings.Join(t.Namespaces, ","), "service-account", t.ServiceAccount)
+			}
+			k8sInst.Tenants = tenants
+		}
+		if *k8sWatchResources {
+			k8sInst.WatchResources(shutdown, shutdownWg)
+		}
 
 		if err := k8sInst.Ping(); err != nil {
 			logger.Log("ping", err)
@@ -546,6 +785,64 @@ func main() {
 		} else {
 			k8sManifests = kubernetes.NewManifests(namespacer, logger)
 		}
+
+		if decryptEnabled {
+			decrypter = &decrypt.Decrypter{KMS: sopsKMS, Parser: k8sManifests}
+			if *sopsAgeKeysSecret != "" {
+				if !isInCluster {
+					logger.Log("err", "--sops-age-keys-secret can only be used when running in a cluster")
+					os.Exit(1)
+				}
+				namespace, err := ioutil.ReadFile(filepath.Join(k8sInClusterSecretsBaseDir, "serviceaccount/namespace"))
+				if err != nil {
+					logger.Log("err", err)
+					os.Exit(1)
+				}
+				decrypter.AgeKeys = kubernetes.AgeKeysSecret{
+					SecretAPI:  clientset.CoreV1().Secrets(string(namespace)),
+					SecretName: *sopsAgeKeysSecret,
+				}
+			}
+		}
+
+		if *leaderElection {
+			namespace := *leaderElectionNamespace
+			if namespace == "" {
+				ns, err := ioutil.ReadFile(filepath.Join(k8sInClusterSecretsBaseDir, "serviceaccount/namespace"))
+				if err != nil {
+					logger.Log("err", "--leader-election-namespace must be given when not running in a cluster")
+					os.Exit(1)
+				}
+				namespace = string(ns)
+			}
+			address := *leaderElectionAddress
+			if address == "" {
+				_, port, err := net.SplitHostPort(*listenAddr)
+				if err != nil || os.Getenv("POD_IP") == "" {
+					logger.Log("err", "--leader-election-advertise-address must be given, or $POD_IP set, to use leader election")
+					os.Exit(1)
+				}
+				address = net.JoinHostPort(os.Getenv("POD_IP"), port)
+			}
+			id, err := os.Hostname()
+			if err != nil {
+				logger.Log("err", err)
+				os.Exit(1)
+			}
+			leaderElector, err = leader.NewElector(clientset, leader.Config{
+				Namespace:     namespace,
+				LeaseName:     *leaderElectionLeaseName,
+				ID:            id,
+				Address:       address,
+				LeaseDuration: *leaderElectionLeaseDuration,
+				RenewDeadline: *leaderElectionRenewDeadline,
+				RetryPeriod:   *leaderElectionRetryPeriod,
+			}, log.With(logger, "component", "leader-election"))
+			if err != nil {
+				logger.Log("err", err)
+				os.Exit(1)
+			}
+		}
 	}
 
 	// Wrap the procedure for collecting images to scan
@@ -565,6 +862,30 @@ func main() {
 		}
 		imageCreds = credsWithAWSAuth
 
+		var providers []registry.CredentialsProvider
+		if len(*registryCredentialHelpers) > 0 {
+			helpers, err := registry.ParseCredentialHelpers(*registryCredentialHelpers)
+			if err != nil {
+				logger.Log("err", err)
+				os.Exit(1)
+			}
+			providers = append(providers, helpers)
+		}
+		if *registryVaultAddr != "" {
+			if *registryVaultPath == "" {
+				logger.Log("err", "--registry-vault-path is required with --registry-vault-addr")
+				os.Exit(1)
+			}
+			providers = append(providers, registry.Vault{
+				Address:   *registryVaultAddr,
+				Path:      *registryVaultPath,
+				TokenFile: *registryVaultTokenFile,
+			})
+		}
+		if len(providers) > 0 {
+			imageCreds = registry.ImageCredsWithProviders(imageCreds, log.With(logger, "component", "credentials"), providers...)
+		}
+
 		if *dockerConfig != "" {
 			credsWithDefaults, err := registry.ImageCredsWithDefaults(imageCreds, *dockerConfig)
 			if err != nil {
@@ -645,6 +966,15 @@ func main() {
 	}
 	checkpoint.CheckForUpdates(product, "XXXXX", checkpointFlags, updateCheckLogger)
 
+	// Signing with SSH uses the deploy key, unless told otherwise
+	signingKey := *gitSigningKey
+	if *gitSigningFormat == git.SigningFormatSSH && signingKey == "" {
+		if _, signingKey = sshKeyRing.KeyPair(); signingKey == "" {
+			logger.Log("err", "--git-signing-format=ssh needs --git-signing-key, since there is no deploy key")
+			os.Exit(1)
+		}
+	}
+
 	gitRemote := git.Remote{URL: *gitURL}
 	gitConfig := git.Config{
 		Paths:       *gitPath,
@@ -652,12 +982,48 @@ func main() {
 		NotesRef:    *gitNotesRef,
 		UserName:    *gitUser,
 		UserEmail:   *gitEmail,
-		SigningKey:  *gitSigningKey,
+		SigningKey:  signingKey,
 		SetAuthor:   *gitSetAuthor,
 		SkipMessage: *gitSkipMessage,
+
+		SigningFormat: *gitSigningFormat,
 	}
 
-	repo := git.NewRepo(gitRemote, git.PollInterval(*gitPollInterval), git.Timeout(*gitTimeout), git.Branch(*gitBranch), git.IsReadOnly(*gitReadonly))
+	repoOptions := []git.Option{git.PollInterval(*gitPollInterval), git.Timeout(*gitTimeout), git.Branch(*gitBranch), git.IsReadOnly(*gitReadonly)}
+	if gitCredentials != nil {
+		if *gitBackend != "go-git" {
+			ctx, cancel := context.WithTimeout(context.Background(), *gitTimeout)
+			err := git.CheckCredentialsSupport(ctx)
+			cancel()
+			if err != nil {
+				logger.Log("err", err)
+				os.Exit(1)
+			}
+		}
+		repoOptions = append(repoOptions, git.WithCredentials(gitCredentials))
+	}
+	if *gitSSHAllowedSigners != "" {
+		repoOptions = append(repoOptions, git.WithAllowedSigners(*gitSSHAllowedSigners))
+	}
+	if *gitDepth > 0 {
+		repoOptions = append(repoOptions, git.WithDepth(*gitDepth))
+	}
+	if *gitSparseCheckout {
+		repoOptions = append(repoOptions, git.WithSparseCheckout(*gitPath))
+	}
+	if *gitBackend == "go-git" {
+		backend := git.NewGoGitBackend()
+		backend.SSHKeyPath = func() string {
+			_, privateKeyPath := sshKeyRing.KeyPair()
+			return privateKeyPath
+		}
+		if backend.KeyRing, err = git.ReadKeyRing(*gitImportGPG); err != nil {
+			logger.Log("err", err)
+			os.Exit(1)
+		}
+		repoOptions = append(repoOptions, git.WithBackend(backend))
+	}
+	repo := git.NewRepo(gitRemote, repoOptions...)
 	{
 		shutdownWg.Add(1)
 		go func() {
@@ -672,7 +1038,8 @@ func main() {
 		"url", gitRemote.SafeURL(),
 		"user", *gitUser,
 		"email", *gitEmail,
-		"signing-key", *gitSigningKey,
+		"signing-key", signingKey,
+		"signing-format", *gitSigningFormat,
 		"verify-signatures-mode", gitVerifySignaturesMode,
 		"sync-tag", *gitSyncTag,
 		"state", *syncState,
@@ -681,7 +1048,12 @@ func main() {
 		"notes-ref", *gitNotesRef,
 		"set-author", *gitSetAuthor,
 		"git-secret", *gitSecret,
+		"git-backend", *gitBackend,
+		"git-depth", *gitDepth,
+		"git-sparse-checkout", *gitSparseCheckout,
 		"sops", *sopsEnabled,
+		"sops-age-keys-secret", *sopsAgeKeysSecret,
+		"sops-kms-local-keys", *sopsLocalKMSKeys,
 	)
 
 	var jobs *job.Queue
@@ -711,7 +1083,7 @@ func main() {
 		syncProvider, err = fluxsync.NewGitTagSyncProvider(
 			repo,
 			*gitSyncTag,
-			*gitSigningKey,
+			signingKey,
 			gitVerifySignaturesMode,
 			gitConfig,
 		)
@@ -725,6 +1097,20 @@ func main() {
 		os.Exit(1)
 	}
 
+	var canaries *canary.Config
+	var canaryMetrics canary.Querier
+	if *canaryAnalyses != "" {
+		config, err := canary.ReadConfig(*canaryAnalyses)
+		if err != nil {
+			logger.Log("err", err)
+			os.Exit(1)
+		}
+		for _, a := range config.Analyses {
+			logger.Log("canary-analysis", a.Name, "interval", a.Interval, "iterations", a.Iterations, "metrics", len(a.Metrics))
+		}
+		canaries, canaryMetrics = &config, canary.NewPrometheus(config.Prometheus)
+	}
+
 	daemon := &daemon.Daemon{
 		V:                         version,
 		Cluster:                   k8s,
@@ -738,6 +1124,7 @@ func main() {
 		Logger:                    log.With(logger, "component", "daemon"),
 		ManifestGenerationEnabled: *manifestGeneration,
 		GitSecretEnabled:          *gitSecret,
+		Decrypter:                 decrypter,
 		LoopVars: &daemon.LoopVars{
 			SyncInterval:            *syncInterval,
 			SyncTimeout:             *syncTimeout,
@@ -746,9 +1133,22 @@ func main() {
 			GitTimeout:              *gitTimeout,
 			GitVerifySignaturesMode: gitVerifySignaturesMode,
 			ImageScanDisabled:       *registryDisableScanning,
+			DriftInterval:           *driftInterval,
+			DriftCorrection:         *driftCorrection,
+			ReadinessInterval:       *readinessInterval,
+			SyncHookTimeout:         *syncHookTimeout,
+			Canaries:                canaries,
+			CanaryMetrics:           canaryMetrics,
 		},
 	}
 
+	// When there's leader election, API calls that need the leader
+	// are forwarded to it.
+	var apiServer api.Server = daemon
+	if leaderElector != nil {
+		apiServer = leader.NewServer(daemon, leaderElector, *rpcTimeout)
+	}
+
 	{
 		// Connect to fluxsvc if given an upstream address
 		if *upstreamURL != "" {
@@ -760,7 +1160,7 @@ func main() {
 				client.Token(*token),
 				transport.NewUpstreamRouter(),
 				*upstreamURL,
-				remote.NewErrorLoggingServer(daemon, upstreamLogger),
+				remote.NewErrorLoggingServer(apiServer, upstreamLogger),
 				*rpcTimeout,
 				upstreamLogger,
 			)
@@ -778,15 +1178,33 @@ func main() {
 		}
 	}
 
-	shutdownWg.Add(1)
-	go daemon.Loop(shutdown, shutdownWg, log.With(logger, "component", "sync-loop"))
-
 	if !*registryDisableScanning {
 		cacheWarmer.Notify = daemon.AskForAutomatedWorkloadImageUpdates
 		cacheWarmer.Priority = daemon.ImageRefresh
 		cacheWarmer.Trace = *registryTrace
+	}
+
+	// These must only be running in one replica at a time.
+	lead := func(stop <-chan struct{}, wg *sync.WaitGroup) {
+		wg.Add(1)
+		go daemon.Loop(stop, wg, log.With(logger, "component", "sync-loop"))
+
+		if !*registryDisableScanning {
+			wg.Add(1)
+			go cacheWarmer.Loop(log.With(logger, "component", "warmer"), stop, wg, imageCreds)
+		}
+	}
+	if leaderElector != nil {
 		shutdownWg.Add(1)
-		go cacheWarmer.Loop(log.With(logger, "component", "warmer"), shutdown, shutdownWg, imageCreds)
+		go leaderElector.Run(shutdown, shutdownWg, lead, func() {
+			// Exit straight away, rather than waiting for a sync or
+			// job in flight, which would overlap with the new
+			// leader's; fluxd is restarted as a follower.
+			logger.Log("exiting", "lost the leadership")
+			os.Exit(1)
+		})
+	} else {
+		lead(shutdown, shutdownWg)
 	}
 
 	go func() {
@@ -795,7 +1213,10 @@ func main() {
 		if *listenMetricsAddr == "" {
 			mux.Handle("/metrics", promhttp.Handler())
 		}
-		handler := daemonhttp.NewHandler(daemon, daemonhttp.NewRouter())
+		handler := daemonhttp.NewHandler(apiServer, daemonhttp.NewRouter())
+		if leaderElector != nil {
+			handler = leader.Handler(handler)
+		}
 		mux.Handle("/api/flux/", http.StripPrefix("/api/flux", handler))
 		logger.Log("addr", *listenAddr)
 		errc <- http.ListenAndServe(*listenAddr, mux)
@@ -810,6 +1231,25 @@ func main() {
 		}()
 	}
 
+	if *listenWebhookAddr != "" {
+		go func() {
+			mux := http.NewServeMux()
+			// Notifications go through the API server, so that with
+			// leader election, a replica that isn't the leader
+			// forwards them to the one that is.
+			mux.Handle("/hook", &webhook.Receiver{
+				Notifier: apiServer,
+				Secret:   webhookSecret,
+				URL:      *gitURL,
+				Branch:   *gitBranch,
+				Paths:    *gitPath,
+				Logger:   log.With(logger, "component", "webhook"),
+			})
+			logger.Log("webhook-addr", *listenWebhookAddr)
+			errc <- http.ListenAndServe(*listenWebhookAddr, mux)
+		}()
+	}
+
 	// wait here until stopping.
 	logger.Log("exiting", <-errc)
 	close(shutdown)
@@ -0,0 +1,83 @@
+// This package defines the types for Flux API version 12.
+package v12
+
+import (
+	"context"
+	"time"
+
+	"github.com/fluxcd/flux/pkg/api/v11"
+	"github.com/fluxcd/flux/pkg/cluster"
+	"github.com/fluxcd/flux/pkg/job"
+	"github.com/fluxcd/flux/pkg/resource"
+	"github.com/fluxcd/flux/pkg/update"
+)
+
+type WorkloadHistoryOptions struct {
+	Workload resource.ID
+	// Before is a revision as returned in WorkloadHistory.Next; if
+	// given, only entries for commits older than it are returned.
+	Before string
+	// Limit is the maximum number of entries to return. Zero means
+	// the server's default.
+	Limit int
+}
+
+// WorkloadHistory is a page of entries, most recent first, for the
+// commits that changed a workload.
+type WorkloadHistory struct {
+	Workload resource.ID
+	Entries  []HistoryEntry
+	// Next is the value to give as WorkloadHistoryOptions.Before to
+	// get the next page. It is empty if there are no more entries.
+	Next string
+}
+
+// HistoryEntry describes a commit that changed a workload.
+type HistoryEntry struct {
+	Revision string
+	Author   string
+	Time     time.Time
+	Message  string
+	// UpdateType is the type of update (e.g., "image", "policy")
+	// when the commit was made by Flux, and empty otherwise.
+	UpdateType string
+	Cause      update.Cause
+	Images     []update.ContainerUpdate
+	Policies   resource.PolicyUpdate
+	// Synced says whether the revision has been applied to the
+	// cluster. SyncedAt is only known for revisions synced since the
+	// daemon last started.
+	Synced   bool
+	SyncedAt *time.Time
+}
+
+// DriftStatus is the outcome of the most recent check for resources
+// that have been changed in the cluster since they were synced.
+type DriftStatus struct {
+	// Enabled is false if the daemon is not checking for drift.
+	Enabled   bool
+	CheckedAt time.Time
+	Error     string
+	Resources []ResourceDrift
+}
+
+type ResourceDrift struct {
+	cluster.ResourceDrift
+	// Correct is true if the daemon syncs as soon as it notices the
+	// drift, rather than waiting for the next scheduled sync.
+	Correct bool
+}
+
+// RollbackOptions says which workload to roll back, and how far.
+type RollbackOptions struct {
+	update.RollbackSpec
+	Cause update.Cause
+}
+
+type Server interface {
+	v11.Server
+
+	WorkloadHistory(ctx context.Context, opts WorkloadHistoryOptions) (WorkloadHistory, error)
+	DriftStatus(ctx context.Context) (DriftStatus, error)
+	Rollback(ctx context.Context, opts RollbackOptions) (job.ID, error)
+}
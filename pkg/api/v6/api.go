@@ -37,6 +37,7 @@ type ControllerStatus struct {
 	ReadOnly   ReadOnlyReason
 	Status     string
 	Rollout    cluster.RolloutStatus
+	Readiness  cluster.Readiness
 	SyncError  string
 	Antecedent resource.ID
 	Labels     map[string]string
@@ -44,6 +45,9 @@ type ControllerStatus struct {
 	Locked     bool
 	Ignore     bool
 	Policies   map[string]string
+	// PolicySources says where each of the Policies came from, if
+	// not from the workload's own manifest; e.g., the namespace.
+	PolicySources map[string]string
 }
 
 // --- config types
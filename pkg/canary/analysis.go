@@ -0,0 +1,194 @@
+// Package canary has what's needed to try out new images on a canary
+// copy of a workload before releasing them: the analyses that say
+// which metrics to check, and for how long, and a client for the
+// metrics store they're queried from.
+package canary
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Analysis says how a canary is judged: each of the metrics is
+// queried every interval, and the canary passes once all of them
+// have been within their thresholds for the number of iterations
+// given. It fails as soon as any of them is outside its thresholds.
+type Analysis struct {
+	Name       string        `yaml:"name"`
+	Interval   time.Duration `yaml:"interval"`
+	Iterations int           `yaml:"iterations"`
+	// Replicas of the canary to run; one if not given.
+	Replicas int      `yaml:"replicas"`
+	Metrics  []Metric `yaml:"metrics"`
+}
+
+// Metric is a query giving a single value, and the thresholds for
+// that value. The query is a template, given a Target.
+type Metric struct {
+	Name  string   `yaml:"name"`
+	Query string   `yaml:"query"`
+	Min   *float64 `yaml:"min"`
+	Max   *float64 `yaml:"max"`
+
+	query *template.Template
+}
+
+// Target is what the metrics are queried about.
+type Target struct {
+	// Namespace of the workload and its canary
+	Namespace string
+	// Name of the canary
+	Name string
+	// Workload is the name of the workload the canary is a copy of
+	Workload string
+}
+
+// Querier evaluates a query to a single value.
+type Querier interface {
+	Query(ctx context.Context, query string) (float64, error)
+}
+
+// Config is the format of the file listing analyses, e.g.,
+//
+//	prometheus: http://prometheus.monitoring:9090
+//	analyses:
+//	- name: http
+//	  interval: 1m
+//	  iterations: 5
+//	  metrics:
+//	  - name: error-rate
+//	    query: |
+//	      sum(rate(http_requests_total{namespace="{{.Namespace}}",pod=~"{{.Name}}-.*",code=~"5.."}[1m]))
+//	      / sum(rate(http_requests_total{namespace="{{.Namespace}}",pod=~"{{.Name}}-.*"}[1m]))
+//	    max: 0.01
+type Config struct {
+	// Prometheus is the URL of the Prometheus (or compatible) HTTP
+	// API to query.
+	Prometheus string     `yaml:"prometheus"`
+	Analyses   []Analysis `yaml:"analyses"`
+}
+
+// ReadConfig reads the analyses in the file at the path given.
+func ReadConfig(path string) (Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Config{}, errors.Wrap(err, "reading canary analyses")
+	}
+	defer f.Close()
+	return ParseConfig(f)
+}
+
+// ParseConfig parses and checks the analyses given in the format of
+// Config.
+func ParseConfig(r io.Reader) (Config, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return Config{}, err
+	}
+	var config Config
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return Config{}, errors.Wrap(err, "parsing canary analyses")
+	}
+	if config.Prometheus == "" {
+		return Config{}, errors.New("a Prometheus URL must be given for canary analyses")
+	}
+
+	names := map[string]bool{}
+	for i := range config.Analyses {
+		a := &config.Analyses[i]
+		if a.Name == "" {
+			return Config{}, fmt.Errorf("canary analysis %d has no name", i+1)
+		}
+		if names[a.Name] {
+			return Config{}, fmt.Errorf("canary analysis %q is given more than once", a.Name)
+		}
+		names[a.Name] = true
+		if a.Interval <= 0 || a.Iterations <= 0 {
+			return Config{}, fmt.Errorf("canary analysis %q must have a positive interval and number of iterations", a.Name)
+		}
+		if a.Replicas < 0 {
+			return Config{}, fmt.Errorf("canary analysis %q has a negative number of replicas", a.Name)
+		}
+		if a.Replicas == 0 {
+			a.Replicas = 1
+		}
+		if len(a.Metrics) == 0 {
+			return Config{}, fmt.Errorf("canary analysis %q has no metrics", a.Name)
+		}
+		for j := range a.Metrics {
+			m := &a.Metrics[j]
+			if m.Name == "" {
+				return Config{}, fmt.Errorf("metric %d of canary analysis %q has no name", j+1, a.Name)
+			}
+			if m.Min == nil && m.Max == nil {
+				return Config{}, fmt.Errorf("metric %q of canary analysis %q must have a min or a max", m.Name, a.Name)
+			}
+			if m.query, err = template.New(m.Name).Option("missingkey=error").Parse(m.Query); err != nil {
+				return Config{}, errors.Wrapf(err, "parsing query of metric %q of canary analysis %q", m.Name, a.Name)
+			}
+		}
+	}
+	return config, nil
+}
+
+// Analysis returns the analysis with the name given, if there is one.
+func (c Config) Analysis(name string) (Analysis, bool) {
+	for _, a := range c.Analyses {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return Analysis{}, false
+}
+
+// Check queries each of the metrics for the target, and returns a
+// description of each that is outside its thresholds. An error means
+// the metrics couldn't all be queried, rather than that the check
+// failed.
+func (a Analysis) Check(ctx context.Context, q Querier, target Target) ([]string, error) {
+	var failures []string
+	for _, m := range a.Metrics {
+		query, err := m.render(target)
+		if err != nil {
+			return nil, err
+		}
+		value, err := q.Query(ctx, query)
+		if err != nil {
+			return nil, errors.Wrapf(err, "querying metric %q", m.Name)
+		}
+		switch {
+		case math.IsNaN(value):
+			failures = append(failures, fmt.Sprintf("%s has no value", m.Name))
+		case m.Min != nil && value < *m.Min:
+			failures = append(failures, fmt.Sprintf("%s is %g, below the minimum of %g", m.Name, value, *m.Min))
+		case m.Max != nil && value > *m.Max:
+			failures = append(failures, fmt.Sprintf("%s is %g, above the maximum of %g", m.Name, value, *m.Max))
+		}
+	}
+	return failures, nil
+}
+
+func (m Metric) render(target Target) (string, error) {
+	tmpl := m.query
+	if tmpl == nil {
+		var err error
+		if tmpl, err = template.New(m.Name).Option("missingkey=error").Parse(m.Query); err != nil {
+			return "", err
+		}
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, target); err != nil {
+		return "", errors.Wrapf(err, "rendering query of metric %q", m.Name)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,93 @@
+package canary
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfig = `prometheus: http://prometheus:9090
+analyses:
+- name: http
+  interval: 1m
+  iterations: 3
+  metrics:
+  - name: error-rate
+    query: errors{namespace="{{.Namespace}}",pod=~"{{.Name}}-.*"}
+    max: 0.01
+  - name: throughput
+    query: requests{namespace="{{.Namespace}}",deployment="{{.Workload}}"}
+    min: 10
+`
+
+// stubQuerier gives the value for each query, or an error for those
+// it doesn't know.
+type stubQuerier map[string]float64
+
+func (s stubQuerier) Query(_ context.Context, query string) (float64, error) {
+	if v, ok := s[query]; ok {
+		return v, nil
+	}
+	return 0, errors.New("no such query")
+}
+
+func TestParseConfig(t *testing.T) {
+	config, err := ParseConfig(strings.NewReader(testConfig))
+	require.NoError(t, err)
+	assert.Equal(t, "http://prometheus:9090", config.Prometheus)
+	a, ok := config.Analysis("http")
+	require.True(t, ok)
+	assert.Equal(t, time.Minute, a.Interval)
+	assert.Equal(t, 3, a.Iterations)
+	assert.Equal(t, 1, a.Replicas)
+	assert.Len(t, a.Metrics, 2)
+	_, ok = config.Analysis("grpc")
+	assert.False(t, ok)
+
+	for name, invalid := range map[string]string{
+		"no prometheus":  "analyses: []\n",
+		"unknown field":  "prometheus: http://p\nfoo: bar\n",
+		"no name":        "prometheus: http://p\nanalyses:\n- interval: 1m\n  iterations: 1\n",
+		"no interval":    "prometheus: http://p\nanalyses:\n- name: a\n  iterations: 1\n",
+		"no metrics":     "prometheus: http://p\nanalyses:\n- name: a\n  interval: 1m\n  iterations: 1\n",
+		"no thresholds":  "prometheus: http://p\nanalyses:\n- name: a\n  interval: 1m\n  iterations: 1\n  metrics:\n  - name: m\n    query: up\n",
+		"bad template":   "prometheus: http://p\nanalyses:\n- name: a\n  interval: 1m\n  iterations: 1\n  metrics:\n  - name: m\n    query: up{{\n    max: 1\n",
+		"duplicate name": "prometheus: http://p\nanalyses:\n- name: a\n  interval: 1m\n  iterations: 1\n  metrics: [{name: m, query: up, max: 1}]\n- name: a\n  interval: 1m\n  iterations: 1\n  metrics: [{name: m, query: up, max: 1}]\n",
+	} {
+		_, err := ParseConfig(strings.NewReader(invalid))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	config, err := ParseConfig(strings.NewReader(testConfig))
+	require.NoError(t, err)
+	a, _ := config.Analysis("http")
+	target := Target{Namespace: "default", Name: "app-canary", Workload: "app"}
+	errorsQuery := `errors{namespace="default",pod=~"app-canary-.*"}`
+	requestsQuery := `requests{namespace="default",deployment="app"}`
+
+	failures, err := a.Check(context.Background(), stubQuerier{errorsQuery: 0.001, requestsQuery: 20}, target)
+	assert.NoError(t, err)
+	assert.Empty(t, failures)
+
+	failures, err = a.Check(context.Background(), stubQuerier{errorsQuery: 0.5, requestsQuery: 5}, target)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"error-rate is 0.5, above the maximum of 0.01",
+		"throughput is 5, below the minimum of 10",
+	}, failures)
+
+	failures, err = a.Check(context.Background(), stubQuerier{errorsQuery: math.NaN(), requestsQuery: 20}, target)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"error-rate has no value"}, failures)
+
+	_, err = a.Check(context.Background(), stubQuerier{errorsQuery: 0}, target)
+	assert.Error(t, err)
+}
@@ -0,0 +1,88 @@
+package canary
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Prometheus queries the HTTP API of Prometheus, or anything that
+// serves the same API.
+type Prometheus struct {
+	URL    string
+	Client *http.Client
+}
+
+var _ Querier = &Prometheus{}
+
+// NewPrometheus returns a Querier for the Prometheus HTTP API at the
+// URL given.
+func NewPrometheus(baseURL string) *Prometheus {
+	return &Prometheus{URL: strings.TrimSuffix(baseURL, "/"), Client: http.DefaultClient}
+}
+
+type promResponse struct {
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType"`
+	Error     string `json:"error"`
+	Data      struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+// Query evaluates an instant query, which must give a scalar or a
+// vector with a single sample.
+func (p *Prometheus) Query(ctx context.Context, query string) (float64, error) {
+	req, err := http.NewRequest("GET", p.URL+"/api/v1/query?"+url.Values{"query": {query}}.Encode(), nil)
+	if err != nil {
+		return 0, err
+	}
+	res, err := p.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	var body promResponse
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return 0, fmt.Errorf("decoding response (%s): %s", res.Status, err)
+	}
+	if body.Status != "success" {
+		return 0, fmt.Errorf("query failed: %s: %s", body.ErrorType, body.Error)
+	}
+
+	var sample []interface{}
+	switch body.Data.ResultType {
+	case "scalar":
+		if err := json.Unmarshal(body.Data.Result, &sample); err != nil {
+			return 0, err
+		}
+	case "vector":
+		var vector []struct {
+			Value []interface{} `json:"value"`
+		}
+		if err := json.Unmarshal(body.Data.Result, &vector); err != nil {
+			return 0, err
+		}
+		if len(vector) != 1 {
+			return 0, fmt.Errorf("query gave %d series, rather than one", len(vector))
+		}
+		sample = vector[0].Value
+	default:
+		return 0, fmt.Errorf("query gave a %s, rather than a scalar or vector", body.Data.ResultType)
+	}
+	// A sample is [<timestamp>, "<value>"]
+	if len(sample) != 2 {
+		return 0, fmt.Errorf("unexpected sample %v", sample)
+	}
+	value, ok := sample[1].(string)
+	if !ok {
+		return 0, fmt.Errorf("unexpected sample value %v", sample[1])
+	}
+	return strconv.ParseFloat(value, 64)
+}
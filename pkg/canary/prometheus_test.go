@@ -0,0 +1,39 @@
+package canary
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrometheusQuery(t *testing.T) {
+	responses := map[string]string{
+		"scalar":  `{"status":"success","data":{"resultType":"scalar","result":[1600000000,"0.25"]}}`,
+		"vector":  `{"status":"success","data":{"resultType":"vector","result":[{"metric":{"pod":"a"},"value":[1600000000,"42"]}]}}`,
+		"empty":   `{"status":"success","data":{"resultType":"vector","result":[]}}`,
+		"matrix":  `{"status":"success","data":{"resultType":"matrix","result":[]}}`,
+		"invalid": `{"status":"error","errorType":"bad_data","error":"parse error"}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/query", r.URL.Path)
+		w.Write([]byte(responses[r.URL.Query().Get("query")]))
+	}))
+	defer server.Close()
+	prom := NewPrometheus(server.URL + "/")
+
+	value, err := prom.Query(context.Background(), "scalar")
+	assert.NoError(t, err)
+	assert.Equal(t, 0.25, value)
+
+	value, err = prom.Query(context.Background(), "vector")
+	assert.NoError(t, err)
+	assert.Equal(t, 42.0, value)
+
+	for _, q := range []string{"empty", "matrix", "invalid"} {
+		_, err := prom.Query(context.Background(), q)
+		assert.Error(t, err, q)
+	}
+}
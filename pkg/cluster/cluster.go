@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 
+	"github.com/fluxcd/flux/pkg/image"
 	"github.com/fluxcd/flux/pkg/policy"
 	"github.com/fluxcd/flux/pkg/resource"
 	"github.com/fluxcd/flux/pkg/ssh"
@@ -31,6 +32,22 @@ type Cluster interface {
 	Ping() error
 	Export(ctx context.Context) ([]byte, error)
 	Sync(SyncSet) error
+	// Drift compares the cluster with the resources given in the
+	// last Sync, and reports those that no longer match.
+	Drift(ctx context.Context) ([]ResourceDrift, error)
+	// Readiness reports whether each of the resources given in the
+	// last Sync has been reconciled.
+	Readiness(ctx context.Context) ([]ResourceReadiness, error)
+	// RunHook runs a sync hook (e.g., a Job) and waits for it to
+	// finish, returning an error if it failed. A hook that has
+	// already succeeded with the same key is not run again; the
+	// result says whether it was run.
+	RunHook(ctx context.Context, hook resource.Resource, key string) (bool, error)
+	// Canary runs a copy of the workload given, with the images
+	// given for its containers, so they can be tried out alongside
+	// it. Giving zero replicas removes the canary. The result is the
+	// ID of the canary.
+	Canary(ctx context.Context, workload resource.Resource, images map[string]image.Ref, replicas int) (resource.ID, error)
 	PublicSSHKey(regenerate bool) (ssh.PublicKey, error)
 }
 
@@ -73,6 +90,9 @@ type Workload struct {
 	Labels     map[string]string
 	Policies   policy.Set
 	Rollout    RolloutStatus
+	// Readiness is worked out from the status of the workload's
+	// resource in the same way for every kind, unlike Status.
+	Readiness Readiness
 	// Errors during the recurring sync from the Git repository to the
 	// cluster will surface here.
 	SyncError error
@@ -0,0 +1,31 @@
+package cluster
+
+import (
+	"github.com/fluxcd/flux/pkg/policy"
+	"github.com/fluxcd/flux/pkg/resource"
+)
+
+// Reasons for a resource to be considered as having drifted from
+// what was last synced.
+const (
+	// DriftMissing means the resource has been removed from the
+	// cluster.
+	DriftMissing = "missing"
+	// DriftModified means the resource has been changed in the
+	// cluster, so that it no longer matches its manifest.
+	DriftModified = "modified"
+)
+
+// ResourceDrift describes how a resource in the cluster differs from
+// what was applied from git in the last sync.
+type ResourceDrift struct {
+	ResourceID resource.ID
+	Source     string
+	Reason     string
+	// Fields gives the paths (e.g., `spec.replicas`) of the fields
+	// that differ, when the resource has been modified.
+	Fields []string
+	// Policies are those given in the manifest, so that whoever
+	// is told about the drift can decide what to do about it.
+	Policies policy.Set
+}
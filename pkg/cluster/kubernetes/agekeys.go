@@ -0,0 +1,44 @@
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+
+	"filippo.io/age"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	v1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// AgeKeysSecret supplies age identities, for decrypting SOPS-encrypted
+// manifests, from the entries of a secret; each entry holds one or
+// more identities as written by age-keygen. The secret is read each
+// time the identities are needed, so keys can be added or rotated
+// without restarting.
+type AgeKeysSecret struct {
+	SecretAPI  v1.SecretInterface
+	SecretName string
+}
+
+func (s AgeKeysSecret) Identities(ctx context.Context) ([]age.Identity, error) {
+	secret, err := s.SecretAPI.Get(ctx, s.SecretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "reading age keys secret")
+	}
+	var names []string
+	for name := range secret.Data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var identities []age.Identity
+	for _, name := range names {
+		ids, err := age.ParseIdentities(bytes.NewReader(secret.Data[name]))
+		if err != nil {
+			return nil, fmt.Errorf("parsing age keys in entry %q of secret %s: %s", name, s.SecretName, err)
+		}
+		identities = append(identities, ids...)
+	}
+	return identities, nil
+}
@@ -0,0 +1,43 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestAgeKeysSecret(t *testing.T) {
+	id1, err := age.GenerateX25519Identity()
+	assert.NoError(t, err)
+	id2, err := age.GenerateX25519Identity()
+	assert.NoError(t, err)
+	client := fake.NewSimpleClientset(&apiv1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "sops-age", Namespace: "flux"},
+		Data: map[string][]byte{
+			"a.agekey": []byte("# created: today\n" + id1.String() + "\n"),
+			"b.agekey": []byte(id2.String()),
+		},
+	}, &apiv1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "bogus", Namespace: "flux"},
+		Data:       map[string][]byte{"key": []byte("not a key")},
+	})
+	secrets := client.CoreV1().Secrets("flux")
+	ctx := context.Background()
+
+	ids, err := AgeKeysSecret{SecretAPI: secrets, SecretName: "sops-age"}.Identities(ctx)
+	assert.NoError(t, err)
+	if assert.Len(t, ids, 2) {
+		assert.Equal(t, id1.String(), ids[0].(*age.X25519Identity).String())
+		assert.Equal(t, id2.String(), ids[1].(*age.X25519Identity).String())
+	}
+
+	_, err = AgeKeysSecret{SecretAPI: secrets, SecretName: "bogus"}.Identities(ctx)
+	assert.Error(t, err)
+	_, err = AgeKeysSecret{SecretAPI: secrets, SecretName: "missing"}.Identities(ctx)
+	assert.Error(t, err)
+}
@@ -0,0 +1,648 @@
+package kubernetes
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/watch"
+	toolscache "k8s.io/client-go/tools/cache"
+
+	fluxmetrics "github.com/fluxcd/flux/pkg/metrics"
+)
+
+const (
+	// cacheRefreshInterval is how often the informers are checked
+	// against the API resources and namespaces, besides whenever
+	// discovery is invalidated; namespaces coming and going doesn't
+	// invalidate discovery.
+	cacheRefreshInterval = time.Minute
+	// cacheMetricsInterval is how often the staleness of the cache
+	// is reported.
+	cacheMetricsInterval = 15 * time.Second
+)
+
+// unwatchedResources are never synced, and change all the time, so
+// there's no point in watching them. Componentstatuses and endpoints
+// are left out of the resources for syncing anyway (see
+// getAllowedResourcesBySelector); events may be synced, in principle,
+// but there would be nothing to gain from watching every event in the
+// cluster for the odd one that is.
+var unwatchedResources = map[schema.GroupResource]bool{
+	{Resource: "componentstatuses"}:              true,
+	{Resource: "endpoints"}:                      true,
+	{Resource: "events"}:                         true,
+	{Group: "events.k8s.io", Resource: "events"}: true,
+}
+
+// resourceCache keeps an in-memory view of the resources in the
+// allowed namespaces. This means the workloads and the resources to
+// sync can be had without a LIST call per kind, per namespace, each
+// time.
+//
+// Only the workloads (and namespaces) are watched in full. Everything
+// else is watched through the GC mark label selector, which is all
+// garbage collection, drift detection and readiness need, so that
+// secrets and configmaps and the like that flux doesn't sync aren't
+// all kept in memory.
+//
+// Each kind of resource has one informer for the whole cluster, with
+// the namespaces that aren't allowed filtered out here; only where
+// that's forbidden -- because flux has been given roles in the
+// allowed namespaces and not a cluster role -- is there an informer
+// per allowed namespace instead.
+//
+// Where the view of a kind of resource isn't up to date -- because
+// its informer hasn't loaded yet, or can't watch it -- or doesn't
+// cover what's asked for, the API server is asked instead.
+type resourceCache struct {
+	cluster *Cluster
+	logger  log.Logger
+	// refreshSoon asks for the informers to be refreshed as soon as
+	// may be
+	refreshSoon chan<- struct{}
+
+	mu        sync.RWMutex
+	informers map[informerKey]*resourceInformer
+	// the version of each resource watched, by group and resource,
+	// and by group and kind
+	resources map[schema.GroupResource]cachedResource
+	kinds     map[schema.GroupKind]cachedResource
+	// every kind the API server serves, watched or not
+	served map[schema.GroupKind]bool
+	// the resources that can't be watched across the cluster, and so
+	// are watched in each allowed namespace. These are remembered
+	// for as long as flux runs, since roles rarely change.
+	perNamespace map[schema.GroupResource]bool
+	// the resources for which staleness has been reported
+	reported map[string]bool
+}
+
+type cachedResource struct {
+	gvr        schema.GroupVersionResource
+	namespaced bool
+	// full is true if all the objects are watched, and false if only
+	// those with the GC mark are
+	full bool
+}
+
+type informerKey struct {
+	gvr       schema.GroupVersionResource
+	namespace string
+}
+
+// resourceInformer is an informer along with what's needed to stop
+// it, and to tell whether it's up to date.
+type resourceInformer struct {
+	informer toolscache.SharedIndexInformer
+	stop     chan struct{}
+	started  time.Time
+
+	mu sync.Mutex
+	// when watching last failed, and the resource version at the
+	// time; once the version has moved on, the informer has
+	// recovered.
+	failedAt      time.Time
+	failedVersion string
+}
+
+// WatchResources starts keeping an in-memory view of the resources in
+// the cluster, which is used in place of listing them from the API
+// server wherever it's up to date. The kinds of resource and the
+// namespaces watched follow those in the cluster, until shutdown is
+// closed. This must be called before the cluster is used.
+func (c *Cluster) WatchResources(shutdown <-chan struct{}, wg *sync.WaitGroup) {
+	// the discovery client is invalidated when CRDs change, which is
+	// when the kinds to watch may have changed
+	refresh := make(chan struct{}, 1)
+	rc := &resourceCache{
+		cluster:      c,
+		logger:       log.With(c.logger, "component", "cluster-cache"),
+		refreshSoon:  refresh,
+		informers:    map[informerKey]*resourceInformer{},
+		perNamespace: map[schema.GroupResource]bool{},
+		reported:     map[string]bool{},
+	}
+	if notifier, ok := c.client.discoveryClient.(interface{ Subscribe(chan<- struct{}) }); ok {
+		notifier.Subscribe(refresh)
+	}
+	rc.refresh()
+	c.cache = rc
+
+	wg.Add(1)
+	go rc.loop(shutdown, wg, refresh)
+}
+
+func (rc *resourceCache) loop(shutdown <-chan struct{}, wg *sync.WaitGroup, refresh <-chan struct{}) {
+	defer wg.Done()
+	refreshTicker := time.NewTicker(cacheRefreshInterval)
+	defer refreshTicker.Stop()
+	metricsTicker := time.NewTicker(cacheMetricsInterval)
+	defer metricsTicker.Stop()
+	for {
+		select {
+		case <-shutdown:
+			rc.mu.Lock()
+			for key, i := range rc.informers {
+				close(i.stop)
+				delete(rc.informers, key)
+			}
+			rc.mu.Unlock()
+			return
+		case <-refresh:
+			rc.refresh()
+		case <-refreshTicker.C:
+			rc.refresh()
+		case <-metricsTicker.C:
+			rc.reportStaleness()
+		}
+	}
+}
+
+// fullyWatched gives the kinds watched in full: the workloads,
+// including any kinds registered as workloads, and the namespaces.
+func fullyWatched() map[schema.GroupKind]bool {
+	kinds := map[schema.GroupKind]bool{{Kind: "Namespace"}: true}
+	for _, kind := range resourceKinds {
+		if ck, ok := kind.(cachedKind); ok {
+			for _, gk := range ck.groupKinds() {
+				kinds[gk] = true
+			}
+		}
+	}
+	return kinds
+}
+
+// refresh starts informers for the resources (and namespaces, where
+// they're watched per namespace) there are now, and stops those for
+// the resources and namespaces there aren't any more.
+func (rc *resourceCache) refresh() {
+	c := rc.cluster
+	sgs, err := c.client.discoveryClient.ServerGroups()
+	if sgs == nil {
+		rc.logger.Log("err", err)
+		return
+	}
+
+	full := fullyWatched()
+	served := map[schema.GroupKind]bool{}
+	resources := map[schema.GroupResource]cachedResource{}
+	kinds := map[schema.GroupKind]cachedResource{}
+	for _, group := range sgs.Groups {
+		// watch each resource in the preferred version, or failing
+		// that, the first version that has it
+		versions := []string{group.PreferredVersion.GroupVersion}
+		for _, v := range group.Versions {
+			if v.GroupVersion != group.PreferredVersion.GroupVersion {
+				versions = append(versions, v.GroupVersion)
+			}
+		}
+		for _, gv := range versions {
+			groupVersion, err := schema.ParseGroupVersion(gv)
+			if err != nil {
+				continue
+			}
+			list, err := c.client.discoveryClient.ServerResourcesForGroupVersion(gv)
+			if err != nil || list == nil {
+				// anything not watched is listed from the API
+				// server, which will report any error
+				continue
+			}
+			for _, r := range list.APIResources {
+				if !strings.Contains(r.Name, "/") {
+					served[groupVersion.WithKind(r.Kind).GroupKind()] = true
+				}
+			}
+			if c.excludedGroupVersion(gv) {
+				continue
+			}
+			for _, r := range c.filterResources(list).APIResources {
+				gr := groupVersion.WithResource(r.Name).GroupResource()
+				if _, ok := resources[gr]; ok || unwatchedResources[gr] || strings.Contains(r.Name, "/") ||
+					!hasVerb(r.Verbs, "list") || !hasVerb(r.Verbs, "watch") {
+					continue
+				}
+				gk := groupVersion.WithKind(r.Kind).GroupKind()
+				cr := cachedResource{gvr: groupVersion.WithResource(r.Name), namespaced: r.Namespaced, full: full[gk]}
+				resources[gr] = cr
+				kinds[gk] = cr
+			}
+		}
+	}
+
+	namespaces, err := c.getAllowedAndExistingNamespaces(context.Background())
+	if err != nil {
+		rc.logger.Log("err", err)
+		return
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	wanted := map[informerKey]cachedResource{}
+	for gr, cr := range resources {
+		if !cr.namespaced || !rc.perNamespace[gr] {
+			wanted[informerKey{gvr: cr.gvr}] = cr
+			continue
+		}
+		for _, ns := range namespaces {
+			wanted[informerKey{gvr: cr.gvr, namespace: ns}] = cr
+		}
+	}
+	for key, i := range rc.informers {
+		if _, ok := wanted[key]; !ok {
+			close(i.stop)
+			delete(rc.informers, key)
+		}
+	}
+	for key, cr := range wanted {
+		if _, ok := rc.informers[key]; !ok {
+			rc.informers[key] = rc.startInformer(key, cr)
+		}
+	}
+	rc.resources, rc.kinds, rc.served = resources, kinds, served
+	cacheInformers.Set(float64(len(rc.informers)))
+}
+
+func (rc *resourceCache) startInformer(key informerKey, cr cachedResource) *resourceInformer {
+	client := rc.cluster.client.dynamicClient.Resource(key.gvr).Namespace(key.namespace)
+	tweak := func(options *meta_v1.ListOptions) {
+		if !cr.full {
+			options.LabelSelector = gcMarkLabel
+		}
+	}
+	// the reflector doesn't pass on what kind of error listing gave,
+	// so being forbidden is looked for here
+	forbidden := func(err error) {
+		if cr.namespaced && key.namespace == meta_v1.NamespaceAll && apierrors.IsForbidden(err) {
+			rc.watchPerNamespace(key.gvr.GroupResource())
+		}
+	}
+	informer := toolscache.NewSharedIndexInformer(&toolscache.ListWatch{
+		ListFunc: func(options meta_v1.ListOptions) (runtime.Object, error) {
+			tweak(&options)
+			list, err := client.List(context.TODO(), options)
+			forbidden(err)
+			return list, err
+		},
+		WatchFunc: func(options meta_v1.ListOptions) (watch.Interface, error) {
+			tweak(&options)
+			w, err := client.Watch(context.TODO(), options)
+			forbidden(err)
+			return w, err
+		},
+	}, &unstructured.Unstructured{}, 0, toolscache.Indexers{toolscache.NamespaceIndex: toolscache.MetaNamespaceIndexFunc})
+	i := &resourceInformer{
+		informer: informer,
+		stop:     make(chan struct{}),
+		started:  time.Now(),
+	}
+	informer.SetWatchErrorHandler(func(r *toolscache.Reflector, err error) {
+		i.watchFailed(time.Now())
+		toolscache.DefaultWatchErrorHandler(r, err)
+	})
+	go informer.Run(i.stop)
+	return i
+}
+
+// watchPerNamespace switches the resource given to being watched in
+// each allowed namespace, if the namespaces are restricted; otherwise
+// there's nothing else to try.
+func (rc *resourceCache) watchPerNamespace(gr schema.GroupResource) {
+	if len(rc.cluster.allowedNamespaces) == 0 {
+		return
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.perNamespace[gr] {
+		return
+	}
+	rc.logger.Log("info", "cannot watch resource across the cluster; watching it in each allowed namespace", "resource", gr.String())
+	rc.perNamespace[gr] = true
+	select {
+	case rc.refreshSoon <- struct{}{}:
+	default:
+	}
+}
+
+// allowed says whether the objects in the namespace given are to be
+// seen.
+func (rc *resourceCache) allowed(namespace string) bool {
+	if len(rc.cluster.allowedNamespaces) == 0 || namespace == meta_v1.NamespaceAll {
+		return true
+	}
+	_, ok := rc.cluster.allowedNamespaces[namespace]
+	return ok
+}
+
+// requiresMark says whether the selector only matches objects with
+// the GC mark, which is all that's watched of most resources.
+func requiresMark(selector labels.Selector) bool {
+	reqs, _ := selector.Requirements()
+	for _, r := range reqs {
+		if r.Key() != gcMarkLabel {
+			continue
+		}
+		switch r.Operator() {
+		case selection.Exists, selection.Equals, selection.DoubleEquals, selection.In:
+			return true
+		}
+	}
+	return false
+}
+
+func (i *resourceInformer) watchFailed(now time.Time) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	version := i.informer.LastSyncResourceVersion()
+	if i.failedAt.IsZero() || version != i.failedVersion {
+		i.failedAt, i.failedVersion = now, version
+	}
+}
+
+// staleness says how long the informer has been out of date: since
+// it was started, if it hasn't loaded yet, or since watching failed,
+// if it hasn't recovered. It's zero if the informer is up to date.
+func (i *resourceInformer) staleness(now time.Time) time.Duration {
+	if !i.informer.HasSynced() {
+		return now.Sub(i.started)
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.failedAt.IsZero() {
+		return 0
+	}
+	if i.informer.LastSyncResourceVersion() != i.failedVersion {
+		i.failedAt = time.Time{}
+		return 0
+	}
+	return now.Sub(i.failedAt)
+}
+
+func (i *resourceInformer) upToDate(now time.Time) bool {
+	return i != nil && i.staleness(now) == 0
+}
+
+func (rc *resourceCache) reportStaleness() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	now := time.Now()
+	staleness := map[string]time.Duration{}
+	for key, i := range rc.informers {
+		name := key.gvr.String()
+		if s, max := i.staleness(now), staleness[name]; s >= max {
+			staleness[name] = s
+		}
+	}
+	for name := range rc.reported {
+		if _, ok := staleness[name]; !ok {
+			cacheStaleness.With(fluxmetrics.LabelResource, name).Set(0)
+			delete(rc.reported, name)
+		}
+	}
+	for name, s := range staleness {
+		cacheStaleness.With(fluxmetrics.LabelResource, name).Set(s.Seconds())
+		rc.reported[name] = true
+	}
+}
+
+// list gives copies of the objects of the resource given matching
+// the selector, in the namespace given or in all the namespaces
+// watched if that's empty. It returns false if the cache can't be
+// relied upon for these, in which case they should be listed from the
+// API server. Since each resource is watched in only one version,
+// nothing is returned for the other versions.
+//
+// Most resources are only watched through the GC mark label selector,
+// so unless the selector given requires the mark, only the workloads
+// can be listed from the cache.
+func (rc *resourceCache) list(gvr schema.GroupVersionResource, namespace string, selector labels.Selector) ([]unstructured.Unstructured, bool) {
+	if rc == nil {
+		return nil, false
+	}
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+	cr, ok := rc.resources[gvr.GroupResource()]
+	if !ok {
+		return nil, false
+	}
+	if cr.gvr != gvr {
+		return nil, true
+	}
+	return rc.listLocked(cr, namespace, selector)
+}
+
+func (rc *resourceCache) listLocked(cr cachedResource, namespace string, selector labels.Selector) ([]unstructured.Unstructured, bool) {
+	if !cr.full && !requiresMark(selector) {
+		return nil, false
+	}
+	now := time.Now()
+	var informers []*resourceInformer
+	switch {
+	case !cr.namespaced:
+		namespace = meta_v1.NamespaceAll
+		informers = append(informers, rc.informers[informerKey{gvr: cr.gvr}])
+	case namespace == meta_v1.NamespaceAll:
+		// all of them, whether that's one for the whole cluster or
+		// one for each allowed namespace
+		for key, i := range rc.informers {
+			if key.gvr == cr.gvr {
+				informers = append(informers, i)
+			}
+		}
+		if len(informers) == 0 {
+			return nil, false
+		}
+	case !rc.allowed(namespace):
+		return nil, false
+	default:
+		i, ok := rc.informers[informerKey{gvr: cr.gvr, namespace: namespace}]
+		if !ok {
+			i = rc.informers[informerKey{gvr: cr.gvr}]
+		}
+		informers = append(informers, i)
+	}
+
+	var result []unstructured.Unstructured
+	for _, i := range informers {
+		if !i.upToDate(now) {
+			return nil, false
+		}
+		var items []interface{}
+		if namespace != meta_v1.NamespaceAll {
+			items, _ = i.informer.GetIndexer().ByIndex(toolscache.NamespaceIndex, namespace)
+		} else {
+			items = i.informer.GetIndexer().List()
+		}
+		for _, item := range items {
+			obj, ok := item.(*unstructured.Unstructured)
+			if ok && (!cr.namespaced || rc.allowed(obj.GetNamespace())) && selector.Matches(labels.Set(obj.GetLabels())) {
+				result = append(result, *obj.DeepCopy())
+			}
+		}
+	}
+	return result, true
+}
+
+// listKind gives copies of the objects of the kind given in the
+// namespace given, or in all namespaces watched if that's empty. If
+// the API server doesn't serve the kind at all, there are none.
+func (rc *resourceCache) listKind(gk schema.GroupKind, namespace string) ([]unstructured.Unstructured, bool) {
+	if rc == nil {
+		return nil, false
+	}
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+	cr, ok := rc.kinds[gk]
+	if !ok {
+		return nil, !rc.served[gk]
+	}
+	if !cr.namespaced && namespace != meta_v1.NamespaceAll {
+		// a namespace was asked for, and these aren't in one
+		return nil, true
+	}
+	return rc.listLocked(cr, namespace, labels.Everything())
+}
+
+// get gives a copy of the object of the kind given, and whether it was
+// found; or false if the cache can't be relied upon for it.
+func (rc *resourceCache) get(gk schema.GroupKind, namespace, name string) (*unstructured.Unstructured, bool, bool) {
+	if rc == nil {
+		return nil, false, false
+	}
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+	cr, ok := rc.kinds[gk]
+	if !ok {
+		return nil, false, !rc.served[gk]
+	}
+	if !cr.full || (cr.namespaced && !rc.allowed(namespace)) {
+		return nil, false, false
+	}
+	i := rc.informers[informerKey{gvr: cr.gvr}]
+	key := name
+	if cr.namespaced {
+		key = namespace + "/" + name
+		if nsi, ok := rc.informers[informerKey{gvr: cr.gvr, namespace: namespace}]; ok {
+			i = nsi
+		}
+	}
+	if !i.upToDate(time.Now()) {
+		return nil, false, false
+	}
+	item, exists, err := i.informer.GetIndexer().GetByKey(key)
+	if err != nil {
+		return nil, false, false
+	}
+	if !exists {
+		return nil, false, true
+	}
+	obj, ok := item.(*unstructured.Unstructured)
+	if !ok {
+		return nil, false, false
+	}
+	return obj.DeepCopy(), true, true
+}
+
+// cachedKind is implemented by the kinds of workload that can be made
+// from the objects in the resource cache.
+type cachedKind interface {
+	// groupKinds gives the API groups and kinds of the resources
+	// for the workloads, in order of preference
+	groupKinds() []schema.GroupKind
+	fromUnstructured(obj *unstructured.Unstructured) (workload, error)
+}
+
+// workloads makes workloads of the kind given from the cached objects
+// in the namespace given, or returns false if it can't. Where there
+// are objects of more than one group for the same name, the group
+// preferred is used.
+func (rc *resourceCache) workloads(kind cachedKind, namespace string) ([]workload, bool) {
+	seen := map[string]bool{}
+	var workloads []workload
+	for _, gk := range kind.groupKinds() {
+		objs, ok := rc.listKind(gk, namespace)
+		if !ok {
+			return nil, false
+		}
+		for i := range objs {
+			key := objs[i].GetNamespace() + "/" + objs[i].GetName()
+			if seen[key] {
+				continue
+			}
+			w, err := kind.fromUnstructured(&objs[i])
+			if err != nil {
+				return nil, false
+			}
+			seen[key] = true
+			workloads = append(workloads, w)
+		}
+	}
+	return workloads, true
+}
+
+// workload makes the named workload of the kind given from the cached
+// object, returning false if it can't.
+func (rc *resourceCache) workload(kind cachedKind, namespace, name string) (workload, bool, bool) {
+	for _, gk := range kind.groupKinds() {
+		obj, found, ok := rc.get(gk, namespace, name)
+		if !ok {
+			return workload{}, false, false
+		}
+		if found {
+			w, err := kind.fromUnstructured(obj)
+			return w, true, err == nil
+		}
+	}
+	return workload{}, false, true
+}
+
+// getWorkloads lists the workloads of the kind given from the cache,
+// if it's up to date for them, or otherwise from the API server.
+func (c *Cluster) getWorkloads(ctx context.Context, kind resourceKind, namespace string) ([]workload, error) {
+	if ck, ok := kind.(cachedKind); ok && c.cache != nil {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if workloads, ok := c.cache.workloads(ck, namespace); ok {
+			return workloads, nil
+		}
+	}
+	return kind.getWorkloads(ctx, c, namespace)
+}
+
+// getWorkload gets the named workload of the kind given from the
+// cache, if it's up to date for it, or otherwise from the API server.
+func (c *Cluster) getWorkload(ctx context.Context, kind resourceKind, namespace, name string) (workload, error) {
+	if ck, ok := kind.(cachedKind); ok && c.cache != nil {
+		if err := ctx.Err(); err != nil {
+			return workload{}, err
+		}
+		w, found, ok := c.cache.workload(ck, namespace, name)
+		if ok {
+			if !found {
+				gk := ck.groupKinds()[0]
+				return workload{}, apierrors.NewNotFound(schema.GroupResource{Group: gk.Group, Resource: strings.ToLower(gk.Kind)}, name)
+			}
+			return w, nil
+		}
+	}
+	return kind.getWorkload(ctx, c, namespace, name)
+}
+
+func hasVerb(verbs []string, verb string) bool {
+	for _, v := range verbs {
+		if v == verb {
+			return true
+		}
+	}
+	return false
+}
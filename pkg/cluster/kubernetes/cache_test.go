@@ -0,0 +1,245 @@
+package kubernetes
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	helmopfake "github.com/fluxcd/helm-operator/pkg/client/clientset/versioned/fake"
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	corefake "k8s.io/client-go/kubernetes/fake"
+	k8s_testing "k8s.io/client-go/testing"
+)
+
+var (
+	deploymentsGVR = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	configMapsGVR  = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	secretsGVR     = schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+	namespacesGVR  = schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+	listAndWatch   = []string{"get", "list", "watch"}
+)
+
+func testObject(apiVersion, kind, namespace, name string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(apiVersion)
+	obj.SetKind(kind)
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	if kind == "Deployment" {
+		// as the API server would default it
+		unstructured.SetNestedField(obj.Object, int64(1), "spec", "replicas")
+	}
+	return obj
+}
+
+func testCacheCluster(t *testing.T, allowedNamespaces map[string]struct{}) (*Cluster, *corefake.Clientset, *dynamicfake.FakeDynamicClient) {
+	coreClient := corefake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "demo"}})
+	coreClient.Fake.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "apps/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "deployments", Namespaced: true, Kind: "Deployment", Verbs: listAndWatch},
+				{Name: "deployments/scale", Namespaced: true, Kind: "Scale", Verbs: []string{"get"}},
+			},
+		},
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "namespaces", Namespaced: false, Kind: "Namespace", Verbs: listAndWatch},
+				{Name: "configmaps", Namespaced: true, Kind: "ConfigMap", Verbs: listAndWatch},
+				// can't be watched, so has to be listed each time
+				{Name: "secrets", Namespaced: true, Kind: "Secret", Verbs: getAndList},
+			},
+		},
+	}
+	// only configmaps with the GC mark are watched
+	cm := testObject("v1", "ConfigMap", "demo", "config")
+	cm.SetLabels(map[string]string{"app": "podinfo", gcMarkLabel: "mark"})
+	otherCM := testObject("v1", "ConfigMap", "other", "config")
+	otherCM.SetLabels(map[string]string{gcMarkLabel: "mark"})
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			deploymentsGVR: "DeploymentList",
+			configMapsGVR:  "ConfigMapList",
+			secretsGVR:     "SecretList",
+			namespacesGVR:  "NamespaceList",
+		},
+		testObject("v1", "Namespace", "", "demo"),
+		testObject("v1", "Namespace", "", "other"),
+		testObject("apps/v1", "Deployment", "demo", "podinfo"),
+		testObject("apps/v1", "Deployment", "other", "podinfo"),
+		testObject("v1", "Secret", "demo", "creds"),
+		testObject("v1", "ConfigMap", "demo", "unsynced"),
+		cm, otherCM)
+	client := ExtendedClient{
+		coreClient:         coreClient,
+		dynamicClient:      dynamicClient,
+		helmOperatorClient: helmopfake.NewSimpleClientset(),
+		discoveryClient:    coreClient.Discovery(),
+	}
+	return NewCluster(client, nil, nil, log.NewNopLogger(), allowedNamespaces, nil, nil), coreClient, dynamicClient
+}
+
+func watchResources(t *testing.T, c *Cluster) func() {
+	shutdown := make(chan struct{})
+	wg := &sync.WaitGroup{}
+	c.WatchResources(shutdown, wg)
+	assert.Eventually(t, func() bool {
+		c.cache.mu.RLock()
+		defer c.cache.mu.RUnlock()
+		for _, i := range c.cache.informers {
+			if !i.upToDate(time.Now()) {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+	return func() {
+		close(shutdown)
+		wg.Wait()
+	}
+}
+
+func dynamicLists(d *dynamicfake.FakeDynamicClient) map[string]int {
+	lists := map[string]int{}
+	for _, a := range d.Actions() {
+		if a.GetVerb() == "list" {
+			lists[a.GetResource().Resource]++
+		}
+	}
+	return lists
+}
+
+func TestResourceCache(t *testing.T) {
+	c, coreClient, dynamicClient := testCacheCluster(t, nil)
+	defer watchResources(t, c)()
+	assert.Len(t, c.cache.informers, 3)
+
+	dynamicClient.ClearActions()
+	resources, err := c.getAllowedResourcesBySelector("")
+	require.NoError(t, err)
+	for _, id := range []string{
+		"demo:deployment/podinfo",
+		"other:deployment/podinfo",
+		"demo:configmap/config",
+		"demo:configmap/unsynced",
+		"<cluster>:namespace/demo",
+		"demo:secret/creds",
+	} {
+		assert.Contains(t, resources, id)
+	}
+	assert.Equal(t, map[string]int{"configmaps": 1, "secrets": 1}, dynamicLists(dynamicClient),
+		"expected only the resources not watched in full to be listed")
+
+	dynamicClient.ClearActions()
+	resources, err = c.getAllowedResourcesBySelector(gcMarkLabel)
+	require.NoError(t, err)
+	assert.Contains(t, resources, "demo:configmap/config")
+	assert.Contains(t, resources, "other:configmap/config")
+	assert.NotContains(t, resources, "demo:configmap/unsynced")
+	assert.Equal(t, map[string]int{"secrets": 1}, dynamicLists(dynamicClient), "expected only secrets to be listed")
+
+	resources, err = c.getAllowedResourcesBySelector("app=podinfo")
+	require.NoError(t, err)
+	assert.Contains(t, resources, "demo:configmap/config")
+	assert.NotContains(t, resources, "demo:deployment/podinfo")
+
+	coreClient.ClearActions()
+	workloads, err := c.AllWorkloads(context.Background(), "demo")
+	require.NoError(t, err)
+	if assert.Len(t, workloads, 1) {
+		assert.Equal(t, "demo:deployment/podinfo", workloads[0].ID.String())
+	}
+	assert.Empty(t, coreClient.Actions(), "expected workloads to come from the cache")
+
+	// changes are seen without listing again
+	_, err = dynamicClient.Resource(deploymentsGVR).Namespace("demo").Create(context.Background(),
+		testObject("apps/v1", "Deployment", "demo", "helloworld"), metav1.CreateOptions{})
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		workloads, err := c.AllWorkloads(context.Background(), "")
+		return err == nil && len(workloads) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+	workloads, err = c.SomeWorkloads(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Empty(t, workloads)
+	assert.Empty(t, coreClient.Actions())
+
+	// the informers follow the API resources
+	coreClient.Fake.Resources = coreClient.Fake.Resources[:1]
+	c.cache.refresh()
+	assert.Len(t, c.cache.informers, 1)
+	_, ok := c.cache.list(configMapsGVR, "", labels.Everything())
+	assert.False(t, ok)
+	c.cache.reportStaleness()
+}
+
+func TestResourceCache_AllowedNamespaces(t *testing.T) {
+	c, _, dynamicClient := testCacheCluster(t, map[string]struct{}{"demo": {}, "missing": {}})
+	defer watchResources(t, c)()
+	// one for each of deployments, configmaps and namespaces, across
+	// the cluster
+	assert.Len(t, c.cache.informers, 3)
+
+	dynamicClient.ClearActions()
+	resources, err := c.getAllowedResourcesBySelector(gcMarkLabel)
+	require.NoError(t, err)
+	assert.Contains(t, resources, "demo:configmap/config")
+	assert.NotContains(t, resources, "other:configmap/config")
+	assert.Equal(t, map[string]int{"secrets": 1}, dynamicLists(dynamicClient))
+
+	workloads, err := c.AllWorkloads(context.Background(), "")
+	require.NoError(t, err)
+	if assert.Len(t, workloads, 1) {
+		assert.Equal(t, "demo:deployment/podinfo", workloads[0].ID.String())
+	}
+	_, ok := c.cache.list(deploymentsGVR, "other", labels.Everything())
+	assert.False(t, ok, "expected namespaces not allowed to be left to the API server")
+
+	w, err := c.getWorkload(context.Background(), resourceKinds["deployment"], "demo", "podinfo")
+	require.NoError(t, err)
+	assert.Equal(t, "podinfo", w.GetName())
+	_, err = c.getWorkload(context.Background(), resourceKinds["deployment"], "demo", "missing")
+	assert.Error(t, err)
+}
+
+func TestResourceCache_PerNamespace(t *testing.T) {
+	c, _, dynamicClient := testCacheCluster(t, map[string]struct{}{"demo": {}})
+	// as when flux has a role in each allowed namespace, rather than
+	// a cluster role
+	forbidden := func(action k8s_testing.Action) (bool, runtime.Object, error) {
+		if action.GetResource() == configMapsGVR && action.GetNamespace() == metav1.NamespaceAll {
+			return true, nil, apierrors.NewForbidden(configMapsGVR.GroupResource(), "", nil)
+		}
+		return false, nil, nil
+	}
+	dynamicClient.PrependReactor("list", "configmaps", forbidden)
+	dynamicClient.PrependWatchReactor("configmaps", func(action k8s_testing.Action) (bool, watch.Interface, error) {
+		_, _, err := forbidden(action)
+		return err != nil, nil, err
+	})
+	defer watchResources(t, c)()
+
+	assert.Eventually(t, func() bool {
+		c.cache.mu.RLock()
+		defer c.cache.mu.RUnlock()
+		_, ok := c.cache.informers[informerKey{gvr: configMapsGVR, namespace: "demo"}]
+		return ok && len(c.cache.informers) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		items, ok := c.cache.list(configMapsGVR, "demo", labels.SelectorFromSet(labels.Set{gcMarkLabel: "mark"}))
+		return ok && len(items) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -20,8 +20,18 @@ import (
 type cachedDiscovery struct {
 	discovery.CachedDiscoveryInterface
 
-	invalidMu sync.Mutex
-	invalid   bool
+	invalidMu   sync.Mutex
+	invalid     bool
+	subscribers []chan<- struct{}
+}
+
+// Subscribe arranges for the channel given to be sent to, without
+// blocking, each time the cache is invalidated; that is, whenever the
+// API resources may have changed.
+func (d *cachedDiscovery) Subscribe(ch chan<- struct{}) {
+	d.invalidMu.Lock()
+	d.subscribers = append(d.subscribers, ch)
+	d.invalidMu.Unlock()
 }
 
 // The k8s.io/client-go v8.0.0 implementation of MemCacheDiscovery
@@ -32,15 +42,19 @@ type cachedDiscovery struct {
 func (d *cachedDiscovery) Invalidate() {
 	d.invalidMu.Lock()
 	d.invalid = true
+	subscribers := d.subscribers
 	d.invalidMu.Unlock()
+	for _, ch := range subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
 }
 
-// ServerResourcesForGroupVersion is the method used by the
-// namespacer; so, this is the one where we check whether the cache
-// has been invalidated. A cachedDiscovery implementation for more
-// general use would do this for all methods (that weren't implemented
-// purely in terms of other methods).
-func (d *cachedDiscovery) ServerResourcesForGroupVersion(groupVersion string) (*metav1.APIResourceList, error) {
+// refreshIfInvalid does the invalidation deferred by Invalidate, if
+// there is one pending.
+func (d *cachedDiscovery) refreshIfInvalid() {
 	d.invalidMu.Lock()
 	invalid := d.invalid
 	d.invalid = false
@@ -48,6 +62,21 @@ func (d *cachedDiscovery) ServerResourcesForGroupVersion(groupVersion string) (*
 	if invalid {
 		d.CachedDiscoveryInterface.Invalidate()
 	}
+}
+
+// ServerResourcesForGroupVersion is the method used by the
+// namespacer, and ServerGroups the one used to find all the resources
+// in the cluster; so, these are the ones where we check whether the
+// cache has been invalidated. A cachedDiscovery implementation for
+// more general use would do this for all methods (that weren't
+// implemented purely in terms of other methods).
+func (d *cachedDiscovery) ServerGroups() (*metav1.APIGroupList, error) {
+	d.refreshIfInvalid()
+	return d.CachedDiscoveryInterface.ServerGroups()
+}
+
+func (d *cachedDiscovery) ServerResourcesForGroupVersion(groupVersion string) (*metav1.APIResourceList, error) {
+	d.refreshIfInvalid()
 	result, err := d.CachedDiscoveryInterface.ServerResourcesForGroupVersion(groupVersion)
 	if err == memory.ErrCacheNotFound {
 		// improve the error returned from memcacheclient
@@ -0,0 +1,144 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/go-kit/kit/log"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	kresource "github.com/fluxcd/flux/pkg/cluster/kubernetes/resource"
+	"github.com/fluxcd/flux/pkg/image"
+	"github.com/fluxcd/flux/pkg/resource"
+)
+
+const (
+	canarySuffix = "-canary"
+	// canaryLabel is given to a canary, its selector and its pods,
+	// with the name of the workload it's a copy of as the value.
+	// Since the pods otherwise have the same labels as those of the
+	// workload, they are selected by the same services.
+	canaryLabel = kresource.PolicyPrefix + "canary-of"
+)
+
+var deploymentResource = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+
+// Canary creates, scales, or (given zero replicas) deletes a copy of
+// the Deployment given, named with the suffix "-canary", with the
+// images given for its containers.
+//
+// The canary is applied without a garbage collection mark, so it's
+// only ever deleted by asking for zero replicas.
+func (c *Cluster) Canary(ctx context.Context, workload resource.Resource, images map[string]image.Ref, replicas int) (resource.ID, error) {
+	namespace, kind, name := workload.ResourceID().Components()
+	id := resource.MakeID(namespace, kind, name+canarySuffix)
+	if kind != "deployment" {
+		return id, fmt.Errorf("only Deployments can have canaries")
+	}
+	if !c.IsAllowedResource(id) {
+		return id, fmt.Errorf("not allowed to run canaries in namespace %q", namespace)
+	}
+	tenant := c.tenantOf(workload.Source())
+	if err := tenant.allows(id); err != nil {
+		return id, err
+	}
+	logger := log.With(c.logger, "method", "Canary", "canary", id)
+
+	if replicas == 0 {
+		existing, err := c.client.Resource(deploymentResource).Namespace(namespace).Get(ctx, name+canarySuffix, metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+			return id, nil
+		case err != nil:
+			return id, err
+		}
+		logger.Log("info", "deleting canary")
+		cs := makeChangeSet()
+		cs.stageAs("delete", tenant.impersonate(), id, workload.Source(), (&kuberesource{obj: existing, namespaced: true}).IdentifyingBytes())
+		return id, c.applyNow(logger, cs)
+	}
+
+	payload, err := canaryManifest(workload, images, replicas)
+	if err != nil {
+		return id, err
+	}
+	logger.Log("info", "applying canary", "replicas", replicas)
+	cs := makeChangeSet()
+	cs.stageAs("apply", tenant.impersonate(), id, workload.Source(), payload)
+	return id, c.applyNow(logger, cs)
+}
+
+// canaryManifest makes the definition of the canary from that of the
+// workload.
+func canaryManifest(workload resource.Resource, images map[string]image.Ref, replicas int) ([]byte, error) {
+	jsonBytes, err := yaml.YAMLToJSON(workload.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	var obj unstructured.Unstructured
+	if err := json.Unmarshal(jsonBytes, &obj.Object); err != nil {
+		return nil, err
+	}
+	namespace, _, name := workload.ResourceID().Components()
+	obj.SetName(name + canarySuffix)
+	obj.SetNamespace(namespace)
+
+	// Flux's annotations are left off, so the canary isn't taken to
+	// be automated, locked, and so on.
+	annotations := map[string]string{}
+	for k, v := range obj.GetAnnotations() {
+		if !strings.HasPrefix(k, kresource.PolicyPrefix) && !strings.HasPrefix(k, kresource.AlternatePolicyPrefix) && !strings.HasPrefix(k, kresource.FilterPolicyPrefix) {
+			annotations[k] = v
+		}
+	}
+	obj.SetAnnotations(annotations)
+
+	for _, path := range [][]string{
+		{"metadata", "labels"},
+		{"spec", "selector", "matchLabels"},
+		{"spec", "template", "metadata", "labels"},
+	} {
+		if err := unstructured.SetNestedField(obj.Object, name, append(path, canaryLabel)...); err != nil {
+			return nil, err
+		}
+	}
+	if err := unstructured.SetNestedField(obj.Object, int64(replicas), "spec", "replicas"); err != nil {
+		return nil, err
+	}
+
+	unset := map[string]bool{}
+	for container := range images {
+		unset[container] = true
+	}
+	for _, field := range []string{"initContainers", "containers"} {
+		containers, _, err := unstructured.NestedSlice(obj.Object, "spec", "template", "spec", field)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range containers {
+			container, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if ref, ok := images[fmt.Sprint(container["name"])]; ok {
+				container["image"] = ref.String()
+				delete(unset, fmt.Sprint(container["name"]))
+			}
+		}
+		if containers != nil {
+			if err := unstructured.SetNestedSlice(obj.Object, containers, "spec", "template", "spec", field); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for container := range unset {
+		return nil, fmt.Errorf("container %q not found in workload", container)
+	}
+	return yaml.Marshal(obj.Object)
+}
@@ -0,0 +1,88 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	kresource "github.com/fluxcd/flux/pkg/cluster/kubernetes/resource"
+	"github.com/fluxcd/flux/pkg/image"
+	"github.com/fluxcd/flux/pkg/resource"
+)
+
+const testCanaryWorkload = `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: unusual-default
+  labels:
+    app: app
+  annotations:
+    fluxcd.io/automated: "true"
+    fluxcd.io/canary: http
+    team: a
+spec:
+  replicas: 3
+  selector:
+    matchLabels:
+      app: app
+  template:
+    metadata:
+      labels:
+        app: app
+    spec:
+      containers:
+      - name: app
+        image: app:1.0
+      - name: sidecar
+        image: sidecar:1.0
+`
+
+func TestCanary(t *testing.T) {
+	kube, applier, cancel := setup(t)
+	defer cancel()
+
+	manifests, err := kresource.ParseMultidoc([]byte(testCanaryWorkload), "app.yaml")
+	require.NoError(t, err)
+	var workload resource.Resource
+	for _, m := range manifests {
+		workload = m
+	}
+	deployments := applier.dynamicClient.Resource(deploymentResource).Namespace(defaultTestNamespace)
+	ctx := context.Background()
+
+	id, err := kube.Canary(ctx, workload, map[string]image.Ref{"app": image.Ref{Name: image.Name{Image: "app"}, Tag: "1.1"}}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "unusual-default:deployment/app-canary", id.String())
+
+	canary, err := deployments.Get(ctx, "app-canary", metav1.GetOptions{})
+	require.NoError(t, err)
+	replicas, _, _ := unstructured.NestedFieldNoCopy(canary.Object, "spec", "replicas")
+	assert.EqualValues(t, 1, replicas)
+	containers, _, _ := unstructured.NestedSlice(canary.Object, "spec", "template", "spec", "containers")
+	require.Len(t, containers, 2)
+	assert.Equal(t, "app:1.1", containers[0].(map[string]interface{})["image"])
+	assert.Equal(t, "sidecar:1.0", containers[1].(map[string]interface{})["image"])
+	selector, _, _ := unstructured.NestedStringMap(canary.Object, "spec", "selector", "matchLabels")
+	assert.Equal(t, map[string]string{"app": "app", canaryLabel: "app"}, selector)
+	assert.Equal(t, map[string]string{"team": "a"}, canary.GetAnnotations())
+	assert.Empty(t, canary.GetLabels()[gcMarkLabel], "expected the canary not to be marked for garbage collection")
+
+	// a container that isn't there is an error
+	_, err = kube.Canary(ctx, workload, map[string]image.Ref{"nope": image.Ref{Name: image.Name{Image: "app"}, Tag: "1.1"}}, 1)
+	assert.Error(t, err)
+
+	// zero replicas deletes the canary, whether or not it's there
+	_, err = kube.Canary(ctx, workload, nil, 0)
+	require.NoError(t, err)
+	_, err = deployments.Get(ctx, "app-canary", metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+	_, err = kube.Canary(ctx, workload, nil, 0)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,219 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	apiresource "k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/fluxcd/flux/pkg/cluster"
+	"github.com/fluxcd/flux/pkg/policy"
+	"github.com/fluxcd/flux/pkg/resource"
+)
+
+// syncedResource records what was applied for a resource in the last
+// sync, to compare against what's in the cluster later.
+type syncedResource struct {
+	id       resource.ID
+	source   string
+	policies policy.Set
+	// manifest is the definition as applied, decoded as JSON would
+	// be, so it can be compared with what the API server returns.
+	manifest map[string]interface{}
+}
+
+func makeSyncedResource(res resource.Resource, applied []byte) (syncedResource, error) {
+	synced := syncedResource{
+		id:       res.ResourceID(),
+		source:   res.Source(),
+		policies: res.Policies(),
+	}
+	jsonBytes, err := yaml.YAMLToJSON(applied)
+	if err != nil {
+		return synced, err
+	}
+	err = json.Unmarshal(jsonBytes, &synced.manifest)
+	return synced, err
+}
+
+func (c *Cluster) setLastSync(synced map[string]syncedResource) {
+	c.muLastSync.Lock()
+	defer c.muLastSync.Unlock()
+	c.lastSync = synced
+}
+
+// Drift compares the resources in the cluster with those applied in
+// the last sync. A resource has drifted if it's been deleted, or if
+// any field given in its manifest has a different value in the
+// cluster. Fields not mentioned in the manifest (e.g., those filled
+// in with defaults, or status) are not considered.
+func (c *Cluster) Drift(ctx context.Context) ([]cluster.ResourceDrift, error) {
+	c.muLastSync.RLock()
+	synced := c.lastSync
+	c.muLastSync.RUnlock()
+	if len(synced) == 0 {
+		return nil, nil
+	}
+
+	// everything synced has the GC mark, and asking for only those
+	// lets them come from the cache
+	clusterResources, err := c.getAllowedResourcesBySelector(gcMarkLabel)
+	if err != nil {
+		return nil, errors.Wrap(err, "collating resources in cluster for drift detection")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, errors.Wrap(err, "collating resources in cluster for drift detection")
+	}
+
+	var drifted []cluster.ResourceDrift
+	for id, s := range synced {
+		res, ok := clusterResources[id]
+		if !ok {
+			drifted = append(drifted, cluster.ResourceDrift{
+				ResourceID: s.id,
+				Source:     s.source,
+				Reason:     cluster.DriftMissing,
+				Policies:   s.policies,
+			})
+			continue
+		}
+		// Someone has asked for this to be left alone in the cluster
+		if res.Policies().Has(policy.Ignore) {
+			continue
+		}
+		live, err := normaliseObject(res.obj.Object)
+		if err != nil {
+			return nil, errors.Wrapf(err, "decoding cluster resource %s", id)
+		}
+		var fields []string
+		diffFields("", s.manifest, live, &fields)
+		if len(fields) > 0 {
+			sort.Strings(fields)
+			drifted = append(drifted, cluster.ResourceDrift{
+				ResourceID: s.id,
+				Source:     s.source,
+				Reason:     cluster.DriftModified,
+				Fields:     fields,
+				Policies:   s.policies,
+			})
+		}
+	}
+	sort.Slice(drifted, func(i, j int) bool {
+		return drifted[i].ResourceID.String() < drifted[j].ResourceID.String()
+	})
+	return drifted, nil
+}
+
+// normaliseObject round-trips an object from the API server through
+// JSON, so that numbers and so on are represented the same way as in
+// a decoded manifest.
+func normaliseObject(obj map[string]interface{}) (map[string]interface{}, error) {
+	bytes, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var normalised map[string]interface{}
+	err = json.Unmarshal(bytes, &normalised)
+	return normalised, err
+}
+
+// diffFields appends to `fields` the path of each value in
+// `expected` that differs in `actual`.
+func diffFields(path string, expected, actual interface{}, fields *[]string) {
+	switch exp := expected.(type) {
+	case map[string]interface{}:
+		act, ok := actual.(map[string]interface{})
+		if !ok {
+			*fields = append(*fields, path)
+			return
+		}
+		for k, v := range exp {
+			if path == "" && k == "status" {
+				continue
+			}
+			field := k
+			if path != "" {
+				field = path + "." + k
+			}
+			actualValue, ok := act[k]
+			if !ok {
+				// The API server drops empty values
+				if !isEmptyValue(v) {
+					*fields = append(*fields, field)
+				}
+				continue
+			}
+			diffFields(field, v, actualValue, fields)
+		}
+	case []interface{}:
+		act, ok := actual.([]interface{})
+		if !ok || len(act) != len(exp) {
+			*fields = append(*fields, path)
+			return
+		}
+		for i := range exp {
+			diffFields(fmt.Sprintf("%s[%d]", path, i), exp[i], act[i], fields)
+		}
+	default:
+		if !scalarEqual(expected, actual) {
+			*fields = append(*fields, path)
+		}
+	}
+}
+
+func isEmptyValue(v interface{}) bool {
+	switch val := v.(type) {
+	case nil:
+		return true
+	case map[string]interface{}:
+		return len(val) == 0
+	case []interface{}:
+		return len(val) == 0
+	}
+	return false
+}
+
+// scalarEqual compares values allowing for the API server having
+// converted between strings and numbers or booleans (e.g., for
+// int-or-string fields), or having canonicalised quantities (e.g.,
+// `0.5` to `500m`, or `1024Mi` to `1Gi`).
+func scalarEqual(expected, actual interface{}) bool {
+	if reflect.DeepEqual(expected, actual) {
+		return true
+	}
+	exp, act := scalarString(expected), scalarString(actual)
+	if exp == act {
+		return true
+	}
+	return quantitiesEqual(exp, act)
+}
+
+// quantitiesEqual says whether both values are quantities, and the
+// same amount.
+func quantitiesEqual(a, b string) bool {
+	qa, err := apiresource.ParseQuantity(a)
+	if err != nil {
+		return false
+	}
+	qb, err := apiresource.ParseQuantity(b)
+	if err != nil {
+		return false
+	}
+	return qa.Cmp(qb) == 0
+}
+
+func scalarString(v interface{}) string {
+	switch val := v.(type) {
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(v)
+}
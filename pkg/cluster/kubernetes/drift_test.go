@@ -0,0 +1,165 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/fluxcd/flux/pkg/cluster"
+	kresource "github.com/fluxcd/flux/pkg/cluster/kubernetes/resource"
+	"github.com/fluxcd/flux/pkg/resource"
+)
+
+func TestDrift(t *testing.T) {
+	const defs = `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: dep1
+  namespace: ` + defaultTestNamespace + `
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+      - name: app
+        image: app:v1
+        ports:
+        - containerPort: 80
+`
+	kube, _, cancel := setup(t)
+	defer cancel()
+
+	manifests, err := kresource.ParseMultidoc([]byte(defs), "test.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resources []resource.Resource
+	for _, m := range manifests {
+		resources = append(resources, m)
+	}
+	if err := kube.Sync(cluster.SyncSet{Name: "testset", Resources: resources}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	drifted, err := kube.Drift(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, drifted)
+
+	deployments := kube.client.dynamicClient.Resource(schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}).Namespace(defaultTestNamespace)
+	obj, err := deployments.Get(ctx, "dep1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Fields not in the manifest don't count
+	unstructured.SetNestedField(obj.Object, "2020-01-01T00:00:00Z", "metadata", "creationTimestamp")
+	unstructured.SetNestedField(obj.Object, int64(2), "status", "replicas")
+	if _, err = deployments.Update(ctx, obj, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	drifted, err = kube.Drift(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, drifted)
+
+	unstructured.SetNestedField(obj.Object, int64(5), "spec", "replicas")
+	if _, err = deployments.Update(ctx, obj, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	drifted, err = kube.Drift(ctx)
+	assert.NoError(t, err)
+	if assert.Len(t, drifted, 1) {
+		assert.Equal(t, "unusual-default:deployment/dep1", drifted[0].ResourceID.String())
+		assert.Equal(t, cluster.DriftModified, drifted[0].Reason)
+		assert.Equal(t, []string{"spec.replicas"}, drifted[0].Fields)
+		assert.Equal(t, "test.yaml", drifted[0].Source)
+	}
+
+	if err = deployments.Delete(ctx, "dep1", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	drifted, err = kube.Drift(ctx)
+	assert.NoError(t, err)
+	if assert.Len(t, drifted, 1) {
+		assert.Equal(t, cluster.DriftMissing, drifted[0].Reason)
+	}
+}
+
+func TestDiffFields(t *testing.T) {
+	for _, v := range []struct {
+		name     string
+		expected map[string]interface{}
+		actual   map[string]interface{}
+		fields   []string
+	}{
+		{
+			name:     "same",
+			expected: map[string]interface{}{"a": "b", "n": float64(1)},
+			actual:   map[string]interface{}{"a": "b", "n": float64(1), "extra": true},
+		},
+		{
+			name:     "int-or-string",
+			expected: map[string]interface{}{"port": "8080"},
+			actual:   map[string]interface{}{"port": float64(8080)},
+		},
+		{
+			name:     "empty values dropped",
+			expected: map[string]interface{}{"labels": map[string]interface{}{}, "args": []interface{}{}, "x": nil},
+			actual:   map[string]interface{}{},
+		},
+		{
+			name:     "changed and removed",
+			expected: map[string]interface{}{"spec": map[string]interface{}{"replicas": float64(1), "paused": true}},
+			actual:   map[string]interface{}{"spec": map[string]interface{}{"replicas": float64(3)}},
+			fields:   []string{"spec.paused", "spec.replicas"},
+		},
+		{
+			name: "list elements",
+			expected: map[string]interface{}{"containers": []interface{}{
+				map[string]interface{}{"name": "a", "image": "a:1"},
+			}},
+			actual: map[string]interface{}{"containers": []interface{}{
+				map[string]interface{}{"name": "a", "image": "a:2"},
+			}},
+			fields: []string{"containers[0].image"},
+		},
+		{
+			name:     "list length",
+			expected: map[string]interface{}{"args": []interface{}{"a"}},
+			actual:   map[string]interface{}{"args": []interface{}{"a", "b"}},
+			fields:   []string{"args"},
+		},
+		{
+			name:     "status ignored",
+			expected: map[string]interface{}{"status": map[string]interface{}{"phase": "Active"}},
+			actual:   map[string]interface{}{"status": map[string]interface{}{"phase": "Terminating"}},
+		},
+	} {
+		t.Run(v.name, func(t *testing.T) {
+			var fields []string
+			diffFields("", v.expected, v.actual, &fields)
+			assert.ElementsMatch(t, v.fields, fields)
+		})
+	}
+}
+
+func TestScalarEqual(t *testing.T) {
+	for _, v := range []struct {
+		expected, actual interface{}
+		equal            bool
+	}{
+		{"80", float64(80), true},
+		{"0.5", "500m", true},
+		{float64(1), "1000m", true},
+		{"1024Mi", "1Gi", true},
+		{"1Gi", "1G", false},
+		{"500m", "501m", false},
+		{"app:v1", "app:v2", false},
+	} {
+		assert.Equal(t, v.equal, scalarEqual(v.expected, v.actual), "%v vs %v", v.expected, v.actual)
+	}
+}
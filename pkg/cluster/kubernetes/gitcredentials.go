@@ -0,0 +1,36 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	v1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+const (
+	GitCredentialsUsernameKey = "username"
+	GitCredentialsPasswordKey = "password"
+)
+
+// GitCredentialsSecret supplies git HTTPS credentials from the
+// `username` and `password` entries of a secret. The secret is read
+// each time the credentials are needed, so changes to it take effect
+// without restarting.
+type GitCredentialsSecret struct {
+	SecretAPI  v1.SecretInterface
+	SecretName string
+}
+
+func (s GitCredentialsSecret) Get(ctx context.Context) (string, string, error) {
+	secret, err := s.SecretAPI.Get(ctx, s.SecretName, metav1.GetOptions{})
+	if err != nil {
+		return "", "", errors.Wrap(err, "reading git credentials secret")
+	}
+	username, password := string(secret.Data[GitCredentialsUsernameKey]), string(secret.Data[GitCredentialsPasswordKey])
+	if username == "" || password == "" {
+		return "", "", fmt.Errorf("secret %s must have both %q and %q entries", s.SecretName, GitCredentialsUsernameKey, GitCredentialsPasswordKey)
+	}
+	return username, password, nil
+}
@@ -0,0 +1,31 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestGitCredentialsSecret(t *testing.T) {
+	client := fake.NewSimpleClientset(&apiv1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "git-auth", Namespace: "flux"},
+		Data: map[string][]byte{
+			GitCredentialsUsernameKey: []byte("flux"),
+			GitCredentialsPasswordKey: []byte("s3cr3t"),
+		},
+	})
+	secrets := client.CoreV1().Secrets("flux")
+	ctx := context.Background()
+
+	username, password, err := GitCredentialsSecret{SecretAPI: secrets, SecretName: "git-auth"}.Get(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "flux", username)
+	assert.Equal(t, "s3cr3t", password)
+
+	_, _, err = GitCredentialsSecret{SecretAPI: secrets, SecretName: "missing"}.Get(ctx)
+	assert.Error(t, err)
+}
@@ -0,0 +1,157 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/fluxcd/flux/pkg/cluster"
+	"github.com/fluxcd/flux/pkg/resource"
+)
+
+// hookPollInterval is how often a hook is checked on, while waiting
+// for it to finish (or to be deleted).
+var hookPollInterval = time.Second
+
+// hookResources are the kinds that can be sync hooks, i.e., those
+// that run to completion.
+var hookResources = map[string]schema.GroupVersionResource{
+	"job": {Group: "batch", Version: "v1", Resource: "jobs"},
+	"pod": {Group: "", Version: "v1", Resource: "pods"},
+}
+
+// RunHook runs the Job or Pod given as a sync hook, and waits for it
+// to finish. The key is recorded on the hook, and it's not run again
+// while it has succeeded with the same key. Otherwise, any previous
+// run of the hook is deleted first, since Jobs and Pods can't be
+// changed once created.
+//
+// Hooks are applied without a garbage collection mark, so they are
+// left in place once run, whether or not they are still in the repo.
+func (c *Cluster) RunHook(ctx context.Context, hook resource.Resource, key string) (bool, error) {
+	id := hook.ResourceID()
+	namespace, kind, name := id.Components()
+	gvr, ok := hookResources[kind]
+	if !ok {
+		return false, fmt.Errorf("only Jobs and Pods can be sync hooks")
+	}
+	if !c.IsAllowedResource(id) {
+		return false, fmt.Errorf("not allowed to run hooks in namespace %q", namespace)
+	}
+	tenant := c.tenantOf(hook.Source())
+	if err := tenant.allows(id); err != nil {
+		return false, err
+	}
+	logger := log.With(c.logger, "method", "RunHook", "hook", id)
+	client := c.client.Resource(gvr).Namespace(namespace)
+
+	existing, err := client.Get(ctx, name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+	case err != nil:
+		return false, err
+	default:
+		if existing.GetAnnotations()[checksumAnnotation] == key && hookReadiness(existing).Status == cluster.ReadinessCurrent {
+			return false, nil
+		}
+		logger.Log("info", "deleting previous run of hook")
+		previous := &kuberesource{obj: existing, namespaced: true}
+		cs := makeChangeSet()
+		cs.stageAs("delete", tenant.impersonate(), id, hook.Source(), previous.IdentifyingBytes())
+		if err := c.applyNow(logger, cs); err != nil {
+			return false, err
+		}
+		if err := waitForHook(ctx, client, name, func(obj *unstructured.Unstructured) (bool, error) {
+			return obj == nil, nil
+		}); err != nil {
+			return false, fmt.Errorf("waiting for previous run of hook to be deleted: %s", err)
+		}
+	}
+
+	payload, err := applyMetadata(hook, "", key)
+	if err != nil {
+		return false, err
+	}
+	cs := makeChangeSet()
+	cs.stageAs("apply", tenant.impersonate(), id, hook.Source(), payload)
+	logger.Log("info", "running hook")
+	if err := c.applyNow(logger, cs); err != nil {
+		return true, err
+	}
+
+	var last cluster.Readiness
+	err = waitForHook(ctx, client, name, func(obj *unstructured.Unstructured) (bool, error) {
+		if obj == nil {
+			return false, fmt.Errorf("hook was deleted before it finished")
+		}
+		last = hookReadiness(obj)
+		switch last.Status {
+		case cluster.ReadinessCurrent:
+			return true, nil
+		case cluster.ReadinessFailed:
+			return false, fmt.Errorf("%s", last.Message)
+		}
+		return false, nil
+	})
+	if err != nil && ctx.Err() == context.DeadlineExceeded && last.Message != "" {
+		err = fmt.Errorf("timed out waiting for hook to finish; %s", last.Message)
+	}
+	return true, err
+}
+
+// applyNow applies the change set given straight away, rather than as
+// part of a sync.
+func (c *Cluster) applyNow(logger log.Logger, cs changeSet) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if errs := c.applier.apply(logger, cs, nil); len(errs) > 0 {
+		return errs[0].Error
+	}
+	return nil
+}
+
+// waitForHook polls the hook until done says it's finished, or
+// returns an error. done is given nil if the hook doesn't exist.
+func waitForHook(ctx context.Context, client dynamic.ResourceInterface, name string, done func(*unstructured.Unstructured) (bool, error)) error {
+	for {
+		obj, err := client.Get(ctx, name, metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+			obj = nil
+		case err != nil:
+			return err
+		}
+		if finished, err := done(obj); finished || err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(hookPollInterval):
+		}
+	}
+}
+
+// hookReadiness says whether a hook has finished successfully. Unlike
+// ComputeReadiness, a Pod has to have run to completion, rather than
+// just be ready.
+func hookReadiness(obj *unstructured.Unstructured) cluster.Readiness {
+	if obj.GetKind() == "Pod" {
+		phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase")
+		switch phase {
+		case "Succeeded":
+			return current("pod has completed successfully")
+		case "Failed":
+			return failed("pod has failed")
+		}
+		return inProgress("pod is %s", phase)
+	}
+	return jobReadiness(obj)
+}
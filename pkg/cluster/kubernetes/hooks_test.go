@@ -0,0 +1,116 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	kresource "github.com/fluxcd/flux/pkg/cluster/kubernetes/resource"
+	"github.com/fluxcd/flux/pkg/resource"
+)
+
+const testHook = `---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+  namespace: unusual-default
+  annotations:
+    fluxcd.io/hook: pre-sync
+spec:
+  template:
+    spec:
+      containers:
+      - name: migrate
+        image: migrate:1.0
+`
+
+func TestRunHook(t *testing.T) {
+	kube, applier, cancel := setup(t)
+	defer cancel()
+	defer func(interval time.Duration) { hookPollInterval = interval }(hookPollInterval)
+	hookPollInterval = 10 * time.Millisecond
+
+	manifests, err := kresource.ParseMultidoc([]byte(testHook), "hooks/migrate.yaml")
+	require.NoError(t, err)
+	var hook resource.Resource
+	for _, m := range manifests {
+		hook = m
+	}
+	jobs := applier.dynamicClient.Resource(hookResources["job"]).Namespace(defaultTestNamespace)
+
+	// finish acts as the job controller would, once the hook has
+	// been created with the key given
+	finish := func(key, condition string) {
+		go func() {
+			for {
+				job, err := jobs.Get(context.TODO(), "migrate", metav1.GetOptions{})
+				if err == nil && job.GetAnnotations()[checksumAnnotation] == key {
+					unstructured.SetNestedSlice(job.Object, []interface{}{
+						map[string]interface{}{"type": condition, "status": "True"},
+					}, "status", "conditions")
+					_, err = jobs.Update(context.TODO(), job, metav1.UpdateOptions{})
+					if err == nil {
+						return
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+		}()
+	}
+
+	ctx, cancelCtx := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelCtx()
+
+	finish("first", "Complete")
+	ran, err := kube.RunHook(ctx, hook, "first")
+	assert.NoError(t, err)
+	assert.True(t, ran)
+	job, err := jobs.Get(ctx, "migrate", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, job.GetLabels()[gcMarkLabel], "expected the hook not to be marked for garbage collection")
+
+	// having succeeded, it's not run again for the same key
+	ran, err = kube.RunHook(ctx, hook, "first")
+	assert.NoError(t, err)
+	assert.False(t, ran)
+
+	// but is for another, replacing the previous run
+	finish("second", "Failed")
+	ran, err = kube.RunHook(ctx, hook, "second")
+	assert.Error(t, err)
+	assert.True(t, ran)
+
+	// and a hook that doesn't finish in time fails
+	shortCtx, cancelShort := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancelShort()
+	ran, err = kube.RunHook(shortCtx, hook, "third")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "timed out")
+	}
+	assert.True(t, ran)
+}
+
+func TestRunHook_Kinds(t *testing.T) {
+	kube, _, cancel := setup(t)
+	defer cancel()
+	manifests, err := kresource.ParseMultidoc([]byte(`---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: unusual-default
+  annotations:
+    fluxcd.io/hook: post-sync
+`), "app.yaml")
+	require.NoError(t, err)
+	for _, m := range manifests {
+		_, err := kube.RunHook(context.Background(), m, "key")
+		assert.Error(t, err)
+	}
+}
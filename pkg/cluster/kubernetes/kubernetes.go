@@ -13,6 +13,7 @@ import (
 	"gopkg.in/yaml.v2"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/discovery"
 	k8sclientdynamic "k8s.io/client-go/dynamic"
 	k8sclient "k8s.io/client-go/kubernetes"
@@ -89,6 +90,17 @@ type Cluster struct {
 	GC bool
 	// dry run garbage collection without syncing
 	DryGC bool
+	// GCMaxDeletions is the most resources garbage collection will
+	// delete in one sync; if there are more, it deletes none of
+	// them. Zero means there's no limit.
+	GCMaxDeletions int
+	// GCProtectedKinds are the kinds of resource that garbage
+	// collection leaves alone, unless they have the prune policy
+	// enabled.
+	GCProtectedKinds []string
+	// Tenants are given parts of the git repo and of the cluster;
+	// see Tenant.
+	Tenants []Tenant
 
 	client  ExtendedClient
 	applier Applier
@@ -102,6 +114,11 @@ type Cluster struct {
 	syncErrors   map[resource.ID]error
 	muSyncErrors sync.RWMutex
 
+	// lastSync keeps what was applied in the last sync, for
+	// detecting drift.
+	lastSync   map[string]syncedResource
+	muLastSync sync.RWMutex
+
 	allowedNamespaces   map[string]struct{}
 	loggedAllowedNS     map[string]bool // to keep track of whether we've logged a problem with seeing an allowed namespace
 	loggedAllowedNSLock sync.RWMutex
@@ -109,6 +126,10 @@ type Cluster struct {
 	imageIncluder       cluster.Includer
 	resourceExcludeList []string
 	mu                  sync.Mutex
+
+	// cache is the in-memory view of the cluster's resources, if
+	// WatchResources has been called
+	cache *resourceCache
 }
 
 // NewCluster returns a usable cluster.
@@ -150,7 +171,7 @@ func (c *Cluster) SomeWorkloads(ctx context.Context, ids []resource.ID) (res []c
 			continue
 		}
 
-		workload, err := resourceKind.getWorkload(ctx, c, ns, name)
+		workload, err := c.getWorkload(ctx, resourceKind, ns, name)
 		if err != nil {
 			if apierrors.IsForbidden(err) || apierrors.IsNotFound(err) {
 				continue
@@ -191,7 +212,7 @@ func (c *Cluster) AllWorkloads(ctx context.Context, restrictToNamespace string)
 	var allworkloads []cluster.Workload
 	for _, ns := range namespaces {
 		for kind, resourceKind := range resourceKinds {
-			workloads, err := resourceKind.getWorkloads(ctx, c, ns)
+			workloads, err := c.getWorkloads(ctx, resourceKind, ns)
 			if err != nil {
 				switch {
 				case apierrors.IsNotFound(err):
@@ -263,7 +284,7 @@ func (c *Cluster) Export(ctx context.Context) ([]byte, error) {
 		}
 
 		for _, resourceKind := range resourceKinds {
-			workloads, err := resourceKind.getWorkloads(ctx, c, ns)
+			workloads, err := c.getWorkloads(ctx, resourceKind, ns)
 			if err != nil {
 				switch {
 				case apierrors.IsNotFound(err):
@@ -311,11 +332,11 @@ func (c *Cluster) getAllowedAndExistingNamespaces(ctx context.Context) ([]string
 			if err := ctx.Err(); err != nil {
 				return nil, err
 			}
-			ns, err := c.client.CoreV1().Namespaces().Get(ctx, name, meta_v1.GetOptions{})
+			err := c.getNamespace(ctx, name)
 			switch {
 			case err == nil:
 				c.updateLoggedAllowedNS(name, false) // reset, so if the namespace goes away we'll log it again
-				nsList = append(nsList, ns.Name)
+				nsList = append(nsList, name)
 			case apierrors.IsUnauthorized(err) || apierrors.IsForbidden(err) || apierrors.IsNotFound(err):
 				if !c.getLoggedAllowedNS(name) {
 					c.logger.Log("warning", "cannot access allowed namespace",
@@ -335,6 +356,20 @@ func (c *Cluster) getAllowedAndExistingNamespaces(ctx context.Context) ([]string
 	return []string{meta_v1.NamespaceAll}, nil
 }
 
+// getNamespace checks that the namespace exists and can be seen,
+// using the cache if that's up to date for namespaces.
+func (c *Cluster) getNamespace(ctx context.Context, name string) error {
+	gk := schema.GroupKind{Kind: "Namespace"}
+	if _, found, ok := c.cache.get(gk, "", name); ok {
+		if !found {
+			return apierrors.NewNotFound(schema.GroupResource{Resource: "namespaces"}, name)
+		}
+		return nil
+	}
+	_, err := c.client.CoreV1().Namespaces().Get(ctx, name, meta_v1.GetOptions{})
+	return err
+}
+
 func (c *Cluster) updateLoggedAllowedNS(key string, value bool) {
 	c.loggedAllowedNSLock.Lock()
 	defer c.loggedAllowedNSLock.Unlock()
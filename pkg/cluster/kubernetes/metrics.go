@@ -0,0 +1,31 @@
+package kubernetes
+
+import (
+	"github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+
+	fluxmetrics "github.com/fluxcd/flux/pkg/metrics"
+)
+
+var (
+	cacheStaleness = prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Namespace: "flux",
+		Subsystem: "cluster_cache",
+		Name:      "staleness_seconds",
+		Help:      "How long the cached view of each kind of resource has been out of date (not yet loaded, or failing to watch), in seconds; zero when it is up to date.",
+	}, []string{fluxmetrics.LabelResource})
+
+	cacheInformers = prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Namespace: "flux",
+		Subsystem: "cluster_cache",
+		Name:      "informers",
+		Help:      "Number of informers watching resources for the cached view of the cluster.",
+	}, []string{})
+
+	tenantSyncErrors = prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Namespace: "flux",
+		Subsystem: "cluster",
+		Name:      "tenant_sync_errors",
+		Help:      "Number of resources belonging to each tenant that failed to sync or be garbage collected in the last sync.",
+	}, []string{fluxmetrics.LabelTenant})
+)
@@ -0,0 +1,341 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/fluxcd/flux/pkg/cluster"
+)
+
+// Readiness works out whether each resource applied in the last sync
+// has been reconciled, from its status in the cluster. Resources
+// that can't be found are reported as Unknown.
+func (c *Cluster) Readiness(ctx context.Context) ([]cluster.ResourceReadiness, error) {
+	c.muLastSync.RLock()
+	synced := c.lastSync
+	c.muLastSync.RUnlock()
+	if len(synced) == 0 {
+		return nil, nil
+	}
+
+	// as with drift, everything synced has the GC mark
+	clusterResources, err := c.getAllowedResourcesBySelector(gcMarkLabel)
+	if err != nil {
+		return nil, errors.Wrap(err, "collating resources in cluster for readiness")
+	}
+
+	var result []cluster.ResourceReadiness
+	for id, s := range synced {
+		readiness := cluster.Readiness{Status: cluster.ReadinessUnknown, Message: "resource not found in cluster"}
+		if res, ok := clusterResources[id]; ok {
+			readiness = ComputeReadiness(res.obj)
+		}
+		result = append(result, cluster.ResourceReadiness{ResourceID: s.id, Readiness: readiness})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ResourceID.String() < result[j].ResourceID.String()
+	})
+	return result, nil
+}
+
+// ComputeReadiness works out whether the object given has been
+// reconciled, in the manner of kstatus: the built-in kinds that
+// report the progress of a rollout in their own way are checked
+// using that, and anything else by the standard `Ready`, `Stalled`
+// and `Reconciling` conditions, if it has them. An object with no
+// status to go on is taken to be Current.
+func ComputeReadiness(obj *unstructured.Unstructured) cluster.Readiness {
+	if obj.GetDeletionTimestamp() != nil {
+		return cluster.Readiness{Status: cluster.ReadinessTerminating, Message: "resource scheduled for deletion"}
+	}
+	// a controller that reports the generation it has seen hasn't
+	// looked at the latest spec if that's behind
+	if observed, found, err := unstructured.NestedInt64(obj.Object, "status", "observedGeneration"); err == nil && found {
+		if generation := obj.GetGeneration(); observed < generation {
+			return inProgress("waiting for generation %d to be observed, at %d", generation, observed)
+		}
+	}
+
+	gk := obj.GroupVersionKind().GroupKind()
+	switch gk.String() {
+	case "Deployment.apps":
+		return deploymentReadiness(obj)
+	case "StatefulSet.apps":
+		return statefulSetReadiness(obj)
+	case "DaemonSet.apps":
+		return daemonSetReadiness(obj)
+	case "ReplicaSet.apps":
+		return replicaSetReadiness(obj)
+	case "Job.batch":
+		return jobReadiness(obj)
+	case "Pod":
+		return podReadiness(obj)
+	case "PersistentVolumeClaim":
+		return pvcReadiness(obj)
+	case "Service":
+		return serviceReadiness(obj)
+	case "HelmRelease.helm.fluxcd.io":
+		return helmReleaseReadiness(obj)
+	case "HelmRelease." + HelmReleaseV2Group:
+		return helmReleaseV2Readiness(obj)
+	}
+	return conditionsReadiness(obj)
+}
+
+// readinessOf converts one of the typed objects returned by the
+// clientsets to unstructured, so its readiness can be worked out.
+func readinessOf(obj interface{}) cluster.Readiness {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		return ComputeReadiness(u)
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return cluster.Readiness{Status: cluster.ReadinessUnknown, Message: err.Error()}
+	}
+	return ComputeReadiness(&unstructured.Unstructured{Object: content})
+}
+
+func current(format string, args ...interface{}) cluster.Readiness {
+	return cluster.Readiness{Status: cluster.ReadinessCurrent, Message: fmt.Sprintf(format, args...)}
+}
+
+func inProgress(format string, args ...interface{}) cluster.Readiness {
+	return cluster.Readiness{Status: cluster.ReadinessInProgress, Message: fmt.Sprintf(format, args...)}
+}
+
+func failed(format string, args ...interface{}) cluster.Readiness {
+	return cluster.Readiness{Status: cluster.ReadinessFailed, Message: fmt.Sprintf(format, args...)}
+}
+
+func nestedInt(obj *unstructured.Unstructured, fields ...string) int64 {
+	v, _, _ := unstructured.NestedInt64(obj.Object, fields...)
+	return v
+}
+
+// replicas gives spec.replicas, which defaults to one.
+func replicas(obj *unstructured.Unstructured) int64 {
+	v, found, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+	if !found {
+		return 1
+	}
+	return v
+}
+
+type condition struct {
+	Type, Status, Reason, Message string
+}
+
+func conditions(obj *unstructured.Unstructured) map[string]condition {
+	list, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	result := map[string]condition{}
+	for _, item := range list {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		var c condition
+		c.Type, _ = m["type"].(string)
+		c.Status, _ = m["status"].(string)
+		c.Reason, _ = m["reason"].(string)
+		c.Message, _ = m["message"].(string)
+		result[c.Type] = c
+	}
+	return result
+}
+
+func (c condition) describe() string {
+	if c.Message != "" {
+		return c.Message
+	}
+	if c.Reason != "" {
+		return c.Reason
+	}
+	return fmt.Sprintf("%s: %s", c.Type, c.Status)
+}
+
+func conditionsReadiness(obj *unstructured.Unstructured) cluster.Readiness {
+	conds := conditions(obj)
+	if c, ok := conds["Stalled"]; ok && c.Status == "True" {
+		return failed("%s", c.describe())
+	}
+	if c, ok := conds["Reconciling"]; ok && c.Status == "True" {
+		return inProgress("%s", c.describe())
+	}
+	if c, ok := conds["Ready"]; ok {
+		if c.Status == "True" {
+			return current("%s", c.describe())
+		}
+		return inProgress("%s", c.describe())
+	}
+	return current("resource is current")
+}
+
+func deploymentReadiness(obj *unstructured.Unstructured) cluster.Readiness {
+	if c, ok := conditions(obj)["Progressing"]; ok && c.Reason == "ProgressDeadlineExceeded" {
+		return failed("progress deadline exceeded")
+	}
+	desired := replicas(obj)
+	total := nestedInt(obj, "status", "replicas")
+	updated := nestedInt(obj, "status", "updatedReplicas")
+	ready := nestedInt(obj, "status", "readyReplicas")
+	available := nestedInt(obj, "status", "availableReplicas")
+	switch {
+	case updated < desired:
+		return inProgress("updated: %d/%d", updated, desired)
+	case total > updated:
+		return inProgress("pending termination: %d", total-updated)
+	case available < updated:
+		return inProgress("available: %d/%d", available, updated)
+	case ready < desired:
+		return inProgress("ready: %d/%d", ready, desired)
+	}
+	return current("deployment is available, with %d replicas", desired)
+}
+
+func statefulSetReadiness(obj *unstructured.Unstructured) cluster.Readiness {
+	if strategy, _, _ := unstructured.NestedString(obj.Object, "spec", "updateStrategy", "type"); strategy == "OnDelete" {
+		return current("updates are on delete, so the rollout is not tracked")
+	}
+	desired := replicas(obj)
+	ready := nestedInt(obj, "status", "readyReplicas")
+	if ready < desired {
+		return inProgress("ready: %d/%d", ready, desired)
+	}
+	if partition, found, _ := unstructured.NestedInt64(obj.Object, "spec", "updateStrategy", "rollingUpdate", "partition"); found && partition > 0 {
+		updated := nestedInt(obj, "status", "updatedReplicas")
+		if expected := desired - partition; updated < expected {
+			return inProgress("updated in partition: %d/%d", updated, expected)
+		}
+		return current("partitioned rollout complete, with %d replicas updated", desired-partition)
+	}
+	currentRevision, _, _ := unstructured.NestedString(obj.Object, "status", "currentRevision")
+	updateRevision, _, _ := unstructured.NestedString(obj.Object, "status", "updateRevision")
+	if currentRevision != updateRevision {
+		return inProgress("waiting for revision %s to be rolled out", updateRevision)
+	}
+	return current("all %d replicas are ready, at revision %s", desired, currentRevision)
+}
+
+func daemonSetReadiness(obj *unstructured.Unstructured) cluster.Readiness {
+	desired := nestedInt(obj, "status", "desiredNumberScheduled")
+	scheduled := nestedInt(obj, "status", "currentNumberScheduled")
+	updated := nestedInt(obj, "status", "updatedNumberScheduled")
+	available := nestedInt(obj, "status", "numberAvailable")
+	ready := nestedInt(obj, "status", "numberReady")
+	switch {
+	case scheduled < desired:
+		return inProgress("scheduled: %d/%d", scheduled, desired)
+	case updated < desired:
+		return inProgress("updated: %d/%d", updated, desired)
+	case available < desired:
+		return inProgress("available: %d/%d", available, desired)
+	case ready < desired:
+		return inProgress("ready: %d/%d", ready, desired)
+	}
+	return current("all %d replicas are available", desired)
+}
+
+func replicaSetReadiness(obj *unstructured.Unstructured) cluster.Readiness {
+	if c, ok := conditions(obj)["ReplicaFailure"]; ok && c.Status == "True" {
+		return inProgress("%s", c.describe())
+	}
+	desired := replicas(obj)
+	ready := nestedInt(obj, "status", "readyReplicas")
+	available := nestedInt(obj, "status", "availableReplicas")
+	switch {
+	case ready < desired:
+		return inProgress("ready: %d/%d", ready, desired)
+	case available < desired:
+		return inProgress("available: %d/%d", available, desired)
+	}
+	return current("all %d replicas are available", desired)
+}
+
+func jobReadiness(obj *unstructured.Unstructured) cluster.Readiness {
+	conds := conditions(obj)
+	if c, ok := conds["Failed"]; ok && c.Status == "True" {
+		return failed("job failed: %s", c.describe())
+	}
+	if c, ok := conds["Complete"]; ok && c.Status == "True" {
+		return current("job completed")
+	}
+	return inProgress("job in progress: %d active, %d succeeded", nestedInt(obj, "status", "active"), nestedInt(obj, "status", "succeeded"))
+}
+
+func podReadiness(obj *unstructured.Unstructured) cluster.Readiness {
+	phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase")
+	switch phase {
+	case "Succeeded":
+		return current("pod has completed successfully")
+	case "Failed":
+		return failed("pod has failed")
+	}
+	statuses, _, _ := unstructured.NestedSlice(obj.Object, "status", "containerStatuses")
+	for _, s := range statuses {
+		status, ok := s.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		reason, _, _ := unstructured.NestedString(status, "state", "waiting", "reason")
+		if reason == "CrashLoopBackOff" {
+			return failed("a container is in CrashLoopBackOff")
+		}
+	}
+	if c, ok := conditions(obj)["Ready"]; ok && c.Status == "True" {
+		return current("pod is ready")
+	}
+	return inProgress("pod is %s", strings.ToLower(phase))
+}
+
+func pvcReadiness(obj *unstructured.Unstructured) cluster.Readiness {
+	phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase")
+	if phase != "Bound" {
+		return inProgress("not bound")
+	}
+	return current("bound")
+}
+
+func serviceReadiness(obj *unstructured.Unstructured) cluster.Readiness {
+	if kind, _, _ := unstructured.NestedString(obj.Object, "spec", "type"); kind == "LoadBalancer" {
+		if ingress, _, _ := unstructured.NestedSlice(obj.Object, "status", "loadBalancer", "ingress"); len(ingress) == 0 {
+			return inProgress("waiting for a load balancer")
+		}
+	}
+	return current("service is ready")
+}
+
+// helmReleaseReadiness goes by the phase, since the Helm operator
+// doesn't give the standard conditions.
+func helmReleaseReadiness(obj *unstructured.Unstructured) cluster.Readiness {
+	phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase")
+	message := phase
+	if c, ok := conditions(obj)["Released"]; ok && c.Message != "" {
+		message = c.Message
+	}
+	switch {
+	case phase == "Succeeded" || phase == "Deployed" || phase == "Tested":
+		return current("%s", message)
+	case strings.HasSuffix(phase, "Failed") || phase == "RolledBack":
+		return failed("%s", message)
+	case phase == "":
+		return inProgress("waiting for the Helm operator")
+	}
+	return inProgress("%s", message)
+}
+
+// helmReleaseV2Readiness goes by the standard conditions, except
+// that a failed install or upgrade is only reported by the reason
+// given for not being Ready (by earlier versions of the Helm
+// controller, anyway).
+func helmReleaseV2Readiness(obj *unstructured.Unstructured) cluster.Readiness {
+	if c, ok := conditions(obj)["Ready"]; ok && c.Status == "False" && strings.HasSuffix(c.Reason, "Failed") {
+		return failed("%s", c.describe())
+	}
+	return conditionsReadiness(obj)
+}
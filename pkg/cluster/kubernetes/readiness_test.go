@@ -0,0 +1,149 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/fluxcd/flux/pkg/cluster"
+)
+
+func TestComputeReadiness(t *testing.T) {
+	for name, c := range map[string]struct {
+		manifest string
+		status   string
+	}{
+		"deployment rolled out": {`
+apiVersion: apps/v1
+kind: Deployment
+metadata: {generation: 2}
+spec: {replicas: 2}
+status: {observedGeneration: 2, replicas: 2, updatedReplicas: 2, readyReplicas: 2, availableReplicas: 2}
+`, cluster.ReadinessCurrent},
+		"deployment rolling out": {`
+apiVersion: apps/v1
+kind: Deployment
+metadata: {generation: 2}
+spec: {replicas: 2}
+status: {observedGeneration: 2, replicas: 3, updatedReplicas: 1, readyReplicas: 2, availableReplicas: 2}
+`, cluster.ReadinessInProgress},
+		"deployment not observed": {`
+apiVersion: apps/v1
+kind: Deployment
+metadata: {generation: 3}
+spec: {replicas: 1}
+status: {observedGeneration: 2, replicas: 1, updatedReplicas: 1, readyReplicas: 1, availableReplicas: 1}
+`, cluster.ReadinessInProgress},
+		"deployment past deadline": {`
+apiVersion: apps/v1
+kind: Deployment
+spec: {replicas: 1}
+status:
+  conditions:
+  - {type: Progressing, status: "False", reason: ProgressDeadlineExceeded}
+`, cluster.ReadinessFailed},
+		"terminating": {`
+apiVersion: v1
+kind: ConfigMap
+metadata: {deletionTimestamp: "2020-01-01T00:00:00Z"}
+`, cluster.ReadinessTerminating},
+		"no status": {`
+apiVersion: v1
+kind: ConfigMap
+`, cluster.ReadinessCurrent},
+		"ready condition": {`
+apiVersion: cert-manager.io/v1
+kind: Certificate
+status:
+  conditions:
+  - {type: Ready, status: "True", message: Certificate is up to date}
+`, cluster.ReadinessCurrent},
+		"not ready condition": {`
+apiVersion: cert-manager.io/v1
+kind: Certificate
+status:
+  conditions:
+  - {type: Ready, status: "False", reason: Issuing}
+`, cluster.ReadinessInProgress},
+		"stalled condition": {`
+apiVersion: example.com/v1
+kind: Widget
+status:
+  conditions:
+  - {type: Ready, status: "False"}
+  - {type: Stalled, status: "True", message: invalid spec}
+`, cluster.ReadinessFailed},
+		"job failed": {`
+apiVersion: batch/v1
+kind: Job
+status:
+  conditions:
+  - {type: Failed, status: "True", reason: BackoffLimitExceeded}
+`, cluster.ReadinessFailed},
+		"job running": {`
+apiVersion: batch/v1
+kind: Job
+status: {active: 1}
+`, cluster.ReadinessInProgress},
+		"helmrelease deployed": {`
+apiVersion: helm.fluxcd.io/v1
+kind: HelmRelease
+status: {phase: Deployed}
+`, cluster.ReadinessCurrent},
+		"helmrelease failed": {`
+apiVersion: helm.fluxcd.io/v1
+kind: HelmRelease
+status: {phase: ChartFetchFailed}
+`, cluster.ReadinessFailed},
+		"helmrelease v2 upgrade failed": {`
+apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+status:
+  conditions:
+  - {type: Ready, status: "False", reason: UpgradeFailed}
+`, cluster.ReadinessFailed},
+		"helmrelease v2 ready": {`
+apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+status:
+  conditions:
+  - {type: Ready, status: "True", reason: UpgradeSucceeded}
+`, cluster.ReadinessCurrent},
+		"load balancer pending": {`
+apiVersion: v1
+kind: Service
+spec: {type: LoadBalancer}
+`, cluster.ReadinessInProgress},
+	} {
+		// go through JSON, so numbers come out as int64 as they
+		// would from the API server
+		js, err := yaml.YAMLToJSON([]byte(c.manifest))
+		require.NoError(t, err, name)
+		obj := &unstructured.Unstructured{}
+		require.NoError(t, obj.UnmarshalJSON(js), name)
+		readiness := ComputeReadiness(obj)
+		assert.Equal(t, c.status, readiness.Status, "%s: %s", name, readiness.Message)
+	}
+}
+
+func TestReadinessOfTypedObject(t *testing.T) {
+	replicas := int32(1)
+	d := &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "podinfo", Generation: 1},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+		Status: appsv1.DeploymentStatus{
+			ObservedGeneration: 1,
+			Replicas:           1,
+			UpdatedReplicas:    1,
+			ReadyReplicas:      1,
+			AvailableReplicas:  1,
+		},
+	}
+	assert.Equal(t, cluster.ReadinessCurrent, readinessOf(d).Status)
+}
@@ -221,8 +221,11 @@ func unmarshalKind(base baseObject, bytes []byte) (KubeManifest, error) {
 		// assumption it is unlikely to happen.
 		return nil, nil
 	// The remainder are things we have to care about, but not
-	// treat specially
+	// treat specially, unless they're registered workload kinds
 	default:
+		if kind, ok := workloadKindFor(base); ok {
+			return unmarshalCustomWorkload(base, kind, bytes)
+		}
 		return &base, nil
 	}
 }
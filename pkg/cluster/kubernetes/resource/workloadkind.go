@@ -0,0 +1,618 @@
+package resource
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	jsonyaml "github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
+
+	"github.com/fluxcd/flux/pkg/image"
+	"github.com/fluxcd/flux/pkg/resource"
+)
+
+// WorkloadKind describes a kind of resource that isn't built in, but
+// runs containers -- an Argo Rollout, a Knative Service, or an
+// in-house custom resource, say -- well enough that it can be treated
+// as a workload: listed, automated, and have its rollout reported.
+//
+// The paths are JSONPath expressions, e.g., `.spec.template.spec`,
+// limited to field names and list indices, where an index of `*`
+// means every item. The surrounding braces are optional.
+type WorkloadKind struct {
+	// APIVersion is the group and version of the kind, e.g.,
+	// `argoproj.io/v1alpha1`. The version is used when getting
+	// resources from the cluster; manifests of any version in the
+	// group are treated as workloads.
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	// PodSpec is the path to a pod spec, if the kind has one. Its
+	// containers and init containers are the workload's containers,
+	// unless Containers is given, and its service account and image
+	// pull secrets are used to fetch image metadata.
+	PodSpec string `yaml:"podSpec,omitempty"`
+	// Containers are paths to lists of containers, or to single
+	// containers, each with a name and an image.
+	Containers []string `yaml:"containers,omitempty"`
+	// Rollout gives the paths to the fields reporting the progress
+	// of a rollout; any not given are treated as zero.
+	Rollout RolloutPaths `yaml:"rollout,omitempty"`
+
+	podSpec    fieldPath
+	containers []fieldPath
+}
+
+// RolloutPaths are the paths, within a resource, to the fields that
+// report how a rollout is going; the numbers are replicas.
+type RolloutPaths struct {
+	// ObservedGeneration is the generation of the resource last
+	// acted on by its controller. If it's not given, the status of
+	// the workload is always ready.
+	ObservedGeneration string `yaml:"observedGeneration,omitempty"`
+	Desired            string `yaml:"desired,omitempty"`
+	Updated            string `yaml:"updated,omitempty"`
+	Ready              string `yaml:"ready,omitempty"`
+	// Available defaults to the same as Ready, for kinds that don't
+	// distinguish them.
+	Available string `yaml:"available,omitempty"`
+	// Total is all the replicas, updated or not, from which the
+	// number outdated is worked out.
+	Total string `yaml:"total,omitempty"`
+}
+
+// WorkloadKindsConfig is the format of the file listing workload
+// kinds, e.g.,
+//
+//	workloadKinds:
+//	- apiVersion: argoproj.io/v1alpha1
+//	  kind: Rollout
+//	  podSpec: .spec.template.spec
+//	  rollout:
+//	    observedGeneration: .status.observedGeneration
+//	    desired: .spec.replicas
+//	    ...
+type WorkloadKindsConfig struct {
+	WorkloadKinds []WorkloadKind `yaml:"workloadKinds"`
+}
+
+// ReadWorkloadKinds reads the workload kinds listed in the file at
+// the path given.
+func ReadWorkloadKinds(path string) ([]WorkloadKind, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading workload kinds")
+	}
+	defer f.Close()
+	return ParseWorkloadKinds(f)
+}
+
+// ParseWorkloadKinds parses and checks a list of workload kinds, in
+// the format of WorkloadKindsConfig.
+func ParseWorkloadKinds(r io.Reader) ([]WorkloadKind, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var config WorkloadKindsConfig
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, errors.Wrap(err, "parsing workload kinds")
+	}
+	for i := range config.WorkloadKinds {
+		if err := config.WorkloadKinds[i].compile(); err != nil {
+			return nil, err
+		}
+	}
+	return config.WorkloadKinds, nil
+}
+
+// Group gives the API group of the kind.
+func (k *WorkloadKind) Group() string {
+	if i := strings.Index(k.APIVersion, "/"); i >= 0 {
+		return k.APIVersion[:i]
+	}
+	return ""
+}
+
+func (k *WorkloadKind) compile() error {
+	fail := func(err error) error {
+		return errors.Wrapf(err, "workload kind %s %s", k.APIVersion, k.Kind)
+	}
+	if k.Kind == "" || k.APIVersion == "" {
+		return fail(errors.New("apiVersion and kind must both be given"))
+	}
+	if k.PodSpec == "" && len(k.Containers) == 0 {
+		return fail(errors.New("one of podSpec or containers must be given"))
+	}
+	var err error
+	if k.PodSpec != "" {
+		if k.podSpec, err = parseFieldPath(k.PodSpec); err != nil {
+			return fail(err)
+		}
+	}
+	k.containers = nil
+	paths := k.Containers
+	if len(paths) == 0 {
+		paths = []string{k.PodSpec + ".initContainers", k.PodSpec + ".containers"}
+	}
+	for _, p := range paths {
+		path, err := parseFieldPath(p)
+		if err != nil {
+			return fail(err)
+		}
+		k.containers = append(k.containers, path)
+	}
+	r := k.Rollout
+	for _, p := range []string{r.ObservedGeneration, r.Desired, r.Updated, r.Ready, r.Available, r.Total} {
+		if p == "" {
+			continue
+		}
+		if _, err := parseFieldPath(p); err != nil {
+			return fail(err)
+		}
+	}
+	return nil
+}
+
+// -- registry
+
+// builtinKinds are the kinds given their own types here, which
+// cannot be registered as workload kinds.
+var builtinKinds = map[string]bool{
+	"cronjob":     true,
+	"daemonset":   true,
+	"deployment":  true,
+	"statefulset": true,
+	"helmrelease": true,
+	"namespace":   true,
+}
+
+// workloadKinds are the registered workload kinds, by lower-case
+// kind, since that's all a resource ID has to go on.
+var workloadKinds = map[string]*WorkloadKind{}
+
+// RegisterWorkloadKind makes manifests of the kind given be parsed
+// as workloads. Since resource IDs don't include the API group, a
+// kind can be registered only once, and not if it's built in.
+func RegisterWorkloadKind(kind WorkloadKind) (*WorkloadKind, error) {
+	if err := kind.compile(); err != nil {
+		return nil, err
+	}
+	key := strings.ToLower(kind.Kind)
+	if builtinKinds[key] || strings.HasSuffix(key, "list") {
+		return nil, fmt.Errorf("workload kind %s is built in, and cannot be registered", kind.Kind)
+	}
+	if existing, ok := workloadKinds[key]; ok {
+		return nil, fmt.Errorf("workload kind %s is already registered, for %s", kind.Kind, existing.APIVersion)
+	}
+	workloadKinds[key] = &kind
+	return &kind, nil
+}
+
+// UnregisterWorkloadKind removes a registered workload kind; it's
+// for tests.
+func UnregisterWorkloadKind(kind string) {
+	delete(workloadKinds, strings.ToLower(kind))
+}
+
+// LookupWorkloadKind gives the registered workload kind for the kind
+// (of any case) given, if there is one.
+func LookupWorkloadKind(kind string) (*WorkloadKind, bool) {
+	k, ok := workloadKinds[strings.ToLower(kind)]
+	return k, ok
+}
+
+func workloadKindFor(base baseObject) (*WorkloadKind, bool) {
+	k, ok := LookupWorkloadKind(base.Kind)
+	if !ok || k.Kind != base.Kind {
+		return nil, false
+	}
+	group := ""
+	if i := strings.Index(base.APIVersion, "/"); i >= 0 {
+		group = base.APIVersion[:i]
+	}
+	return k, group == k.Group()
+}
+
+// -- workloads of a registered kind
+
+// CustomWorkload is a resource of a registered WorkloadKind.
+type CustomWorkload struct {
+	baseObject
+	kind   *WorkloadKind
+	object map[string]interface{}
+}
+
+func unmarshalCustomWorkload(base baseObject, kind *WorkloadKind, data []byte) (*CustomWorkload, error) {
+	w := CustomWorkload{baseObject: base, kind: kind}
+	// ghodss/yaml gives map[string]interface{}, as from JSON,
+	// rather than map[interface{}]interface{}
+	if err := jsonyaml.Unmarshal(data, &w.object); err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// WorkloadKind gives the registered kind of the workload.
+func (w *CustomWorkload) WorkloadKind() *WorkloadKind {
+	return w.kind
+}
+
+func (w *CustomWorkload) Containers() []resource.Container {
+	var result []resource.Container
+	w.kind.EachContainer(w.object, func(c map[string]interface{}) bool {
+		name, _ := c["name"].(string)
+		im, _ := c["image"].(string)
+		ref, _ := image.ParseRef(im)
+		result = append(result, resource.Container{Name: name, Image: ref})
+		return true
+	})
+	return result
+}
+
+func (w *CustomWorkload) SetContainerImage(container string, ref image.Ref) error {
+	found := false
+	w.kind.EachContainer(w.object, func(c map[string]interface{}) bool {
+		if c["name"] == container {
+			c["image"] = ref.String()
+			found = true
+			return false
+		}
+		return true
+	})
+	if !found {
+		return fmt.Errorf("container %q not found in workload", container)
+	}
+	return nil
+}
+
+var _ resource.Workload = &CustomWorkload{}
+
+// EachContainer calls fn with each container in the object given,
+// as decoded from JSON, until fn returns false.
+func (k *WorkloadKind) EachContainer(obj map[string]interface{}, fn func(map[string]interface{}) bool) {
+	for _, path := range k.containers {
+		for _, found := range path.find(obj) {
+			switch v := found.(type) {
+			case map[string]interface{}:
+				if !fn(v) {
+					return
+				}
+			case []interface{}:
+				for _, item := range v {
+					if c, ok := item.(map[string]interface{}); ok && !fn(c) {
+						return
+					}
+				}
+			}
+		}
+	}
+}
+
+// FindPodSpec gives the pod spec in the object given, as decoded from
+// JSON, if the kind has one.
+func (k *WorkloadKind) FindPodSpec(obj map[string]interface{}) (map[string]interface{}, bool) {
+	if k.podSpec == nil {
+		return nil, false
+	}
+	for _, found := range k.podSpec.find(obj) {
+		if spec, ok := found.(map[string]interface{}); ok {
+			return spec, true
+		}
+	}
+	return nil, false
+}
+
+// FindInt gives the number at the path given, in the object given,
+// as decoded from JSON. An empty path, or a path to nothing, gives
+// zero.
+func FindInt(obj map[string]interface{}, path string) int64 {
+	if path == "" {
+		return 0
+	}
+	p, err := parseFieldPath(path)
+	if err != nil {
+		return 0
+	}
+	for _, found := range p.find(obj) {
+		switch v := found.(type) {
+		case int64:
+			return v
+		case float64:
+			return int64(v)
+		case int:
+			return int64(v)
+		}
+	}
+	return 0
+}
+
+// -- paths
+
+// fieldPath is a parsed path; each element is a field name, or an
+// index in a list (given as a number, or `*` for all).
+type fieldPath []pathElem
+
+type pathElem struct {
+	field string
+	index int // only if field == ""; -1 means all
+}
+
+func parseFieldPath(s string) (fieldPath, error) {
+	orig := s
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+		s = s[1 : len(s)-1]
+	}
+	s = strings.TrimPrefix(s, "$")
+	var path fieldPath
+	for s != "" {
+		switch s[0] {
+		case '.':
+			s = s[1:]
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("path %q: empty field name", orig)
+			}
+			path = append(path, pathElem{field: s[:end]})
+			s = s[end:]
+		case '[':
+			end := strings.Index(s, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("path %q: unclosed [", orig)
+			}
+			index := s[1:end]
+			s = s[end+1:]
+			if index == "*" {
+				path = append(path, pathElem{index: -1})
+				continue
+			}
+			i, err := strconv.Atoi(index)
+			if err != nil || i < 0 {
+				return nil, fmt.Errorf("path %q: index must be a number or *", orig)
+			}
+			path = append(path, pathElem{index: i})
+		default:
+			return nil, fmt.Errorf("path %q: expected . or [", orig)
+		}
+	}
+	if len(path) == 0 {
+		return nil, fmt.Errorf("path %q is empty", orig)
+	}
+	return path, nil
+}
+
+// find gives the values at the path in the object given, as decoded
+// from JSON.
+func (p fieldPath) find(obj interface{}) []interface{} {
+	if len(p) == 0 {
+		return []interface{}{obj}
+	}
+	elem, rest := p[0], p[1:]
+	if elem.field != "" {
+		m, ok := obj.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v, ok := m[elem.field]
+		if !ok {
+			return nil
+		}
+		return rest.find(v)
+	}
+	list, ok := obj.([]interface{})
+	if !ok {
+		return nil
+	}
+	if elem.index >= 0 {
+		if elem.index >= len(list) {
+			return nil
+		}
+		return rest.find(list[elem.index])
+	}
+	var result []interface{}
+	for _, item := range list {
+		result = append(result, rest.find(item)...)
+	}
+	return result
+}
+
+// -- updating manifests
+
+// SetCustomWorkloadContainerImage sets the image of the container
+// named, in the workload of a registered kind given by namespace,
+// kind and name, in the YAML document stream given. Only the image
+// value itself is changed, so that comments and formatting are left
+// as they are. A document without a namespace is taken to be in
+// whichever namespace is asked for, since it's the namespacer that
+// decides which one it'd end up in.
+func SetCustomWorkloadContainerImage(in []byte, namespace, kind, name, container, image string) ([]byte, error) {
+	k, ok := LookupWorkloadKind(kind)
+	if !ok {
+		return nil, fmt.Errorf("kind %s is not a registered workload kind", kind)
+	}
+	decoder := yamlv3.NewDecoder(bytes.NewReader(in))
+	for {
+		var doc yamlv3.Node
+		if err := decoder.Decode(&doc); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, errors.Wrap(err, "parsing YAML")
+		}
+		for _, obj := range documentObjects(&doc) {
+			if !nodeMatches(obj, k, namespace, name) {
+				continue
+			}
+			for _, path := range k.containers {
+				for _, c := range nodeContainers(path.findNode(obj)) {
+					if nodeField(c, "name") != container {
+						continue
+					}
+					imageNode := nodeFieldNode(c, "image")
+					if imageNode == nil {
+						return nil, fmt.Errorf("container %q has no image", container)
+					}
+					return replaceScalar(in, imageNode, image)
+				}
+			}
+			return nil, fmt.Errorf("container %q not found in workload", container)
+		}
+	}
+	return nil, fmt.Errorf("resource %s:%s/%s not found", namespace, strings.ToLower(kind), name)
+}
+
+// documentObjects gives the top-level object in a document, or if
+// it's a list, the objects in that.
+func documentObjects(doc *yamlv3.Node) []*yamlv3.Node {
+	if doc.Kind != yamlv3.DocumentNode || len(doc.Content) == 0 {
+		return nil
+	}
+	obj := doc.Content[0]
+	if strings.HasSuffix(nodeField(obj, "kind"), "List") {
+		if items := nodeFieldNode(obj, "items"); items != nil && items.Kind == yamlv3.SequenceNode {
+			return items.Content
+		}
+	}
+	return []*yamlv3.Node{obj}
+}
+
+func nodeMatches(obj *yamlv3.Node, kind *WorkloadKind, namespace, name string) bool {
+	if nodeField(obj, "kind") != kind.Kind {
+		return false
+	}
+	apiVersion := nodeField(obj, "apiVersion")
+	if i := strings.Index(apiVersion, "/"); i < 0 || apiVersion[:i] != kind.Group() {
+		return false
+	}
+	meta := nodeFieldNode(obj, "metadata")
+	if meta == nil || nodeField(meta, "name") != name {
+		return false
+	}
+	ns := nodeField(meta, "namespace")
+	return ns == "" || ns == namespace || namespace == ClusterScope
+}
+
+// nodeFieldNode gives the value of the field in the mapping node
+// given, or nil if it's not a mapping or has no such field.
+func nodeFieldNode(n *yamlv3.Node, field string) *yamlv3.Node {
+	if n == nil || n.Kind != yamlv3.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == field {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func nodeField(n *yamlv3.Node, field string) string {
+	if v := nodeFieldNode(n, field); v != nil && v.Kind == yamlv3.ScalarNode {
+		return v.Value
+	}
+	return ""
+}
+
+func nodeContainers(found []*yamlv3.Node) []*yamlv3.Node {
+	var result []*yamlv3.Node
+	for _, n := range found {
+		switch n.Kind {
+		case yamlv3.MappingNode:
+			result = append(result, n)
+		case yamlv3.SequenceNode:
+			for _, item := range n.Content {
+				if item.Kind == yamlv3.MappingNode {
+					result = append(result, item)
+				}
+			}
+		}
+	}
+	return result
+}
+
+// findNode is find for YAML nodes.
+func (p fieldPath) findNode(n *yamlv3.Node) []*yamlv3.Node {
+	if n == nil {
+		return nil
+	}
+	if n.Kind == yamlv3.AliasNode {
+		n = n.Alias
+	}
+	if len(p) == 0 {
+		return []*yamlv3.Node{n}
+	}
+	elem, rest := p[0], p[1:]
+	if elem.field != "" {
+		return rest.findNode(nodeFieldNode(n, elem.field))
+	}
+	if n.Kind != yamlv3.SequenceNode {
+		return nil
+	}
+	if elem.index >= 0 {
+		if elem.index >= len(n.Content) {
+			return nil
+		}
+		return rest.findNode(n.Content[elem.index])
+	}
+	var result []*yamlv3.Node
+	for _, item := range n.Content {
+		result = append(result, rest.findNode(item)...)
+	}
+	return result
+}
+
+// replaceScalar replaces the text of the scalar node given, which
+// must be on a single line, with the value given, quoted in the same
+// style.
+func replaceScalar(in []byte, n *yamlv3.Node, value string) ([]byte, error) {
+	if n.Kind != yamlv3.ScalarNode {
+		return nil, errors.New("expected a string value")
+	}
+	start := 0
+	for line := 1; line < n.Line; line++ {
+		i := bytes.IndexByte(in[start:], '\n')
+		if i < 0 {
+			return nil, errors.New("value is beyond the end of the input")
+		}
+		start += i + 1
+	}
+	// columns count characters, not bytes
+	lineEnd := bytes.IndexByte(in[start:], '\n')
+	if lineEnd < 0 {
+		lineEnd = len(in) - start
+	}
+	runes := []rune(string(in[start : start+lineEnd]))
+	if n.Column-1 > len(runes) {
+		return nil, errors.New("value is beyond the end of its line")
+	}
+	start += len(string(runes[:n.Column-1]))
+
+	var text, replacement string
+	switch n.Style {
+	case 0:
+		text, replacement = n.Value, value
+	case yamlv3.DoubleQuotedStyle:
+		text, replacement = strconv.Quote(n.Value), strconv.Quote(value)
+	case yamlv3.SingleQuotedStyle:
+		text, replacement = "'"+strings.Replace(n.Value, "'", "''", -1)+"'", "'"+strings.Replace(value, "'", "''", -1)+"'"
+	default:
+		return nil, errors.New("cannot update a value spanning lines")
+	}
+	if !bytes.HasPrefix(in[start:], []byte(text)) {
+		return nil, fmt.Errorf("could not find %s in the input at line %d", text, n.Line)
+	}
+	out := make([]byte, 0, len(in)-len(text)+len(replacement))
+	out = append(out, in[:start]...)
+	out = append(out, replacement...)
+	return append(out, in[start+len(text):]...), nil
+}
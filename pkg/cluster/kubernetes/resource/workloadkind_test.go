@@ -0,0 +1,150 @@
+package resource
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fluxcd/flux/pkg/image"
+)
+
+const workloadKindsConfig = `
+workloadKinds:
+- apiVersion: argoproj.io/v1alpha1
+  kind: Rollout
+  podSpec: .spec.template.spec
+  rollout:
+    observedGeneration: .status.observedGeneration
+    desired: .spec.replicas
+    updated: .status.updatedReplicas
+- apiVersion: example.com/v1
+  kind: Sidecar
+  containers:
+  - '{.spec.main}'
+  - .spec.extras[*].container
+`
+
+const rolloutManifest = `---
+apiVersion: argoproj.io/v1alpha1
+kind: Rollout
+metadata:
+  name: podinfo
+  namespace: demo
+spec:
+  replicas: 2
+  template:
+    spec:
+      initContainers:
+      - name: init
+        image: busybox:1.31
+      containers:
+      - name: podinfo
+        # keep this comment
+        image: "stefanprodan/podinfo:3.1.0" # and this
+---
+apiVersion: example.com/v1
+kind: Sidecar
+metadata:
+  name: helper
+spec:
+  main:
+    name: main
+    image: 'example/main:1'
+  extras:
+  - container: {name: extra, image: example/extra:1}
+`
+
+func registerTestKinds(t *testing.T) func() {
+	kinds, err := ParseWorkloadKinds(strings.NewReader(workloadKindsConfig))
+	require.NoError(t, err)
+	for _, k := range kinds {
+		_, err := RegisterWorkloadKind(k)
+		require.NoError(t, err)
+	}
+	return func() {
+		for _, k := range kinds {
+			UnregisterWorkloadKind(k.Kind)
+		}
+	}
+}
+
+func TestParseWorkloadKinds_Errors(t *testing.T) {
+	for name, config := range map[string]string{
+		"no kind":       "workloadKinds: [{apiVersion: example.com/v1, podSpec: .spec}]",
+		"no containers": "workloadKinds: [{apiVersion: example.com/v1, kind: Foo}]",
+		"bad path":      "workloadKinds: [{apiVersion: example.com/v1, kind: Foo, podSpec: 'spec..template'}]",
+		"bad index":     "workloadKinds: [{apiVersion: example.com/v1, kind: Foo, containers: ['.spec[first]']}]",
+		"unknown field": "workloadKinds: [{apiVersion: example.com/v1, kind: Foo, podSpec: .spec, pods: .spec}]",
+	} {
+		_, err := ParseWorkloadKinds(strings.NewReader(config))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestRegisterWorkloadKind(t *testing.T) {
+	defer registerTestKinds(t)()
+	_, err := RegisterWorkloadKind(WorkloadKind{APIVersion: "example.org/v1", Kind: "Rollout", PodSpec: ".spec"})
+	assert.Error(t, err, "a kind can only be registered once")
+	_, err = RegisterWorkloadKind(WorkloadKind{APIVersion: "apps/v1", Kind: "Deployment", PodSpec: ".spec.template.spec"})
+	assert.Error(t, err, "built-in kinds cannot be registered")
+}
+
+func TestParseCustomWorkload(t *testing.T) {
+	defer registerTestKinds(t)()
+
+	objs, err := ParseMultidoc([]byte(rolloutManifest), "test")
+	require.NoError(t, err)
+
+	rollout, ok := objs["demo:rollout/podinfo"].(*CustomWorkload)
+	require.True(t, ok, "expected a Rollout to be parsed as a workload")
+	containers := rollout.Containers()
+	if assert.Len(t, containers, 2) {
+		assert.Equal(t, "init", containers[0].Name)
+		assert.Equal(t, "podinfo", containers[1].Name)
+		assert.Equal(t, "stefanprodan/podinfo:3.1.0", containers[1].Image.String())
+	}
+	ref, _ := image.ParseRef("stefanprodan/podinfo:3.2.0")
+	assert.NoError(t, rollout.SetContainerImage("podinfo", ref))
+	assert.Equal(t, ref, rollout.Containers()[1].Image)
+	assert.Error(t, rollout.SetContainerImage("missing", ref))
+
+	sidecar, ok := objs["<cluster>:sidecar/helper"].(*CustomWorkload)
+	require.True(t, ok, "expected a Sidecar to be parsed as a workload")
+	containers = sidecar.Containers()
+	if assert.Len(t, containers, 2) {
+		assert.Equal(t, "main", containers[0].Name)
+		assert.Equal(t, "extra", containers[1].Name)
+	}
+
+	// the group must match for the manifest to be a workload
+	objs, err = ParseMultidoc([]byte("apiVersion: other.io/v1\nkind: Rollout\nmetadata: {name: other}\n"), "test")
+	require.NoError(t, err)
+	_, ok = objs["<cluster>:rollout/other"].(*CustomWorkload)
+	assert.False(t, ok)
+}
+
+func TestSetCustomWorkloadContainerImage(t *testing.T) {
+	defer registerTestKinds(t)()
+
+	out, err := SetCustomWorkloadContainerImage([]byte(rolloutManifest), "demo", "rollout", "podinfo", "podinfo", "stefanprodan/podinfo:3.2.0")
+	require.NoError(t, err)
+	expected := strings.Replace(rolloutManifest, `"stefanprodan/podinfo:3.1.0"`, `"stefanprodan/podinfo:3.2.0"`, 1)
+	assert.Equal(t, expected, string(out))
+
+	out, err = SetCustomWorkloadContainerImage([]byte(rolloutManifest), "default", "sidecar", "helper", "extra", "example/extra:2")
+	require.NoError(t, err)
+	expected = strings.Replace(rolloutManifest, "image: example/extra:1}", "image: example/extra:2}", 1)
+	assert.Equal(t, expected, string(out))
+
+	out, err = SetCustomWorkloadContainerImage([]byte(rolloutManifest), "default", "sidecar", "helper", "main", "example/it's:2")
+	require.NoError(t, err)
+	expected = strings.Replace(rolloutManifest, "'example/main:1'", "'example/it''s:2'", 1)
+	assert.Equal(t, expected, string(out))
+
+	_, err = SetCustomWorkloadContainerImage([]byte(rolloutManifest), "demo", "rollout", "podinfo", "missing", "foo:1")
+	assert.Error(t, err)
+	_, err = SetCustomWorkloadContainerImage([]byte(rolloutManifest), "other", "rollout", "podinfo", "podinfo", "foo:1")
+	assert.Error(t, err)
+}
@@ -8,7 +8,12 @@ import (
 	apiapps "k8s.io/api/apps/v1"
 	apibatch "k8s.io/api/batch/v1beta1"
 	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
 
 	"github.com/fluxcd/flux/pkg/cluster"
 	kresource "github.com/fluxcd/flux/pkg/cluster/kubernetes/resource"
@@ -25,6 +30,14 @@ import (
 // `resource.ID`.
 const AntecedentAnnotation = hr_v1.AntecedentAnnotation
 
+// The Helm controller doesn't annotate the resources it creates, but
+// labels them with the name and namespace of the v2 HelmRelease
+// responsible.
+const (
+	helmReleaseV2NameLabel      = HelmReleaseV2Group + "/name"
+	helmReleaseV2NamespaceLabel = HelmReleaseV2Group + "/namespace"
+)
+
 /////////////////////////////////////////////////////////////////////////////
 // Kind registry
 
@@ -81,6 +94,8 @@ func (w workload) toClusterWorkload(resourceID resource.ID) cluster.Workload {
 		if err == nil {
 			antecedent = id
 		}
+	} else if name, ok := w.GetLabels()[helmReleaseV2NameLabel]; ok {
+		antecedent = resource.MakeID(w.GetLabels()[helmReleaseV2NamespaceLabel], "HelmRelease", name)
 	}
 
 	var policies policy.Set
@@ -99,6 +114,7 @@ func (w workload) toClusterWorkload(resourceID resource.ID) cluster.Workload {
 		ID:         resourceID,
 		Status:     w.status,
 		Rollout:    w.rollout,
+		Readiness:  readinessOf(w.k8sObject),
 		SyncError:  w.syncError,
 		Antecedent: antecedent,
 		Labels:     w.GetLabels(),
@@ -156,6 +172,18 @@ func deploymentErrors(d *apiapps.Deployment) []string {
 	return errs
 }
 
+func (dk *deploymentKind) groupKinds() []schema.GroupKind {
+	return []schema.GroupKind{{Group: "apps", Kind: "Deployment"}}
+}
+
+func (dk *deploymentKind) fromUnstructured(obj *unstructured.Unstructured) (workload, error) {
+	var deployment apiapps.Deployment
+	if err := fromUnstructured(obj, &deployment); err != nil {
+		return workload{}, err
+	}
+	return makeDeploymentWorkload(&deployment), nil
+}
+
 func makeDeploymentWorkload(deployment *apiapps.Deployment) workload {
 	var status string
 	objectMeta, deploymentStatus := deployment.ObjectMeta, deployment.Status
@@ -224,6 +252,18 @@ func (dk *daemonSetKind) getWorkloads(ctx context.Context, c *Cluster, namespace
 	return workloads, nil
 }
 
+func (dk *daemonSetKind) groupKinds() []schema.GroupKind {
+	return []schema.GroupKind{{Group: "apps", Kind: "DaemonSet"}}
+}
+
+func (dk *daemonSetKind) fromUnstructured(obj *unstructured.Unstructured) (workload, error) {
+	var daemonSet apiapps.DaemonSet
+	if err := fromUnstructured(obj, &daemonSet); err != nil {
+		return workload{}, err
+	}
+	return makeDaemonSetWorkload(&daemonSet), nil
+}
+
 func makeDaemonSetWorkload(daemonSet *apiapps.DaemonSet) workload {
 	var status string
 	objectMeta, daemonSetStatus := daemonSet.ObjectMeta, daemonSet.Status
@@ -291,6 +331,18 @@ func (dk *statefulSetKind) getWorkloads(ctx context.Context, c *Cluster, namespa
 	return workloads, nil
 }
 
+func (dk *statefulSetKind) groupKinds() []schema.GroupKind {
+	return []schema.GroupKind{{Group: "apps", Kind: "StatefulSet"}}
+}
+
+func (dk *statefulSetKind) fromUnstructured(obj *unstructured.Unstructured) (workload, error) {
+	var statefulSet apiapps.StatefulSet
+	if err := fromUnstructured(obj, &statefulSet); err != nil {
+		return workload{}, err
+	}
+	return makeStatefulSetWorkload(&statefulSet), nil
+}
+
 func makeStatefulSetWorkload(statefulSet *apiapps.StatefulSet) workload {
 	var status string
 	objectMeta, statefulSetStatus := statefulSet.ObjectMeta, statefulSet.Status
@@ -390,6 +442,20 @@ func (dk *cronJobKind) getWorkloads(ctx context.Context, c *Cluster, namespace s
 	return workloads, nil
 }
 
+func (dk *cronJobKind) groupKinds() []schema.GroupKind {
+	return []schema.GroupKind{{Group: "batch", Kind: "CronJob"}}
+}
+
+// fromUnstructured makes a workload from a CronJob in whichever
+// version is watched; the job template is the same in all of them.
+func (dk *cronJobKind) fromUnstructured(obj *unstructured.Unstructured) (workload, error) {
+	var cronJob apibatch.CronJob
+	if err := fromUnstructured(obj, &cronJob); err != nil {
+		return workload{}, err
+	}
+	return makeCronJobWorkload(&cronJob), nil
+}
+
 func makeCronJobWorkload(cronJob *apibatch.CronJob) workload {
 	cronJob.APIVersion = "batch/v1beta1"
 	cronJob.Kind = "CronJob"
@@ -400,15 +466,28 @@ func makeCronJobWorkload(cronJob *apibatch.CronJob) workload {
 }
 
 /////////////////////////////////////////////////////////////////////////////
-// flux.weave.works/v1beta1 HelmRelease
+// helm.fluxcd.io/v1 and helm.toolkit.fluxcd.io/v2 HelmRelease
 
 type helmReleaseKind struct{}
 
-// getWorkload attempts to resolve a HelmRelease
+// getWorkload attempts to resolve a HelmRelease, looking for a v2
+// HelmRelease first, since that's the one that will remain once
+// migrated.
 func (hr *helmReleaseKind) getWorkload(ctx context.Context, c *Cluster, namespace, name string) (workload, error) {
 	if err := ctx.Err(); err != nil {
 		return workload{}, err
 	}
+	if client, err := helmReleaseV2Client(c, namespace); err == nil {
+		helmRelease, err := client.Get(ctx, name, meta_v1.GetOptions{})
+		if err == nil {
+			return makeHelmReleaseV2Workload(helmRelease), nil
+		}
+		if !apierrors.IsNotFound(err) {
+			return workload{}, err
+		}
+	} else if !apierrors.IsNotFound(err) {
+		return workload{}, err
+	}
 	if helmRelease, err := c.client.HelmV1().HelmReleases(namespace).Get(name, meta_v1.GetOptions{}); err == nil {
 		return makeHelmReleaseStableWorkload(helmRelease), err
 	} else {
@@ -416,26 +495,64 @@ func (hr *helmReleaseKind) getWorkload(ctx context.Context, c *Cluster, namespac
 	}
 }
 
-// getWorkloads collects v1 HelmRelease workloads
+// getWorkloads collects v2 and v1 HelmRelease workloads; where there
+// are both for the same name, the v2 HelmRelease is used. Either API
+// may be missing, but not both.
 func (hr *helmReleaseKind) getWorkloads(ctx context.Context, c *Cluster, namespace string) ([]workload, error) {
 	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
 	names := make(map[string]bool, 0)
 	workloads := make([]workload, 0)
+
+	client, v2Err := helmReleaseV2Client(c, namespace)
+	if v2Err == nil {
+		var helmReleases *unstructured.UnstructuredList
+		if helmReleases, v2Err = client.List(ctx, meta_v1.ListOptions{}); v2Err == nil {
+			for i := range helmReleases.Items {
+				workload := makeHelmReleaseV2Workload(&helmReleases.Items[i])
+				workloads = append(workloads, workload)
+				names[workload.GetNamespace()+"/"+workload.GetName()] = true
+			}
+		}
+	}
+	if v2Err != nil && !apierrors.IsNotFound(v2Err) {
+		return nil, v2Err
+	}
+
 	if helmReleases, err := c.client.HelmV1().HelmReleases(namespace).List(meta_v1.ListOptions{}); err == nil {
 		for i, _ := range helmReleases.Items {
 			workload := makeHelmReleaseStableWorkload(&helmReleases.Items[i])
+			if names[workload.GetNamespace()+"/"+workload.GetName()] {
+				continue
+			}
 			workloads = append(workloads, workload)
-			names[workload.GetName()] = true
 		}
-	} else {
+	} else if v2Err != nil || !apierrors.IsNotFound(err) {
 		return nil, err
 	}
 
 	return workloads, nil
 }
 
+func (hr *helmReleaseKind) groupKinds() []schema.GroupKind {
+	return []schema.GroupKind{
+		{Group: HelmReleaseV2Group, Kind: "HelmRelease"},
+		{Group: "helm.fluxcd.io", Kind: "HelmRelease"},
+	}
+}
+
+func (hr *helmReleaseKind) fromUnstructured(obj *unstructured.Unstructured) (workload, error) {
+	if obj.GroupVersionKind().Group == HelmReleaseV2Group {
+		return makeHelmReleaseV2Workload(obj), nil
+	}
+	var helmRelease hr_v1.HelmRelease
+	if err := fromUnstructured(obj, &helmRelease); err != nil {
+		return workload{}, err
+	}
+	return makeHelmReleaseStableWorkload(&helmRelease), nil
+}
+
 func makeHelmReleaseStableWorkload(helmRelease *hr_v1.HelmRelease) workload {
 	containers := createK8sHRContainers(helmRelease.ObjectMeta.Annotations, helmRelease.GetValues())
 
@@ -456,6 +573,79 @@ func makeHelmReleaseStableWorkload(helmRelease *hr_v1.HelmRelease) workload {
 	}
 }
 
+// HelmReleaseV2Group is the API group of the HelmRelease custom
+// resource used by the Helm controller, which supersedes the Helm
+// operator's helm.fluxcd.io.
+const HelmReleaseV2Group = "helm.toolkit.fluxcd.io"
+
+// helmReleaseV2Versions are the versions of HelmReleaseV2Group we
+// know how to read, most preferred first. The values and annotations
+// are in the same place in all of them.
+var helmReleaseV2Versions = []string{"v2", "v2beta2", "v2beta1"}
+
+// helmReleaseV2Client gives a client for the most preferred version
+// of the v2 HelmRelease API served, or a NotFound error if none is.
+func helmReleaseV2Client(c *Cluster, namespace string) (dynamic.ResourceInterface, error) {
+	for _, version := range helmReleaseV2Versions {
+		gv := schema.GroupVersion{Group: HelmReleaseV2Group, Version: version}
+		resources, err := c.client.discoveryClient.ServerResourcesForGroupVersion(gv.String())
+		if err != nil {
+			if apierrors.IsForbidden(err) {
+				return nil, err
+			}
+			continue
+		}
+		for _, r := range resources.APIResources {
+			if r.Kind == "HelmRelease" && !strings.Contains(r.Name, "/") {
+				return c.client.dynamicClient.Resource(gv.WithResource(r.Name)).Namespace(namespace), nil
+			}
+		}
+	}
+	return nil, apierrors.NewNotFound(schema.GroupResource{Group: HelmReleaseV2Group, Resource: "helmreleases"}, "")
+}
+
+// makeHelmReleaseV2Workload interprets a v2 HelmRelease, which has
+// its values where the v1 HelmRelease does, but reports its status
+// with the standard conditions.
+func makeHelmReleaseV2Workload(helmRelease *unstructured.Unstructured) workload {
+	values, _, _ := unstructured.NestedMap(helmRelease.Object, "spec", "values")
+	containers := createK8sHRContainers(helmRelease.GetAnnotations(), values)
+
+	podTemplate := apiv1.PodTemplateSpec{
+		ObjectMeta: meta_v1.ObjectMeta{
+			Name:        helmRelease.GetName(),
+			Namespace:   helmRelease.GetNamespace(),
+			Labels:      helmRelease.GetLabels(),
+			Annotations: helmRelease.GetAnnotations(),
+		},
+		Spec: apiv1.PodSpec{
+			Containers:       containers,
+			ImagePullSecrets: []apiv1.LocalObjectReference{},
+		},
+	}
+
+	status := cluster.StatusUnknown
+	switch ComputeReadiness(helmRelease).Status {
+	case cluster.ReadinessCurrent:
+		status = cluster.StatusReady
+	case cluster.ReadinessInProgress:
+		status = cluster.StatusUpdating
+	case cluster.ReadinessFailed:
+		status = cluster.StatusError
+	}
+	return workload{
+		status:      status,
+		podTemplate: podTemplate,
+		k8sObject:   helmRelease,
+	}
+}
+
+// fromUnstructured converts an object from the cache to one of the
+// typed objects returned by the clientsets.
+func fromUnstructured(obj *unstructured.Unstructured, into interface{}) error {
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, into)
+}
+
 // createK8sContainers creates a list of k8s containers by
 // interpreting the HelmRelease resource.
 func createK8sHRContainers(annotations map[string]string, values map[string]interface{}) []apiv1.Container {
@@ -0,0 +1,169 @@
+package kubernetes
+
+import (
+	"context"
+	"testing"
+
+	hr_v1 "github.com/fluxcd/helm-operator/pkg/apis/helm.fluxcd.io/v1"
+	helmopfake "github.com/fluxcd/helm-operator/pkg/client/clientset/versioned/fake"
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	corefake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/fluxcd/flux/pkg/cluster"
+	"github.com/fluxcd/flux/pkg/resource"
+)
+
+func testHelmReleaseV2(name, readyStatus, reason string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "helm.toolkit.fluxcd.io/v2",
+		"kind":       "HelmRelease",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": "demo",
+			"annotations": map[string]interface{}{
+				"fluxcd.io/automated":          "true",
+				"repository.fluxcd.io/podinfo": "podinfo.repo",
+				"tag.fluxcd.io/podinfo":        "podinfo.version",
+			},
+		},
+		"spec": map[string]interface{}{
+			"values": map[string]interface{}{
+				"podinfo": map[string]interface{}{
+					"repo":    "stefanprodan/podinfo",
+					"version": "3.1.0",
+				},
+			},
+		},
+		"status": map[string]interface{}{
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "Ready", "status": readyStatus, "reason": reason},
+			},
+		},
+	}}
+}
+
+func testHelmReleaseCluster(t *testing.T, v2 bool, objs ...*unstructured.Unstructured) (*Cluster, *helmopfake.Clientset) {
+	coreClient := corefake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "demo"}})
+	if v2 {
+		coreClient.Fake.Resources = []*metav1.APIResourceList{
+			{
+				GroupVersion: "helm.toolkit.fluxcd.io/v2",
+				APIResources: []metav1.APIResource{
+					{Name: "helmreleases", SingularName: "helmrelease", Namespaced: true, Kind: "HelmRelease"},
+				},
+			},
+		}
+	}
+	var runtimeObjs []runtime.Object
+	for _, obj := range objs {
+		runtimeObjs = append(runtimeObjs, obj)
+	}
+	gvr := schema.GroupVersionResource{Group: HelmReleaseV2Group, Version: "v2", Resource: "helmreleases"}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{gvr: "HelmReleaseList"}, runtimeObjs...)
+	helmClient := helmopfake.NewSimpleClientset()
+	client := ExtendedClient{
+		coreClient:         coreClient,
+		dynamicClient:      dynamicClient,
+		helmOperatorClient: helmClient,
+		discoveryClient:    coreClient.Discovery(),
+	}
+	return NewCluster(client, nil, nil, log.NewNopLogger(), nil, nil, nil), helmClient
+}
+
+func TestHelmReleaseV2Workloads(t *testing.T) {
+	c, helmClient := testHelmReleaseCluster(t, true,
+		testHelmReleaseV2("podinfo", "True", "ReconciliationSucceeded"),
+		testHelmReleaseV2("broken", "False", "UpgradeFailed"))
+	// a v1 HelmRelease that's been migrated is hidden by the v2 one
+	for _, name := range []string{"podinfo", "legacy"} {
+		_, err := helmClient.HelmV1().HelmReleases("demo").Create(&hr_v1.HelmRelease{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "demo"},
+			Status:     hr_v1.HelmReleaseStatus{ReleaseStatus: "deployed"},
+		})
+		require.NoError(t, err)
+	}
+
+	workloads, err := c.AllWorkloads(context.Background(), "")
+	require.NoError(t, err)
+	byID := map[string]cluster.Workload{}
+	for _, w := range workloads {
+		byID[w.ID.String()] = w
+	}
+	assert.Len(t, byID, 3)
+
+	podinfo, ok := byID["demo:helmrelease/podinfo"]
+	if assert.True(t, ok) {
+		assert.Equal(t, cluster.StatusReady, podinfo.Status)
+		assert.Equal(t, cluster.ReadinessCurrent, podinfo.Readiness.Status)
+		assert.True(t, podinfo.Policies.Has("automated"))
+		if assert.Len(t, podinfo.Containers.Containers, 1) {
+			assert.Equal(t, "podinfo", podinfo.Containers.Containers[0].Name)
+			assert.Equal(t, "stefanprodan/podinfo:3.1.0", podinfo.Containers.Containers[0].Image.String())
+		}
+	}
+	broken := byID["demo:helmrelease/broken"]
+	assert.Equal(t, cluster.StatusError, broken.Status)
+	assert.Equal(t, cluster.ReadinessFailed, broken.Readiness.Status)
+	assert.Equal(t, "deployed", byID["demo:helmrelease/legacy"].Status)
+
+	workloads, err = c.SomeWorkloads(context.Background(), []resource.ID{
+		resource.MustParseID("demo:helmrelease/podinfo"),
+		resource.MustParseID("demo:helmrelease/legacy"),
+	})
+	require.NoError(t, err)
+	if assert.Len(t, workloads, 2) {
+		assert.Equal(t, cluster.ReadinessCurrent, workloads[0].Readiness.Status)
+		assert.Equal(t, "deployed", workloads[1].Status)
+	}
+}
+
+func TestHelmReleaseV1Only(t *testing.T) {
+	c, helmClient := testHelmReleaseCluster(t, false)
+	_, err := helmClient.HelmV1().HelmReleases("demo").Create(&hr_v1.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{Name: "legacy", Namespace: "demo"},
+	})
+	require.NoError(t, err)
+
+	workloads, err := c.AllWorkloads(context.Background(), "")
+	require.NoError(t, err)
+	if assert.Len(t, workloads, 1) {
+		assert.Equal(t, "demo:helmrelease/legacy", workloads[0].ID.String())
+	}
+}
+
+func TestHelmReleaseV2Antecedent(t *testing.T) {
+	w := workload{k8sObject: &metav1.ObjectMeta{
+		Labels: map[string]string{
+			"helm.toolkit.fluxcd.io/name":      "podinfo",
+			"helm.toolkit.fluxcd.io/namespace": "demo",
+		},
+	}}
+	assert.Equal(t, resource.MustParseID("demo:helmrelease/podinfo"), w.toClusterWorkload(resource.MustParseID("demo:deployment/podinfo")).Antecedent)
+}
+
+func TestHelmReleaseFromUnstructured(t *testing.T) {
+	v1 := testHelmReleaseV2("podinfo", "True", "")
+	v1.SetAPIVersion("helm.fluxcd.io/v1")
+	unstructured.SetNestedField(v1.Object, "deployed", "status", "releaseStatus")
+
+	for obj, status := range map[*unstructured.Unstructured]string{
+		v1:                                       "deployed",
+		testHelmReleaseV2("podinfo", "True", ""): cluster.StatusReady,
+	} {
+		w, err := resourceKinds["helmrelease"].(cachedKind).fromUnstructured(obj)
+		require.NoError(t, err)
+		assert.Equal(t, status, w.status, obj.GetAPIVersion())
+		if assert.Len(t, w.podTemplate.Spec.Containers, 1, obj.GetAPIVersion()) {
+			assert.Equal(t, "stefanprodan/podinfo:3.1.0", w.podTemplate.Spec.Containers[0].Image)
+		}
+	}
+}
@@ -23,6 +23,7 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/rest"
 
@@ -42,6 +43,11 @@ const (
 	checksumAnnotation = kresource.PolicyPrefix + "sync-checksum"
 )
 
+// DefaultGCProtectedKinds are the kinds of resource that are not
+// garbage collected unless asked for, since deleting them also
+// deletes the resources or data they contain.
+var DefaultGCProtectedKinds = []string{"Namespace", "PersistentVolumeClaim", "CustomResourceDefinition"}
+
 // Sync takes a definition of what should be running in the cluster,
 // and attempts to make the cluster conform. An error return does not
 // necessarily indicate complete failure; some resources may succeed
@@ -62,7 +68,11 @@ func (c *Cluster) Sync(syncSet cluster.SyncSet) error {
 	}
 
 	cs := makeChangeSet()
-	var errs cluster.SyncError
+	synced := map[string]syncedResource{}
+	errs := append(cluster.SyncError(nil), syncSet.Errors...)
+	// tenants records the tenant of each resource that has one
+	tenants := map[resource.ID]*Tenant{}
+	var rejected cluster.SyncError
 	var excluded []string
 	for _, res := range syncSet.Resources {
 		resID := res.ResourceID()
@@ -71,6 +81,14 @@ func (c *Cluster) Sync(syncSet cluster.SyncSet) error {
 			excluded = append(excluded, id)
 			continue
 		}
+		tenant := c.tenantOf(res.Source())
+		if tenant != nil {
+			tenants[resID] = tenant
+		}
+		if err := tenant.allows(resID); err != nil {
+			rejected = append(rejected, cluster.ResourceError{ResourceID: resID, Source: res.Source(), Error: err})
+			continue
+		}
 		// make a record of the checksum, whether we stage it to
 		// be applied or not, so that we don't delete it later.
 		csum := sha1.Sum(res.Bytes())
@@ -87,9 +105,12 @@ func (c *Cluster) Sync(syncSet cluster.SyncSet) error {
 			logger.Log("info", "not applying resource; ignore annotation in cluster resource", "resource", cres.ResourceID())
 			continue
 		}
-		resBytes, err := applyMetadata(res, syncSet.Name, checkHex)
+		resBytes, err := applyMetadata(res, tenant.syncSetName(syncSet.Name), checkHex)
 		if err == nil {
-			cs.stage("apply", res.ResourceID(), res.Source(), resBytes)
+			cs.stageAs("apply", tenant.impersonate(), res.ResourceID(), res.Source(), resBytes)
+			if s, err := makeSyncedResource(res, resBytes); err == nil {
+				synced[id] = s
+			}
 		} else {
 			errs = append(errs, cluster.ResourceError{ResourceID: res.ResourceID(), Source: res.Source(), Error: err})
 			break
@@ -99,18 +120,26 @@ func (c *Cluster) Sync(syncSet cluster.SyncSet) error {
 	if len(excluded) > 0 {
 		logger.Log("warning", "not applying resources; excluded by namespace constraints", "resources", strings.Join(excluded, ","))
 	}
+	errs = append(errs, rejected...)
 
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.muSyncErrors.RLock()
 	if applyErrs := c.applier.apply(logger, cs, c.syncErrors); len(applyErrs) > 0 {
-		errs = append(errs, applyErrs...)
+		errs = append(errs, withTenants(applyErrs, tenants)...)
 	}
 	c.muSyncErrors.RUnlock()
 
+	var gcAborted *cluster.GCAbortedError
 	if c.GC || c.DryGC {
-		deleteErrs, gcFailure := c.collectGarbage(syncSet, checksums, logger, c.DryGC)
-		if gcFailure != nil {
+		// Resources rejected for being outside their tenant are
+		// left alone, as are those that couldn't be made ready.
+		gcSet := syncSet
+		gcSet.Errors = append(append(cluster.SyncError(nil), syncSet.Errors...), rejected...)
+		deleteErrs, gcFailure := c.collectGarbage(gcSet, checksums, tenants, logger, c.DryGC)
+		if aborted, ok := gcFailure.(*cluster.GCAbortedError); ok {
+			gcAborted = aborted
+		} else if gcFailure != nil {
 			return gcFailure
 		}
 		errs = append(errs, deleteErrs...)
@@ -119,6 +148,19 @@ func (c *Cluster) Sync(syncSet cluster.SyncSet) error {
 	// It is expected that Cluster.Sync is invoked with *all* resources.
 	// Otherwise it will override previously recorded sync errors.
 	c.setSyncErrors(errs)
+	c.reportTenantErrors(errs, tenants)
+
+	// Resources that failed to apply are already reported as sync
+	// errors, so don't also report them as drifted.
+	for _, e := range errs {
+		delete(synced, e.ResourceID.String())
+	}
+	c.setLastSync(synced)
+
+	if gcAborted != nil {
+		gcAborted.SyncErrors = errs
+		return gcAborted
+	}
 
 	// If `nil`, errs is a cluster.SyncError(nil) rather than error(nil), so it cannot be returned directly.
 	if errs == nil {
@@ -131,21 +173,29 @@ func (c *Cluster) Sync(syncSet cluster.SyncSet) error {
 func (c *Cluster) collectGarbage(
 	syncSet cluster.SyncSet,
 	checksums map[string]string,
+	tenants map[resource.ID]*Tenant,
 	logger log.Logger,
 	dryRun bool) (cluster.SyncError, error) {
 
-	orphanedResources := makeChangeSet()
-
 	clusterResources, err := c.getAllowedGCMarkedResourcesInSyncSet(syncSet.Name)
 	if err != nil {
 		return nil, errors.Wrap(err, "collating resources in cluster for calculating garbage collection")
 	}
 
+	failed := map[string]bool{}
+	for _, e := range syncSet.Errors {
+		failed[e.ResourceID.String()] = true
+	}
+
+	var orphaned []*kuberesource
 	for resourceID, res := range clusterResources {
 		actual := res.GetChecksum()
 		expected, ok := checksums[resourceID]
 
 		switch {
+		case failed[resourceID]:
+			c.logger.Log("info", "skipping GC of cluster resource; resource in repo could not be synced", "dry-run", dryRun, "resource", resourceID)
+			continue
 		case !ok: // was not recorded as having been staged for application
 			if res.Policies().Has(policy.Ignore) {
 				c.logger.Log("info", "skipping GC of cluster resource; resource has ignore policy true", "dry-run", dryRun, "resource", resourceID)
@@ -158,10 +208,24 @@ func (c *Cluster) collectGarbage(
 				continue
 			}
 
-			c.logger.Log("info", "cluster resource not in resources to be synced; deleting", "dry-run", dryRun, "resource", resourceID)
-			if !dryRun {
-				orphanedResources.stage("delete", res.ResourceID(), "<cluster>", res.IdentifyingBytes())
+			if ok, reason := c.pruneAllowed(res); !ok {
+				c.logger.Log("info", "skipping GC of cluster resource; "+reason, "dry-run", dryRun, "resource", resourceID)
+				continue
+			}
+
+			// A tenant only collects its own garbage, from its
+			// own namespaces (which may have changed since the
+			// resource was synced).
+			tenant, _ := c.gcOwner(res, syncSet.Name)
+			if err := tenant.allows(res.ResourceID()); err != nil {
+				c.logger.Log("info", "skipping GC of cluster resource; "+err.Error(), "dry-run", dryRun, "resource", resourceID)
+				continue
+			}
+			if tenant != nil {
+				tenants[res.ResourceID()] = tenant
 			}
+
+			orphaned = append(orphaned, res)
 		case actual != expected:
 			c.logger.Log("warning", "resource to be synced has not been updated; skipping", "dry-run", dryRun, "resource", resourceID)
 			continue
@@ -171,7 +235,47 @@ func (c *Cluster) collectGarbage(
 		}
 	}
 
-	return c.applier.apply(logger, orphanedResources, nil), nil
+	// A sync set that's suddenly missing a lot of resources is more
+	// likely a mistake (e.g., a generator outputting nothing) than
+	// intended, so don't delete anything.
+	if c.GCMaxDeletions > 0 && len(orphaned) > c.GCMaxDeletions {
+		aborted := &cluster.GCAbortedError{MaxDeletions: c.GCMaxDeletions}
+		for _, res := range orphaned {
+			aborted.Deletions = append(aborted.Deletions, res.ResourceID())
+		}
+		sort.Slice(aborted.Deletions, func(i, j int) bool {
+			return aborted.Deletions[i].String() < aborted.Deletions[j].String()
+		})
+		c.logger.Log("warning", "not collecting garbage; too many resources to delete", "dry-run", dryRun, "count", len(orphaned), "max", c.GCMaxDeletions)
+		return nil, aborted
+	}
+
+	orphanedResources := makeChangeSet()
+	for _, res := range orphaned {
+		c.logger.Log("info", "cluster resource not in resources to be synced; deleting", "dry-run", dryRun, "resource", res.ResourceID())
+		if !dryRun {
+			orphanedResources.stageAs("delete", tenants[res.ResourceID()].impersonate(), res.ResourceID(), "<cluster>", res.IdentifyingBytes())
+		}
+	}
+	return withTenants(c.applier.apply(logger, orphanedResources, nil), tenants), nil
+}
+
+// pruneAllowed says whether garbage collection may delete the
+// resource given, and if not, why not.
+func (c *Cluster) pruneAllowed(res *kuberesource) (bool, string) {
+	switch v, _ := res.Policies().Get(policy.Prune); v {
+	case policy.PruneDisabled:
+		return false, "resource has prune policy disabled"
+	case policy.PruneEnabled:
+		return true, ""
+	}
+	kind := res.obj.GetKind()
+	for _, protected := range c.GCProtectedKinds {
+		if strings.EqualFold(protected, kind) {
+			return false, "resource kind is protected from garbage collection"
+		}
+	}
+	return true, ""
 }
 
 // --- internals in support of Sync
@@ -238,6 +342,17 @@ func (c *Cluster) filterResources(resources *meta_v1.APIResourceList) *meta_v1.A
 	}
 }
 
+// excludedGroupVersion says whether all the resources in the group
+// version given are excluded.
+func (c *Cluster) excludedGroupVersion(gv string) bool {
+	for _, exp := range c.resourceExcludeList {
+		if glob.Glob(exp, fmt.Sprintf("%s/", gv)) {
+			return true
+		}
+	}
+	return false
+}
+
 func (c *Cluster) getAllowedResourcesBySelector(selector string) (map[string]*kuberesource, error) {
 	listOptions := meta_v1.ListOptions{}
 	if selector != "" {
@@ -253,15 +368,7 @@ func (c *Cluster) getAllowedResourcesBySelector(selector string) (map[string]*ku
 	for i := range sgs.Groups {
 		for _, v := range sgs.Groups[i].Versions {
 			gv := v.GroupVersion
-			excluded := false
-			for _, exp := range c.resourceExcludeList {
-				if glob.Glob(exp, fmt.Sprintf("%s/", gv)) {
-					excluded = true
-					break
-				}
-			}
-
-			if !excluded {
+			if !c.excludedGroupVersion(gv) {
 				if r, err := c.client.discoveryClient.ServerResourcesForGroupVersion(gv); err == nil {
 					if r != nil {
 						resources = append(resources, c.filterResources(r))
@@ -293,6 +400,11 @@ func (c *Cluster) getAllowedResourcesBySelector(selector string) (map[string]*ku
 			if !contains(verbs, "list") {
 				continue
 			}
+			// these are left out below anyway, so don't bother
+			// listing them
+			if resource.GroupVersion == "v1" && (apiResource.Kind == "ComponentStatus" || apiResource.Kind == "Endpoints") {
+				continue
+			}
 			groupVersion, err := schema.ParseGroupVersion(resource.GroupVersion)
 			if err != nil {
 				return nil, err
@@ -335,7 +447,14 @@ func (c *Cluster) getAllowedResourcesBySelector(selector string) (map[string]*ku
 
 func (c *Cluster) listAllowedResources(
 	namespaced bool, gvr schema.GroupVersionResource, options meta_v1.ListOptions) ([]unstructured.Unstructured, error) {
+	selector, err := labels.Parse(options.LabelSelector)
+	if err != nil {
+		return nil, err
+	}
 	if !namespaced {
+		if items, ok := c.cache.list(gvr, meta_v1.NamespaceAll, selector); ok {
+			return items, nil
+		}
 		// The resource is not namespaced, everything is allowed
 		resourceClient := c.client.dynamicClient.Resource(gvr)
 		data, err := resourceClient.List(context.TODO(), options)
@@ -352,6 +471,10 @@ func (c *Cluster) listAllowedResources(
 	}
 	var result []unstructured.Unstructured
 	for _, ns := range namespaces {
+		if items, ok := c.cache.list(gvr, ns, selector); ok {
+			result = append(result, items...)
+			continue
+		}
 		data, err := c.client.dynamicClient.Resource(gvr).Namespace(ns).List(context.TODO(), options)
 		if err != nil {
 			return result, err
@@ -369,7 +492,7 @@ func (c *Cluster) getAllowedGCMarkedResourcesInSyncSet(syncSetName string) (map[
 	allowedSyncSetGCMarkedResources := map[string]*kuberesource{}
 	for resID, kres := range allGCMarkedResources {
 		// Discard resources whose mark doesn't match their resource ID
-		if kres.GetGCMark() != makeGCMark(syncSetName, resID) {
+		if _, ok := c.gcOwner(kres, syncSetName); !ok {
 			continue
 		}
 		allowedSyncSetGCMarkedResources[resID] = kres
@@ -417,6 +540,22 @@ func applyMetadata(res resource.Resource, syncSetName, checksum string) ([]byte,
 	return bytes, nil
 }
 
+// gcOwner says whether the resource given was marked as being in the
+// sync set, and if so, which tenant (if any) it was synced for.
+func (c *Cluster) gcOwner(res *kuberesource, syncSetName string) (*Tenant, bool) {
+	mark, id := res.GetGCMark(), res.ResourceID().String()
+	if mark == makeGCMark(syncSetName, id) {
+		return nil, true
+	}
+	for i := range c.Tenants {
+		t := &c.Tenants[i]
+		if mark == makeGCMark(t.syncSetName(syncSetName), id) {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
 func makeGCMark(syncSetName, resourceID string) string {
 	hasher := sha256.New()
 	hasher.Write([]byte(syncSetName))
@@ -433,6 +572,9 @@ type applyObject struct {
 	ResourceID resource.ID
 	Source     string
 	Payload    []byte
+	// As is the user to impersonate when applying or deleting the
+	// object; empty means fluxd's own.
+	As string
 }
 
 type changeSet struct {
@@ -444,7 +586,26 @@ func makeChangeSet() changeSet {
 }
 
 func (c *changeSet) stage(cmd string, id resource.ID, source string, bytes []byte) {
-	c.objs[cmd] = append(c.objs[cmd], applyObject{id, source, bytes})
+	c.stageAs(cmd, "", id, source, bytes)
+}
+
+// stageAs stages an object to be operated on as the user given.
+func (c *changeSet) stageAs(cmd, as string, id resource.ID, source string, bytes []byte) {
+	c.objs[cmd] = append(c.objs[cmd], applyObject{ResourceID: id, Source: source, Payload: bytes, As: as})
+}
+
+// ordered returns the objects staged for the command given, in the
+// order they should be operated on. Objects to be applied are in
+// dependency order (e.g., namespaces first); objects to be deleted
+// are in the reverse of that.
+func (c *changeSet) ordered(cmd string) []applyObject {
+	objs := c.objs[cmd]
+	if cmd == "delete" {
+		sort.Sort(sort.Reverse(applyOrder(objs)))
+	} else {
+		sort.Sort(applyOrder(objs))
+	}
+	return objs
 }
 
 // Applier is something that will apply a changeset to the cluster.
@@ -580,16 +741,53 @@ func (c *Kubectl) apply(logger log.Logger, cs changeSet, errored map[resource.ID
 	// is also being deleted. GC does not have the dependency ranking,
 	// but we can use it as a shortcut to avoid the above problem at
 	// least.
-	objs := cs.objs["delete"]
-	sort.Sort(sort.Reverse(applyOrder(objs)))
-	f(objs, "delete")
-
-	objs = cs.objs["apply"]
-	sort.Sort(applyOrder(objs))
-	f(objs, "apply")
+	//
+	// Tenants' objects are operated on as the tenant, in separate
+	// commands; since they may depend on fluxd's own (e.g., the
+	// namespaces they go in), those are deleted last and applied
+	// first.
+	deletes := groupByUser(cs.ordered("delete"))
+	for i := len(deletes) - 1; i >= 0; i-- {
+		f(deletes[i].objs, "delete", deletes[i].args()...)
+	}
+	for _, group := range groupByUser(cs.ordered("apply")) {
+		f(group.objs, "apply", group.args()...)
+	}
 	return errs
 }
 
+type userObjects struct {
+	as   string
+	objs []applyObject
+}
+
+func (u userObjects) args() []string {
+	if u.as == "" {
+		return nil
+	}
+	return []string{"--as=" + u.as}
+}
+
+// groupByUser splits the objects given by the user to operate on
+// them as, keeping their order; fluxd's own objects come first, then
+// those for each other user, by name.
+func groupByUser(objs []applyObject) []userObjects {
+	byUser := map[string][]applyObject{}
+	users := []string{""}
+	for _, obj := range objs {
+		if _, ok := byUser[obj.As]; !ok && obj.As != "" {
+			users = append(users, obj.As)
+		}
+		byUser[obj.As] = append(byUser[obj.As], obj)
+	}
+	sort.Strings(users[1:])
+	var groups []userObjects
+	for _, user := range users {
+		groups = append(groups, userObjects{as: user, objs: byUser[user]})
+	}
+	return groups
+}
+
 func (c *Kubectl) doCommand(logger log.Logger, r io.Reader, args ...string) error {
 	args = append(args, "-f", "-")
 	cmd := c.kubectlCommand(args...)
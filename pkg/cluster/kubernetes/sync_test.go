@@ -41,6 +41,7 @@ func fakeClients() (ExtendedClient, func()) {
 	listMapping := map[schema.GroupVersionResource]string{
 		{Group: "", Version: "v1", Resource: "namespaces"}:      "List",
 		{Group: "apps", Version: "v1", Resource: "deployments"}: "List",
+		{Group: "batch", Version: "v1", Resource: "jobs"}:       "List",
 	}
 
 	// Set this to `true` to output a trace of the API actions called
@@ -64,6 +65,12 @@ func fakeClients() (ExtendedClient, func()) {
 				{Name: "namespaces", SingularName: "namespace", Namespaced: false, Kind: "Namespace", Verbs: getAndList},
 			},
 		},
+		{
+			GroupVersion: "batch/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "jobs", SingularName: "job", Namespaced: true, Kind: "Job", Verbs: getAndList},
+			},
+		},
 	}
 
 	coreClient := corefake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: defaultTestNamespace}})
@@ -109,6 +116,9 @@ type fakeApplier struct {
 	coreClient    k8sclient.Interface
 	defaultNS     string
 	commandRun    bool
+	// users, if not nil, records the user each resource was last
+	// operated on as, by command
+	users map[string]map[resource.ID]string
 }
 
 func groupVersionResource(res *unstructured.Unstructured) schema.GroupVersionResource {
@@ -121,6 +131,12 @@ func (a fakeApplier) apply(_ log.Logger, cs changeSet, errored map[resource.ID]e
 
 	operate := func(obj applyObject, cmd string) {
 		a.commandRun = true
+		if a.users != nil {
+			if a.users[cmd] == nil {
+				a.users[cmd] = map[resource.ID]string{}
+			}
+			a.users[cmd][obj.ResourceID] = obj.As
+		}
 		var unstruct map[string]interface{}
 		if err := yaml.Unmarshal(obj.Payload, &unstruct); err != nil {
 			errs = append(errs, cluster.ResourceError{obj.ResourceID, obj.Source, err})
@@ -208,10 +224,10 @@ func (a fakeApplier) apply(_ log.Logger, cs changeSet, errored map[resource.ID]e
 		}
 	}
 
-	for _, obj := range cs.objs["delete"] {
+	for _, obj := range cs.ordered("delete") {
 		operate(obj, "delete")
 	}
-	for _, obj := range cs.objs["apply"] {
+	for _, obj := range cs.ordered("apply") {
 		operate(obj, "apply")
 	}
 	if len(errs) == 0 {
@@ -395,7 +411,7 @@ metadata:
 		for _, r := range resources {
 			resourcesByID[r.ResourceID().String()] = r
 		}
-		err = sync.Sync("testset", resourcesByID, kube)
+		err = sync.Sync("testset", resourcesByID, nil, kube)
 		if !expectErrors && err != nil {
 			t.Error(err)
 		}
@@ -837,6 +853,120 @@ spec:
 		assert.NotNil(t, r)
 		checkSame(t, []byte(existing), r)
 	})
+
+	t.Run("sync doesn't GC resources with prune: disabled", func(t *testing.T) {
+		kube, _, cancel := setup(t)
+		defer cancel()
+		kube.GC = true
+
+		const dep1 = `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: dep1
+  namespace: foobar
+  annotations: {fluxcd.io/prune: disabled}
+`
+		test(t, kube, ns1+dep1+defs2, ns1+dep1+defs2, false)
+		// dep2 is collected, but dep1 is left alone
+		test(t, kube, ns1, ns1+dep1, false)
+	})
+
+	t.Run("sync doesn't GC protected kinds unless prune: enabled", func(t *testing.T) {
+		kube, _, cancel := setup(t)
+		defer cancel()
+		kube.GC = true
+		kube.GCProtectedKinds = DefaultGCProtectedKinds
+
+		const ns3prunable = `---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: other
+  annotations: {fluxcd.io/prune: enabled}
+`
+		test(t, kube, ns1+ns3prunable, ns1+ns3prunable, false)
+		test(t, kube, "", ns1, false)
+	})
+
+	t.Run("sync aborts GC when there are too many resources to delete", func(t *testing.T) {
+		kube, _, cancel := setup(t)
+		defer cancel()
+		kube.GC = true
+		kube.GCMaxDeletions = 1
+
+		test(t, kube, ns1+defs1+defs2, ns1+defs1+defs2, false)
+		// Deleting two resources is too many, so neither is deleted
+		test(t, kube, ns1, ns1+defs1+defs2, true)
+
+		resources, err := kresource.ParseMultidoc([]byte(ns1), "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = kube.Sync(cluster.SyncSet{Name: "testset", Resources: []resource.Resource{resources["<cluster>:namespace/foobar"]}})
+		if aborted, ok := err.(*cluster.GCAbortedError); assert.True(t, ok, "expected GCAbortedError, got %v", err) {
+			assert.Equal(t, 1, aborted.MaxDeletions)
+			assert.Equal(t, []resource.ID{
+				resource.MustParseID("foobar:deployment/dep1"),
+				resource.MustParseID("foobar:deployment/dep2"),
+			}, aborted.Deletions)
+		}
+
+		// .. but one is fine
+		test(t, kube, ns1+defs1, ns1+defs1, false)
+	})
+
+	t.Run("sync reports and doesn't GC resources that couldn't be prepared", func(t *testing.T) {
+		kube, _, cancel := setup(t)
+		defer cancel()
+		kube.GC = true
+
+		test(t, kube, ns1+defs1+defs2, ns1+defs1+defs2, false)
+
+		resources, err := kresource.ParseMultidoc([]byte(ns1+defs1), "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		dep2 := resource.MustParseID("foobar:deployment/dep2")
+		err = kube.Sync(cluster.SyncSet{
+			Name:      "testset",
+			Resources: []resource.Resource{resources["<cluster>:namespace/foobar"], resources["foobar:deployment/dep1"]},
+			Errors:    cluster.SyncError{{ResourceID: dep2, Source: "dep2.yaml", Error: fmt.Errorf("could not decrypt")}},
+		})
+		if syncErr, ok := err.(cluster.SyncError); assert.True(t, ok, "expected SyncError, got %v", err) {
+			assert.Len(t, syncErr, 1)
+			assert.Equal(t, dep2, syncErr[0].ResourceID)
+		}
+		actual, err := kube.getAllowedGCMarkedResourcesInSyncSet("testset")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Contains(t, actual, dep2.String())
+	})
+}
+
+// TestChangeSetOrder checks that resources are deleted in the
+// reverse of the order they're applied.
+func TestChangeSetOrder(t *testing.T) {
+	cs := makeChangeSet()
+	for _, id := range []resource.ID{
+		resource.MakeID("test", "Deployment", "deploy"),
+		resource.MakeID("test", "Secret", "secret"),
+		resource.MakeID("", "Namespace", "namespace"),
+		resource.MakeID("test", "Deployment", "another"),
+	} {
+		cs.stage("apply", id, "", nil)
+		cs.stage("delete", id, "", nil)
+	}
+	var applied, deleted []string
+	for _, obj := range cs.ordered("apply") {
+		applied = append([]string{obj.ResourceID.String()}, applied...)
+	}
+	for _, obj := range cs.ordered("delete") {
+		deleted = append(deleted, obj.ResourceID.String())
+	}
+	assert.Equal(t, applied, deleted)
+	assert.Equal(t, "test:deployment/deploy", deleted[0])
 }
 
 // ----
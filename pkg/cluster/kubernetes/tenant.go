@@ -0,0 +1,197 @@
+package kubernetes
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/fluxcd/flux/pkg/cluster"
+	kresource "github.com/fluxcd/flux/pkg/cluster/kubernetes/resource"
+	fluxmetrics "github.com/fluxcd/flux/pkg/metrics"
+	"github.com/fluxcd/flux/pkg/resource"
+)
+
+// Tenant is a team given some paths in the git repo, and some
+// namespaces in the cluster. Manifests in the tenant's paths may only
+// be for resources in the tenant's namespaces, and are applied (and
+// garbage collected) as the tenant's service account, so they are
+// also subject to whatever RBAC rules apply to it.
+type Tenant struct {
+	Name string `yaml:"name"`
+	// Paths are directories in the git repo, relative to its root.
+	Paths      []string `yaml:"paths"`
+	Namespaces []string `yaml:"namespaces"`
+	// ServiceAccount is `<namespace>/<name>` of the service account
+	// to impersonate.
+	ServiceAccount string `yaml:"serviceAccount"`
+
+	namespaces map[string]bool
+}
+
+// TenantsConfig is the format of the file listing tenants, e.g.,
+//
+//	tenants:
+//	- name: team-a
+//	  paths: [teams/a]
+//	  namespaces: [team-a, team-a-staging]
+//	  serviceAccount: team-a/flux
+type TenantsConfig struct {
+	Tenants []Tenant `yaml:"tenants"`
+}
+
+// ReadTenants reads the tenants listed in the file at the path given.
+func ReadTenants(path string) ([]Tenant, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading tenants")
+	}
+	defer f.Close()
+	return ParseTenants(f)
+}
+
+// ParseTenants parses and checks a list of tenants, in the format of
+// TenantsConfig.
+func ParseTenants(r io.Reader) ([]Tenant, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var config TenantsConfig
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, errors.Wrap(err, "parsing tenants")
+	}
+
+	names := map[string]bool{}
+	owners := map[string]string{} // path -> tenant
+	for i := range config.Tenants {
+		t := &config.Tenants[i]
+		if t.Name == "" {
+			return nil, fmt.Errorf("tenant %d has no name", i+1)
+		}
+		if names[t.Name] {
+			return nil, fmt.Errorf("tenant %q is given more than once", t.Name)
+		}
+		names[t.Name] = true
+		if len(t.Paths) == 0 || len(t.Namespaces) == 0 {
+			return nil, fmt.Errorf("tenant %q must have at least one path and one namespace", t.Name)
+		}
+		if parts := strings.Split(t.ServiceAccount, "/"); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("service account of tenant %q must be given as <namespace>/<name>", t.Name)
+		}
+
+		for j, p := range t.Paths {
+			p = filepath.Clean(p)
+			if filepath.IsAbs(p) || p == "." || p == ".." || strings.HasPrefix(p, ".."+string(filepath.Separator)) {
+				return nil, fmt.Errorf("path %q of tenant %q must be a directory within the repo", t.Paths[j], t.Name)
+			}
+			for other, owner := range owners {
+				if underPath(p, other) || underPath(other, p) {
+					return nil, fmt.Errorf("path %q of tenant %q overlaps with path %q of tenant %q", p, t.Name, other, owner)
+				}
+			}
+			owners[p] = t.Name
+			t.Paths[j] = p
+		}
+		t.namespaces = map[string]bool{}
+		for _, ns := range t.Namespaces {
+			t.namespaces[ns] = true
+		}
+	}
+	return config.Tenants, nil
+}
+
+func underPath(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// impersonate gives the user to act as, for kubectl's --as.
+func (t *Tenant) impersonate() string {
+	if t == nil {
+		return ""
+	}
+	return "system:serviceaccount:" + strings.Replace(t.ServiceAccount, "/", ":", 1)
+}
+
+// syncSetName gives the name of the part of a sync set belonging to
+// the tenant; it's used to mark resources for garbage collection, so
+// that each tenant only collects its own.
+func (t *Tenant) syncSetName(syncSetName string) string {
+	if t == nil {
+		return syncSetName
+	}
+	return syncSetName + "/" + t.Name
+}
+
+// allows returns an error if the tenant may not have the resource
+// given.
+func (t *Tenant) allows(id resource.ID) error {
+	if t == nil {
+		return nil
+	}
+	namespace, _, _ := id.Components()
+	if namespace == kresource.ClusterScope {
+		return fmt.Errorf("tenant %s may not have cluster-scoped resources", t.Name)
+	}
+	if !t.namespaces[namespace] {
+		return fmt.Errorf("tenant %s may not have resources in namespace %q", t.Name, namespace)
+	}
+	return nil
+}
+
+// tenantOf returns the tenant whose paths include the source given,
+// or nil if there is none. A source may be a file in the repo, or,
+// for generated manifests, the path the generator was run for joined
+// with the config file relative to it (e.g.,
+// `teams/a/../.flux.yaml`); in that case the tenant is that of either
+// the path or the config file, so a tenant's manifests can't escape
+// it by being generated from elsewhere.
+func (c *Cluster) tenantOf(source string) *Tenant {
+	candidates := []string{filepath.Clean(source)}
+	parts := strings.Split(filepath.ToSlash(source), "/")
+	for i, part := range parts {
+		if part == ".." {
+			candidates = append(candidates, filepath.Join(parts[:i]...))
+			break
+		}
+	}
+	for i := range c.Tenants {
+		t := &c.Tenants[i]
+		for _, path := range t.Paths {
+			for _, candidate := range candidates {
+				if underPath(candidate, path) {
+					return t
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// withTenants says which tenant each error belongs to, if any.
+func withTenants(errs cluster.SyncError, tenants map[resource.ID]*Tenant) cluster.SyncError {
+	for i := range errs {
+		if t, ok := tenants[errs[i].ResourceID]; ok {
+			errs[i].Error = fmt.Errorf("tenant %s: %w", t.Name, errs[i].Error)
+		}
+	}
+	return errs
+}
+
+// reportTenantErrors sets the number of sync errors for each tenant.
+func (c *Cluster) reportTenantErrors(errs cluster.SyncError, tenants map[resource.ID]*Tenant) {
+	counts := map[string]int{}
+	for _, e := range errs {
+		if t, ok := tenants[e.ResourceID]; ok {
+			counts[t.Name]++
+		}
+	}
+	for _, t := range c.Tenants {
+		tenantSyncErrors.With(fluxmetrics.LabelTenant, t.Name).Set(float64(counts[t.Name]))
+	}
+}
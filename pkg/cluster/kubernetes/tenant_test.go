@@ -0,0 +1,159 @@
+package kubernetes
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/fluxcd/flux/pkg/cluster"
+	kresource "github.com/fluxcd/flux/pkg/cluster/kubernetes/resource"
+	"github.com/fluxcd/flux/pkg/resource"
+)
+
+const testTenants = `
+tenants:
+- name: team-a
+  paths: [teams/a/]
+  namespaces: [team-a]
+  serviceAccount: team-a/flux
+- name: team-b
+  paths: [teams/b, shared/b]
+  namespaces: [team-b, team-b-staging]
+  serviceAccount: team-b/flux
+`
+
+func TestParseTenants(t *testing.T) {
+	tenants, err := ParseTenants(strings.NewReader(testTenants))
+	require.NoError(t, err)
+	if assert.Len(t, tenants, 2) {
+		assert.Equal(t, []string{"teams/a"}, tenants[0].Paths)
+		assert.Equal(t, "system:serviceaccount:team-b:flux", tenants[1].impersonate())
+	}
+
+	for name, config := range map[string]string{
+		"no name":       `{tenants: [{paths: [a], namespaces: [a], serviceAccount: a/flux}]}`,
+		"duplicate":     `{tenants: [{name: a, paths: [a], namespaces: [a], serviceAccount: a/flux}, {name: a, paths: [b], namespaces: [b], serviceAccount: b/flux}]}`,
+		"no namespaces": `{tenants: [{name: a, paths: [a], serviceAccount: a/flux}]}`,
+		"bad account":   `{tenants: [{name: a, paths: [a], namespaces: [a], serviceAccount: flux}]}`,
+		"outside repo":  `{tenants: [{name: a, paths: [../a], namespaces: [a], serviceAccount: a/flux}]}`,
+		"whole repo":    `{tenants: [{name: a, paths: [.], namespaces: [a], serviceAccount: a/flux}]}`,
+		"overlapping":   `{tenants: [{name: a, paths: [a], namespaces: [a], serviceAccount: a/flux}, {name: b, paths: [a/b], namespaces: [b], serviceAccount: b/flux}]}`,
+		"unknown field": `{tenants: [{name: a, paths: [a], namespaces: [a], serviceAccount: a/flux, clusterAdmin: true}]}`,
+	} {
+		_, err := ParseTenants(strings.NewReader(config))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestTenantOf(t *testing.T) {
+	tenants, err := ParseTenants(strings.NewReader(testTenants))
+	require.NoError(t, err)
+	c := &Cluster{Tenants: tenants}
+	for source, expected := range map[string]string{
+		"teams/a/deployment.yaml":     "team-a",
+		"teams/a/apps/service.yaml":   "team-a",
+		"shared/b/config.yaml":        "team-b",
+		"teams/ab/deployment.yaml":    "",
+		"namespaces.yaml":             "",
+		"teams/a/../.flux.yaml":       "team-a",
+		"teams/a/staging/.flux.yaml":  "team-a",
+		"base/../teams/b/.flux.yaml":  "team-b",
+		"teams/../namespaces/ns.yaml": "",
+	} {
+		name := ""
+		if tenant := c.tenantOf(source); tenant != nil {
+			name = tenant.Name
+		}
+		assert.Equal(t, expected, name, source)
+	}
+}
+
+func TestSyncTenants(t *testing.T) {
+	kube, applier, cancel := setup(t)
+	defer cancel()
+	applier.users = map[string]map[resource.ID]string{}
+	kube.GC = true
+	tenants, err := ParseTenants(strings.NewReader(testTenants))
+	require.NoError(t, err)
+	kube.Tenants = tenants
+
+	parse := func(source, def string) []resource.Resource {
+		manifests, err := kresource.ParseMultidoc([]byte(def), source)
+		require.NoError(t, err)
+		var resources []resource.Resource
+		for _, m := range manifests {
+			resources = append(resources, m)
+		}
+		return resources
+	}
+	namespaces := parse("namespaces.yaml", `---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: team-a
+`)
+	teamA := parse("teams/a/deployment.yaml", `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: podinfo
+  namespace: team-a
+`)
+	// tenant A trying to put something in tenant B's namespace
+	trespass := parse("teams/a/other.yaml", `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: podinfo
+  namespace: team-b
+`)
+
+	var resources []resource.Resource
+	resources = append(resources, namespaces...)
+	resources = append(resources, teamA...)
+	resources = append(resources, trespass...)
+	err = kube.Sync(cluster.SyncSet{Name: "testset", Resources: resources})
+	if syncErr, ok := err.(cluster.SyncError); assert.True(t, ok, "%v", err) && assert.Len(t, syncErr, 1) {
+		assert.Equal(t, "team-b:deployment/podinfo", syncErr[0].ResourceID.String())
+		assert.Contains(t, syncErr[0].Error.Error(), "tenant team-a may not have resources in namespace \"team-b\"")
+	}
+
+	deploymentID := resource.MustParseID("team-a:deployment/podinfo")
+	assert.Equal(t, "system:serviceaccount:team-a:flux", applier.users["apply"][deploymentID])
+	assert.Equal(t, "", applier.users["apply"][resource.MustParseID("<cluster>:namespace/team-a")])
+	assert.NotContains(t, applier.users["apply"], resource.MustParseID("team-b:deployment/podinfo"))
+
+	deployments := kube.client.dynamicClient.Resource(schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"})
+	dep, err := deployments.Namespace("team-a").Get(context.TODO(), "podinfo", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, makeGCMark("testset/team-a", deploymentID.String()), dep.GetLabels()[gcMarkLabel])
+
+	// the tenant's resources are garbage collected as the tenant
+	err = kube.Sync(cluster.SyncSet{Name: "testset", Resources: namespaces})
+	assert.NoError(t, err)
+	assert.Equal(t, "system:serviceaccount:team-a:flux", applier.users["delete"][deploymentID])
+	_, err = deployments.Namespace("team-a").Get(context.TODO(), "podinfo", metav1.GetOptions{})
+	assert.Error(t, err)
+}
+
+func TestGroupByUser(t *testing.T) {
+	objs := []applyObject{
+		{ResourceID: resource.MustParseID("b:deployment/one"), As: "b"},
+		{ResourceID: resource.MustParseID("<cluster>:namespace/a")},
+		{ResourceID: resource.MustParseID("a:deployment/one"), As: "a"},
+		{ResourceID: resource.MustParseID("b:deployment/two"), As: "b"},
+	}
+	groups := groupByUser(objs)
+	if assert.Len(t, groups, 3) {
+		assert.Nil(t, groups[0].args())
+		assert.Len(t, groups[0].objs, 1)
+		assert.Equal(t, []string{"--as=a"}, groups[1].args())
+		assert.Equal(t, []string{"--as=b"}, groups[2].args())
+		assert.Len(t, groups[2].objs, 2)
+	}
+}
@@ -19,6 +19,11 @@ func updateWorkloadContainer(in []byte, resource resource.ID, container string,
 	if _, ok := resourceKinds[strings.ToLower(kind)]; !ok {
 		return nil, UpdateNotSupportedError(kind)
 	}
+	// kubeyaml only knows where the containers are in the built-in
+	// kinds
+	if _, ok := kresource.LookupWorkloadKind(kind); ok {
+		return kresource.SetCustomWorkloadContainerImage(in, namespace, kind, name, container, newImageID.String())
+	}
 	return (KubeYAML{}).Image(in, namespace, kind, name, container, newImageID.String())
 }
 
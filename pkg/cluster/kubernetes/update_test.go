@@ -1,6 +1,7 @@
 package kubernetes
 
 import (
+	"strings"
 	"testing"
 
 	kresource "github.com/fluxcd/flux/pkg/cluster/kubernetes/resource"
@@ -70,6 +71,7 @@ func TestWorkloadContainerUpdates(t *testing.T) {
 		{"in multidoc", case9resource, case9containers, case9image, case9, case9out, emptyContainerImageMap},
 		{"in kubernetes List resource", case10resource, case10containers, case10image, case10, case10out, emptyContainerImageMap},
 		{"HelmRelease (v1; with image map)", case14resource, make([]string, 0), case14image, case14, case14out, case14ImageMap},
+		{"HelmRelease (v2; with image map)", case14resource, make([]string, 0), case14image, case16, case16out, case14ImageMap},
 		{"initContainer", case15resource, case15containers, case15image, case15, case15out, emptyContainerImageMap},
 	} {
 		t.Run(c.name, func(t *testing.T) {
@@ -875,6 +877,10 @@ spec:
       image: sidecar:v1
 `
 
+// the same as case14, with the HelmRelease API of the Helm controller
+var case16 = strings.Replace(case14, "helm.fluxcd.io/v1", "helm.toolkit.fluxcd.io/v2", 1)
+var case16out = strings.Replace(case14out, "helm.fluxcd.io/v1", "helm.toolkit.fluxcd.io/v2", 1)
+
 const case15 = `---
 apiVersion: extensions/v1beta1
 kind: Deployment
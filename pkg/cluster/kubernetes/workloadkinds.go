@@ -0,0 +1,173 @@
+package kubernetes
+
+import (
+	"context"
+	"strings"
+
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/fluxcd/flux/pkg/cluster"
+	kresource "github.com/fluxcd/flux/pkg/cluster/kubernetes/resource"
+)
+
+// RegisterWorkloadKinds registers the kinds given, so that resources
+// of those kinds are treated as workloads, both in manifests and in
+// the cluster.
+func RegisterWorkloadKinds(kinds []kresource.WorkloadKind) error {
+	for _, k := range kinds {
+		registered, err := kresource.RegisterWorkloadKind(k)
+		if err != nil {
+			return err
+		}
+		resourceKinds[strings.ToLower(k.Kind)] = &customWorkloadKind{kind: registered}
+	}
+	return nil
+}
+
+/////////////////////////////////////////////////////////////////////////////
+// Registered workload kinds, with their containers and status at
+// configured paths
+
+type customWorkloadKind struct {
+	kind *kresource.WorkloadKind
+}
+
+// resourceClient gives a client for the kind in the namespace given,
+// or nil if the kind is cluster-scoped and a namespace is given. If
+// the API server doesn't know about the kind, it returns a NotFound
+// error, so that the kind is skipped like any other not supported.
+func (k *customWorkloadKind) resourceClient(c *Cluster, namespace string) (dynamic.ResourceInterface, error) {
+	gv, err := schema.ParseGroupVersion(k.kind.APIVersion)
+	if err != nil {
+		return nil, err
+	}
+	notFound := apierrors.NewNotFound(gv.WithResource(strings.ToLower(k.kind.Kind)).GroupResource(), "")
+	resources, err := c.client.discoveryClient.ServerResourcesForGroupVersion(k.kind.APIVersion)
+	if err != nil {
+		if apierrors.IsForbidden(err) {
+			return nil, err
+		}
+		return nil, notFound
+	}
+	for _, r := range resources.APIResources {
+		if r.Kind != k.kind.Kind || strings.Contains(r.Name, "/") {
+			continue
+		}
+		client := c.client.dynamicClient.Resource(gv.WithResource(r.Name))
+		if !r.Namespaced {
+			if namespace != meta_v1.NamespaceAll {
+				return nil, nil
+			}
+			return client, nil
+		}
+		return client.Namespace(namespace), nil
+	}
+	return nil, notFound
+}
+
+func (k *customWorkloadKind) getWorkload(ctx context.Context, c *Cluster, namespace, name string) (workload, error) {
+	if err := ctx.Err(); err != nil {
+		return workload{}, err
+	}
+	if namespace == kresource.ClusterScope {
+		namespace = meta_v1.NamespaceAll
+	}
+	client, err := k.resourceClient(c, namespace)
+	if err != nil {
+		return workload{}, err
+	}
+	if client == nil {
+		return workload{}, apierrors.NewNotFound(schema.GroupResource{Resource: strings.ToLower(k.kind.Kind)}, name)
+	}
+	obj, err := client.Get(ctx, name, meta_v1.GetOptions{})
+	if err != nil {
+		return workload{}, err
+	}
+	return makeCustomWorkload(k.kind, obj), nil
+}
+
+func (k *customWorkloadKind) getWorkloads(ctx context.Context, c *Cluster, namespace string) ([]workload, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	client, err := k.resourceClient(c, namespace)
+	if err != nil || client == nil {
+		return nil, err
+	}
+	list, err := client.List(ctx, meta_v1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var workloads []workload
+	for i := range list.Items {
+		workloads = append(workloads, makeCustomWorkload(k.kind, &list.Items[i]))
+	}
+	return workloads, nil
+}
+
+func (k *customWorkloadKind) groupKinds() []schema.GroupKind {
+	gv, _ := schema.ParseGroupVersion(k.kind.APIVersion)
+	return []schema.GroupKind{gv.WithKind(k.kind.Kind).GroupKind()}
+}
+
+func (k *customWorkloadKind) fromUnstructured(obj *unstructured.Unstructured) (workload, error) {
+	return makeCustomWorkload(k.kind, obj), nil
+}
+
+func makeCustomWorkload(kind *kresource.WorkloadKind, obj *unstructured.Unstructured) workload {
+	var podTemplate apiv1.PodTemplateSpec
+	if spec, ok := kind.FindPodSpec(obj.Object); ok {
+		// this is for the service account and image pull secrets;
+		// anything that can't be converted is left out
+		_ = runtime.DefaultUnstructuredConverter.FromUnstructured(spec, &podTemplate.Spec)
+	}
+	// init containers are included here, so they're all in the
+	// order of the configured paths
+	podTemplate.Spec.Containers, podTemplate.Spec.InitContainers = nil, nil
+	kind.EachContainer(obj.Object, func(c map[string]interface{}) bool {
+		name, _ := c["name"].(string)
+		image, _ := c["image"].(string)
+		podTemplate.Spec.Containers = append(podTemplate.Spec.Containers, apiv1.Container{Name: name, Image: image})
+		return true
+	})
+
+	status := cluster.StatusReady
+	var rollout cluster.RolloutStatus
+	if paths := kind.Rollout; paths.ObservedGeneration != "" {
+		rollout = cluster.RolloutStatus{
+			Desired: int32(kresource.FindInt(obj.Object, paths.Desired)),
+			Updated: int32(kresource.FindInt(obj.Object, paths.Updated)),
+			Ready:   int32(kresource.FindInt(obj.Object, paths.Ready)),
+		}
+		rollout.Available = rollout.Ready
+		if paths.Available != "" {
+			rollout.Available = int32(kresource.FindInt(obj.Object, paths.Available))
+		}
+		if paths.Total != "" {
+			rollout.Outdated = int32(kresource.FindInt(obj.Object, paths.Total)) - rollout.Updated
+		}
+
+		status = cluster.StatusStarted
+		if kresource.FindInt(obj.Object, paths.ObservedGeneration) >= obj.GetGeneration() {
+			// the definition has been updated; now let's see about the replicas
+			status = cluster.StatusUpdating
+			if rollout.Updated == rollout.Desired && rollout.Available == rollout.Desired && rollout.Outdated == 0 {
+				status = cluster.StatusReady
+			}
+		}
+	}
+
+	return workload{
+		status:      status,
+		rollout:     rollout,
+		podTemplate: podTemplate,
+		k8sObject:   obj,
+	}
+}
@@ -0,0 +1,173 @@
+package kubernetes
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	corefake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/fluxcd/flux/pkg/cluster"
+	kresource "github.com/fluxcd/flux/pkg/cluster/kubernetes/resource"
+	"github.com/fluxcd/flux/pkg/image"
+	"github.com/fluxcd/flux/pkg/resource"
+	helmopfake "github.com/fluxcd/helm-operator/pkg/client/clientset/versioned/fake"
+)
+
+const testWorkloadKinds = `
+workloadKinds:
+- apiVersion: argoproj.io/v1alpha1
+  kind: Rollout
+  podSpec: .spec.template.spec
+  rollout:
+    observedGeneration: .status.observedGeneration
+    desired: .spec.replicas
+    updated: .status.updatedReplicas
+    ready: .status.readyReplicas
+    total: .status.replicas
+`
+
+func registerTestWorkloadKinds(t *testing.T) func() {
+	kinds, err := kresource.ParseWorkloadKinds(strings.NewReader(testWorkloadKinds))
+	require.NoError(t, err)
+	require.NoError(t, RegisterWorkloadKinds(kinds))
+	return func() {
+		for _, k := range kinds {
+			kresource.UnregisterWorkloadKind(k.Kind)
+			delete(resourceKinds, strings.ToLower(k.Kind))
+		}
+	}
+}
+
+func testRollout(name string, generation, observed, replicas, updated, ready int64) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "argoproj.io/v1alpha1",
+		"kind":       "Rollout",
+		"metadata": map[string]interface{}{
+			"name":       name,
+			"namespace":  "demo",
+			"generation": generation,
+			"annotations": map[string]interface{}{
+				"fluxcd.io/automated": "true",
+			},
+		},
+		"spec": map[string]interface{}{
+			"replicas": replicas,
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"serviceAccountName": "podinfo",
+					"imagePullSecrets":   []interface{}{map[string]interface{}{"name": "registry"}},
+					"containers": []interface{}{
+						map[string]interface{}{"name": "podinfo", "image": "stefanprodan/podinfo:3.1.0"},
+					},
+				},
+			},
+		},
+		"status": map[string]interface{}{
+			"observedGeneration": observed,
+			"replicas":           replicas,
+			"updatedReplicas":    updated,
+			"readyReplicas":      ready,
+		},
+	}}
+	return obj
+}
+
+func TestMakeCustomWorkload(t *testing.T) {
+	defer registerTestWorkloadKinds(t)()
+	kind, _ := kresource.LookupWorkloadKind("rollout")
+
+	w := makeCustomWorkload(kind, testRollout("done", 2, 2, 3, 3, 3))
+	assert.Equal(t, cluster.StatusReady, w.status)
+	assert.Equal(t, cluster.RolloutStatus{Desired: 3, Updated: 3, Ready: 3, Available: 3}, w.rollout)
+	assert.Equal(t, "podinfo", w.podTemplate.Spec.ServiceAccountName)
+	assert.Equal(t, []corev1.LocalObjectReference{{Name: "registry"}}, w.podTemplate.Spec.ImagePullSecrets)
+	assert.Equal(t, []corev1.Container{{Name: "podinfo", Image: "stefanprodan/podinfo:3.1.0"}}, w.podTemplate.Spec.Containers)
+
+	w = makeCustomWorkload(kind, testRollout("updating", 2, 2, 3, 1, 3))
+	assert.Equal(t, cluster.StatusUpdating, w.status)
+	assert.Equal(t, int32(2), w.rollout.Outdated)
+
+	w = makeCustomWorkload(kind, testRollout("started", 3, 2, 3, 3, 3))
+	assert.Equal(t, cluster.StatusStarted, w.status)
+}
+
+func TestCustomWorkloadsInCluster(t *testing.T) {
+	defer registerTestWorkloadKinds(t)()
+
+	coreClient := corefake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "demo"}})
+	coreClient.Fake.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "argoproj.io/v1alpha1",
+			APIResources: []metav1.APIResource{
+				{Name: "rollouts", SingularName: "rollout", Namespaced: true, Kind: "Rollout"},
+				{Name: "rollouts/status", Namespaced: true, Kind: "Rollout"},
+			},
+		},
+	}
+	rolloutsGVR := schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "rollouts"}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{rolloutsGVR: "RolloutList"},
+		testRollout("podinfo", 1, 1, 1, 1, 1))
+	client := ExtendedClient{
+		coreClient:         coreClient,
+		dynamicClient:      dynamicClient,
+		helmOperatorClient: helmopfake.NewSimpleClientset(),
+		discoveryClient:    coreClient.Discovery(),
+	}
+	c := NewCluster(client, nil, nil, log.NewNopLogger(), nil, nil, nil)
+
+	id := resource.MustParseID("demo:rollout/podinfo")
+	workloads, err := c.SomeWorkloads(context.Background(), []resource.ID{id, resource.MustParseID("demo:rollout/missing")})
+	require.NoError(t, err)
+	if assert.Len(t, workloads, 1) {
+		assert.Equal(t, id, workloads[0].ID)
+		assert.Equal(t, cluster.StatusReady, workloads[0].Status)
+		assert.True(t, workloads[0].Policies.Has("automated"))
+		if assert.Len(t, workloads[0].Containers.Containers, 1) {
+			assert.Equal(t, "stefanprodan/podinfo:3.1.0", workloads[0].Containers.Containers[0].Image.String())
+		}
+	}
+
+	workloads, err = c.AllWorkloads(context.Background(), "")
+	require.NoError(t, err)
+	if assert.Len(t, workloads, 1) {
+		assert.Equal(t, id, workloads[0].ID)
+	}
+
+	// a kind the API server doesn't know about is skipped
+	coreClient.Fake.Resources = nil
+	workloads, err = c.AllWorkloads(context.Background(), "")
+	assert.NoError(t, err)
+	assert.Len(t, workloads, 0)
+}
+
+func TestUpdateCustomWorkloadContainer(t *testing.T) {
+	defer registerTestWorkloadKinds(t)()
+
+	manifest := `apiVersion: argoproj.io/v1alpha1
+kind: Rollout
+metadata:
+  name: podinfo
+spec:
+  template:
+    spec:
+      containers:
+      - name: podinfo
+        image: stefanprodan/podinfo:3.1.0 # pinned
+`
+	manifests := NewManifests(ConstNamespacer("default"), log.NewNopLogger())
+	ref, _ := image.ParseRef("stefanprodan/podinfo:3.2.0")
+	out, err := manifests.SetWorkloadContainerImage([]byte(manifest), resource.MustParseID("default:rollout/podinfo"), "podinfo", ref)
+	require.NoError(t, err)
+	assert.Equal(t, strings.Replace(manifest, "3.1.0", "3.2.0", 1), string(out))
+}
@@ -19,6 +19,10 @@ type Mock struct {
 	PingFunc                      func() error
 	ExportFunc                    func(ctx context.Context) ([]byte, error)
 	SyncFunc                      func(cluster.SyncSet) error
+	DriftFunc                     func(ctx context.Context) ([]cluster.ResourceDrift, error)
+	ReadinessFunc                 func(ctx context.Context) ([]cluster.ResourceReadiness, error)
+	RunHookFunc                   func(ctx context.Context, hook resource.Resource, key string) (bool, error)
+	CanaryFunc                    func(ctx context.Context, workload resource.Resource, images map[string]image.Ref, replicas int) (resource.ID, error)
 	PublicSSHKeyFunc              func(regenerate bool) (ssh.PublicKey, error)
 	SetWorkloadContainerImageFunc func(def []byte, id resource.ID, container string, newImageID image.Ref) ([]byte, error)
 	LoadManifestsFunc             func(base string, paths []string) (map[string]resource.Resource, error)
@@ -56,6 +60,27 @@ func (m *Mock) Sync(c cluster.SyncSet) error {
 	return m.SyncFunc(c)
 }
 
+func (m *Mock) Drift(ctx context.Context) ([]cluster.ResourceDrift, error) {
+	return m.DriftFunc(ctx)
+}
+
+// Readiness reports nothing if ReadinessFunc isn't set, since it's
+// called after every sync.
+func (m *Mock) Readiness(ctx context.Context) ([]cluster.ResourceReadiness, error) {
+	if m.ReadinessFunc == nil {
+		return nil, nil
+	}
+	return m.ReadinessFunc(ctx)
+}
+
+func (m *Mock) RunHook(ctx context.Context, hook resource.Resource, key string) (bool, error) {
+	return m.RunHookFunc(ctx, hook, key)
+}
+
+func (m *Mock) Canary(ctx context.Context, workload resource.Resource, images map[string]image.Ref, replicas int) (resource.ID, error) {
+	return m.CanaryFunc(ctx, workload, images, replicas)
+}
+
 func (m *Mock) PublicSSHKey(regenerate bool) (ssh.PublicKey, error) {
 	return m.PublicSSHKeyFunc(regenerate)
 }
@@ -0,0 +1,39 @@
+package cluster
+
+import (
+	"github.com/fluxcd/flux/pkg/resource"
+)
+
+// The readiness of a resource, as worked out from its status in the
+// cluster. These follow kstatus
+// (https://github.com/kubernetes-sigs/cli-utils/tree/master/pkg/kstatus),
+// so that they mean the same here as for other tools.
+const (
+	// ReadinessCurrent means the resource has been reconciled, and
+	// is as its spec says.
+	ReadinessCurrent = "Current"
+	// ReadinessInProgress means the resource is still being
+	// reconciled.
+	ReadinessInProgress = "InProgress"
+	// ReadinessFailed means reconciling the resource has failed, and
+	// won't get any further without something being changed.
+	ReadinessFailed = "Failed"
+	// ReadinessTerminating means the resource is being deleted.
+	ReadinessTerminating = "Terminating"
+	// ReadinessUnknown means the status of the resource couldn't be
+	// worked out, or the resource wasn't found.
+	ReadinessUnknown = "Unknown"
+)
+
+// Readiness says whether a resource has been reconciled, with a
+// message explaining why if not.
+type Readiness struct {
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// ResourceReadiness is the readiness of a particular resource.
+type ResourceReadiness struct {
+	ResourceID resource.ID
+	Readiness
+}
@@ -1,6 +1,7 @@
 package cluster
 
 import (
+	"fmt"
 	"strings"
 
 	"github.com/fluxcd/flux/pkg/resource"
@@ -18,6 +19,11 @@ import (
 type SyncSet struct {
 	Name      string
 	Resources []resource.Resource
+	// Errors are for resources that couldn't be made ready to sync
+	// (e.g., because they couldn't be decrypted). They are reported
+	// along with any errors from syncing, and are not garbage
+	// collected.
+	Errors SyncError
 }
 
 type ResourceError struct {
@@ -35,3 +41,17 @@ func (err SyncError) Error() string {
 	}
 	return strings.Join(errs, "; ")
 }
+
+// GCAbortedError is returned from Sync when garbage collection was
+// abandoned because it would have deleted more resources than
+// allowed. The resources to be synced will still have been applied;
+// SyncErrors has any errors from applying them.
+type GCAbortedError struct {
+	Deletions    []resource.ID
+	MaxDeletions int
+	SyncErrors   SyncError
+}
+
+func (err *GCAbortedError) Error() string {
+	return fmt.Sprintf("garbage collection aborted: %d resources to delete is more than the maximum of %d", len(err.Deletions), err.MaxDeletions)
+}
@@ -0,0 +1,287 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/fluxcd/flux/pkg/canary"
+	"github.com/fluxcd/flux/pkg/image"
+	"github.com/fluxcd/flux/pkg/job"
+	fluxmetrics "github.com/fluxcd/flux/pkg/metrics"
+	"github.com/fluxcd/flux/pkg/policy"
+	"github.com/fluxcd/flux/pkg/resource"
+	"github.com/fluxcd/flux/pkg/update"
+)
+
+// canaryCheckInterval is how often the running canaries are looked
+// at, to see whether any is due to have its metrics checked.
+var canaryCheckInterval = 10 * time.Second
+
+// canaryTimeout is how long creating or removing a canary is given.
+var canaryTimeout = time.Minute
+
+// canaryQueryTimeout is how long checking the metrics of a canary is
+// given. Checks are made on the daemon loop, so this is kept short
+// whatever the analysis interval.
+var canaryQueryTimeout = 10 * time.Second
+
+// maxCanaryQueryErrors is how many times in a row the metrics for a
+// canary can fail to be queried before the canary is abandoned (and
+// started again at the next automation run).
+const maxCanaryQueryErrors = 3
+
+// Outcomes of a canary release
+const (
+	canaryPromoted  = "promoted"
+	canaryRejected  = "rejected"
+	canaryAbandoned = "abandoned"
+)
+
+// canaryRelease is an automated release of new images to a workload,
+// being tried out on a canary before it's committed.
+type canaryRelease struct {
+	workload resource.Resource
+	canary   resource.ID
+	analysis canary.Analysis
+	changes  []update.Change
+	passed   int
+	errors   int
+	next     time.Time
+	// outcome is empty while the canary is running. Once promoted or
+	// rejected, the release is kept until the automation run no
+	// longer comes up with the same changes (i.e., the commit has
+	// been synced), so that it's not started again meanwhile.
+	outcome string
+	// job is the job committing the outcome, if there is one; should
+	// it fail, the release is done with, so that it's started again.
+	job job.ID
+}
+
+func (r *canaryRelease) images() map[string]image.Ref {
+	images := map[string]image.Ref{}
+	for _, c := range r.changes {
+		images[c.Container.Name] = c.ImageID
+	}
+	return images
+}
+
+func (r *canaryRelease) target() canary.Target {
+	namespace, _, name := r.canary.Components()
+	_, _, workload := r.workload.ResourceID().Components()
+	return canary.Target{Namespace: namespace, Name: name, Workload: workload}
+}
+
+func sameImages(a, b map[string]image.Ref) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for container, ref := range a {
+		if other, ok := b[container]; !ok || other.String() != ref.String() {
+			return false
+		}
+	}
+	return true
+}
+
+// startCanaries takes the changes for workloads with a canary policy
+// out of those given, and starts a canary for each such workload,
+// unless one is already running with the same images. The changes
+// returned are those to be released straight away.
+func (d *Daemon) startCanaries(ctx context.Context, candidates resources, changes *update.Automated, logger log.Logger) *update.Automated {
+	direct := &update.Automated{}
+	byWorkload := map[resource.ID][]update.Change{}
+	for _, c := range changes.Changes {
+		if res, ok := candidates[c.WorkloadID]; ok && res.Policies().Has(policy.Canary) {
+			byWorkload[c.WorkloadID] = append(byWorkload[c.WorkloadID], c)
+			continue
+		}
+		direct.Changes = append(direct.Changes, c)
+	}
+	if d.canaryReleases == nil {
+		d.canaryReleases = map[resource.ID]*canaryRelease{}
+	}
+
+	// Releases for workloads that no longer have changes are done
+	// with, and their canaries (if still running) removed; as are
+	// releases whose outcome couldn't be committed.
+	for id, rel := range d.canaryReleases {
+		if _, ok := byWorkload[id]; !ok {
+			if rel.outcome == "" {
+				d.endCanary(rel, canaryAbandoned, log.With(logger, "workload", id))
+			}
+			delete(d.canaryReleases, id)
+			continue
+		}
+		if d.canaryJobFailed(rel) {
+			logger.Log("warning", "job for canary release failed", "workload", id, "outcome", rel.outcome, "job", rel.job)
+			delete(d.canaryReleases, id)
+		}
+	}
+
+	for id, cs := range byWorkload {
+		logger := log.With(logger, "workload", id)
+		rel := &canaryRelease{workload: candidates[id], changes: cs}
+		if running, ok := d.canaryReleases[id]; ok && sameImages(running.images(), rel.images()) {
+			continue
+		}
+		name, _ := rel.workload.Policies().Get(policy.Canary)
+		var ok bool
+		if d.Canaries != nil {
+			rel.analysis, ok = d.Canaries.Analysis(name)
+		}
+		if !ok {
+			logger.Log("warning", fmt.Sprintf("canary analysis %q not found", name), "action", "skip workload")
+			continue
+		}
+		ctx, cancel := context.WithTimeout(ctx, canaryTimeout)
+		canaryID, err := d.Cluster.Canary(ctx, rel.workload, rel.images(), rel.analysis.Replicas)
+		cancel()
+		if err != nil {
+			logger.Log("err", err, "action", "skip workload")
+			continue
+		}
+		rel.canary = canaryID
+		rel.next = time.Now().Add(rel.analysis.Interval)
+		d.canaryReleases[id] = rel
+		logger.Log("info", "started canary", "canary", canaryID, "analysis", name, "images", imagesString(rel.changes))
+	}
+	d.countCanaries()
+	return direct
+}
+
+// checkCanaries checks the metrics of each running canary that's due
+// to be checked, and promotes or rejects those that have passed or
+// failed.
+func (d *Daemon) checkCanaries(logger log.Logger) {
+	now := time.Now()
+	for id, rel := range d.canaryReleases {
+		if rel.outcome != "" || now.Before(rel.next) {
+			continue
+		}
+		rel.next = now.Add(rel.analysis.Interval)
+		logger := log.With(logger, "workload", id, "canary", rel.canary)
+		ctx, cancel := context.WithTimeout(context.Background(), canaryQueryTimeout)
+		failures, err := rel.analysis.Check(ctx, d.CanaryMetrics, rel.target())
+		cancel()
+		switch {
+		case err != nil:
+			rel.errors++
+			logger.Log("warning", "unable to check canary metrics", "err", err, "attempts", rel.errors)
+			if rel.errors >= maxCanaryQueryErrors {
+				d.endCanary(rel, canaryAbandoned, logger)
+				delete(d.canaryReleases, id)
+			}
+		case len(failures) > 0:
+			d.rejectCanary(rel, failures, logger)
+		default:
+			rel.errors = 0
+			rel.passed++
+			logger.Log("info", "canary passed check", "passed", rel.passed, "iterations", rel.analysis.Iterations)
+			if rel.passed >= rel.analysis.Iterations {
+				d.promoteCanary(rel, logger)
+			}
+		}
+	}
+	d.countCanaries()
+}
+
+// promoteCanary releases the images tried out on the canary to the
+// workload, as an automated release would have without a canary.
+func (d *Daemon) promoteCanary(rel *canaryRelease, logger log.Logger) {
+	spec := update.Spec{Type: update.Auto, Spec: &update.Automated{Changes: rel.changes}}
+	jobID, err := d.UpdateManifests(context.Background(), spec)
+	if err != nil {
+		logger.Log("err", err)
+		d.endCanary(rel, canaryAbandoned, logger)
+		delete(d.canaryReleases, rel.workload.ResourceID())
+		return
+	}
+	logger.Log("info", "promoting canary", "images", imagesString(rel.changes), "job", jobID)
+	rel.job = jobID
+	d.endCanary(rel, canaryPromoted, logger)
+}
+
+// rejectCanary adds the tags tried out on the canary to the reject
+// policies of the workload, so that automation passes over them.
+func (d *Daemon) rejectCanary(rel *canaryRelease, failures []string, logger log.Logger) {
+	logger.Log("info", "rejecting canary", "images", imagesString(rel.changes), "failures", strings.Join(failures, "; "))
+	id := rel.workload.ResourceID()
+	add := policy.Set{}
+	for _, c := range rel.changes {
+		p := policy.RejectPrefix(c.Container.Name)
+		add = add.Set(p, policy.AddRejected(rel.workload.Policies()[p], c.ImageID.Tag))
+	}
+	spec := update.Spec{
+		Type: update.Policy,
+		Cause: update.Cause{
+			Message: fmt.Sprintf("Reject %s for %s\n\nCanary analysis %q failed: %s", imagesString(rel.changes), id, rel.analysis.Name, strings.Join(failures, "; ")),
+		},
+		Spec: resource.PolicyUpdates{id: resource.PolicyUpdate{Add: add}},
+	}
+	jobID, err := d.UpdateManifests(context.Background(), spec)
+	if err != nil {
+		logger.Log("err", err)
+		d.endCanary(rel, canaryAbandoned, logger)
+		delete(d.canaryReleases, id)
+		return
+	}
+	rel.job = jobID
+	d.endCanary(rel, canaryRejected, logger)
+}
+
+// canaryJobFailed says whether the job committing the outcome of a
+// release is known to have failed.
+func (d *Daemon) canaryJobFailed(rel *canaryRelease) bool {
+	if rel.job == "" || d.JobStatusCache == nil {
+		return false
+	}
+	status, ok := d.JobStatusCache.Status(rel.job)
+	return ok && status.StatusString == job.StatusFailed
+}
+
+// endCanary removes the canary of a release, and records the outcome.
+func (d *Daemon) endCanary(rel *canaryRelease, outcome string, logger log.Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), canaryTimeout)
+	defer cancel()
+	if _, err := d.Cluster.Canary(ctx, rel.workload, nil, 0); err != nil {
+		logger.Log("warning", "unable to remove canary", "err", err)
+	}
+	rel.outcome = outcome
+	canaryOutcomes.With(fluxmetrics.LabelOutcome, outcome).Add(1)
+}
+
+// stopCanaries removes any canaries still running, e.g., when the
+// daemon stops looping.
+func (d *Daemon) stopCanaries(logger log.Logger) {
+	for id, rel := range d.canaryReleases {
+		if rel.outcome == "" {
+			d.endCanary(rel, canaryAbandoned, log.With(logger, "workload", id))
+		}
+		delete(d.canaryReleases, id)
+	}
+	d.countCanaries()
+}
+
+func (d *Daemon) countCanaries() {
+	var running int
+	for _, rel := range d.canaryReleases {
+		if rel.outcome == "" {
+			running++
+		}
+	}
+	canariesRunning.Set(float64(running))
+}
+
+func imagesString(changes []update.Change) string {
+	var images []string
+	for _, c := range changes {
+		images = append(images, c.ImageID.String())
+	}
+	sort.Strings(images)
+	return strings.Join(images, ", ")
+}
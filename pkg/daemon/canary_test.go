@@ -0,0 +1,130 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fluxcd/flux/pkg/canary"
+	"github.com/fluxcd/flux/pkg/image"
+	"github.com/fluxcd/flux/pkg/job"
+	"github.com/fluxcd/flux/pkg/policy"
+	"github.com/fluxcd/flux/pkg/resource"
+	"github.com/fluxcd/flux/pkg/update"
+)
+
+const testCanaryConfig = `prometheus: http://prometheus:9090
+analyses:
+- name: http
+  interval: 1ns
+  iterations: 2
+  replicas: 2
+  metrics:
+  - name: error-rate
+    query: errors{pod=~"{{.Name}}-.*"}
+    max: 0.01
+`
+
+// stubMetrics gives the same value (or error) for any query.
+type stubMetrics struct {
+	value float64
+	err   error
+}
+
+func (s *stubMetrics) Query(context.Context, string) (float64, error) {
+	return s.value, s.err
+}
+
+func TestCanaries(t *testing.T) {
+	d, _, clean, k8s, _, _ := mockDaemon(t)
+	defer clean()
+	logger := log.NewNopLogger()
+	ctx := context.Background()
+
+	config, err := canary.ParseConfig(strings.NewReader(testCanaryConfig))
+	require.NoError(t, err)
+	metrics := &stubMetrics{}
+	d.Canaries, d.CanaryMetrics = &config, metrics
+
+	var calls []int
+	k8s.CanaryFunc = func(_ context.Context, workload resource.Resource, images map[string]image.Ref, replicas int) (resource.ID, error) {
+		calls = append(calls, replicas)
+		if replicas > 0 {
+			assert.Equal(t, newHelloImage, images[container].String())
+		}
+		_, _, name := workload.ResourceID().Components()
+		return resource.MakeID(ns, "deployment", name+"-canary"), nil
+	}
+
+	id := resource.MustParseID(wl)
+	other := resource.MustParseID(anotherWl)
+	candidates := resources{
+		id:    candidate{resourceID: id, policies: policy.Set{policy.Automated: "true", policy.Canary: "http"}},
+		other: candidate{resourceID: other, policies: policy.Set{policy.Automated: "true"}},
+	}
+	changes := &update.Automated{}
+	changes.Add(id, resource.Container{Name: container}, mustParseImageRef(newHelloImage))
+	changes.Add(other, resource.Container{Name: anotherContainer}, mustParseImageRef(anotherImage))
+	queued := func() int {
+		d.Jobs.Sync()
+		return d.Jobs.Len()
+	}
+
+	// the workload with a canary policy gets a canary, the other is
+	// released straight away
+	direct := d.startCanaries(ctx, candidates, changes, logger)
+	assert.Equal(t, []update.Change{changes.Changes[1]}, direct.Changes)
+	assert.Equal(t, []int{2}, calls)
+
+	// the canary's not started again for the same images
+	d.startCanaries(ctx, candidates, changes, logger)
+	assert.Equal(t, []int{2}, calls)
+
+	// and is promoted once enough checks have passed
+	d.checkCanaries(logger)
+	assert.Equal(t, 0, queued())
+	d.checkCanaries(logger)
+	assert.Equal(t, 1, queued())
+	assert.Equal(t, []int{2, 0}, calls)
+	assert.Equal(t, canaryPromoted, d.canaryReleases[id].outcome)
+
+	// until the release has been synced, the changes are the same,
+	// and there's no new canary
+	d.startCanaries(ctx, candidates, changes, logger)
+	assert.Equal(t, []int{2, 0}, calls)
+
+	// unless the job committing the release failed, in which case
+	// the canary is started again
+	d.JobStatusCache.SetStatus(d.canaryReleases[id].job, job.Status{StatusString: job.StatusFailed})
+	d.startCanaries(ctx, candidates, changes, logger)
+	assert.Equal(t, []int{2, 0, 2}, calls)
+	assert.Equal(t, "", d.canaryReleases[id].outcome)
+	d.startCanaries(ctx, candidates, &update.Automated{}, logger)
+	assert.Empty(t, d.canaryReleases)
+
+	// a canary failing its checks is rejected
+	calls = nil
+	d.startCanaries(ctx, candidates, changes, logger)
+	metrics.value = 0.5
+	d.checkCanaries(logger)
+	assert.Equal(t, []int{2, 0}, calls)
+	assert.Equal(t, canaryRejected, d.canaryReleases[id].outcome)
+	assert.Equal(t, 2, queued())
+
+	// a canary whose metrics can't be queried is abandoned in the end
+	calls = nil
+	d.startCanaries(ctx, candidates, &update.Automated{}, logger)
+	d.startCanaries(ctx, candidates, changes, logger)
+	metrics.err = errors.New("prometheus is down")
+	for i := 0; i < maxCanaryQueryErrors; i++ {
+		d.checkCanaries(logger)
+	}
+	assert.Equal(t, []int{2, 0}, calls)
+	assert.Empty(t, d.canaryReleases)
+	assert.Equal(t, 2, queued())
+}
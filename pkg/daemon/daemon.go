@@ -17,6 +17,7 @@ import (
 	"github.com/fluxcd/flux/pkg/api/v6"
 	"github.com/fluxcd/flux/pkg/api/v9"
 	"github.com/fluxcd/flux/pkg/cluster"
+	"github.com/fluxcd/flux/pkg/decrypt"
 	"github.com/fluxcd/flux/pkg/event"
 	"github.com/fluxcd/flux/pkg/git"
 	"github.com/fluxcd/flux/pkg/guid"
@@ -47,6 +48,8 @@ type Daemon struct {
 	Logger                    log.Logger
 	ManifestGenerationEnabled bool
 	GitSecretEnabled          bool
+	// Decrypter, if set, decrypts resources before they are synced
+	Decrypter *decrypt.Decrypter
 	// bookkeeping
 	*LoopVars
 }
@@ -138,8 +141,10 @@ func (d *Daemon) ListServicesWithOptions(ctx context.Context, opts v11.ListServi
 		repoIsReadonly := d.Repo.Readonly()
 
 		var policies policy.Set
+		var sources map[string]string
 		if resource, ok := resources[workload.ID.String()]; ok {
 			policies = resource.Policies()
+			sources = policySources(resource)
 		}
 		switch {
 		case policies == nil:
@@ -159,6 +164,7 @@ func (d *Daemon) ListServicesWithOptions(ctx context.Context, opts v11.ListServi
 			ReadOnly:   readOnly,
 			Status:     workload.Status,
 			Rollout:    workload.Rollout,
+			Readiness:  workload.Readiness,
 			SyncError:  syncError,
 			Antecedent: workload.Antecedent,
 			Labels:     workload.Labels,
@@ -166,12 +172,28 @@ func (d *Daemon) ListServicesWithOptions(ctx context.Context, opts v11.ListServi
 			Locked:     policies.Has(policy.Locked),
 			Ignore:     policies.Has(policy.Ignore),
 			Policies:   policies.ToStringMap(),
+
+			PolicySources: sources,
 		})
 	}
 
 	return res, nil
 }
 
+// policySources says where the policies of a resource came from, if
+// any were inherited.
+func policySources(res resource.Resource) map[string]string {
+	inherited, ok := res.(resource.InheritedPolicies)
+	if !ok {
+		return nil
+	}
+	sources := map[string]string{}
+	for p, source := range inherited.PolicySources() {
+		sources[string(p)] = source
+	}
+	return sources
+}
+
 type clusterContainers []cluster.Workload
 
 func (cs clusterContainers) Len() int {
@@ -353,6 +375,11 @@ func (d *Daemon) UpdateManifests(ctx context.Context, spec update.Spec) (job.ID,
 		return d.queueJob(d.makeLoggingJobFunc(d.makeJobFromUpdate(d.release(spec, s)))), nil
 	case resource.PolicyUpdates:
 		return d.queueJob(d.makeLoggingJobFunc(d.makeJobFromUpdate(d.updatePolicies(spec, s)))), nil
+	case update.RejectSpec:
+		if err := s.Validate(); err != nil {
+			return id, err
+		}
+		return d.queueJob(d.makeLoggingJobFunc(d.makeJobFromUpdate(d.reject(spec, s)))), nil
 	case update.ManualSync:
 		return d.queueJob(d.sync()), nil
 	default:
@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -17,6 +18,7 @@ import (
 
 	"github.com/fluxcd/flux/pkg/api/v10"
 	"github.com/fluxcd/flux/pkg/api/v11"
+	"github.com/fluxcd/flux/pkg/api/v12"
 	"github.com/fluxcd/flux/pkg/api/v6"
 	"github.com/fluxcd/flux/pkg/api/v9"
 	"github.com/fluxcd/flux/pkg/cluster"
@@ -527,6 +529,370 @@ func TestDaemon_PolicyUpdate(t *testing.T) {
 	}, "Waiting for new annotation")
 }
 
+func TestDaemon_Rollback(t *testing.T) {
+	d, start, clean, k8s, _, _ := mockDaemon(t)
+	start()
+	defer clean()
+	w := newWait(t)
+
+	ctx := context.Background()
+
+	// Release a new image, so there's something to roll back
+	w.ForJobSucceeded(d, updateImage(ctx, d, t))
+	w.ForImageTag(t, d, wl, container, "2")
+
+	// Pretend the release has been applied to the cluster
+	k8s.SomeWorkloadsFunc = func(ctx context.Context, ids []resource.ID) ([]cluster.Workload, error) {
+		return []cluster.Workload{{
+			ID: resource.MustParseID(wl),
+			Containers: cluster.ContainersOrExcuse{
+				Containers: []resource.Container{
+					{Name: container, Image: mustParseImageRef(newHelloImage)},
+				},
+			},
+		}}, nil
+	}
+
+	id, err := d.Rollback(ctx, v12.RollbackOptions{
+		RollbackSpec: update.RollbackSpec{
+			Workload: resource.MustParseID(wl),
+		},
+		Cause: update.Cause{
+			User:    "fluxtest",
+			Message: "bad release",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stat := w.ForJobSucceeded(d, id)
+	assert.Equal(t, update.ReleaseStatusSuccess, stat.Result.Result[resource.MustParseID(wl)].Status)
+	w.ForImageTag(t, d, wl, container, "master-a000001")
+
+	// The workload is locked, so that automation doesn't undo the rollback
+	var policies policy.Set
+	w.Eventually(func() bool {
+		// the clone can fail while the sync tag is being moved
+		co, err := d.Repo.Clone(ctx, d.GitConfig)
+		if err != nil {
+			return false
+		}
+		defer co.Clean()
+		cm := manifests.NewRawFiles(co.Dir(), co.AbsolutePaths(), d.Manifests)
+		resources, err := cm.GetAllResourcesByID(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		policies = resources[wl].Policies()
+		return true
+	}, "Waiting for a clone of the repo")
+	assert.True(t, policies.Has(policy.Locked))
+	msg, _ := policies.Get(policy.LockedMsg)
+	assert.Contains(t, msg, "bad release")
+}
+
+func TestDaemon_RollbackNotEnoughHistory(t *testing.T) {
+	d, start, clean, _, _, _ := mockDaemon(t)
+	start()
+	defer clean()
+
+	ctx := context.Background()
+
+	id, err := d.Rollback(ctx, v12.RollbackOptions{
+		RollbackSpec: update.RollbackSpec{
+			Workload: resource.MustParseID(wl),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := newWait(t)
+	w.Eventually(func() bool {
+		stat, err := d.JobStatus(ctx, id)
+		return err == nil && stat.StatusString == job.StatusFailed
+	}, "Waiting for job to fail")
+}
+
+func TestMatchRevision(t *testing.T) {
+	commits := []git.Commit{
+		{Revision: "abc1234000"},
+		{Revision: "abc5678000"},
+		{Revision: "def0000000"},
+	}
+	rev, err := matchRevision(commits, "abc1")
+	assert.NoError(t, err)
+	assert.Equal(t, "abc1234000", rev)
+	rev, err = matchRevision(commits, "def0000000")
+	assert.NoError(t, err)
+	assert.Equal(t, "def0000000", rev)
+	_, err = matchRevision(commits, "abc")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "ambiguous")
+	_, err = matchRevision(commits, "fff")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "not found")
+}
+
+func TestRollbackTargets(t *testing.T) {
+	changes := []imageChange{
+		{
+			Revision: "c",
+			Containers: []update.ContainerUpdate{
+				{Container: "one", Current: mustParseImageRef("foo:2"), Target: mustParseImageRef("foo:3")},
+			},
+		},
+		{
+			Revision: "b",
+			Containers: []update.ContainerUpdate{
+				{Container: "one", Current: mustParseImageRef("foo:1"), Target: mustParseImageRef("foo:2")},
+				{Container: "two", Current: mustParseImageRef("bar:1"), Target: mustParseImageRef("bar:2")},
+			},
+		},
+	}
+	targets := rollbackTargets(changes)
+	assert.Equal(t, map[string]image.Ref{
+		"one": mustParseImageRef("foo:1"),
+		"two": mustParseImageRef("bar:1"),
+	}, targets)
+}
+
+func TestDaemon_WorkloadHistory(t *testing.T) {
+	d, start, clean, _, _, _ := mockDaemon(t)
+	start()
+	defer clean()
+	w := newWait(t)
+
+	ctx := context.Background()
+	id := resource.MustParseID(wl)
+
+	w.ForJobSucceeded(d, updateImage(ctx, d, t))
+	w.ForJobSucceeded(d, updatePolicy(ctx, t, d))
+
+	history, err := d.WorkloadHistory(ctx, v12.WorkloadHistoryOptions{Workload: id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The policy change, the release, and the commit(s) that set up
+	// the test repo
+	if len(history.Entries) < 3 {
+		t.Fatalf("expected at least three entries, got %d", len(history.Entries))
+	}
+	assert.Equal(t, update.Policy, history.Entries[0].UpdateType)
+	assert.True(t, history.Entries[0].Policies.Add.Has(policy.Locked))
+	assert.Equal(t, update.Images, history.Entries[1].UpdateType)
+	if assert.Len(t, history.Entries[1].Images, 1) {
+		assert.Equal(t, container, history.Entries[1].Images[0].Container)
+		assert.Equal(t, newHelloImage, history.Entries[1].Images[0].Target.String())
+	}
+	assert.Equal(t, "", history.Entries[2].UpdateType)
+	assert.Empty(t, history.Next)
+
+	// Paging through gives the same entries
+	var paged []v12.HistoryEntry
+	opts := v12.WorkloadHistoryOptions{Workload: id, Limit: 1}
+	for {
+		page, err := d.WorkloadHistory(ctx, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paged = append(paged, page.Entries...)
+		if page.Next == "" {
+			break
+		}
+		assert.Len(t, page.Entries, 1)
+		opts.Before = page.Next
+	}
+	// The sync loop runs in the background, so whether an entry is
+	// synced can change between calls; compare the commits only.
+	revisions := func(entries []v12.HistoryEntry) (revs []string) {
+		for _, e := range entries {
+			revs = append(revs, e.Revision)
+		}
+		return revs
+	}
+	assert.Equal(t, revisions(history.Entries), revisions(paged))
+
+	_, err = d.WorkloadHistory(ctx, v12.WorkloadHistoryOptions{Workload: id, Before: "0000000"})
+	assert.Error(t, err)
+}
+
+func TestDaemon_CheckDrift(t *testing.T) {
+	d, _, clean, k8s, events, _ := mockDaemon(t)
+	defer clean()
+	d.DriftInterval = time.Minute
+	d.ensureInit()
+
+	reported := resource.MustParseID("default:deployment/reported")
+	drifted := []cluster.ResourceDrift{
+		{
+			ResourceID: resource.MustParseID(wl),
+			Reason:     cluster.DriftModified,
+			Fields:     []string{"spec.replicas"},
+		},
+		{
+			ResourceID: reported,
+			Reason:     cluster.DriftMissing,
+			Policies:   policy.Set{policy.Drift: policy.DriftReport},
+		},
+	}
+	k8s.DriftFunc = func(context.Context) ([]cluster.ResourceDrift, error) {
+		return drifted, nil
+	}
+
+	// By default, drift is only reported
+	d.checkDrift(context.Background(), log.NewNopLogger())
+	status, err := d.DriftStatus(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, status.Enabled)
+	if assert.Len(t, status.Resources, 2) {
+		assert.False(t, status.Resources[0].Correct)
+		assert.False(t, status.Resources[1].Correct)
+	}
+	assert.Len(t, events.events, 1)
+	assert.Equal(t, event.EventDrift, events.events[0].Type)
+	assert.Len(t, d.syncSoon, 0)
+
+	// The same drift doesn't make another event, but it is corrected
+	// (except where the policy says not to) once asked for
+	d.DriftCorrection = true
+	d.checkDrift(context.Background(), log.NewNopLogger())
+	status, _ = d.DriftStatus(context.Background())
+	if assert.Len(t, status.Resources, 2) {
+		assert.True(t, status.Resources[0].Correct)
+		assert.False(t, status.Resources[1].Correct)
+	}
+	assert.Len(t, events.events, 1)
+	assert.Len(t, d.syncSoon, 1)
+
+	k8s.DriftFunc = func(context.Context) ([]cluster.ResourceDrift, error) {
+		return nil, fmt.Errorf("cluster unavailable")
+	}
+	d.checkDrift(context.Background(), log.NewNopLogger())
+	status, _ = d.DriftStatus(context.Background())
+	assert.Equal(t, "cluster unavailable", status.Error)
+
+	// Checks run in the background, and not more than one at a time
+	unblock := make(chan struct{})
+	var calls int32
+	k8s.DriftFunc = func(context.Context) ([]cluster.ResourceDrift, error) {
+		atomic.AddInt32(&calls, 1)
+		<-unblock
+		return nil, nil
+	}
+	var wg sync.WaitGroup
+	d.startDriftCheck(context.Background(), &wg, log.NewNopLogger())
+	d.startDriftCheck(context.Background(), &wg, log.NewNopLogger())
+	close(unblock)
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestDaemon_CheckReadiness(t *testing.T) {
+	d, _, clean, k8s, _, _ := mockDaemon(t)
+	defer clean()
+
+	failing := resource.MustParseID("default:helmrelease/failing")
+	k8s.ReadinessFunc = func(context.Context) ([]cluster.ResourceReadiness, error) {
+		return []cluster.ResourceReadiness{
+			{ResourceID: resource.MustParseID(wl), Readiness: cluster.Readiness{Status: cluster.ReadinessCurrent}},
+			{ResourceID: failing, Readiness: cluster.Readiness{Status: cluster.ReadinessFailed, Message: "chart not found"}},
+		}, nil
+	}
+	notReady := d.checkReadiness(context.Background(), log.NewNopLogger())
+	assert.Equal(t, []event.ResourceReadiness{
+		{ID: failing, Status: cluster.ReadinessFailed, Message: "chart not found"},
+	}, notReady)
+
+	k8s.ReadinessFunc = func(context.Context) ([]cluster.ResourceReadiness, error) {
+		return nil, fmt.Errorf("cluster unavailable")
+	}
+	assert.Nil(t, d.checkReadiness(context.Background(), log.NewNopLogger()))
+
+	// Periodic checks run in the background, and not more than one
+	// at a time
+	unblock := make(chan struct{})
+	var calls int32
+	k8s.ReadinessFunc = func(context.Context) ([]cluster.ResourceReadiness, error) {
+		atomic.AddInt32(&calls, 1)
+		<-unblock
+		return nil, nil
+	}
+	var wg sync.WaitGroup
+	d.startReadinessCheck(context.Background(), &wg, log.NewNopLogger())
+	d.startReadinessCheck(context.Background(), &wg, log.NewNopLogger())
+	close(unblock)
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestDaemon_Reject(t *testing.T) {
+	d, start, clean, _, _, _ := mockDaemon(t)
+	start()
+	defer clean()
+	w := newWait(t)
+
+	ctx := context.Background()
+	policies := func() policy.Set {
+		var policies policy.Set
+		w.Eventually(func() bool {
+			// the clone can fail while the sync tag is being moved
+			co, err := d.Repo.Clone(ctx, d.GitConfig)
+			if err != nil {
+				return false
+			}
+			defer co.Clean()
+			cm := manifests.NewRawFiles(co.Dir(), co.AbsolutePaths(), d.Manifests)
+			resources, err := cm.GetAllResourcesByID(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			policies = resources[wl].Policies()
+			return true
+		}, "Waiting for a clone of the repo")
+		return policies
+	}
+
+	// A tag needs a container to be rejected for
+	_, err := d.UpdateManifests(ctx, update.Spec{
+		Type: update.Reject,
+		Spec: update.RejectSpec{Images: []string{"2"}},
+	})
+	assert.Error(t, err)
+
+	// Rejected for a container of the workload
+	stat := w.ForJobSucceeded(d, updateManifest(ctx, t, d, update.Spec{
+		Type: update.Reject,
+		Spec: update.RejectSpec{
+			Workload:  resource.MustParseID(wl),
+			Container: container,
+			Images:    []string{"2"},
+		},
+	}))
+	assert.Equal(t, update.ReleaseStatusSuccess, stat.Result.Result[resource.MustParseID(wl)].Status)
+	assert.Equal(t, "2", policies()[policy.RejectPrefix(container)])
+
+	// Rejected for every workload, in the .flux.yaml
+	stat = w.ForJobSucceeded(d, updateManifest(ctx, t, d, update.Spec{
+		Type: update.Reject,
+		Spec: update.RejectSpec{Images: []string{oldHelloImage}},
+	}))
+	assert.NotEmpty(t, stat.Result.Revision)
+	assert.Equal(t, oldHelloImage, policies()[policy.Reject])
+
+	// and allowed again
+	w.ForJobSucceeded(d, updateManifest(ctx, t, d, update.Spec{
+		Type: update.Reject,
+		Spec: update.RejectSpec{
+			Workload:  resource.MustParseID(wl),
+			Container: container,
+			Images:    []string{"2"},
+			Remove:    true,
+		},
+	}))
+	_, ok := policies()[policy.RejectPrefix(container)]
+	assert.False(t, ok)
+}
+
 // When I call sync status, it should return a commit showing the sync
 // that is about to take place. Then it should return empty once it is
 // complete
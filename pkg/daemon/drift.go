@@ -0,0 +1,185 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/fluxcd/flux/pkg/api/v12"
+	"github.com/fluxcd/flux/pkg/cluster"
+	"github.com/fluxcd/flux/pkg/event"
+	fluxmetrics "github.com/fluxcd/flux/pkg/metrics"
+	"github.com/fluxcd/flux/pkg/policy"
+	"github.com/fluxcd/flux/pkg/resource"
+)
+
+// driftCheckTimeout is how long a drift check is given.
+var driftCheckTimeout = 5 * time.Minute
+
+// driftState keeps the outcome of the most recent drift check, so it
+// can be reported through the API.
+type driftState struct {
+	mu        sync.RWMutex
+	checking  bool
+	checkedAt time.Time
+	err       error
+	resources []v12.ResourceDrift
+}
+
+// record stores the result of a check, and returns true if the set of
+// drifted resources (and how they've drifted) has changed since the
+// previous check.
+func (s *driftState) record(checkedAt time.Time, resources []v12.ResourceDrift, err error) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checkedAt = checkedAt
+	s.err = err
+	if err != nil {
+		return false
+	}
+	changed := driftKey(s.resources) != driftKey(resources)
+	s.resources = resources
+	return changed
+}
+
+// begin marks a check as running, and returns false if one already
+// is.
+func (s *driftState) begin() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.checking {
+		return false
+	}
+	s.checking = true
+	return true
+}
+
+func (s *driftState) end() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checking = false
+}
+
+func driftKey(resources []v12.ResourceDrift) string {
+	var keys []string
+	for _, r := range resources {
+		keys = append(keys, fmt.Sprintf("%s:%s:%s", r.ResourceID, r.Reason, strings.Join(r.Fields, ",")))
+	}
+	return strings.Join(keys, ";")
+}
+
+// correctDrift says whether a drifted resource should be synced
+// straight away, according to its policy or otherwise the daemon's
+// default.
+func (d *Daemon) correctDrift(r cluster.ResourceDrift) bool {
+	if mode, ok := r.Policies.Get(policy.Drift); ok {
+		switch mode {
+		case policy.DriftCorrect:
+			return true
+		case policy.DriftReport:
+			return false
+		}
+	}
+	return d.DriftCorrection
+}
+
+// startDriftCheck checks for drift in the background, so that syncs
+// and automation aren't held up while the cluster is compared with
+// the last sync. If the previous check is still running, there's no
+// new check.
+func (d *Daemon) startDriftCheck(ctx context.Context, wg *sync.WaitGroup, logger log.Logger) {
+	if !d.driftState.begin() {
+		logger.Log("info", "previous drift check still running; skipping")
+		return
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer d.driftState.end()
+		ctx, cancel := context.WithTimeout(ctx, driftCheckTimeout)
+		defer cancel()
+		d.checkDrift(ctx, logger)
+	}()
+}
+
+// checkDrift asks the cluster for resources that have changed since
+// the last sync, reports them in metrics and (when they've changed)
+// as an event, and asks for a sync if any should be corrected.
+func (d *Daemon) checkDrift(ctx context.Context, logger log.Logger) {
+	started := time.Now().UTC()
+	drifted, err := d.Cluster.Drift(ctx)
+	driftCheckDuration.With(
+		fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+	).Observe(time.Since(started).Seconds())
+	if err != nil {
+		d.driftState.record(started, nil, err)
+		logger.Log("err", err)
+		return
+	}
+
+	counts := map[string]int{cluster.DriftMissing: 0, cluster.DriftModified: 0}
+	var resources []v12.ResourceDrift
+	correct := false
+	for _, r := range drifted {
+		counts[r.Reason]++
+		res := v12.ResourceDrift{ResourceDrift: r, Correct: d.correctDrift(r)}
+		correct = correct || res.Correct
+		resources = append(resources, res)
+	}
+	for reason, n := range counts {
+		driftedResources.With(fluxmetrics.LabelReason, reason).Set(float64(n))
+	}
+
+	// Only tell people about drift when there's something new to
+	// tell; otherwise, the same event would be logged every check.
+	if d.driftState.record(started, resources, nil) && len(resources) > 0 {
+		metadata := &event.DriftEventMetadata{Correcting: correct}
+		for _, r := range resources {
+			metadata.Resources = append(metadata.Resources, event.ResourceDrift{
+				ID:     r.ResourceID,
+				Path:   r.Source,
+				Reason: r.Reason,
+				Fields: r.Fields,
+			})
+		}
+		logger.Log("event", "drift", "resources", len(resources), "correcting", correct)
+		if err := d.LogEvent(event.Event{
+			ServiceIDs: driftIDs(resources),
+			Type:       event.EventDrift,
+			StartedAt:  started,
+			EndedAt:    started,
+			LogLevel:   event.LogLevelWarn,
+			Metadata:   metadata,
+		}); err != nil {
+			logger.Log("err", err)
+		}
+	}
+	if correct {
+		d.AskForSync()
+	}
+}
+
+func driftIDs(resources []v12.ResourceDrift) []resource.ID {
+	ids := make([]resource.ID, len(resources))
+	for i, r := range resources {
+		ids[i] = r.ResourceID
+	}
+	return ids
+}
+
+// DriftStatus reports the outcome of the most recent drift check.
+func (d *Daemon) DriftStatus(ctx context.Context) (v12.DriftStatus, error) {
+	status := v12.DriftStatus{Enabled: d.DriftInterval > 0}
+	d.driftState.mu.RLock()
+	defer d.driftState.mu.RUnlock()
+	status.CheckedAt = d.driftState.checkedAt
+	if d.driftState.err != nil {
+		status.Error = d.driftState.err.Error()
+	}
+	status.Resources = d.driftState.resources
+	return status, nil
+}
@@ -85,3 +85,52 @@ HEAD is
 `,
 	}
 }
+
+func unknownRevisionError(rev string) error {
+	return &fluxerr.Error{
+		Type: fluxerr.Missing,
+		Err:  fmt.Errorf("revision %q not found", rev),
+		Help: `Revision not found
+
+The revision given is not in the history of the branch Flux is using,
+or does not touch the paths Flux is configured to look at. Check the
+revision with
+
+    git log -- <paths>
+
+and try again with a revision from that list.
+`,
+	}
+}
+
+func ambiguousRevisionError(rev string, matches int) error {
+	return &fluxerr.Error{
+		Type: fluxerr.User,
+		Err:  fmt.Errorf("revision %q is ambiguous; it matches %d commits", rev, matches),
+		Help: `Ambiguous revision
+
+The abbreviated revision given is the start of more than one commit in
+the history of the branch Flux is using. Give more of the revision, or
+all of it, and try again.
+`,
+	}
+}
+
+func notEnoughHistoryError(id resource.ID, wanted, found int) error {
+	return &fluxerr.Error{
+		Type: fluxerr.User,
+		Err:  fmt.Errorf("cannot roll back %s by %d image change(s); only %d recorded", id, wanted, found),
+		Help: `Not enough image history to roll back
+
+Flux finds the images to roll back to in the notes it attaches to the
+commits it makes. Image changes made by editing the files directly in
+git are not recorded there, so cannot be rolled back this way.
+
+You can use
+
+    fluxctl release --workload=<workload> --update-image=<image> --force
+
+to release a specific image instead.
+`,
+	}
+}
@@ -0,0 +1,211 @@
+package daemon
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/fluxcd/flux/pkg/api/v12"
+	"github.com/fluxcd/flux/pkg/git"
+	"github.com/fluxcd/flux/pkg/resource"
+	"github.com/fluxcd/flux/pkg/update"
+)
+
+const (
+	defaultHistoryLimit = 20
+	// maxSyncTimes bounds the number of revisions for which we
+	// remember the sync time.
+	maxSyncTimes = 1000
+)
+
+// syncTimes remembers when revisions were applied to the cluster. It
+// only knows about syncs since the daemon started, since there's
+// nowhere in git to keep this.
+type syncTimes struct {
+	mu    sync.Mutex
+	times map[string]time.Time
+	order []string
+}
+
+func (s *syncTimes) record(at time.Time, revisions ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.times == nil {
+		s.times = map[string]time.Time{}
+	}
+	for _, rev := range revisions {
+		if _, ok := s.times[rev]; ok {
+			continue
+		}
+		s.times[rev] = at
+		s.order = append(s.order, rev)
+	}
+	for len(s.order) > maxSyncTimes {
+		delete(s.times, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+func (s *syncTimes) syncedAt(rev string) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.times[rev]
+	return t, ok
+}
+
+// WorkloadHistory reconstructs the changes made to a workload from
+// the commits that touched the file it is defined in, and the notes
+// flux attached to those it made itself.
+func (d *Daemon) WorkloadHistory(ctx context.Context, opts v12.WorkloadHistoryOptions) (v12.WorkloadHistory, error) {
+	history := v12.WorkloadHistory{Workload: opts.Workload}
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+
+	// If the workload is defined in a file, look at all commits to
+	// that file. Otherwise (e.g., it's generated, or has been
+	// removed) the best we can do is look for notes about it.
+	var source string
+	err := d.WithReadonlyClone(ctx, func(checkout *git.Export) error {
+		cm, err := d.getManifestStore(checkout)
+		if err != nil {
+			return err
+		}
+		resources, err := cm.GetAllResourcesByID(ctx)
+		if err != nil {
+			return manifestLoadError(err)
+		}
+		if res, ok := resources[opts.Workload.String()]; ok {
+			if _, err := os.Stat(filepath.Join(checkout.Dir(), res.Source())); err == nil {
+				source = res.Source()
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return history, err
+	}
+	paths := d.GitConfig.Paths
+	if source != "" {
+		paths = []string{source}
+	}
+
+	notes, err := d.Repo.NoteRevList(ctx, d.GitConfig.NotesRef)
+	if err != nil {
+		return history, errors.Wrap(err, "enumerating commit notes")
+	}
+	head, err := d.Repo.BranchHead(ctx)
+	if err != nil {
+		return history, err
+	}
+	commits, err := d.Repo.CommitsBefore(ctx, head, false, paths...)
+	if err != nil {
+		return history, errors.Wrap(err, "getting commits")
+	}
+	synced, err := d.syncedRevisions(ctx, paths)
+	if err != nil {
+		return history, err
+	}
+
+	start := 0
+	if opts.Before != "" {
+		start = -1
+		for i, commit := range commits {
+			if strings.HasPrefix(commit.Revision, opts.Before) {
+				start = i + 1
+				break
+			}
+		}
+		if start < 0 {
+			return history, unknownRevisionError(opts.Before)
+		}
+	}
+
+	history.Entries = []v12.HistoryEntry{}
+	for _, commit := range commits[start:] {
+		entry := v12.HistoryEntry{
+			Revision: commit.Revision,
+			Author:   commit.Author,
+			Time:     commit.Time,
+			Message:  commit.Message,
+			Synced:   synced[commit.Revision],
+		}
+		mentioned := false
+		if _, ok := notes[commit.Revision]; ok {
+			var n note
+			ok, err := d.Repo.GetNote(ctx, commit.Revision, d.GitConfig.NotesRef, &n)
+			if err != nil {
+				return history, errors.Wrapf(err, "reading note for %s", commit.Revision)
+			}
+			mentioned = ok && noteHistory(&entry, n, opts.Workload)
+		}
+		if source == "" && !mentioned {
+			continue
+		}
+		if t, ok := d.syncTimes.syncedAt(commit.Revision); ok {
+			entry.SyncedAt = &t
+		}
+		if len(history.Entries) == limit {
+			history.Next = history.Entries[limit-1].Revision
+			break
+		}
+		history.Entries = append(history.Entries, entry)
+	}
+	return history, nil
+}
+
+// syncedRevisions returns the set of revisions, among those touching
+// the paths given, that have been applied to the cluster.
+func (d *Daemon) syncedRevisions(ctx context.Context, paths []string) (map[string]bool, error) {
+	synced := map[string]bool{}
+	syncMarkerRevision, err := d.SyncState.GetRevision(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if syncMarkerRevision == "" {
+		return synced, nil
+	}
+	commits, err := d.Repo.CommitsBefore(ctx, syncMarkerRevision, false, paths...)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting synced commits")
+	}
+	for _, commit := range commits {
+		synced[commit.Revision] = true
+	}
+	return synced, nil
+}
+
+// noteHistory fills in the entry with what the note says happened to
+// the workload, returning false if the note doesn't concern it.
+func noteHistory(entry *v12.HistoryEntry, n note, id resource.ID) bool {
+	result, inResult := n.Result[id]
+	if inResult && result.Status != update.ReleaseStatusSuccess {
+		return false
+	}
+	switch n.Spec.Type {
+	case update.Policy:
+		updates, ok := n.Spec.Spec.(resource.PolicyUpdates)
+		if !ok {
+			return false
+		}
+		u, ok := updates[id]
+		if !ok {
+			return false
+		}
+		entry.Policies = u
+	default:
+		if !inResult {
+			return false
+		}
+		entry.Images = result.PerContainer
+	}
+	entry.UpdateType = n.Spec.Type
+	entry.Cause = n.Spec.Cause
+	return true
+}
@@ -0,0 +1,163 @@
+package daemon
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/fluxcd/flux/pkg/cluster"
+	"github.com/fluxcd/flux/pkg/event"
+	fluxmetrics "github.com/fluxcd/flux/pkg/metrics"
+	"github.com/fluxcd/flux/pkg/policy"
+	"github.com/fluxcd/flux/pkg/resource"
+)
+
+// DefaultSyncHookTimeout is how long the sync hooks of a sync are
+// given to finish, if not otherwise configured.
+const DefaultSyncHookTimeout = 5 * time.Minute
+
+// readinessPollInterval is how often the cluster is asked about the
+// readiness of the resources synced, while waiting for them before
+// running post-sync hooks.
+var readinessPollInterval = 2 * time.Second
+
+// syncHooks are the resources to be run as hooks, before or after
+// the others are applied, rather than being applied with them.
+type syncHooks struct {
+	preSync, postSync []resource.Resource
+	// key changes whenever any of the resources to be synced does,
+	// so that the hooks are run again then, but not otherwise
+	key string
+	// timeout for all the hooks to finish
+	timeout time.Duration
+}
+
+// preSyncHookError is returned when a pre-sync hook fails, since that
+// means nothing else is applied.
+type preSyncHookError struct {
+	hook event.HookResult
+}
+
+func (e preSyncHookError) Error() string {
+	return fmt.Sprintf("pre-sync hook %s failed, so nothing else was synced: %s", e.hook.ID, e.hook.Error)
+}
+
+// splitHooks takes the hooks out of the resources given. Those with
+// a hook policy that isn't understood are returned as errors, so
+// they are neither applied nor run.
+func splitHooks(resources map[string]resource.Resource, timeout time.Duration) (map[string]resource.Resource, syncHooks, cluster.SyncError) {
+	if timeout == 0 {
+		timeout = DefaultSyncHookTimeout
+	}
+	hooks := syncHooks{key: resourcesChecksum(resources), timeout: timeout}
+	others := map[string]resource.Resource{}
+	var errs cluster.SyncError
+	for id, res := range resources {
+		phase, ok := res.Policies().Get(policy.Hook)
+		switch {
+		case !ok:
+			others[id] = res
+		case phase == policy.HookPreSync:
+			hooks.preSync = append(hooks.preSync, res)
+		case phase == policy.HookPostSync:
+			hooks.postSync = append(hooks.postSync, res)
+		default:
+			errs = append(errs, cluster.ResourceError{
+				ResourceID: res.ResourceID(),
+				Source:     res.Source(),
+				Error:      fmt.Errorf("hook phase %q is not one of %q or %q", phase, policy.HookPreSync, policy.HookPostSync),
+			})
+		}
+	}
+	for _, rs := range [][]resource.Resource{hooks.preSync, hooks.postSync} {
+		sort.Slice(rs, func(i, j int) bool {
+			return rs[i].ResourceID().String() < rs[j].ResourceID().String()
+		})
+	}
+	return others, hooks, errs
+}
+
+// resourcesChecksum summarises the definitions of all the resources
+// given.
+func resourcesChecksum(resources map[string]resource.Resource) string {
+	ids := make([]string, 0, len(resources))
+	for id := range resources {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	sum := sha256.New()
+	for _, id := range ids {
+		sum.Write([]byte(id))
+		sum.Write(resources[id].Bytes())
+	}
+	return base64.RawURLEncoding.EncodeToString(sum.Sum(nil))
+}
+
+// run runs the hooks for the phase given, one at a time in order of
+// their IDs, and says how each went. Hooks that had already succeeded
+// with the same key are not run, and not reported. Pre-sync hooks
+// stop at the first failure. The context given bounds how long the
+// hooks can take.
+func (h syncHooks) run(ctx context.Context, clus cluster.Cluster, phase string, logger log.Logger) []event.HookResult {
+	hooks := h.preSync
+	if phase == policy.HookPostSync {
+		hooks = h.postSync
+	}
+	var results []event.HookResult
+	for _, hook := range hooks {
+		started := time.Now()
+		ran, err := clus.RunHook(ctx, hook, h.key)
+		if !ran && err == nil {
+			continue
+		}
+		syncHookDuration.With(
+			fluxmetrics.LabelPhase, phase,
+			fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+		).Observe(time.Since(started).Seconds())
+		result := event.HookResult{ID: hook.ResourceID(), Phase: phase}
+		if err != nil {
+			result.Error = err.Error()
+			logger.Log("err", err, "hook", hook.ResourceID(), "phase", phase)
+		} else {
+			logger.Log("info", "hook succeeded", "hook", hook.ResourceID(), "phase", phase)
+		}
+		results = append(results, result)
+		if err != nil && phase == policy.HookPreSync {
+			break
+		}
+	}
+	return results
+}
+
+// waitForReadiness waits, for no longer than the context given
+// allows, until none of the resources synced are still being
+// reconciled, so that post-sync hooks see the outcome of the sync.
+func (h syncHooks) waitForReadiness(ctx context.Context, clus cluster.Cluster, logger log.Logger) {
+	for {
+		readiness, err := clus.Readiness(ctx)
+		if err != nil {
+			logger.Log("warning", "unable to check readiness before running post-sync hooks", "err", err)
+			return
+		}
+		var inProgress int
+		for _, r := range readiness {
+			if r.Status == cluster.ReadinessInProgress {
+				inProgress++
+			}
+		}
+		if inProgress == 0 {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			logger.Log("warning", "running post-sync hooks before all resources are ready", "in-progress", inProgress)
+			return
+		case <-time.After(readinessPollInterval):
+		}
+	}
+}
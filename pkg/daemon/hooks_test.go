@@ -0,0 +1,130 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	kresource "github.com/fluxcd/flux/pkg/cluster/kubernetes/resource"
+	"github.com/fluxcd/flux/pkg/cluster/mock"
+	"github.com/fluxcd/flux/pkg/event"
+	"github.com/fluxcd/flux/pkg/policy"
+	"github.com/fluxcd/flux/pkg/resource"
+)
+
+const hooksManifests = `---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate-b
+  namespace: default
+  annotations:
+    fluxcd.io/hook: pre-sync
+---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate-a
+  namespace: default
+  annotations:
+    fluxcd.io/hook: pre-sync
+---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: smoke-test
+  namespace: default
+  annotations:
+    fluxcd.io/hook: post-sync
+---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: mistake
+  namespace: default
+  annotations:
+    fluxcd.io/hook: mid-sync
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: default
+`
+
+func parseHooksManifests(t *testing.T) map[string]resource.Resource {
+	manifests, err := kresource.ParseMultidoc([]byte(hooksManifests), "hooks.yaml")
+	require.NoError(t, err)
+	resources := map[string]resource.Resource{}
+	for id, m := range manifests {
+		resources[id] = m
+	}
+	return resources
+}
+
+func TestSplitHooks(t *testing.T) {
+	resources := parseHooksManifests(t)
+	others, hooks, errs := splitHooks(resources, 0)
+
+	assert.Len(t, others, 1)
+	assert.Contains(t, others, "default:deployment/app")
+	var pre, post []string
+	for _, h := range hooks.preSync {
+		pre = append(pre, h.ResourceID().String())
+	}
+	for _, h := range hooks.postSync {
+		post = append(post, h.ResourceID().String())
+	}
+	assert.Equal(t, []string{"default:job/migrate-a", "default:job/migrate-b"}, pre)
+	assert.Equal(t, []string{"default:job/smoke-test"}, post)
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "default:job/mistake", errs[0].ResourceID.String())
+	}
+	assert.Equal(t, DefaultSyncHookTimeout, hooks.timeout)
+
+	// the key is the same for the same resources, and changes with
+	// any of them
+	_, again, _ := splitHooks(parseHooksManifests(t), 0)
+	assert.Equal(t, hooks.key, again.key)
+	delete(resources, "default:deployment/app")
+	_, fewer, _ := splitHooks(resources, 0)
+	assert.NotEqual(t, hooks.key, fewer.key)
+}
+
+func TestRunHooks(t *testing.T) {
+	_, hooks, _ := splitHooks(parseHooksManifests(t), 0)
+
+	var ran []string
+	clus := &mock.Mock{
+		RunHookFunc: func(_ context.Context, hook resource.Resource, key string) (bool, error) {
+			assert.Equal(t, hooks.key, key)
+			id := hook.ResourceID().String()
+			ran = append(ran, id)
+			switch id {
+			case "default:job/migrate-a":
+				// already run with this key
+				return false, nil
+			case "default:job/migrate-b":
+				return true, errors.New("migration failed")
+			}
+			return true, nil
+		},
+	}
+
+	results := hooks.run(context.Background(), clus, policy.HookPreSync, log.NewNopLogger())
+	assert.Equal(t, []string{"default:job/migrate-a", "default:job/migrate-b"}, ran)
+	assert.Equal(t, []event.HookResult{
+		{ID: resource.MustParseID("default:job/migrate-b"), Phase: policy.HookPreSync, Error: "migration failed"},
+	}, results)
+
+	ran = nil
+	results = hooks.run(context.Background(), clus, policy.HookPostSync, log.NewNopLogger())
+	assert.Equal(t, []string{"default:job/smoke-test"}, ran)
+	assert.Equal(t, []event.HookResult{
+		{ID: resource.MustParseID("default:job/smoke-test"), Phase: policy.HookPostSync},
+	}, results)
+}
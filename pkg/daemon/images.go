@@ -3,11 +3,13 @@ package daemon
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/pkg/errors"
 
 	"github.com/fluxcd/flux/pkg/cluster"
+	"github.com/fluxcd/flux/pkg/image"
 	"github.com/fluxcd/flux/pkg/policy"
 	"github.com/fluxcd/flux/pkg/resource"
 	"github.com/fluxcd/flux/pkg/update"
@@ -40,7 +42,9 @@ func (d *Daemon) pollForNewAutomatedWorkloadImages(logger log.Logger) {
 		return
 	}
 
-	changes := calculateChanges(logger, candidateWorkloads, workloads, imageRepos)
+	changes, pending := calculateChanges(logger, candidateWorkloads, workloads, imageRepos)
+	pendingImageUpdates.Set(float64(len(pending)))
+	changes = d.startCanaries(ctx, candidateWorkloads, changes, logger)
 
 	if len(changes.Changes) > 0 {
 		d.UpdateManifests(ctx, update.Spec{Type: update.Auto, Spec: changes})
@@ -75,8 +79,21 @@ func (d *Daemon) getAllowedAutomatedResources(ctx context.Context) (resources, e
 	return result, nil
 }
 
-func calculateChanges(logger log.Logger, candidateWorkloads resources, workloads []cluster.Workload, imageRepos update.ImageRepos) *update.Automated {
+// pendingChange is an update held back because the image is too
+// new, according to the workload's min-age policy. It can be released
+// by automation from eligibleAt.
+type pendingChange struct {
+	update.Change
+	eligibleAt time.Time
+}
+
+// calculateChanges works out the image updates for the automated
+// workloads given, along with those held back until the images are
+// old enough.
+func calculateChanges(logger log.Logger, candidateWorkloads resources, workloads []cluster.Workload, imageRepos update.ImageRepos) (*update.Automated, []pendingChange) {
 	changes := &update.Automated{}
+	var pending []pendingChange
+	now := time.Now()
 
 	for _, workload := range workloads {
 		var p policy.Set
@@ -95,6 +112,23 @@ func calculateChanges(logger log.Logger, candidateWorkloads resources, workloads
 				logger.Log("warning", fmt.Sprintf("inconsistent repository metadata: %s", err), "action", "skip container")
 				continue containers
 			}
+			images = images.WithoutRejected(policy.GetRejected(p, container.Name))
+
+			minAge, err := policy.GetMinAge(p, container.Name)
+			if err != nil {
+				logger.Log("warning", err, "action", "skip container")
+				continue containers
+			}
+			if minAge > 0 {
+				var deferred image.Info
+				var eligibleAt time.Time
+				images, deferred, eligibleAt = withoutTooNew(images, currentImageID, minAge, now)
+				if deferred.ID.Tag != "" {
+					newImage := currentImageID.WithNewTag(deferred.ID.Tag)
+					pending = append(pending, pendingChange{update.Change{WorkloadID: workload.ID, Container: container, ImageID: newImage}, eligibleAt})
+					logger.Log("info", "deferred update until image is old enough", "new", newImage, "min_age", minAge, "eligible", eligibleAt.Format(time.RFC3339))
+				}
+			}
 
 			if latest, ok := images.Latest(); ok && latest.ID != currentImageID {
 				if latest.ID.Tag == "" {
@@ -113,5 +147,46 @@ func calculateChanges(logger log.Logger, candidateWorkloads resources, workloads
 		}
 	}
 
-	return changes
+	return changes, pending
+}
+
+// eligibleAt returns when an image is old enough to be released by
+// automation, given a minimum age: once that long has passed since
+// it was created, and since it was first seen when scanning the
+// registry. It returns false if neither time is known.
+func eligibleAt(info image.Info, minAge time.Duration) (time.Time, bool) {
+	at := info.CreatedAt
+	if info.FirstSeen.After(at) {
+		at = info.FirstSeen
+	}
+	if at.IsZero() {
+		return time.Time{}, false
+	}
+	return at.Add(minAge), true
+}
+
+// withoutTooNew filters out the images that aren't old enough to be
+// released, other than the current image. It also returns the latest
+// of those filtered out, if it would otherwise have been released,
+// and when it will be old enough. Images of unknown age are always
+// filtered out, since it can't be known when they'll be old enough.
+func withoutTooNew(images update.SortedImageInfos, current image.Ref, minAge time.Duration, now time.Time) (update.SortedImageInfos, image.Info, time.Time) {
+	var filtered update.SortedImageInfos
+	var deferred image.Info
+	var deferredAt time.Time
+	for i, im := range images {
+		if im.ID == current {
+			filtered = append(filtered, im)
+			continue
+		}
+		at, ok := eligibleAt(im, minAge)
+		if ok && !now.Before(at) {
+			filtered = append(filtered, im)
+			continue
+		}
+		if ok && i == 0 {
+			deferred, deferredAt = im, at
+		}
+	}
+	return filtered, deferred, deferredAt
 }
@@ -92,7 +92,7 @@ func TestCalculateChanges_Automated(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	changes := calculateChanges(logger, candidateWorkloads, workloads, imageRepos)
+	changes, _ := calculateChanges(logger, candidateWorkloads, workloads, imageRepos)
 
 	if len := len(changes.Changes); len != 1 {
 		t.Errorf("Expected exactly 1 change, got %d changes", len)
@@ -148,7 +148,7 @@ func TestCalculateChanges_UntaggedImage(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	changes := calculateChanges(logger, candidateWorkloads, workloads, imageRepos)
+	changes, _ := calculateChanges(logger, candidateWorkloads, workloads, imageRepos)
 
 	if len := len(changes.Changes); len != 1 {
 		t.Errorf("Expected exactly 1 change, got %d changes", len)
@@ -217,7 +217,7 @@ func TestCalculateChanges_ZeroTimestamp(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	changes := calculateChanges(logger, candidateWorkloads, workloads, imageRepos)
+	changes, _ := calculateChanges(logger, candidateWorkloads, workloads, imageRepos)
 
 	if len := len(changes.Changes); len != 2 {
 		t.Fatalf("Expected exactly 2 changes, got %d changes: %v", len, changes.Changes)
@@ -229,3 +229,139 @@ func TestCalculateChanges_ZeroTimestamp(t *testing.T) {
 		t.Errorf("Expected changed image to be %s, got %s", newContainer3Image, newImage)
 	}
 }
+
+func TestCalculateChanges_Rejected(t *testing.T) {
+	logger := log.NewNopLogger()
+	resourceID := resource.MakeID(ns, "deployment", "application")
+	candidateWorkloads := resources{
+		resourceID: candidate{
+			resourceID: resourceID,
+			policies: policy.Set{
+				policy.Automated:                "true",
+				policy.TagPrefix(container3):    "semver:^1.0",
+				policy.RejectPrefix(container3): "1.2.0",
+			},
+		},
+	}
+	workloads := []cluster.Workload{
+		cluster.Workload{
+			ID: resourceID,
+			Containers: cluster.ContainersOrExcuse{
+				Containers: []resource.Container{
+					{
+						Name:  container3,
+						Image: mustParseImageRef(currentContainer3Image),
+					},
+				},
+			},
+		},
+	}
+	var imageRegistry registry.Registry
+	{
+		current := makeImageInfo(currentContainer3Image, time.Now())
+		new := makeImageInfo(newContainer3Image, time.Now())
+		rejected := makeImageInfo("container3/application:1.2.0", time.Now())
+		imageRegistry = &registryMock.Registry{
+			Images: []image.Info{
+				current,
+				new,
+				rejected,
+			},
+		}
+	}
+	imageRepos, err := update.FetchImageRepos(imageRegistry, clusterContainers(workloads), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes, _ := calculateChanges(logger, candidateWorkloads, workloads, imageRepos)
+
+	if len := len(changes.Changes); len != 1 {
+		t.Errorf("Expected exactly 1 change, got %d changes", len)
+	} else if newImage := changes.Changes[0].ImageID.String(); newImage != newContainer3Image {
+		t.Errorf("Expected changed image to be %s, got %s", newContainer3Image, newImage)
+	}
+}
+
+func TestCalculateChanges_MinAge(t *testing.T) {
+	logger := log.NewNopLogger()
+	resourceID := resource.MakeID(ns, "deployment", "application")
+	candidateWorkloads := resources{
+		resourceID: candidate{
+			resourceID: resourceID,
+			policies: policy.Set{
+				policy.Automated:                "true",
+				policy.TagPrefix(container3):    "semver:^1.0",
+				policy.MinAgePrefix(container3): "30m",
+			},
+		},
+	}
+	workloads := []cluster.Workload{
+		cluster.Workload{
+			ID: resourceID,
+			Containers: cluster.ContainersOrExcuse{
+				Containers: []resource.Container{
+					{
+						Name:  container3,
+						Image: mustParseImageRef(currentContainer3Image),
+					},
+				},
+			},
+		},
+	}
+	var imageRegistry registry.Registry
+	pushed := time.Now().Add(-10 * time.Minute)
+	{
+		current := makeImageInfo(currentContainer3Image, time.Now().Add(-time.Hour))
+		new := makeImageInfo(newContainer3Image, time.Now().Add(-time.Hour))
+		// created a while ago, but only just pushed
+		tooNew := makeImageInfo("container3/application:1.2.0", time.Now().Add(-time.Hour))
+		tooNew.FirstSeen = pushed
+		imageRegistry = &registryMock.Registry{
+			Images: []image.Info{
+				current,
+				new,
+				tooNew,
+			},
+		}
+	}
+	imageRepos, err := update.FetchImageRepos(imageRegistry, clusterContainers(workloads), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes, pending := calculateChanges(logger, candidateWorkloads, workloads, imageRepos)
+
+	if len := len(changes.Changes); len != 1 {
+		t.Errorf("Expected exactly 1 change, got %d changes", len)
+	} else if newImage := changes.Changes[0].ImageID.String(); newImage != newContainer3Image {
+		t.Errorf("Expected changed image to be %s, got %s", newContainer3Image, newImage)
+	}
+	if len := len(pending); len != 1 {
+		t.Fatalf("Expected exactly 1 pending change, got %d", len)
+	}
+	if p := pending[0]; p.ImageID.String() != "container3/application:1.2.0" || !p.eligibleAt.Equal(pushed.Add(30*time.Minute)) {
+		t.Errorf("Expected 1.2.0 to be pending until %s, got %s until %s", pushed.Add(30*time.Minute), p.ImageID, p.eligibleAt)
+	}
+}
+
+func TestEligibleAt(t *testing.T) {
+	created := time.Now().Add(-time.Hour)
+	seen := time.Now().Add(-time.Minute)
+	for _, c := range []struct {
+		info     image.Info
+		expected time.Time
+		ok       bool
+	}{
+		{image.Info{CreatedAt: created, FirstSeen: seen}, seen.Add(time.Minute), true},
+		{image.Info{CreatedAt: seen, FirstSeen: created}, seen.Add(time.Minute), true},
+		{image.Info{CreatedAt: created}, created.Add(time.Minute), true},
+		{image.Info{FirstSeen: seen}, seen.Add(time.Minute), true},
+		{image.Info{}, time.Time{}, false},
+	} {
+		at, ok := eligibleAt(c.info, time.Minute)
+		if ok != c.ok || !at.Equal(c.expected) {
+			t.Errorf("%+v: expected %s, %v; got %s, %v", c.info, c.expected, c.ok, at, ok)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/go-kit/kit/log"
 
+	"github.com/fluxcd/flux/pkg/canary"
 	"github.com/fluxcd/flux/pkg/git"
 	fluxmetrics "github.com/fluxcd/flux/pkg/metrics"
 	"github.com/fluxcd/flux/pkg/resource"
@@ -22,10 +23,41 @@ type LoopVars struct {
 	GitVerifySignaturesMode fluxsync.VerifySignaturesMode
 	SyncState               fluxsync.State
 	ImageScanDisabled       bool
+	// DriftInterval is how often to check the cluster for resources
+	// changed since the last sync; zero means never.
+	DriftInterval time.Duration
+	// DriftCorrection says whether to sync as soon as drift is
+	// found, for resources without a drift policy.
+	DriftCorrection bool
+	// ReadinessInterval is how often to check the readiness of the
+	// resources synced, for metrics; zero means only after syncing.
+	ReadinessInterval time.Duration
+	// SyncHookTimeout is how long the sync hooks of a sync are
+	// given to finish, all together; zero means
+	// DefaultSyncHookTimeout.
+	SyncHookTimeout time.Duration
+	// Canaries are the analyses that automated workloads can name
+	// in a canary policy, to have new images tried out on a canary
+	// before they are released; nil means there are none.
+	Canaries *canary.Config
+	// CanaryMetrics is queried for the metrics of canary analyses.
+	CanaryMetrics canary.Querier
 
 	initOnce               sync.Once
 	syncSoon               chan struct{}
 	automatedWorkloadsSoon chan struct{}
+	syncTimes              syncTimes
+	driftState             driftState
+	readinessState         readinessState
+	canaryReleases         map[resource.ID]*canaryRelease
+	// the first commit after the sync head whose signature couldn't
+	// be verified, if any, and the last such commit reported in a
+	// sync event
+	unverifiedCommit   git.Commit
+	reportedUnverified string
+	// the revision and pre-sync hook of the last hook failure
+	// reported in a sync event
+	reportedHookFailure string
 }
 
 func (loop *LoopVars) ensureInit() {
@@ -35,7 +67,7 @@ func (loop *LoopVars) ensureInit() {
 	})
 }
 
-func (d *Daemon) Loop(stop chan struct{}, wg *sync.WaitGroup, logger log.Logger) {
+func (d *Daemon) Loop(stop <-chan struct{}, wg *sync.WaitGroup, logger log.Logger) {
 	defer wg.Done()
 
 	// We want to sync at least every `SyncInterval`. Being told to
@@ -45,6 +77,32 @@ func (d *Daemon) Loop(stop chan struct{}, wg *sync.WaitGroup, logger log.Logger)
 	// Similarly checking to see if any controllers have new images
 	// available.
 	automatedWorkloadTimer := time.NewTimer(d.AutomationInterval)
+	// Anything started in the background by the loop is cancelled
+	// when it stops.
+	loopCtx, cancelLoop := context.WithCancel(context.Background())
+	defer cancelLoop()
+	// Checking for drift is optional; a nil channel is never ready.
+	var driftTick <-chan time.Time
+	if d.DriftInterval > 0 {
+		driftTicker := time.NewTicker(d.DriftInterval)
+		defer driftTicker.Stop()
+		driftTick = driftTicker.C
+	}
+	var readinessTick <-chan time.Time
+	if d.ReadinessInterval > 0 {
+		readinessTicker := time.NewTicker(d.ReadinessInterval)
+		defer readinessTicker.Stop()
+		readinessTick = readinessTicker.C
+	}
+	var canaryTick <-chan time.Time
+	if d.Canaries != nil {
+		canaryTicker := time.NewTicker(canaryCheckInterval)
+		defer canaryTicker.Stop()
+		canaryTick = canaryTicker.C
+		// Canaries are only looked after while looping, so those
+		// still running are removed once stopped.
+		defer d.stopCanaries(logger)
+	}
 
 	// Keep track of current, verified (if signature verification is
 	// enabled), HEAD, so we can know when to treat a repo
@@ -110,6 +168,12 @@ func (d *Daemon) Loop(stop chan struct{}, wg *sync.WaitGroup, logger log.Logger)
 			syncTimer.Reset(d.SyncInterval)
 		case <-syncTimer.C:
 			d.AskForSync()
+		case <-driftTick:
+			d.startDriftCheck(loopCtx, wg, logger)
+		case <-readinessTick:
+			d.startReadinessCheck(loopCtx, wg, logger)
+		case <-canaryTick:
+			d.checkCanaries(logger)
 		case <-d.Repo.C:
 			var newSyncHead string
 			var invalidCommit git.Commit
@@ -127,12 +191,16 @@ func (d *Daemon) Loop(stop chan struct{}, wg *sync.WaitGroup, logger log.Logger)
 				logger.Log("url", d.Repo.Origin().SafeURL(), "err", err)
 				continue
 			}
-			if invalidCommit.Revision != "" {
-				logger.Log("err", "found invalid GPG signature for commit", "revision", invalidCommit.Revision, "key", invalidCommit.Signature.Key)
+			if sig := invalidCommit.Signature; invalidCommit.Revision != "" {
+				logger.Log("err", "found invalid signature for commit", "revision", invalidCommit.Revision,
+					"key", sig.Key, "key-type", sig.KeyType, "principal", sig.Principal, "status", sig.Status)
 			}
+			d.unverifiedCommit = invalidCommit
 
 			logger.Log("event", "refreshed", "url", d.Repo.Origin().SafeURL(), "branch", d.GitConfig.Branch, "HEAD", newSyncHead)
-			if newSyncHead != syncHead {
+			// A newly found unverified commit is reported in a sync
+			// event, even if there's nothing new to sync.
+			if newSyncHead != syncHead || (invalidCommit.Revision != "" && invalidCommit.Revision != d.reportedUnverified) {
 				syncHead = newSyncHead
 				d.AskForSync()
 			}
@@ -51,4 +51,55 @@ var (
 		Name:      "sync_manifests",
 		Help:      "Number of synchronized manifests",
 	}, []string{fluxmetrics.LabelSuccess})
+
+	driftedResources = prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Namespace: "flux",
+		Subsystem: "daemon",
+		Name:      "drifted_resources",
+		Help:      "Number of resources changed in the cluster since they were synced, as of the last check.",
+	}, []string{fluxmetrics.LabelReason})
+
+	driftCheckDuration = prometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+		Namespace: "flux",
+		Subsystem: "daemon",
+		Name:      "drift_check_duration_seconds",
+		Help:      "Duration of checking the cluster for drift, in seconds.",
+		Buckets:   []float64{0.1, 0.5, 1, 2, 5, 10, 20, 30, 60},
+	}, []string{fluxmetrics.LabelSuccess})
+
+	resourceReadiness = prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Namespace: "flux",
+		Subsystem: "daemon",
+		Name:      "resource_readiness",
+		Help:      "Number of synced resources of each kind in each readiness status, as of the last check.",
+	}, []string{fluxmetrics.LabelKind, fluxmetrics.LabelStatus})
+
+	syncHookDuration = prometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+		Namespace: "flux",
+		Subsystem: "daemon",
+		Name:      "sync_hook_duration_seconds",
+		Help:      "Duration of running sync hooks, in seconds.",
+		Buckets:   []float64{1, 5, 10, 30, 60, 120, 300, 600, 1200},
+	}, []string{fluxmetrics.LabelPhase, fluxmetrics.LabelSuccess})
+
+	canariesRunning = prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Namespace: "flux",
+		Subsystem: "daemon",
+		Name:      "canaries_running",
+		Help:      "Number of canaries of automated releases being analysed.",
+	}, []string{})
+
+	canaryOutcomes = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "flux",
+		Subsystem: "daemon",
+		Name:      "canary_outcomes_total",
+		Help:      "Count of canaries of automated releases that were promoted, rejected, or abandoned.",
+	}, []string{fluxmetrics.LabelOutcome})
+
+	pendingImageUpdates = prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Namespace: "flux",
+		Subsystem: "daemon",
+		Name:      "pending_image_updates",
+		Help:      "Number of image updates held back by automation until the images are old enough, as of the last automation run.",
+	}, []string{})
 )
@@ -0,0 +1,124 @@
+package daemon
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/fluxcd/flux/pkg/cluster"
+	"github.com/fluxcd/flux/pkg/event"
+	fluxmetrics "github.com/fluxcd/flux/pkg/metrics"
+	"github.com/fluxcd/flux/pkg/resource"
+)
+
+var readinessStatuses = []string{
+	cluster.ReadinessCurrent,
+	cluster.ReadinessInProgress,
+	cluster.ReadinessFailed,
+	cluster.ReadinessTerminating,
+	cluster.ReadinessUnknown,
+}
+
+// readinessState remembers what the last readiness check saw, so
+// that gauges for kinds no longer synced are zeroed, and failures are
+// only logged when they're new.
+type readinessState struct {
+	mu       sync.Mutex
+	checking bool
+	kinds    map[string]bool
+	failed   map[resource.ID]bool
+}
+
+// begin marks a periodic check as running, and returns false if one
+// already is.
+func (s *readinessState) begin() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.checking {
+		return false
+	}
+	s.checking = true
+	return true
+}
+
+func (s *readinessState) end() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checking = false
+}
+
+// startReadinessCheck checks readiness in the background, so that
+// syncs and jobs aren't held up while the cluster is asked. If the
+// previous check is still running, there's no new check.
+func (d *Daemon) startReadinessCheck(ctx context.Context, wg *sync.WaitGroup, logger log.Logger) {
+	if !d.readinessState.begin() {
+		logger.Log("info", "previous readiness check still running; skipping")
+		return
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer d.readinessState.end()
+		ctx, cancel := context.WithTimeout(ctx, d.SyncTimeout)
+		defer cancel()
+		d.checkReadiness(ctx, logger)
+	}()
+}
+
+// checkReadiness asks the cluster how far the synced resources have
+// got with reconciling, reports that in metrics, and returns those
+// that aren't (yet) current.
+func (d *Daemon) checkReadiness(ctx context.Context, logger log.Logger) []event.ResourceReadiness {
+	readiness, err := d.Cluster.Readiness(ctx)
+	if err != nil {
+		logger.Log("err", err)
+		return nil
+	}
+
+	s := &d.readinessState
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.kinds == nil {
+		s.kinds = map[string]bool{}
+	}
+
+	counts := map[string]map[string]int{}
+	for kind := range s.kinds {
+		counts[kind] = map[string]int{}
+	}
+	failed := map[resource.ID]bool{}
+	var notReady []event.ResourceReadiness
+	for _, r := range readiness {
+		_, kind, _ := r.ResourceID.Components()
+		if counts[kind] == nil {
+			counts[kind] = map[string]int{}
+		}
+		counts[kind][r.Status]++
+		if r.Status == cluster.ReadinessCurrent {
+			continue
+		}
+		if r.Status == cluster.ReadinessFailed {
+			failed[r.ResourceID] = true
+			if !s.failed[r.ResourceID] {
+				logger.Log("resource", r.ResourceID, "readiness", r.Status, "message", r.Message)
+			}
+		}
+		notReady = append(notReady, event.ResourceReadiness{
+			ID:      r.ResourceID,
+			Status:  r.Status,
+			Message: r.Message,
+		})
+	}
+	for kind, byStatus := range counts {
+		s.kinds[kind] = true
+		for _, status := range readinessStatuses {
+			resourceReadiness.With(
+				fluxmetrics.LabelKind, kind,
+				fluxmetrics.LabelStatus, status,
+			).Set(float64(byStatus[status]))
+		}
+	}
+	s.failed = failed
+	return notReady
+}
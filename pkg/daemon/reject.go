@@ -0,0 +1,143 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/fluxcd/flux/pkg/git"
+	"github.com/fluxcd/flux/pkg/job"
+	"github.com/fluxcd/flux/pkg/manifests"
+	"github.com/fluxcd/flux/pkg/policy"
+	"github.com/fluxcd/flux/pkg/resource"
+	"github.com/fluxcd/flux/pkg/update"
+)
+
+// reject adds images to (or, with Remove, takes them from) the reject
+// policies of a workload's containers or, if no workload is given, to
+// the reject policy in the .flux.yaml at the top of the repo, which
+// applies to every workload.
+func (d *Daemon) reject(spec update.Spec, r update.RejectSpec) updateFunc {
+	return func(ctx context.Context, jobID job.ID, working *git.Checkout, logger log.Logger) (job.Result, error) {
+		var zero job.Result
+		if err := r.Validate(); err != nil {
+			return zero, err
+		}
+
+		result := update.Result{}
+		var changed bool
+		addUntracked := d.ManifestGenerationEnabled
+		if r.Workload != (resource.ID{}) {
+			rs, err := d.getManifestStore(working)
+			if err != nil {
+				return zero, err
+			}
+			resources, err := rs.GetAllResourcesByID(ctx)
+			if err != nil {
+				return zero, err
+			}
+			res, ok := resources[r.Workload.String()]
+			if !ok {
+				return zero, fmt.Errorf("workload %s not found in the git repo", r.Workload)
+			}
+			workload, ok := res.(resource.Workload)
+			if !ok {
+				return zero, fmt.Errorf("resource %s does not have containers", r.Workload)
+			}
+			if !rejectApplies(r, workload) {
+				if r.Container != "" {
+					return zero, fmt.Errorf("container %q not found in workload %s", r.Container, r.Workload)
+				}
+				return zero, fmt.Errorf("none of the images are used by workload %s", r.Workload)
+			}
+			u := r.RejectPolicyUpdate(workload)
+			result[r.Workload] = update.WorkloadResult{Status: update.ReleaseStatusSkipped}
+			if len(u.Add) > 0 || len(u.Remove) > 0 {
+				if _, err := rs.UpdateWorkloadPolicies(ctx, r.Workload, u); err != nil {
+					return zero, err
+				}
+				result[r.Workload] = update.WorkloadResult{Status: update.ReleaseStatusSuccess}
+				changed = true
+			}
+		} else {
+			repoPolicies, err := manifests.ReadRepoPolicies(working.Dir())
+			if err != nil {
+				return zero, err
+			}
+			current := repoPolicies[policy.Reject]
+			value := policy.AddRejected(current, r.Images...)
+			if r.Remove {
+				value = policy.RemoveRejected(current, r.Images...)
+			}
+			if value != current {
+				if err := manifests.SetRepoPolicy(working.Dir(), policy.Reject, value); err != nil {
+					return zero, err
+				}
+				// The .flux.yaml may be new, and is likely outside
+				// the git paths, so it must be added to be committed
+				changed, addUntracked = true, true
+			}
+		}
+		if !changed {
+			return job.Result{Spec: &spec, Result: result}, nil
+		}
+
+		commitAuthor := ""
+		if d.GitConfig.SetAuthor {
+			commitAuthor = spec.Cause.User
+		}
+		commitAction := git.CommitAction{
+			Author:  commitAuthor,
+			Message: rejectCommitMessage(r, spec.Cause),
+		}
+		if err := working.CommitAndPush(ctx, commitAction, &note{JobID: jobID, Spec: spec, Result: result}, addUntracked); err != nil {
+			d.AskForSync()
+			return zero, err
+		}
+		revision, err := working.HeadRevision(ctx)
+		if err != nil {
+			return zero, err
+		}
+		return job.Result{
+			Revision: revision,
+			Spec:     &spec,
+			Result:   result,
+		}, nil
+	}
+}
+
+// rejectApplies says whether any of the images in the spec apply to
+// a container of the workload.
+func rejectApplies(r update.RejectSpec, workload resource.Workload) bool {
+	for _, c := range workload.Containers() {
+		if len(r.RejectedFor(c)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func rejectCommitMessage(r update.RejectSpec, cause update.Cause) string {
+	msg := &bytes.Buffer{}
+	verb := "Reject"
+	if r.Remove {
+		verb = "Stop rejecting"
+	}
+	scope := "all workloads"
+	if r.Workload != (resource.ID{}) {
+		scope = r.Workload.String()
+		if r.Container != "" {
+			scope = fmt.Sprintf("%s (container %s)", scope, r.Container)
+		}
+	}
+	summary := fmt.Sprintf("%s %s for %s", verb, strings.Join(r.Images, ", "), scope)
+	if cause.Message != "" {
+		fmt.Fprintf(msg, "%s\n\n%s\n", cause.Message, summary)
+	} else {
+		fmt.Fprintf(msg, "%s\n", summary)
+	}
+	return msg.String()
+}
@@ -0,0 +1,259 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"github.com/fluxcd/flux/pkg/api/v12"
+	"github.com/fluxcd/flux/pkg/git"
+	"github.com/fluxcd/flux/pkg/image"
+	"github.com/fluxcd/flux/pkg/job"
+	"github.com/fluxcd/flux/pkg/policy"
+	"github.com/fluxcd/flux/pkg/release"
+	"github.com/fluxcd/flux/pkg/resource"
+	"github.com/fluxcd/flux/pkg/update"
+)
+
+// imageChange is a change to the images of a workload, as recorded
+// in the note attached to the commit that made it.
+type imageChange struct {
+	Revision   string
+	Containers []update.ContainerUpdate
+}
+
+// imageHistory returns the image changes recorded for a workload,
+// most recent first. If `until` is not empty, only changes made
+// after that revision are returned, and it is an error if the
+// revision is not in the history of the branch, or (abbreviated) is
+// the start of more than one commit in it.
+func (d *Daemon) imageHistory(ctx context.Context, id resource.ID, until string) ([]imageChange, error) {
+	notes, err := d.Repo.NoteRevList(ctx, d.GitConfig.NotesRef)
+	if err != nil {
+		return nil, errors.Wrap(err, "enumerating commit notes")
+	}
+	head, err := d.Repo.BranchHead(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if until != "" {
+		if until, err = d.resolveRevision(ctx, head, until); err != nil {
+			return nil, err
+		}
+	}
+	commits, err := d.Repo.CommitsBefore(ctx, head, false, d.GitConfig.Paths...)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting commits")
+	}
+
+	var changes []imageChange
+	for _, commit := range commits {
+		if until != "" && commit.Revision == until {
+			return changes, nil
+		}
+		if _, ok := notes[commit.Revision]; !ok {
+			continue
+		}
+		var n note
+		ok, err := d.Repo.GetNote(ctx, commit.Revision, d.GitConfig.NotesRef, &n)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading note for %s", commit.Revision)
+		}
+		if !ok {
+			continue
+		}
+		if result, ok := n.Result[id]; ok && result.Status == update.ReleaseStatusSuccess && len(result.PerContainer) > 0 {
+			changes = append(changes, imageChange{
+				Revision:   commit.Revision,
+				Containers: result.PerContainer,
+			})
+		}
+	}
+	if until != "" {
+		return nil, unknownRevisionError(until)
+	}
+	return changes, nil
+}
+
+// resolveRevision finds the commit in the history of head that the
+// (possibly abbreviated) revision given is the start of.
+func (d *Daemon) resolveRevision(ctx context.Context, head, rev string) (string, error) {
+	commits, err := d.Repo.CommitsBefore(ctx, head, false)
+	if err != nil {
+		return "", errors.Wrap(err, "getting commits")
+	}
+	return matchRevision(commits, rev)
+}
+
+func matchRevision(commits []git.Commit, rev string) (string, error) {
+	var matches []string
+	for _, commit := range commits {
+		if strings.HasPrefix(commit.Revision, rev) {
+			matches = append(matches, commit.Revision)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", unknownRevisionError(rev)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", ambiguousRevisionError(rev, len(matches))
+	}
+}
+
+// rollbackTargets works out the image each container should be
+// rolled back to, given the image changes to undo (most recent
+// first). Each container goes back to the image it had before the
+// earliest of the changes that touched it.
+func rollbackTargets(changes []imageChange) map[string]image.Ref {
+	targets := map[string]image.Ref{}
+	for _, change := range changes {
+		for _, c := range change.Containers {
+			targets[c.Container] = c.Current
+		}
+	}
+	return targets
+}
+
+// Rollback queues a job to revert a workload's images to those it had
+// before one or more earlier image changes. The job's commit is noted
+// with a spec of type update.Rollback, so it's reported like other
+// updates.
+func (d *Daemon) Rollback(ctx context.Context, opts v12.RollbackOptions) (job.ID, error) {
+	if err := opts.Validate(); err != nil {
+		return "", err
+	}
+	spec := update.Spec{Type: update.Rollback, Cause: opts.Cause, Spec: opts.RollbackSpec}
+	return d.queueJob(d.makeLoggingJobFunc(d.makeJobFromUpdate(d.rollback(spec, opts.RollbackSpec)))), nil
+}
+
+func (d *Daemon) rollback(spec update.Spec, r update.RollbackSpec) updateFunc {
+	return func(ctx context.Context, jobID job.ID, working *git.Checkout, logger log.Logger) (job.Result, error) {
+		var zero job.Result
+		if err := r.Validate(); err != nil {
+			return zero, err
+		}
+
+		changes, err := d.imageHistory(ctx, r.Workload, r.ToRevision)
+		if err != nil {
+			return zero, err
+		}
+		if r.ToRevision == "" {
+			steps := r.StepsOrDefault()
+			if len(changes) < steps {
+				return zero, notEnoughHistoryError(r.Workload, steps, len(changes))
+			}
+			changes = changes[:steps]
+		}
+		if len(changes) == 0 {
+			return zero, notEnoughHistoryError(r.Workload, 1, 0)
+		}
+
+		rs, err := d.getManifestStore(working)
+		if err != nil {
+			return zero, err
+		}
+		resources, err := rs.GetAllResourcesByID(ctx)
+		if err != nil {
+			return zero, err
+		}
+		res, ok := resources[r.Workload.String()]
+		if !ok {
+			return zero, fmt.Errorf("workload %s not found in the git repo", r.Workload)
+		}
+		workload, ok := res.(resource.Workload)
+		if !ok {
+			return zero, fmt.Errorf("resource %s does not have containers", r.Workload)
+		}
+
+		// The current image is left out of each container update, so
+		// that the rollback goes ahead even if what's running in the
+		// cluster has not caught up with the repo.
+		targets := rollbackTargets(changes)
+		defined := map[string]image.Ref{}
+		var containerUpdates []update.ContainerUpdate
+		for _, c := range workload.Containers() {
+			defined[c.Name] = c.Image
+			if target, ok := targets[c.Name]; ok && target != c.Image {
+				containerUpdates = append(containerUpdates, update.ContainerUpdate{
+					Container: c.Name,
+					Target:    target,
+				})
+			}
+		}
+
+		// Rolling back is an explicit request to change the images
+		// of this workload, so it goes ahead even if the workload
+		// is locked.
+		rc := release.NewReleaseContext(d.Cluster, rs, d.Registry)
+		result, err := release.Release(ctx, rc, update.ReleaseContainersSpec{
+			Kind:           update.ReleaseKindExecute,
+			ContainerSpecs: map[resource.ID][]update.ContainerUpdate{r.Workload: containerUpdates},
+			Force:          true,
+		}, logger)
+		if err != nil {
+			return zero, err
+		}
+		// Record the images being replaced, so the result (and the
+		// note) can be used for a later rollback.
+		if workloadResult, ok := result[r.Workload]; ok {
+			for i, c := range workloadResult.PerContainer {
+				workloadResult.PerContainer[i].Current = defined[c.Container]
+			}
+		}
+
+		earliest := changes[len(changes)-1].Revision
+		lockMsg := fmt.Sprintf("Rolled back to images before %.7s", earliest)
+		if spec.Cause.Message != "" {
+			lockMsg = fmt.Sprintf("%s: %s", lockMsg, spec.Cause.Message)
+		}
+		lock := policy.Set{}.Add(policy.Locked).Set(policy.LockedMsg, lockMsg)
+		if spec.Cause.User != "" {
+			lock = lock.Set(policy.LockedUser, spec.Cause.User)
+		}
+		if _, err := rs.UpdateWorkloadPolicies(ctx, r.Workload, resource.PolicyUpdate{Add: lock}); err != nil {
+			return zero, err
+		}
+
+		commitAuthor := ""
+		if d.GitConfig.SetAuthor {
+			commitAuthor = spec.Cause.User
+		}
+		commitAction := git.CommitAction{
+			Author:  commitAuthor,
+			Message: rollbackCommitMessage(r.Workload, earliest, result, spec.Cause),
+		}
+		if err := working.CommitAndPush(ctx, commitAction, &note{JobID: jobID, Spec: spec, Result: result}, d.ManifestGenerationEnabled); err != nil {
+			d.Repo.Notify()
+			return zero, err
+		}
+		revision, err := working.HeadRevision(ctx)
+		if err != nil {
+			return zero, err
+		}
+		return job.Result{
+			Revision: revision,
+			Spec:     &spec,
+			Result:   result,
+		}, nil
+	}
+}
+
+func rollbackCommitMessage(id resource.ID, earliest string, result update.Result, cause update.Cause) string {
+	msg := &bytes.Buffer{}
+	if cause.Message != "" {
+		fmt.Fprintf(msg, "%s\n\n", cause.Message)
+	} else {
+		fmt.Fprintf(msg, "Roll back %s to images before %.7s\n\n", id, earliest)
+	}
+	for _, c := range result[id].PerContainer {
+		fmt.Fprintf(msg, "- %s: %s -> %s\n", c.Container, c.Current, c.Target)
+	}
+	fmt.Fprintf(msg, "- locked %s\n", id)
+	return msg.String()
+}
@@ -13,9 +13,11 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/fluxcd/flux/pkg/cluster"
+	"github.com/fluxcd/flux/pkg/decrypt"
 	"github.com/fluxcd/flux/pkg/event"
 	"github.com/fluxcd/flux/pkg/git"
 	"github.com/fluxcd/flux/pkg/manifests"
+	"github.com/fluxcd/flux/pkg/policy"
 	"github.com/fluxcd/flux/pkg/resource"
 	fluxsync "github.com/fluxcd/flux/pkg/sync"
 	"github.com/fluxcd/flux/pkg/update"
@@ -41,10 +43,16 @@ type changeSet struct {
 	oldTagRev   string
 	newTagRev   string
 	initialSync bool
+	// a commit after newTagRev whose signature couldn't be verified
+	unverifiedCommit *event.UnverifiedCommit
 }
 
 // Sync starts the synchronization of the cluster with git.
 func (d *Daemon) Sync(ctx context.Context, started time.Time, newRevision string, rat ratchet) error {
+	// Hooks (e.g., migrations) can take a lot longer than applying
+	// manifests, so they're given the hook timeout rather than
+	// counting towards that of the sync
+	hookCtx := ctx
 	ctx, cancel := context.WithTimeout(ctx, d.SyncTimeout)
 	defer cancel()
 
@@ -61,6 +69,18 @@ func (d *Daemon) Sync(ctx context.Context, started time.Time, newRevision string
 		return err
 	}
 
+	// Report a commit that failed verification along with any commits
+	// synced, or by itself if it hasn't been reported before
+	if c := d.unverifiedCommit; c.Revision != "" && (len(changeSet.commits) > 0 || c.Revision != d.reportedUnverified) {
+		changeSet.unverifiedCommit = &event.UnverifiedCommit{
+			Revision:  c.Revision,
+			Key:       c.Signature.Key,
+			KeyType:   c.Signature.KeyType,
+			Principal: c.Signature.Principal,
+			Status:    c.Signature.Status,
+		}
+	}
+
 	d.Logger.Log("info", "trying to sync git changes to the cluster", "old", changeSet.oldTagRev, "new", changeSet.newTagRev)
 
 	// Load resources from the new revision
@@ -72,13 +92,32 @@ func (d *Daemon) Sync(ctx context.Context, started time.Time, newRevision string
 
 	// Run actual sync of resources on cluster
 	syncSetName := makeGitConfigHash(d.Repo.Origin(), d.GitConfig)
-	resources, resourceErrors, err := doSync(ctx, resourceStore, d.Cluster, syncSetName, d.Logger)
+	result, err := doSync(ctx, hookCtx, syncParams{
+		store:       resourceStore,
+		decrypter:   d.Decrypter,
+		cluster:     d.Cluster,
+		syncSetName: syncSetName,
+		hookTimeout: d.SyncHookTimeout,
+		events:      d,
+		logger:      d.Logger,
+	}, started)
+	if hookErr, ok := err.(preSyncHookError); ok {
+		// Report the failed hook with the commits it held back, once
+		// for each revision and hook rather than at every attempt;
+		// the commits will be reported again once they're synced.
+		if failure := changeSet.newTagRev + " " + hookErr.hook.ID.String(); failure != d.reportedHookFailure {
+			if err := logCommitEvent(d, changeSet, resource.IDSet{}, started, nil, nil, nil, result.hookResults, d.Logger); err != nil {
+				return err
+			}
+			d.reportedHookFailure = failure
+		}
+	}
 	if err != nil {
 		return err
 	}
 
 	// Determine what resources changed and deleted during the sync
-	updatedIDs, deletedIDs := compareResources(lastResources, resources)
+	updatedIDs, deletedIDs := compareResources(lastResources, result.resources)
 	// TODO(ordovicia): include deleted resources in sync events
 	_ = deletedIDs
 
@@ -92,10 +131,18 @@ func (d *Daemon) Sync(ctx context.Context, started time.Time, newRevision string
 		return err
 	}
 
+	// See how far the resources have got with reconciling, so the
+	// sync event can say which haven't
+	notReady := d.checkReadiness(ctx, d.Logger)
+
 	// Report all synced commits
-	if err := logCommitEvent(d, changeSet, updatedIDs, started, includesEvents, resourceErrors, d.Logger); err != nil {
+	if err := logCommitEvent(d, changeSet, updatedIDs, started, includesEvents, result.resourceErrors, notReady, result.hookResults, d.Logger); err != nil {
 		return err
 	}
+	if changeSet.unverifiedCommit != nil {
+		d.reportedUnverified = changeSet.unverifiedCommit.Revision
+	}
+	d.reportedHookFailure = ""
 
 	// Report all collected events
 	for _, event := range noteEvents {
@@ -107,11 +154,22 @@ func (d *Daemon) Sync(ctx context.Context, started time.Time, newRevision string
 	}
 
 	// Move the revision the sync state points to
-	if ok, err := rat.Update(ctx, changeSet.oldTagRev, changeSet.newTagRev, resources); err != nil {
+	if ok, err := rat.Update(ctx, changeSet.oldTagRev, changeSet.newTagRev, result.resources); err != nil {
 		return err
 	} else if !ok {
 		return nil
 	}
+	// On an initial sync we don't know when the earlier commits were
+	// applied, only that they have been.
+	if changeSet.initialSync {
+		d.syncTimes.record(time.Now().UTC(), changeSet.newTagRev)
+	} else {
+		revisions := make([]string, len(changeSet.commits))
+		for i, commit := range changeSet.commits {
+			revisions[i] = commit.Revision
+		}
+		d.syncTimes.record(time.Now().UTC(), revisions...)
+	}
 
 	err = refresh(ctx, d.GitTimeout, d.Repo)
 	return err
@@ -218,35 +276,103 @@ func (d *Daemon) getChangeSet(ctxGitOp context.Context, state ratchet, headRev s
 	return c, err
 }
 
-// doSync runs the actual sync of workloads on the cluster. It returns
-// a map with all resources it applied and sync errors it encountered.
-func doSync(ctx context.Context, manifestsStore manifests.Store, clus cluster.Cluster, syncSetName string,
-	logger log.Logger) (map[string]resource.Resource, []event.ResourceError, error) {
-	resources, err := manifestsStore.GetAllResourcesByID(ctx)
+// syncParams are what doSync needs to sync a set of manifests.
+type syncParams struct {
+	store       manifests.Store
+	decrypter   *decrypt.Decrypter
+	cluster     cluster.Cluster
+	syncSetName string
+	hookTimeout time.Duration
+	events      eventLogger
+	logger      log.Logger
+}
+
+// syncResult is the outcome of doSync.
+type syncResult struct {
+	// all resources applied
+	resources map[string]resource.Resource
+	// sync errors encountered
+	resourceErrors []event.ResourceError
+	// the outcome of any hooks run
+	hookResults []event.HookResult
+}
+
+// doSync runs the actual sync of workloads on the cluster. If garbage
+// collection was aborted, that's reported as an event, but otherwise
+// treated as a successful sync. If a decrypter is given, resources
+// are decrypted before being synced; those that can't be are reported
+// as sync errors. Hooks are run with hookCtx, and all of them, from
+// the first pre-sync hook to the last post-sync hook, have to finish
+// within the hook timeout. If a pre-sync hook fails, nothing else is
+// applied, and a preSyncHookError is returned along with the hooks
+// run.
+func doSync(ctx, hookCtx context.Context, p syncParams, started time.Time) (syncResult, error) {
+	var result syncResult
+	resources, err := p.store.GetAllResourcesByID(ctx)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "loading resources from repo")
+		return result, errors.Wrap(err, "loading resources from repo")
+	}
+	total := len(resources)
+
+	var decryptErrors cluster.SyncError
+	if p.decrypter != nil {
+		resources, decryptErrors = p.decrypter.Decrypt(ctx, resources)
 	}
 
-	var resourceErrors []event.ResourceError
-	if err := fluxsync.Sync(syncSetName, resources, clus); err != nil {
+	toApply, hooks, hookErrors := splitHooks(resources, p.hookTimeout)
+	hookCtx, cancelHooks := context.WithTimeout(hookCtx, hooks.timeout)
+	defer cancelHooks()
+	result.hookResults = hooks.run(hookCtx, p.cluster, policy.HookPreSync, p.logger)
+	for _, h := range result.hookResults {
+		if h.Error != "" {
+			return result, preSyncHookError{hook: h}
+		}
+	}
+
+	err = fluxsync.Sync(p.syncSetName, toApply, append(decryptErrors, hookErrors...), p.cluster)
+	if gcAborted, ok := err.(*cluster.GCAbortedError); ok {
+		p.logger.Log("err", err)
+		if err := p.events.LogEvent(event.Event{
+			ServiceIDs: gcAborted.Deletions,
+			Type:       event.EventGCAborted,
+			StartedAt:  started,
+			EndedAt:    started,
+			LogLevel:   event.LogLevelError,
+			Metadata:   &event.GCAbortedEventMetadata{MaxDeletions: gcAborted.MaxDeletions},
+		}); err != nil {
+			return syncResult{}, err
+		}
+		// Carry on as though it was just the apply that happened
+		err = nil
+		if len(gcAborted.SyncErrors) > 0 {
+			err = gcAborted.SyncErrors
+		}
+	}
+	if err != nil {
 		switch syncerr := err.(type) {
 		case cluster.SyncError:
-			logger.Log("err", err)
-			updateSyncManifestsMetric(len(resources)-len(syncerr), len(syncerr))
+			p.logger.Log("err", err)
+			updateSyncManifestsMetric(total-len(syncerr), len(syncerr))
 			for _, e := range syncerr {
-				resourceErrors = append(resourceErrors, event.ResourceError{
+				result.resourceErrors = append(result.resourceErrors, event.ResourceError{
 					ID:    e.ResourceID,
 					Path:  e.Source,
 					Error: e.Error.Error(),
 				})
 			}
 		default:
-			return nil, nil, err
+			return syncResult{hookResults: result.hookResults}, err
 		}
 	} else {
-		updateSyncManifestsMetric(len(resources), 0)
+		updateSyncManifestsMetric(total, 0)
+	}
+
+	if len(hooks.postSync) > 0 {
+		hooks.waitForReadiness(hookCtx, p.cluster, p.logger)
+		result.hookResults = append(result.hookResults, hooks.run(hookCtx, p.cluster, policy.HookPostSync, p.logger)...)
 	}
-	return resources, resourceErrors, nil
+	result.resources = resources
+	return result, nil
 }
 
 func updateSyncManifestsMetric(success, failure int) {
@@ -398,7 +524,26 @@ func (d *Daemon) collectNoteEvents(ctx context.Context, c changeSet, notes map[s
 				},
 			})
 			eventTypes[event.EventAutoRelease] = true
-		case update.Policy:
+		case update.Rollback:
+			spec := n.Spec.Spec.(update.RollbackSpec)
+			noteEvents = append(noteEvents, event.Event{
+				ServiceIDs: n.Result.AffectedResources(),
+				Type:       event.EventRollback,
+				StartedAt:  started,
+				EndedAt:    time.Now().UTC(),
+				LogLevel:   event.LogLevelInfo,
+				Metadata: &event.RollbackEventMetadata{
+					ReleaseEventCommon: event.ReleaseEventCommon{
+						Revision: c.commits[i].Revision,
+						Result:   n.Result,
+						Error:    n.Result.Error(),
+					},
+					Spec:  spec,
+					Cause: n.Spec.Cause,
+				},
+			})
+			eventTypes[event.EventRollback] = true
+		case update.Policy, update.Reject:
 			// Use this to mean any change to policy
 			eventTypes[event.EventUpdatePolicy] = true
 		default:
@@ -412,8 +557,8 @@ func (d *Daemon) collectNoteEvents(ctx context.Context, c changeSet, notes map[s
 
 // logCommitEvent reports all synced commits to the upstream.
 func logCommitEvent(el eventLogger, c changeSet, serviceIDs resource.IDSet, started time.Time,
-	includesEvents map[string]bool, resourceErrors []event.ResourceError, logger log.Logger) error {
-	if len(c.commits) == 0 {
+	includesEvents map[string]bool, resourceErrors []event.ResourceError, notReady []event.ResourceReadiness, hooks []event.HookResult, logger log.Logger) error {
+	if len(c.commits) == 0 && c.unverifiedCommit == nil {
 		return nil
 	}
 	cs := make([]event.Commit, len(c.commits))
@@ -421,17 +566,24 @@ func logCommitEvent(el eventLogger, c changeSet, serviceIDs resource.IDSet, star
 		cs[i].Revision = ci.Revision
 		cs[i].Message = ci.Message
 	}
+	logLevel := event.LogLevelInfo
+	if c.unverifiedCommit != nil {
+		logLevel = event.LogLevelWarn
+	}
 	if err := el.LogEvent(event.Event{
 		ServiceIDs: serviceIDs.ToSlice(),
 		Type:       event.EventSync,
 		StartedAt:  started,
 		EndedAt:    started,
-		LogLevel:   event.LogLevelInfo,
+		LogLevel:   logLevel,
 		Metadata: &event.SyncEventMetadata{
-			Commits:     cs,
-			InitialSync: c.initialSync,
-			Includes:    includesEvents,
-			Errors:      resourceErrors,
+			Commits:          cs,
+			InitialSync:      c.initialSync,
+			Includes:         includesEvents,
+			Errors:           resourceErrors,
+			UnverifiedCommit: c.unverifiedCommit,
+			NotReady:         notReady,
+			Hooks:            hooks,
 		},
 	}); err != nil {
 		logger.Log("err", err)
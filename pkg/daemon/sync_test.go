@@ -131,6 +131,142 @@ func checkSyncManifestsMetrics(t *testing.T, manifestSuccess, manifestFailures i
 	}
 }
 
+func TestSync_ReportsUnverifiedCommit(t *testing.T) {
+	d, cleanup := daemon(t, testfiles.Files)
+	defer cleanup()
+	k8s.SyncFunc = func(def cluster.SyncSet) error { return nil }
+
+	ctx := context.Background()
+	head, err := d.Repo.BranchHead(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitSync, _ := fluxsync.NewGitTagSyncProvider(d.Repo, "sync", "", fluxsync.VerifySignaturesModeNone, d.GitConfig)
+	syncState := &lastKnownSyncState{logger: d.Logger, state: gitSync}
+
+	unverified := func(rev string) git.Commit {
+		return git.Commit{Revision: rev, Signature: git.Signature{Key: "SHA256:abc", KeyType: git.KeyTypeSSH, Status: "U"}}
+	}
+	syncEvents := func() []event.Event {
+		es, err := events.AllEvents(time.Time{}, -1, time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return es
+	}
+
+	// reported along with the commits synced
+	d.unverifiedCommit = unverified("aaaaaaa")
+	if err := d.Sync(ctx, time.Now().UTC(), head, syncState); err != nil {
+		t.Fatal(err)
+	}
+	es := syncEvents()
+	if len(es) != 1 {
+		t.Fatalf("expected one event, got %#v", es)
+	}
+	metadata := es[0].Metadata.(*event.SyncEventMetadata)
+	if len(metadata.Commits) == 0 || metadata.UnverifiedCommit == nil {
+		t.Fatalf("expected commits and an unverified commit, got %#v", metadata)
+	}
+	if *metadata.UnverifiedCommit != (event.UnverifiedCommit{Revision: "aaaaaaa", Key: "SHA256:abc", KeyType: "ssh", Status: "U"}) {
+		t.Errorf("unexpected unverified commit %#v", metadata.UnverifiedCommit)
+	}
+	if es[0].LogLevel != event.LogLevelWarn {
+		t.Errorf("expected a warning, got %s", es[0].LogLevel)
+	}
+
+	// not reported again when there's nothing else to sync
+	if err := d.Sync(ctx, time.Now().UTC(), head, syncState); err != nil {
+		t.Fatal(err)
+	}
+	if es := syncEvents(); len(es) != 1 {
+		t.Fatalf("expected no more events, got %#v", es)
+	}
+
+	// but reported by itself when it's a different commit
+	d.unverifiedCommit = unverified("bbbbbbb")
+	if err := d.Sync(ctx, time.Now().UTC(), head, syncState); err != nil {
+		t.Fatal(err)
+	}
+	es = syncEvents()
+	if len(es) != 2 {
+		t.Fatalf("expected another event, got %#v", es)
+	}
+	metadata = es[1].Metadata.(*event.SyncEventMetadata)
+	if len(metadata.Commits) != 0 || metadata.UnverifiedCommit == nil || metadata.UnverifiedCommit.Revision != "bbbbbbb" {
+		t.Errorf("expected only the unverified commit, got %#v", metadata)
+	}
+}
+
+func TestSync_ReportsFailedHookOnce(t *testing.T) {
+	files := map[string]string{}
+	for name, content := range testfiles.Files {
+		files[name] = content
+	}
+	files["migrate.yaml"] = `---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+  namespace: default
+  annotations:
+    fluxcd.io/hook: pre-sync
+`
+	d, cleanup := daemon(t, files)
+	defer cleanup()
+	k8s.SyncFunc = func(def cluster.SyncSet) error { return nil }
+	hookFails := true
+	k8s.RunHookFunc = func(ctx context.Context, hook resource.Resource, key string) (bool, error) {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("expected the hook to be given a deadline")
+		}
+		if hookFails {
+			return true, fmt.Errorf("migration failed")
+		}
+		return true, nil
+	}
+
+	ctx := context.Background()
+	head, err := d.Repo.BranchHead(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitSync, _ := fluxsync.NewGitTagSyncProvider(d.Repo, "sync", "", fluxsync.VerifySignaturesModeNone, d.GitConfig)
+	syncState := &lastKnownSyncState{logger: d.Logger, state: gitSync}
+	syncEvents := func() []event.Event {
+		es, err := events.AllEvents(time.Time{}, -1, time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return es
+	}
+
+	// the failure is reported at the first attempt, but not at those
+	// after it
+	for i := 0; i < 3; i++ {
+		if err := d.Sync(ctx, time.Now().UTC(), head, syncState); err == nil {
+			t.Fatal("expected the sync to fail")
+		}
+	}
+	es := syncEvents()
+	if len(es) != 1 {
+		t.Fatalf("expected one event, got %#v", es)
+	}
+	metadata := es[0].Metadata.(*event.SyncEventMetadata)
+	if len(metadata.Hooks) != 1 || metadata.Hooks[0].Error == "" {
+		t.Errorf("expected the failed hook, got %#v", metadata.Hooks)
+	}
+
+	// once the hook succeeds, the commits are reported as synced
+	hookFails = false
+	if err := d.Sync(ctx, time.Now().UTC(), head, syncState); err != nil {
+		t.Fatal(err)
+	}
+	if es := syncEvents(); len(es) != 2 {
+		t.Fatalf("expected another event, got %#v", es)
+	}
+}
+
 func TestPullAndSync_InitialSync(t *testing.T) {
 	d, cleanup := daemon(t, testfiles.Files)
 	defer cleanup()
@@ -769,3 +905,45 @@ func TestDoSync_WithErrors(t *testing.T) {
 	// Check 2 sync error in stats
 	checkSyncManifestsMetrics(t, len(expectedResourceIDs)-2, 2)
 }
+
+func TestDoSync_GCAborted(t *testing.T) {
+	d, cleanup := daemon(t, testfiles.Files)
+	defer cleanup()
+
+	wouldDelete := []resource.ID{resource.MustParseID("default:deployment/gone")}
+	k8s.SyncFunc = func(def cluster.SyncSet) error {
+		return &cluster.GCAbortedError{Deletions: wouldDelete, MaxDeletions: 0}
+	}
+
+	ctx := context.Background()
+	head, err := d.Repo.BranchHead(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	syncTag := "sync"
+	gitSync, _ := fluxsync.NewGitTagSyncProvider(d.Repo, syncTag, "", fluxsync.VerifySignaturesModeNone, d.GitConfig)
+	syncState := &lastKnownSyncState{logger: d.Logger, state: gitSync}
+
+	// The resources were applied, so the sync still succeeds
+	if err := d.Sync(ctx, time.Now().UTC(), head, syncState); err != nil {
+		t.Error(err)
+	}
+
+	es, err := events.AllEvents(time.Time{}, -1, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(es) != 2 {
+		t.Fatalf("Unexpected events: %#v", es)
+	}
+	if es[0].Type != event.EventGCAborted || es[0].LogLevel != event.LogLevelError {
+		t.Errorf("Unexpected event: %#v", es[0])
+	}
+	if !reflect.DeepEqual(es[0].ServiceIDs, wouldDelete) {
+		t.Errorf("Unexpected event workload ids: %#v, expected: %#v", es[0].ServiceIDs, wouldDelete)
+	}
+	if es[1].Type != event.EventSync {
+		t.Errorf("Unexpected event type: %#v", es[1])
+	}
+}
@@ -0,0 +1,170 @@
+// Package decrypt decrypts SOPS-encrypted resources loaded from git,
+// before they are synced to the cluster. Unlike decrypting when
+// loading the files (`--sops`), a resource that can't be decrypted is
+// reported as a sync error for that resource alone, and the rest are
+// synced as usual.
+package decrypt
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/pkg/errors"
+	"go.mozilla.org/sops/v3"
+	"go.mozilla.org/sops/v3/aes"
+	"go.mozilla.org/sops/v3/cmd/sops/common"
+	"go.mozilla.org/sops/v3/keyservice"
+	sopsyaml "go.mozilla.org/sops/v3/stores/yaml"
+	"google.golang.org/grpc"
+
+	"github.com/fluxcd/flux/pkg/cluster"
+	"github.com/fluxcd/flux/pkg/resource"
+)
+
+// AgeKeys supplies the age identities used to decrypt data keys
+// encrypted for age recipients.
+type AgeKeys interface {
+	Identities(ctx context.Context) ([]age.Identity, error)
+}
+
+// Parser parses decrypted manifests back into resources; it's
+// satisfied by `manifests.Manifests`.
+type Parser interface {
+	ParseManifest(def []byte, source string) (map[string]resource.Resource, error)
+}
+
+// Decrypter decrypts resources encrypted with SOPS. Data keys
+// encrypted for age recipients are decrypted with the identities
+// from AgeKeys, and those encrypted with a key management service
+// with KMS. If either is nil, and for PGP keys, the keys and
+// credentials in fluxd's environment are used, as the sops binary
+// would use them.
+type Decrypter struct {
+	AgeKeys AgeKeys
+	KMS     KMS
+	Parser  Parser
+}
+
+// Decrypt decrypts any of the resources given that are encrypted with
+// SOPS. It returns the resources with those decrypted, leaving out
+// any that couldn't be, along with an error for each of those.
+func (d *Decrypter) Decrypt(ctx context.Context, resources map[string]resource.Resource) (map[string]resource.Resource, cluster.SyncError) {
+	result := make(map[string]resource.Resource, len(resources))
+	var errs cluster.SyncError
+	var keys *keyService
+	for id, res := range resources {
+		// avoid parsing everything; encrypted resources will
+		// always have the metadata key
+		if !bytes.Contains(res.Bytes(), []byte("sops:")) {
+			result[id] = res
+			continue
+		}
+		tree, err := (&sopsyaml.Store{}).LoadEncryptedFile(res.Bytes())
+		if err == sops.MetadataNotFound {
+			result[id] = res
+			continue
+		}
+		if keys == nil {
+			keys = d.keyService(ctx)
+		}
+		if err == nil {
+			var decrypted resource.Resource
+			if decrypted, err = d.decryptResource(res, tree, keys); err == nil {
+				result[id] = decrypted
+				continue
+			}
+		}
+		errs = append(errs, cluster.ResourceError{
+			ResourceID: res.ResourceID(),
+			Source:     res.Source(),
+			Error:      errors.Wrap(err, "decrypting resource"),
+		})
+	}
+	return result, errs
+}
+
+func (d *Decrypter) decryptResource(res resource.Resource, tree sops.Tree, keys *keyService) (resource.Resource, error) {
+	if _, err := common.DecryptTree(common.DecryptTreeOpts{
+		Tree:        &tree,
+		KeyServices: []keyservice.KeyServiceClient{keys},
+		Cipher:      aes.NewCipher(),
+	}); err != nil {
+		return nil, err
+	}
+	plain, err := (&sopsyaml.Store{}).EmitPlainFile(tree.Branches)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := d.Parser.ParseManifest(plain, res.Source())
+	if err != nil {
+		return nil, err
+	}
+	decrypted, ok := parsed[res.ResourceID().String()]
+	if !ok || len(parsed) != 1 {
+		return nil, fmt.Errorf("decrypted manifest does not define %s alone", res.ResourceID())
+	}
+	return decrypted, nil
+}
+
+// keyService decrypts SOPS data keys, for a single run of Decrypt;
+// the age identities are fetched at most once.
+type keyService struct {
+	ctx     context.Context
+	ageKeys AgeKeys
+	kms     KMS
+	// fetched lazily
+	identities []age.Identity
+	ageErr     error
+}
+
+func (d *Decrypter) keyService(ctx context.Context) *keyService {
+	return &keyService{ctx: ctx, ageKeys: d.AgeKeys, kms: d.KMS}
+}
+
+func (s *keyService) Encrypt(ctx context.Context, req *keyservice.EncryptRequest, opts ...grpc.CallOption) (*keyservice.EncryptResponse, error) {
+	return nil, errors.New("encryption is not supported")
+}
+
+func (s *keyService) Decrypt(_ context.Context, req *keyservice.DecryptRequest, opts ...grpc.CallOption) (*keyservice.DecryptResponse, error) {
+	var plaintext []byte
+	var err error
+	switch req.Key.KeyType.(type) {
+	case *keyservice.Key_AgeKey:
+		if s.ageKeys == nil {
+			return keyservice.Server{}.Decrypt(s.ctx, req)
+		}
+		plaintext, err = s.decryptAge(req.Ciphertext)
+	case *keyservice.Key_KmsKey, *keyservice.Key_GcpKmsKey, *keyservice.Key_AzureKeyvaultKey, *keyservice.Key_VaultKey:
+		if s.kms == nil {
+			return keyservice.Server{}.Decrypt(s.ctx, req)
+		}
+		plaintext, err = s.kms.Decrypt(s.ctx, kmsKeyFrom(req.Key), req.Ciphertext)
+	default:
+		return keyservice.Server{}.Decrypt(s.ctx, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &keyservice.DecryptResponse{Plaintext: plaintext}, nil
+}
+
+func (s *keyService) decryptAge(ciphertext []byte) ([]byte, error) {
+	if s.identities == nil && s.ageErr == nil {
+		s.identities, s.ageErr = s.ageKeys.Identities(s.ctx)
+		if s.ageErr == nil && len(s.identities) == 0 {
+			s.ageErr = errors.New("no age keys found")
+		}
+	}
+	if s.ageErr != nil {
+		return nil, s.ageErr
+	}
+	r, err := age.Decrypt(armor.NewReader(bytes.NewReader(ciphertext)), s.identities...)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
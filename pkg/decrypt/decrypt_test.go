@@ -0,0 +1,163 @@
+package decrypt
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	"go.mozilla.org/sops/v3"
+	"go.mozilla.org/sops/v3/aes"
+	sopsage "go.mozilla.org/sops/v3/age"
+	"go.mozilla.org/sops/v3/cmd/sops/common"
+	"go.mozilla.org/sops/v3/keys"
+	"go.mozilla.org/sops/v3/kms"
+	sopsyaml "go.mozilla.org/sops/v3/stores/yaml"
+
+	"github.com/fluxcd/flux/pkg/cluster/kubernetes"
+	"github.com/fluxcd/flux/pkg/resource"
+)
+
+const (
+	testKMSKeyID = "arn:aws:kms:eu-west-1:111122223333:key/flux-test"
+	secretYAML   = `apiVersion: v1
+kind: Secret
+metadata:
+  name: %s
+  namespace: default
+stringData:
+  password: hunter2
+`
+)
+
+type staticAgeKeys []age.Identity
+
+func (k staticAgeKeys) Identities(context.Context) ([]age.Identity, error) {
+	return k, nil
+}
+
+// encrypt encrypts the manifest given with SOPS, for the master key
+// given, which must already hold the encrypted data key.
+func encrypt(t *testing.T, manifest string, dataKey []byte, key keys.MasterKey) string {
+	store := &sopsyaml.Store{}
+	branches, err := store.LoadPlainFile([]byte(manifest))
+	assert.NoError(t, err)
+	tree := sops.Tree{
+		Branches: branches,
+		Metadata: sops.Metadata{
+			KeyGroups:      []sops.KeyGroup{{key}},
+			EncryptedRegex: "^(data|stringData)$",
+			Version:        "3.7.3",
+		},
+	}
+	assert.NoError(t, common.EncryptTree(common.EncryptTreeOpts{Tree: &tree, Cipher: aes.NewCipher(), DataKey: dataKey}))
+	out, err := store.EmitEncryptedFile(tree)
+	assert.NoError(t, err)
+	return string(out)
+}
+
+func newDataKey(t *testing.T) []byte {
+	dataKey := make([]byte, 32)
+	_, err := rand.Read(dataKey)
+	assert.NoError(t, err)
+	return dataKey
+}
+
+func parse(t *testing.T, parser Parser, manifests ...string) map[string]resource.Resource {
+	resources := map[string]resource.Resource{}
+	for i, m := range manifests {
+		parsed, err := parser.ParseManifest([]byte(m), fmt.Sprintf("file%d.yaml", i))
+		assert.NoError(t, err)
+		for id, res := range parsed {
+			resources[id] = res
+		}
+	}
+	return resources
+}
+
+func TestDecrypt(t *testing.T) {
+	parser := kubernetes.NewManifests(kubernetes.ConstNamespacer("default"), log.NewLogfmtLogger(os.Stderr))
+
+	identity, err := age.GenerateX25519Identity()
+	assert.NoError(t, err)
+	ageKeys, err := sopsage.MasterKeysFromRecipients(identity.Recipient().String())
+	assert.NoError(t, err)
+	ageDataKey := newDataKey(t)
+	assert.NoError(t, ageKeys[0].Encrypt(ageDataKey))
+	ageEncrypted := encrypt(t, fmt.Sprintf(secretYAML, "age"), ageDataKey, ageKeys[0])
+
+	localKMS := LocalKMS{testKMSKeyID: newDataKey(t)}
+	kmsDataKey := newDataKey(t)
+	encryptedDataKey, err := localKMS.Encrypt(testKMSKeyID, kmsDataKey)
+	assert.NoError(t, err)
+	kmsEncrypted := encrypt(t, fmt.Sprintf(secretYAML, "kms"), kmsDataKey, &kms.MasterKey{Arn: testKMSKeyID, EncryptedKey: string(encryptedDataKey)})
+
+	// encrypted for an age key we don't have
+	other, err := age.GenerateX25519Identity()
+	assert.NoError(t, err)
+	otherKeys, err := sopsage.MasterKeysFromRecipients(other.Recipient().String())
+	assert.NoError(t, err)
+	otherDataKey := newDataKey(t)
+	assert.NoError(t, otherKeys[0].Encrypt(otherDataKey))
+	otherEncrypted := encrypt(t, fmt.Sprintf(secretYAML, "other"), otherDataKey, otherKeys[0])
+
+	plain := fmt.Sprintf(secretYAML, "plain")
+
+	resources := parse(t, parser, ageEncrypted, kmsEncrypted, otherEncrypted, plain)
+	d := &Decrypter{AgeKeys: staticAgeKeys{identity}, KMS: localKMS, Parser: parser}
+	decrypted, errs := d.Decrypt(context.Background(), resources)
+
+	assert.Len(t, decrypted, 3)
+	for _, name := range []string{"age", "kms", "plain"} {
+		res, ok := decrypted["default:secret/"+name]
+		if assert.True(t, ok, name) {
+			assert.Contains(t, string(res.Bytes()), "password: hunter2", name)
+			assert.NotContains(t, string(res.Bytes()), "sops:", name)
+		}
+	}
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "default:secret/other", errs[0].ResourceID.String())
+		assert.Equal(t, "file2.yaml", errs[0].Source)
+	}
+}
+
+func TestDecrypt_AgeKeysError(t *testing.T) {
+	parser := kubernetes.NewManifests(kubernetes.ConstNamespacer("default"), log.NewLogfmtLogger(os.Stderr))
+	identity, err := age.GenerateX25519Identity()
+	assert.NoError(t, err)
+	ageKeys, err := sopsage.MasterKeysFromRecipients(identity.Recipient().String())
+	assert.NoError(t, err)
+	dataKey := newDataKey(t)
+	assert.NoError(t, ageKeys[0].Encrypt(dataKey))
+	encrypted := encrypt(t, fmt.Sprintf(secretYAML, "age"), dataKey, ageKeys[0])
+
+	d := &Decrypter{AgeKeys: staticAgeKeys{}, Parser: parser}
+	decrypted, errs := d.Decrypt(context.Background(), parse(t, parser, encrypted))
+	assert.Len(t, decrypted, 0)
+	assert.Len(t, errs, 1)
+}
+
+func TestParseLocalKMS(t *testing.T) {
+	kms, err := ParseLocalKMS(strings.NewReader(`
+# test keys
+arn:aws:kms:eu-west-1:111122223333:key/one	MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("0123456789abcdef0123456789abcdef"), kms["arn:aws:kms:eu-west-1:111122223333:key/one"])
+
+	_, err = ParseLocalKMS(strings.NewReader("key MDEy"))
+	assert.Error(t, err)
+
+	ciphertext, err := kms.Encrypt("arn:aws:kms:eu-west-1:111122223333:key/one", []byte("data key"))
+	assert.NoError(t, err)
+	plaintext, err := kms.Decrypt(context.Background(), KMSKey{ID: "arn:aws:kms:eu-west-1:111122223333:key/one"}, ciphertext)
+	assert.NoError(t, err)
+	assert.Equal(t, "data key", string(plaintext))
+	_, err = kms.Decrypt(context.Background(), KMSKey{ID: "arn:aws:kms:eu-west-1:111122223333:key/two"}, ciphertext)
+	assert.Error(t, err)
+}
@@ -0,0 +1,142 @@
+package decrypt
+
+import (
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.mozilla.org/sops/v3/keyservice"
+)
+
+// The key management services SOPS can encrypt data keys with.
+const (
+	KMSProviderAWS   = "aws"
+	KMSProviderGCP   = "gcp"
+	KMSProviderAzure = "azure"
+	KMSProviderVault = "vault"
+)
+
+// KMSKey identifies a key held by a key management service.
+type KMSKey struct {
+	Provider string
+	// ID is the ARN of an AWS KMS key, the resource ID of a GCP KMS
+	// key, or the URL of an Azure Key Vault or HashiCorp Vault key,
+	// as sops shows them.
+	ID string
+	// Context is the encryption context of an AWS KMS key, if any
+	Context map[string]string
+}
+
+// KMS decrypts data keys encrypted with a key management service.
+type KMS interface {
+	// Decrypt decrypts the ciphertext given, as it appears in the
+	// SOPS metadata, with the key given.
+	Decrypt(ctx context.Context, key KMSKey, ciphertext []byte) ([]byte, error)
+}
+
+func kmsKeyFrom(key *keyservice.Key) KMSKey {
+	switch k := key.KeyType.(type) {
+	case *keyservice.Key_KmsKey:
+		return KMSKey{Provider: KMSProviderAWS, ID: k.KmsKey.Arn, Context: k.KmsKey.Context}
+	case *keyservice.Key_GcpKmsKey:
+		return KMSKey{Provider: KMSProviderGCP, ID: k.GcpKmsKey.ResourceId}
+	case *keyservice.Key_AzureKeyvaultKey:
+		az := k.AzureKeyvaultKey
+		return KMSKey{Provider: KMSProviderAzure, ID: fmt.Sprintf("%s/keys/%s/%s", az.VaultUrl, az.Name, az.Version)}
+	case *keyservice.Key_VaultKey:
+		v := k.VaultKey
+		return KMSKey{Provider: KMSProviderVault, ID: fmt.Sprintf("%s/v1/%s/keys/%s", v.VaultAddress, v.EnginePath, v.KeyName)}
+	}
+	return KMSKey{}
+}
+
+// LocalKMS is a stand-in for a key management service, which keeps
+// its keys in memory, by key ID. It's for testing, and for running
+// where the real service can't be reached. Ciphertexts are base64
+// encodings of the nonce and the AES-GCM sealed data key, with the
+// key ID as additional data.
+type LocalKMS map[string][]byte
+
+// ReadLocalKMS reads the keys for a LocalKMS from a file, with a key
+// per line, given as its ID and the base64 encoding of 32 random
+// bytes, separated by whitespace.
+func ReadLocalKMS(path string) (LocalKMS, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading local KMS keys")
+	}
+	defer f.Close()
+	return ParseLocalKMS(f)
+}
+
+// ParseLocalKMS parses the keys for a LocalKMS, as ReadLocalKMS.
+func ParseLocalKMS(r io.Reader) (LocalKMS, error) {
+	kms := LocalKMS{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected key ID and key", line)
+		}
+		key, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("line %d: key must be 32 bytes, base64-encoded", line)
+		}
+		kms[fields[0]] = key
+	}
+	return kms, scanner.Err()
+}
+
+func (k LocalKMS) aead(id string) (cipher.AEAD, error) {
+	key, ok := k[id]
+	if !ok {
+		return nil, fmt.Errorf("no local key %q", id)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypt encrypts a data key with the key given, as SOPS would with
+// a key management service.
+func (k LocalKMS) Encrypt(id string, plaintext []byte) ([]byte, error) {
+	gcm, err := k.aead(id)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := gcm.Seal(nonce, nonce, plaintext, []byte(id))
+	return []byte(base64.StdEncoding.EncodeToString(sealed)), nil
+}
+
+func (k LocalKMS) Decrypt(_ context.Context, key KMSKey, ciphertext []byte) ([]byte, error) {
+	gcm, err := k.aead(key.ID)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(string(ciphertext))
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding ciphertext")
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(key.ID))
+}
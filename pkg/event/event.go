@@ -7,6 +7,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/fluxcd/flux/pkg/policy"
 	"github.com/fluxcd/flux/pkg/resource"
 	"github.com/fluxcd/flux/pkg/update"
 	"github.com/pkg/errors"
@@ -23,6 +24,9 @@ const (
 	EventLock         = "lock"
 	EventUnlock       = "unlock"
 	EventUpdatePolicy = "update_policy"
+	EventRollback     = "rollback"
+	EventDrift        = "drift"
+	EventGCAborted    = "gc_aborted"
 
 	// This is used to label e.g., commits that we _don't_ consider an event in themselves.
 	NoneOfTheAbove = "other"
@@ -131,6 +135,27 @@ func (e Event) String() string {
 			"Automated release of %s",
 			strings.Join(strImageIDs, ", "),
 		)
+	case EventRollback:
+		metadata := e.Metadata.(*RollbackEventMetadata)
+		strImageIDs := metadata.Result.ChangedImages()
+		if len(strImageIDs) == 0 {
+			strImageIDs = []string{"no image changes"}
+		}
+		var user string
+		if metadata.Cause.User != "" {
+			user = fmt.Sprintf(", by %s", metadata.Cause.User)
+		}
+		var msg string
+		if metadata.Cause.Message != "" {
+			msg = fmt.Sprintf(", with message %q", metadata.Cause.Message)
+		}
+		return fmt.Sprintf(
+			"Rolled back: %s to %s%s%s",
+			metadata.Spec.Workload,
+			strings.Join(strImageIDs, ", "),
+			user,
+			msg,
+		)
 	case EventCommit:
 		metadata := e.Metadata.(*CommitEventMetadata)
 		svcStr := "<no changes>"
@@ -154,7 +179,36 @@ func (e Event) String() string {
 		if len(strWorkloadIDs) > 0 {
 			svcStr = strings.Join(strWorkloadIDs, ", ")
 		}
-		return fmt.Sprintf("Sync: %s, %s", revStr, svcStr)
+		var unverifiedStr string
+		if metadata.UnverifiedCommit != nil {
+			unverifiedStr = fmt.Sprintf("; stopped at %s, whose signature could not be verified", shortRevision(metadata.UnverifiedCommit.Revision))
+		}
+		var failedStr string
+		var failed []string
+		for _, r := range metadata.NotReady {
+			if r.Status == "Failed" {
+				failed = append(failed, r.ID.String())
+			}
+		}
+		if len(failed) > 0 {
+			failedStr = fmt.Sprintf("; failed to reconcile: %s", strings.Join(failed, ", "))
+		}
+		var hooksStr string
+		var failedHooks []string
+		aborted := false
+		for _, h := range metadata.Hooks {
+			if h.Error != "" {
+				failedHooks = append(failedHooks, h.ID.String())
+				aborted = aborted || h.Phase == policy.HookPreSync
+			}
+		}
+		if len(failedHooks) > 0 {
+			hooksStr = fmt.Sprintf("; hooks failed: %s", strings.Join(failedHooks, ", "))
+		}
+		if aborted {
+			hooksStr += ", so the sync was aborted"
+		}
+		return fmt.Sprintf("Sync: %s, %s%s%s%s", revStr, svcStr, unverifiedStr, failedStr, hooksStr)
 	case EventAutomate:
 		return fmt.Sprintf("Automated: %s", strings.Join(strWorkloadIDs, ", "))
 	case EventDeautomate:
@@ -165,6 +219,16 @@ func (e Event) String() string {
 		return fmt.Sprintf("Unlocked: %s", strings.Join(strWorkloadIDs, ", "))
 	case EventUpdatePolicy:
 		return fmt.Sprintf("Updated policies: %s", strings.Join(strWorkloadIDs, ", "))
+	case EventDrift:
+		metadata := e.Metadata.(*DriftEventMetadata)
+		var correcting string
+		if metadata.Correcting {
+			correcting = "; syncing to correct it"
+		}
+		return fmt.Sprintf("Drift detected: %s%s", strings.Join(strWorkloadIDs, ", "), correcting)
+	case EventGCAborted:
+		metadata := e.Metadata.(*GCAbortedEventMetadata)
+		return fmt.Sprintf("Garbage collection aborted: %d resources to delete, maximum is %d", len(e.ServiceIDs), metadata.MaxDeletions)
 	default:
 		return fmt.Sprintf("Unknown event: %s", e.Type)
 	}
@@ -216,6 +280,51 @@ type SyncEventMetadata struct {
 	Errors []ResourceError `json:"errors,omitempty"`
 	// `true` if we have no record of having synced before
 	InitialSync bool `json:"initialSync,omitempty"`
+	// The first commit whose signature could not be verified, if
+	// signatures are verified; neither it nor the commits after it
+	// were synced
+	UnverifiedCommit *UnverifiedCommit `json:"unverifiedCommit,omitempty"`
+	// The resources synced that had not been reconciled just after
+	// the sync; those in progress may well finish, but those failed
+	// will need attention
+	NotReady []ResourceReadiness `json:"notReady,omitempty"`
+	// The sync hooks that were run, and how they went. If a pre-sync
+	// hook failed, nothing else was applied.
+	Hooks []HookResult `json:"hooks,omitempty"`
+}
+
+// HookResult is the outcome of running a sync hook.
+type HookResult struct {
+	ID resource.ID
+	// Phase is pre-sync or post-sync
+	Phase string `json:"phase"`
+	// Error is empty if the hook succeeded
+	Error string `json:"error,omitempty"`
+}
+
+// ResourceReadiness is the readiness of a resource, as kstatus would
+// have it: InProgress, Failed, Terminating, or Unknown, if it's not
+// Current.
+type ResourceReadiness struct {
+	ID      resource.ID
+	Status  string
+	Message string `json:"message,omitempty"`
+}
+
+// UnverifiedCommit describes a commit and the signature on it that
+// could not be verified.
+type UnverifiedCommit struct {
+	Revision string `json:"revision"`
+	// The ID of a GPG key, or the fingerprint of an SSH key
+	Key string `json:"key,omitempty"`
+	// `gpg` or `ssh`, or empty if the commit isn't signed
+	KeyType string `json:"keyType,omitempty"`
+	// Who signed, if known
+	Principal string `json:"principal,omitempty"`
+	// The status of the signature as git reports it; e.g., `N` for
+	// no signature, `B` for a bad signature, `U` for a signature
+	// from an untrusted key
+	Status string `json:"status"`
 }
 
 // Account for old events, which used the revisions field rather than commits
@@ -315,6 +424,38 @@ type AutoReleaseEventMetadata struct {
 	Spec update.Automated `json:"spec"`
 }
 
+// RollbackEventMetadata is for when a workload is rolled back to
+// the images it had before one or more image changes
+type RollbackEventMetadata struct {
+	ReleaseEventCommon
+	Spec  update.RollbackSpec `json:"spec"`
+	Cause update.Cause        `json:"cause"`
+}
+
+// ResourceDrift describes a resource found to differ from what was
+// last synced.
+type ResourceDrift struct {
+	ID     resource.ID
+	Path   string
+	Reason string
+	Fields []string `json:"fields,omitempty"`
+}
+
+// DriftEventMetadata is the metadata for when resources in the
+// cluster are found to have been changed since they were synced
+type DriftEventMetadata struct {
+	Resources []ResourceDrift `json:"resources"`
+	// `true` if a sync was requested to correct the drift
+	Correcting bool `json:"correcting,omitempty"`
+}
+
+// GCAbortedEventMetadata is the metadata for when garbage collection
+// didn't delete anything, because it would have deleted too much. The
+// resources it would have deleted are the event's ServiceIDs.
+type GCAbortedEventMetadata struct {
+	MaxDeletions int `json:"maxDeletions"`
+}
+
 type UnknownEventMetadata map[string]interface{}
 
 func (e *Event) UnmarshalJSON(in []byte) error {
@@ -350,6 +491,27 @@ func (e *Event) UnmarshalJSON(in []byte) error {
 		}
 		e.Metadata = &metadata
 		break
+	case EventRollback:
+		var metadata RollbackEventMetadata
+		if err := json.Unmarshal(wireEvent.MetadataBytes, &metadata); err != nil {
+			return err
+		}
+		e.Metadata = &metadata
+		break
+	case EventDrift:
+		var metadata DriftEventMetadata
+		if err := json.Unmarshal(wireEvent.MetadataBytes, &metadata); err != nil {
+			return err
+		}
+		e.Metadata = &metadata
+		break
+	case EventGCAborted:
+		var metadata GCAbortedEventMetadata
+		if err := json.Unmarshal(wireEvent.MetadataBytes, &metadata); err != nil {
+			return err
+		}
+		e.Metadata = &metadata
+		break
 	case EventCommit:
 		var metadata CommitEventMetadata
 		if err := json.Unmarshal(wireEvent.MetadataBytes, &metadata); err != nil {
@@ -403,6 +565,18 @@ func (rem *AutoReleaseEventMetadata) Type() string {
 	return EventAutoRelease
 }
 
+func (rem *RollbackEventMetadata) Type() string {
+	return EventRollback
+}
+
+func (dem *DriftEventMetadata) Type() string {
+	return EventDrift
+}
+
+func (gem *GCAbortedEventMetadata) Type() string {
+	return EventGCAborted
+}
+
 // Special exception from pointer receiver rule, as UnknownEventMetadata is a
 // type alias for a map
 func (uem UnknownEventMetadata) Type() string {
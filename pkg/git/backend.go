@@ -0,0 +1,172 @@
+package git
+
+import (
+	"context"
+)
+
+// Backend carries out the git operations needed by Repo, Checkout
+// and Export. The default backend runs the git executable; see
+// GoGitBackend for one that does everything in-process.
+//
+// Errors that callers may want to act on are distinguishable with
+// `errors.Is`; e.g., ErrRefNotFound, ErrNonFastForward.
+type Backend interface {
+	// Mirror makes a bare mirror of the repo at repoURL in dir. If
+	// depth is more than zero, only that much history is fetched.
+	Mirror(ctx context.Context, dir, repoURL string, creds Credentials, depth int) (string, error)
+	// Clone makes a working clone of the repo at repoURL in dir,
+	// with the branch given (or the default branch) checked out. If
+	// sparsePaths is not empty, only the files under those paths
+	// are checked out.
+	Clone(ctx context.Context, dir, repoURL, branch string, sparsePaths []string) (string, error)
+	// Deepen fetches more history into a shallow repo: depth more
+	// commits, or all of it if depth is zero.
+	Deepen(ctx context.Context, dir, upstream string, creds Credentials, depth int) error
+	// Config sets the user name and email used for commits.
+	Config(ctx context.Context, dir, user, email string) error
+	// Fetch updates refs from upstream, which may be the name of a
+	// remote or a URL. Refs that aren't found upstream are ignored.
+	//
+	// The methods that contact an upstream are given the credentials
+	// to use, which may be nil.
+	Fetch(ctx context.Context, dir, upstream string, creds Credentials, refspec ...string) error
+	// CheckPush tests that the upstream can be written to.
+	CheckPush(ctx context.Context, dir, upstream string, creds Credentials, branch string) error
+	Checkout(ctx context.Context, dir, ref string) error
+	Add(ctx context.Context, dir, path string) error
+	// HasChanges reports whether there are uncommitted changes in
+	// the paths given; or, if all is true, anywhere in the repo,
+	// including in the index.
+	HasChanges(ctx context.Context, dir string, paths []string, all bool) bool
+	// Commit commits all changes to tracked files.
+	Commit(ctx context.Context, dir string, action CommitAction) error
+	Push(ctx context.Context, dir, upstream string, creds Credentials, refs []string) error
+	RefExists(ctx context.Context, dir, ref string) (bool, error)
+	RefRevision(ctx context.Context, dir, ref string) (string, error)
+	// IsAncestor reports whether ancestor is in the history of ref.
+	IsAncestor(ctx context.Context, dir, ancestor, ref string) (bool, error)
+	// Log lists the commits in refspec (either a ref, or a range
+	// `ref1..ref2`) that touch the paths given, most recent first.
+	// SSH signatures are checked against the allowedSigners file, if
+	// given; likewise in VerifyTag and VerifyCommit.
+	Log(ctx context.Context, dir, refspec string, paths []string, firstParent bool, allowedSigners string) ([]Commit, error)
+	// Changed lists the files under paths that have been added or
+	// changed since ref.
+	Changed(ctx context.Context, dir, ref string, paths []string) ([]string, error)
+	// NotesRef expands a short notes ref (e.g., `flux`) to its full
+	// name.
+	NotesRef(ctx context.Context, dir, ref string) (string, error)
+	AddNote(ctx context.Context, dir, rev, notesRef string, note interface{}) error
+	GetNote(ctx context.Context, dir, notesRef, rev string, note interface{}) (bool, error)
+	NoteRevList(ctx context.Context, dir, notesRef string) (map[string]struct{}, error)
+	MoveTagAndPush(ctx context.Context, dir, upstream string, creds Credentials, action TagAction) error
+	DeleteTag(ctx context.Context, dir, tag, upstream string, creds Credentials) error
+	// VerifyTag verifies the signature on a tag and returns the
+	// revision it points at.
+	VerifyTag(ctx context.Context, dir, tag, allowedSigners string) (string, error)
+	VerifyCommit(ctx context.Context, dir, commit, allowedSigners string) error
+	SecretUnseal(ctx context.Context, dir string) error
+}
+
+// execBackend is the Backend that runs the git executable.
+type execBackend struct{}
+
+func (execBackend) Mirror(ctx context.Context, dir, repoURL string, creds Credentials, depth int) (string, error) {
+	return mirror(ctx, dir, repoURL, creds, depth)
+}
+
+func (execBackend) Clone(ctx context.Context, dir, repoURL, branch string, sparsePaths []string) (string, error) {
+	return clone(ctx, dir, repoURL, branch, sparsePaths)
+}
+
+func (execBackend) Deepen(ctx context.Context, dir, upstream string, creds Credentials, depth int) error {
+	return deepen(ctx, dir, upstream, creds, depth)
+}
+
+func (execBackend) Config(ctx context.Context, dir, user, email string) error {
+	return config(ctx, dir, user, email)
+}
+
+func (execBackend) Fetch(ctx context.Context, dir, upstream string, creds Credentials, refspec ...string) error {
+	return fetch(ctx, dir, upstream, creds, refspec...)
+}
+
+func (execBackend) CheckPush(ctx context.Context, dir, upstream string, creds Credentials, branch string) error {
+	return checkPush(ctx, dir, upstream, creds, branch)
+}
+
+func (execBackend) Checkout(ctx context.Context, dir, ref string) error {
+	return checkout(ctx, dir, ref)
+}
+
+func (execBackend) Add(ctx context.Context, dir, path string) error {
+	return add(ctx, dir, path)
+}
+
+func (execBackend) HasChanges(ctx context.Context, dir string, paths []string, all bool) bool {
+	return check(ctx, dir, paths, all)
+}
+
+func (execBackend) Commit(ctx context.Context, dir string, action CommitAction) error {
+	return commit(ctx, dir, action)
+}
+
+func (execBackend) Push(ctx context.Context, dir, upstream string, creds Credentials, refs []string) error {
+	return push(ctx, dir, upstream, creds, refs)
+}
+
+func (execBackend) RefExists(ctx context.Context, dir, ref string) (bool, error) {
+	return refExists(ctx, dir, ref)
+}
+
+func (execBackend) RefRevision(ctx context.Context, dir, ref string) (string, error) {
+	return refRevision(ctx, dir, ref)
+}
+
+func (execBackend) IsAncestor(ctx context.Context, dir, ancestor, ref string) (bool, error) {
+	return isAncestor(ctx, dir, ancestor, ref)
+}
+
+func (execBackend) Log(ctx context.Context, dir, refspec string, paths []string, firstParent bool, allowedSigners string) ([]Commit, error) {
+	return onelinelog(ctx, dir, refspec, paths, firstParent, allowedSigners)
+}
+
+func (execBackend) Changed(ctx context.Context, dir, ref string, paths []string) ([]string, error) {
+	return changed(ctx, dir, ref, paths)
+}
+
+func (execBackend) NotesRef(ctx context.Context, dir, ref string) (string, error) {
+	return getNotesRef(ctx, dir, ref)
+}
+
+func (execBackend) AddNote(ctx context.Context, dir, rev, notesRef string, note interface{}) error {
+	return addNote(ctx, dir, rev, notesRef, note)
+}
+
+func (execBackend) GetNote(ctx context.Context, dir, notesRef, rev string, note interface{}) (bool, error) {
+	return getNote(ctx, dir, notesRef, rev, note)
+}
+
+func (execBackend) NoteRevList(ctx context.Context, dir, notesRef string) (map[string]struct{}, error) {
+	return noteRevList(ctx, dir, notesRef)
+}
+
+func (execBackend) MoveTagAndPush(ctx context.Context, dir, upstream string, creds Credentials, action TagAction) error {
+	return moveTagAndPush(ctx, dir, upstream, creds, action)
+}
+
+func (execBackend) DeleteTag(ctx context.Context, dir, tag, upstream string, creds Credentials) error {
+	return deleteTag(ctx, dir, tag, upstream, creds)
+}
+
+func (execBackend) VerifyTag(ctx context.Context, dir, tag, allowedSigners string) (string, error) {
+	return verifyTag(ctx, dir, tag, allowedSigners)
+}
+
+func (execBackend) VerifyCommit(ctx context.Context, dir, commit, allowedSigners string) error {
+	return verifyCommit(ctx, dir, commit, allowedSigners)
+}
+
+func (execBackend) SecretUnseal(ctx context.Context, dir string) error {
+	return secretUnseal(ctx, dir)
+}
@@ -0,0 +1,219 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	gogit "github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fluxcd/flux/pkg/cluster/kubernetes/testfiles"
+)
+
+// backends gives each backend to test. The exec backend is skipped
+// if there's no git executable to run.
+func backends(t *testing.T) map[string]Backend {
+	bs := map[string]Backend{"go-git": NewGoGitBackend()}
+	if _, err := exec.LookPath("git"); err == nil {
+		bs["exec"] = execBackend{}
+	} else {
+		t.Log("no git executable found; testing only the go-git backend")
+	}
+	return bs
+}
+
+// upstreamRepo makes a bare repo with a few commits, using go-git so
+// that no git executable is needed. It returns the path to the repo
+// and the revisions committed, oldest first.
+func upstreamRepo(t *testing.T, dir string) (string, []string) {
+	work := filepath.Join(dir, "work")
+	repo, err := gogit.PlainInit(work, false)
+	require.NoError(t, err)
+	w, err := repo.Worktree()
+	require.NoError(t, err)
+
+	var revs []string
+	when := time.Now().Add(-time.Hour)
+	for _, change := range []map[string]string{
+		{"dev/app.yaml": "v1", "prod/app.yaml": "v1"},
+		{"dev/app.yaml": "v2"},
+		{"prod/app.yaml": "v2"},
+	} {
+		for path, content := range change {
+			require.NoError(t, os.MkdirAll(filepath.Join(work, filepath.Dir(path)), 0755))
+			require.NoError(t, ioutil.WriteFile(filepath.Join(work, path), []byte(content), 0644))
+		}
+		require.NoError(t, w.AddWithOptions(&gogit.AddOptions{All: true}))
+		when = when.Add(time.Minute)
+		sig := &object.Signature{Name: "example", Email: "example@example.com", When: when}
+		hash, err := w.Commit("Change\n\nwith a body", &gogit.CommitOptions{Author: sig, Committer: sig})
+		require.NoError(t, err)
+		revs = append(revs, hash.String())
+	}
+
+	bare := filepath.Join(dir, "upstream")
+	_, err = gogit.PlainInit(bare, true)
+	require.NoError(t, err)
+	_, err = repo.CreateRemote(&gitconfig.RemoteConfig{Name: "upstream", URLs: []string{bare}})
+	require.NoError(t, err)
+	require.NoError(t, repo.Push(&gogit.PushOptions{
+		RemoteName: "upstream",
+		RefSpecs:   []gitconfig.RefSpec{"refs/heads/master:refs/heads/master"},
+	}))
+	return bare, revs
+}
+
+func TestBackends(t *testing.T) {
+	for name, backend := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			testBackend(t, backend)
+		})
+	}
+}
+
+func testBackend(t *testing.T, backend Backend) {
+	dir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+	upstream, revs := upstreamRepo(t, dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	repo := NewRepo(Remote{URL: upstream}, Branch("master"), WithBackend(backend))
+	require.NoError(t, repo.Ready(ctx))
+	defer repo.Clean()
+
+	head, err := repo.BranchHead(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, revs[2], head)
+
+	_, err = repo.Revision(ctx, "does-not-exist")
+	assert.True(t, errors.Is(err, ErrRefNotFound), "expected ErrRefNotFound, got %v", err)
+
+	commits, err := repo.CommitsBefore(ctx, head, false, "dev")
+	require.NoError(t, err)
+	if assert.Len(t, commits, 2) {
+		assert.Equal(t, revs[1], commits[0].Revision)
+		assert.Equal(t, revs[0], commits[1].Revision)
+		assert.Equal(t, "Change", commits[0].Message)
+		assert.Equal(t, "example", commits[0].Author)
+		assert.Equal(t, "N", commits[0].Signature.Status)
+	}
+	commits, err = repo.CommitsBetween(ctx, revs[0], head, false)
+	require.NoError(t, err)
+	assert.Len(t, commits, 2)
+
+	conf := Config{
+		Branch:    "master",
+		NotesRef:  "flux",
+		UserName:  "flux",
+		UserEmail: "flux@example.com",
+		Paths:     []string{"dev"},
+	}
+	checkout, err := repo.Clone(ctx, conf)
+	require.NoError(t, err)
+	defer checkout.Clean()
+	stale, err := repo.Clone(ctx, conf)
+	require.NoError(t, err)
+	defer stale.Clean()
+
+	assert.Equal(t, ErrNoChanges, checkout.CommitAndPush(ctx, CommitAction{Message: "nothing"}, nil, false))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(checkout.Dir(), "dev", "app.yaml"), []byte("v3"), 0644))
+	require.NoError(t, checkout.CommitAndPush(ctx, CommitAction{Message: "Update dev"}, &Note{ID: "job-1"}, false))
+	newHead, err := checkout.HeadRevision(ctx)
+	require.NoError(t, err)
+	require.NoError(t, checkout.MoveTagAndPush(ctx, TagAction{Tag: "flux-sync", Revision: newHead, Message: "Sync pointer"}))
+
+	require.NoError(t, repo.Refresh(ctx))
+	head, err = repo.BranchHead(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, newHead, head)
+	tagged, err := repo.Revision(ctx, "flux-sync")
+	require.NoError(t, err)
+	assert.Equal(t, newHead, tagged)
+
+	var note Note
+	ok, err := repo.GetNote(ctx, newHead, "refs/notes/flux", &note)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "job-1", note.ID)
+	notes, err := repo.NoteRevList(ctx, "refs/notes/flux")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]struct{}{newHead: {}}, notes)
+	ok, err = repo.GetNote(ctx, revs[0], "refs/notes/flux", &note)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	export, err := repo.Export(ctx, newHead)
+	require.NoError(t, err)
+	defer export.Clean()
+	changed, err := export.ChangedFiles(ctx, revs[0], []string{"dev"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(export.Dir(), "dev", "app.yaml")}, changed)
+
+	// The other checkout was made before the push above, so pushing
+	// from it can't fast-forward.
+	require.NoError(t, ioutil.WriteFile(filepath.Join(stale.Dir(), "dev", "new.yaml"), []byte("v1"), 0644))
+	err = stale.CommitAndPush(ctx, CommitAction{Message: "Conflicting update"}, nil, true)
+	assert.True(t, errors.Is(err, ErrNonFastForward), "expected ErrNonFastForward, got %v", err)
+}
+
+func TestGoGitBackend_Signing(t *testing.T) {
+	dir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+	upstream, _ := upstreamRepo(t, dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	key, err := openpgp.NewEntity("flux", "", "flux@example.com", nil)
+	require.NoError(t, err)
+	backend := NewGoGitBackend()
+	backend.KeyRing = openpgp.EntityList{key}
+
+	repo := NewRepo(Remote{URL: upstream}, Branch("master"), WithBackend(backend))
+	require.NoError(t, repo.Ready(ctx))
+	defer repo.Clean()
+
+	checkout, err := repo.Clone(ctx, Config{
+		Branch:     "master",
+		NotesRef:   "flux",
+		UserName:   "flux",
+		UserEmail:  "flux@example.com",
+		SigningKey: key.PrimaryKey.KeyIdString(),
+	})
+	require.NoError(t, err)
+	defer checkout.Clean()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(checkout.Dir(), "dev", "app.yaml"), []byte("v3"), 0644))
+	require.NoError(t, checkout.CommitAndPush(ctx, CommitAction{Message: "Signed"}, nil, false))
+	head, err := checkout.HeadRevision(ctx)
+	require.NoError(t, err)
+	require.NoError(t, checkout.MoveTagAndPush(ctx, TagAction{Tag: "flux-sync", Revision: head, Message: "Sync pointer"}))
+	require.NoError(t, repo.Refresh(ctx))
+
+	assert.NoError(t, repo.VerifyCommit(ctx, head))
+	tagged, err := repo.VerifyTag(ctx, "flux-sync")
+	assert.NoError(t, err)
+	assert.Equal(t, head, tagged)
+	commits, err := repo.CommitsBefore(ctx, head, false)
+	require.NoError(t, err)
+	assert.Equal(t, Signature{Key: strings.ToUpper(key.PrimaryKey.KeyIdString()), KeyType: KeyTypeGPG, Principal: "flux <flux@example.com>", Status: "G"}, commits[0].Signature)
+	assert.Equal(t, "N", commits[1].Signature.Status)
+
+	backend.KeyRing = nil
+	assert.Error(t, repo.VerifyCommit(ctx, head))
+	commits, err = repo.CommitsBefore(ctx, head, false)
+	require.NoError(t, err)
+	assert.Equal(t, "E", commits[0].Signature.Status)
+}
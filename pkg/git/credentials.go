@@ -0,0 +1,294 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Credentials supplies the username and password (or token) used to
+// authenticate to HTTPS remotes. They are asked for each time the
+// remote is contacted, so they can change while fluxd is running.
+type Credentials interface {
+	Get(ctx context.Context) (username, password string, err error)
+}
+
+// TokenFile supplies a token read from a file, e.g., one mounted from
+// a Kubernetes secret. The file is read again whenever it changes.
+type TokenFile struct {
+	Username string
+	Path     string
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	token   string
+}
+
+func NewTokenFile(username, path string) *TokenFile {
+	return &TokenFile{Username: username, Path: path}
+}
+
+func (f *TokenFile) Get(ctx context.Context) (string, string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	info, err := os.Stat(f.Path)
+	if err != nil {
+		return "", "", errors.Wrap(err, "reading git token")
+	}
+	if f.token == "" || !info.ModTime().Equal(f.modTime) || info.Size() != f.size {
+		b, err := ioutil.ReadFile(f.Path)
+		if err != nil {
+			return "", "", errors.Wrap(err, "reading git token")
+		}
+		f.token = strings.TrimSpace(string(b))
+		f.modTime, f.size = info.ModTime(), info.Size()
+	}
+	if f.token == "" {
+		return "", "", fmt.Errorf("git token file %s is empty", f.Path)
+	}
+	return f.Username, f.token, nil
+}
+
+const (
+	DefaultGitHubAPIURL = "https://api.github.com"
+
+	// installation tokens last an hour; get a new one well before
+	// the old one expires, so it doesn't run out mid-operation.
+	githubTokenRefreshMargin = 5 * time.Minute
+)
+
+// GitHubApp supplies installation tokens for a GitHub App, minting a
+// new one when the last is close to expiry.
+type GitHubApp struct {
+	AppID          int64
+	InstallationID int64
+	APIURL         string
+	Client         *http.Client
+
+	key *rsa.PrivateKey
+	now func() time.Time
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// NewGitHubApp constructs a GitHubApp given the app's PEM-encoded
+// private key. If apiURL is empty, the public GitHub API is used.
+func NewGitHubApp(appID, installationID int64, privateKey []byte, apiURL string) (*GitHubApp, error) {
+	block, _ := pem.Decode(privateKey)
+	if block == nil {
+		return nil, errors.New("GitHub App private key is not PEM-encoded")
+	}
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		parsed, err8 := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err8 != nil {
+			return nil, errors.Wrap(err, "parsing GitHub App private key")
+		}
+		var ok bool
+		if key, ok = parsed.(*rsa.PrivateKey); !ok {
+			return nil, errors.New("GitHub App private key is not an RSA key")
+		}
+	}
+	if apiURL == "" {
+		apiURL = DefaultGitHubAPIURL
+	}
+	return &GitHubApp{
+		AppID:          appID,
+		InstallationID: installationID,
+		APIURL:         strings.TrimSuffix(apiURL, "/"),
+		Client:         http.DefaultClient,
+		key:            key,
+		now:            time.Now,
+	}, nil
+}
+
+func (a *GitHubApp) Get(ctx context.Context) (string, string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token == "" || a.now().After(a.expires.Add(-githubTokenRefreshMargin)) {
+		if err := a.refresh(ctx); err != nil {
+			return "", "", errors.Wrap(err, "getting GitHub App installation token")
+		}
+	}
+	return "x-access-token", a.token, nil
+}
+
+// jwt makes the token that authenticates as the app itself.
+func (a *GitHubApp) jwt() (string, error) {
+	now := a.now()
+	enc := base64.RawURLEncoding
+	header := enc.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]interface{}{
+		// backdated, to allow for clock drift
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": a.AppID,
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := header + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + enc.EncodeToString(sig), nil
+}
+
+func (a *GitHubApp) refresh(ctx context.Context) error {
+	jwt, err := a.jwt()
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("%s/app/installations/%d/access_tokens", a.APIURL, a.InstallationID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	resp, err := a.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("%s from %s: %s", resp.Status, url, bytes.TrimSpace(body))
+	}
+	var token struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return errors.Wrap(err, "decoding installation token")
+	}
+	if token.Token == "" {
+		return errors.New("no installation token in response")
+	}
+	a.token, a.expires = token.Token, token.ExpiresAt
+	return nil
+}
+
+// credentialsEnv gives the environment for git to send the
+// credentials with each HTTP request to url, and to no other (e.g.,
+// a submodule's host). Passing them this way, rather than in the URL
+// or arguments, keeps them out of the remote config, process
+// listings and git's output. The entries are numbered after any
+// config already given in environ.
+func credentialsEnv(environ []string, url, username, password string) []string {
+	n := 0
+	for _, kv := range environ {
+		if count := strings.TrimPrefix(kv, "GIT_CONFIG_COUNT="); count != kv {
+			n, _ = strconv.Atoi(count)
+		}
+	}
+	auth := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+	return []string{
+		"GIT_CONFIG_COUNT=" + strconv.Itoa(n+1),
+		fmt.Sprintf("GIT_CONFIG_KEY_%d=http.%s.extraHeader", n, url),
+		fmt.Sprintf("GIT_CONFIG_VALUE_%d=Authorization: Basic %s", n, auth),
+	}
+}
+
+// networkCommands are the git commands that contact the remote, and
+// so are given the credentials. Other commands are purely local, and
+// there's no need to get credentials for them (which may mean an API
+// call).
+var networkCommands = map[string]bool{
+	"clone":     true,
+	"fetch":     true,
+	"ls-remote": true,
+	"pull":      true,
+	"push":      true,
+}
+
+// isNetworkCommand says whether the git command given by the
+// arguments is one of networkCommands, looking past any options
+// given to git itself (e.g., `-c key=value`).
+func isNetworkCommand(args []string) bool {
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "-c" || arg == "-C":
+			i++ // skip the option's value
+		case strings.HasPrefix(arg, "-"):
+		default:
+			return networkCommands[arg]
+		}
+	}
+	return false
+}
+
+// Passing the credentials in the environment needs GIT_CONFIG_COUNT,
+// which was introduced in git 2.31.
+const minCredentialsGitMajor, minCredentialsGitMinor = 2, 31
+
+// CheckCredentialsSupport checks that the git executable is recent
+// enough to be given credentials.
+func CheckCredentialsSupport(ctx context.Context) error {
+	return checkGitVersion(ctx, minCredentialsGitMajor, minCredentialsGitMinor, "to authenticate to HTTPS remotes")
+}
+
+// checkGitVersion checks that the git executable is at least the
+// version given, which is needed for the purpose given.
+func checkGitVersion(ctx context.Context, minMajor, minMinor int, purpose string) error {
+	out, err := exec.CommandContext(ctx, "git", "version").Output()
+	if err != nil {
+		return errors.Wrap(err, "getting git version")
+	}
+	major, minor, err := parseGitVersion(string(out))
+	if err != nil {
+		return err
+	}
+	if major < minMajor || (major == minMajor && minor < minMinor) {
+		return fmt.Errorf("git %d.%d or later is needed %s, found %d.%d", minMajor, minMinor, purpose, major, minor)
+	}
+	return nil
+}
+
+// parseGitVersion gets the major and minor version from the output of
+// `git version`, e.g., "git version 2.39.2 (Apple Git-143)".
+func parseGitVersion(out string) (int, int, error) {
+	fields := strings.Fields(out)
+	if len(fields) < 3 || fields[0] != "git" || fields[1] != "version" {
+		return 0, 0, fmt.Errorf("unexpected output from git version: %q", out)
+	}
+	parts := strings.SplitN(fields[2], ".", 3)
+	if len(parts) < 2 {
+		return 0, 0, fmt.Errorf("unexpected git version %q", fields[2])
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("unexpected git version %q", fields[2])
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, fmt.Errorf("unexpected git version %q", fields[2])
+	}
+	return major, minor, nil
+}
@@ -0,0 +1,168 @@
+package git
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fluxcd/flux/pkg/cluster/kubernetes/testfiles"
+)
+
+func TestTokenFile(t *testing.T) {
+	dir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+	path := filepath.Join(dir, "token")
+	ctx := context.Background()
+
+	creds := NewTokenFile("flux", path)
+	_, _, err := creds.Get(ctx)
+	assert.Error(t, err)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("first\n"), 0600))
+	username, password, err := creds.Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "flux", username)
+	assert.Equal(t, "first", password)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("rotated-token\n"), 0600))
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, later, later))
+	_, password, err = creds.Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "rotated-token", password)
+}
+
+func TestGitHubApp(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/app/installations/42/access_tokens", r.URL.Path)
+
+		// The JWT must be signed with the app's key, and issued by the app
+		jwt := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		parts := strings.Split(jwt, ".")
+		require.Len(t, parts, 3)
+		sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+		require.NoError(t, err)
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		assert.NoError(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], sig))
+		claims, err := base64.RawURLEncoding.DecodeString(parts[1])
+		require.NoError(t, err)
+		var c struct{ Iss int64 }
+		require.NoError(t, json.Unmarshal(claims, &c))
+		assert.Equal(t, int64(7), c.Iss)
+
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"token":"token-%d","expires_at":%q}`, requests, now.Add(time.Hour).Format(time.RFC3339))
+	}))
+	defer server.Close()
+
+	app, err := NewGitHubApp(7, 42, keyPEM, server.URL)
+	require.NoError(t, err)
+	app.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	username, password, err := app.Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "x-access-token", username)
+	assert.Equal(t, "token-1", password)
+
+	// cached until close to expiry
+	now = now.Add(50 * time.Minute)
+	_, password, err = app.Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "token-1", password)
+
+	now = now.Add(6 * time.Minute)
+	_, password, err = app.Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "token-2", password)
+}
+
+func TestGoGitBackend_HTTPSCredentials(t *testing.T) {
+	dir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+	path := filepath.Join(dir, "token")
+	require.NoError(t, ioutil.WriteFile(path, []byte("secret"), 0600))
+
+	backend := NewGoGitBackend()
+	auth, err := backend.auth(context.Background(), "https://example.com/repo.git", NewTokenFile("flux", path))
+	require.NoError(t, err)
+	assert.Equal(t, &githttp.BasicAuth{Username: "flux", Password: "secret"}, auth)
+
+	auth, err = backend.auth(context.Background(), "https://example.com/repo.git", nil)
+	require.NoError(t, err)
+	assert.Nil(t, auth)
+}
+
+func TestIsNetworkCommand(t *testing.T) {
+	for args, network := range map[string]bool{
+		"fetch --tags origin":                     true,
+		"-c gpg.ssh.allowedSignersFile=x push -f": true,
+		"ls-remote origin":                        true,
+		"-c user.signingkey=x commit -m msg":      false,
+		"log --pretty=format:%H":                  false,
+		"-C /tmp/repo notes --ref=flux show":      false,
+	} {
+		if got := isNetworkCommand(strings.Fields(args)); got != network {
+			t.Errorf("%q: expected %v, got %v", args, network, got)
+		}
+	}
+}
+
+func TestCredentialsEnv(t *testing.T) {
+	auth := base64.StdEncoding.EncodeToString([]byte("flux:secret"))
+	env := credentialsEnv([]string{"HOME=/home/flux"}, "https://example.com/repo.git", "flux", "secret")
+	assert.Equal(t, []string{
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=http.https://example.com/repo.git.extraHeader",
+		"GIT_CONFIG_VALUE_0=Authorization: Basic " + auth,
+	}, env)
+
+	// config already in the environment is kept
+	env = credentialsEnv([]string{"GIT_CONFIG_COUNT=2", "GIT_CONFIG_KEY_0=a.b", "GIT_CONFIG_VALUE_0=c", "GIT_CONFIG_KEY_1=d.e", "GIT_CONFIG_VALUE_1=f"}, "https://example.com/repo.git", "flux", "secret")
+	assert.Equal(t, []string{
+		"GIT_CONFIG_COUNT=3",
+		"GIT_CONFIG_KEY_2=http.https://example.com/repo.git.extraHeader",
+		"GIT_CONFIG_VALUE_2=Authorization: Basic " + auth,
+	}, env)
+}
+
+func TestParseGitVersion(t *testing.T) {
+	major, minor, err := parseGitVersion("git version 2.39.2 (Apple Git-143)\n")
+	if err != nil || major != 2 || minor != 39 {
+		t.Errorf("unexpected version %d.%d, %v", major, minor, err)
+	}
+	major, minor, err = parseGitVersion("git version 2.31.1.windows.1")
+	if err != nil || major != 2 || minor != 31 {
+		t.Errorf("unexpected version %d.%d, %v", major, minor, err)
+	}
+	if _, _, err = parseGitVersion("hub version 2.14.2"); err == nil {
+		t.Error("expected an error for unexpected output")
+	}
+}
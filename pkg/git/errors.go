@@ -120,3 +120,61 @@ check the box to allow write access unless you're using the
 `,
 	}
 }
+
+// These are the kinds of failure that callers may want to treat
+// specially. Backends wrap or mark their errors so they can be
+// distinguished with `errors.Is`, rather than by matching on the
+// output of git.
+var (
+	ErrHostUnreachable = errors.New("git host could not be reached")
+	ErrRefNotFound     = errors.New("git ref not found")
+	ErrNoteNotFound    = errors.New("no note found for object")
+	ErrNonFastForward  = errors.New("push rejected because it is not a fast-forward")
+	ErrUnsupported     = errors.New("operation not supported by the git backend")
+)
+
+// gitError is an error reported by git, marked with the kind of
+// failure it represents.
+type gitError struct {
+	kind error
+	err  error
+}
+
+func (e *gitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *gitError) Unwrap() error {
+	return e.err
+}
+
+func (e *gitError) Is(target error) bool {
+	return target == e.kind
+}
+
+// classifyOutput returns the kind of error the output of a failed git
+// command indicates, or nil if it's not one we know about.
+func classifyOutput(output string) error {
+	out := strings.ToLower(output)
+	switch {
+	case strings.Contains(out, "could not resolve hostname"),
+		strings.Contains(out, "could not resolve host:"):
+		return ErrHostUnreachable
+	// In git <=2.20 the error started with an uppercase, in 2.21 this
+	// was changed to be consistent with all other die() and error()
+	// messages, hence comparing lowercase to support both versions.
+	// Ref: https://github.com/git/git/commit/0b9c3afdbfb62936337efc52b4007a446939b96b
+	case strings.Contains(out, "couldn't find remote ref"),
+		strings.Contains(out, "bad revision"),
+		strings.Contains(out, "fatal: bad object"),
+		strings.Contains(out, "unknown revision or path not in the working tree"),
+		strings.Contains(out, "error: tag '") && strings.Contains(out, "not found"):
+		return ErrRefNotFound
+	case strings.Contains(out, "no note found for object"):
+		return ErrNoteNotFound
+	case strings.Contains(out, "non-fast-forward"),
+		strings.Contains(out, "(fetch first)"):
+		return ErrNonFastForward
+	}
+	return nil
+}
@@ -7,7 +7,8 @@ import (
 )
 
 type Export struct {
-	dir string
+	dir     string
+	backend Backend
 }
 
 func (e *Export) Dir() string {
@@ -27,20 +28,20 @@ func (r *Repo) Export(ctx context.Context, ref string) (*Export, error) {
 	if err != nil {
 		return nil, err
 	}
-	if err = checkout(ctx, dir, ref); err != nil {
+	if err = r.backend.Checkout(ctx, dir, ref); err != nil {
 		return nil, err
 	}
-	return &Export{dir}, nil
+	return &Export{dir: dir, backend: r.backend}, nil
 }
 
 // SecretUnseal unseals git secrets in the clone.
 func (e *Export) SecretUnseal(ctx context.Context) error {
-	return secretUnseal(ctx, e.Dir())
+	return e.backend.SecretUnseal(ctx, e.Dir())
 }
 
 // ChangedFiles does a git diff listing changed files
 func (e *Export) ChangedFiles(ctx context.Context, sinceRef string, paths []string) ([]string, error) {
-	list, err := changed(ctx, e.Dir(), sinceRef, paths)
+	list, err := e.backend.Changed(ctx, e.Dir(), sinceRef, paths)
 	if err == nil {
 		for i, file := range list {
 			list[i] = filepath.Join(e.Dir(), file)
@@ -0,0 +1,1253 @@
+package git
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	pgperrors "github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	gogit "github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/server"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+// GoGitBackend is a Backend that uses go-git, so it does not need
+// the git executable. Repos given as local paths (or file:// URLs)
+// are served in-process; these must be bare repos, as the mirror kept
+// by Repo is.
+//
+// It does not support git-secret, signing with Sigstore, or shallow
+// and sparse clones, and uses its own keyring, rather than GPG's, for
+// signing and verifying.
+type GoGitBackend struct {
+	// SSHKeyPath returns the path of the private key to use for
+	// SSH remotes. It's consulted for each operation, since the key
+	// may be regenerated.
+	SSHKeyPath func() string
+	// KnownHosts are the files used to check the keys of SSH hosts;
+	// if empty, the defaults for ssh are used.
+	KnownHosts []string
+	// KeyRing holds the OpenPGP keys for verifying signatures, and
+	// the private keys for signing commits and tags.
+	KeyRing openpgp.EntityList
+}
+
+// NewGoGitBackend constructs a GoGitBackend. Since go-git's own
+// support for local repos runs git, this replaces it with a transport
+// that serves them in-process.
+func NewGoGitBackend() *GoGitBackend {
+	client.InstallProtocol("file", server.DefaultServer)
+	return &GoGitBackend{}
+}
+
+// ReadKeyRing reads the OpenPGP keys in the files at the paths given,
+// or in the files immediately within them if they are directories.
+func ReadKeyRing(paths []string) (openpgp.EntityList, error) {
+	var keyring openpgp.EntityList
+	for _, path := range paths {
+		files := []string{path}
+		if info, err := os.Stat(path); err != nil {
+			return nil, err
+		} else if info.IsDir() {
+			entries, err := ioutil.ReadDir(path)
+			if err != nil {
+				return nil, err
+			}
+			files = files[:0]
+			for _, e := range entries {
+				if e.Mode().IsRegular() {
+					files = append(files, filepath.Join(path, e.Name()))
+				}
+			}
+		}
+		for _, f := range files {
+			b, err := ioutil.ReadFile(f)
+			if err != nil {
+				return nil, err
+			}
+			entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(b))
+			if err != nil {
+				if entities, err = openpgp.ReadKeyRing(bytes.NewReader(b)); err != nil {
+					return nil, errors.Wrapf(err, "reading keys from %s", f)
+				}
+			}
+			keyring = append(keyring, entities...)
+		}
+	}
+	return keyring, nil
+}
+
+// classifyGoGitError marks the errors from go-git that correspond to
+// the kinds callers look for.
+func classifyGoGitError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var kind error
+	var dnsErr *net.DNSError
+	switch {
+	case errors.Is(err, plumbing.ErrReferenceNotFound),
+		errors.Is(err, plumbing.ErrObjectNotFound),
+		errors.Is(err, gogit.NoMatchingRefSpecError{}):
+		kind = ErrRefNotFound
+	case errors.Is(err, gogit.ErrNonFastForwardUpdate),
+		errors.Is(err, gogit.ErrForceNeeded),
+		strings.Contains(err.Error(), "non-fast-forward"):
+		kind = ErrNonFastForward
+	case errors.As(err, &dnsErr):
+		kind = ErrHostUnreachable
+	default:
+		return err
+	}
+	return &gitError{kind: kind, err: err}
+}
+
+func (g *GoGitBackend) auth(ctx context.Context, repoURL string, creds Credentials) (transport.AuthMethod, error) {
+	ep, err := transport.NewEndpoint(repoURL)
+	if err != nil {
+		return nil, err
+	}
+	if creds != nil && (ep.Protocol == "http" || ep.Protocol == "https") {
+		username, password, err := creds.Get(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &githttp.BasicAuth{Username: username, Password: password}, nil
+	}
+	if ep.Protocol != "ssh" || g.SSHKeyPath == nil {
+		return nil, nil
+	}
+	keyPath := g.SSHKeyPath()
+	if keyPath == "" {
+		return nil, nil
+	}
+	user := ep.User
+	if user == "" {
+		user = "git"
+	}
+	keys, err := gitssh.NewPublicKeysFromFile(user, keyPath, "")
+	if err != nil {
+		return nil, errors.Wrap(err, "loading SSH key")
+	}
+	callback, err := gitssh.NewKnownHostsCallback(g.KnownHosts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "loading SSH known hosts")
+	}
+	keys.HostKeyCallback = callback
+	return keys, nil
+}
+
+// remote returns a remote for upstream, which may be the name of a
+// remote already configured in the repo, or a URL.
+func (g *GoGitBackend) remote(ctx context.Context, repo *gogit.Repository, upstream string, creds Credentials) (*gogit.Remote, transport.AuthMethod, error) {
+	r, err := repo.Remote(upstream)
+	if err == nil {
+		auth, err := g.auth(ctx, r.Config().URLs[0], creds)
+		return r, auth, err
+	}
+	if err != gogit.ErrRemoteNotFound {
+		return nil, nil, err
+	}
+	auth, err := g.auth(ctx, upstream, creds)
+	return gogit.NewRemote(repo.Storer, &gitconfig.RemoteConfig{
+		Name: "anonymous",
+		URLs: []string{upstream},
+	}), auth, err
+}
+
+func (g *GoGitBackend) Mirror(ctx context.Context, dir, repoURL string, creds Credentials, depth int) (string, error) {
+	if depth > 0 {
+		return "", errors.Wrap(ErrUnsupported, "shallow clone")
+	}
+	repo, err := gogit.PlainInit(dir, true)
+	if err != nil {
+		return "", errors.Wrap(err, "initialising mirror")
+	}
+	r, err := repo.CreateRemote(&gitconfig.RemoteConfig{
+		Name:  "origin",
+		URLs:  []string{repoURL},
+		Fetch: []gitconfig.RefSpec{"+refs/*:refs/*"},
+	})
+	if err != nil {
+		return "", err
+	}
+	auth, err := g.auth(ctx, repoURL, creds)
+	if err != nil {
+		return "", err
+	}
+	if err := r.FetchContext(ctx, &gogit.FetchOptions{RemoteName: "origin", Auth: auth}); err != nil &&
+		err != gogit.NoErrAlreadyUpToDate {
+		return "", errors.Wrap(classifyGoGitError(err), "mirroring "+repoURL)
+	}
+	// Point HEAD at the upstream's default branch, so clones without
+	// a branch get the same one as they would from upstream.
+	refs, err := r.ListContext(ctx, &gogit.ListOptions{Auth: auth})
+	if err != nil {
+		return "", classifyGoGitError(err)
+	}
+	for _, ref := range refs {
+		if ref.Name() == plumbing.HEAD && ref.Type() == plumbing.SymbolicReference {
+			if err := repo.Storer.SetReference(ref); err != nil {
+				return "", err
+			}
+		}
+	}
+	return dir, nil
+}
+
+func (g *GoGitBackend) Clone(ctx context.Context, dir, repoURL, branch string, sparsePaths []string) (string, error) {
+	if len(sparsePaths) > 0 {
+		return "", errors.Wrap(ErrUnsupported, "sparse checkout")
+	}
+	auth, err := g.auth(ctx, repoURL, nil)
+	if err != nil {
+		return "", err
+	}
+	opts := &gogit.CloneOptions{URL: repoURL, Auth: auth}
+	if branch != "" {
+		opts.ReferenceName = plumbing.NewBranchReferenceName(branch)
+	}
+	if _, err := gogit.PlainCloneContext(ctx, dir, false, opts); err != nil {
+		return "", errors.Wrap(classifyGoGitError(err), "git clone")
+	}
+	return dir, nil
+}
+
+func (g *GoGitBackend) Deepen(ctx context.Context, dir, upstream string, creds Credentials, depth int) error {
+	return errors.Wrap(ErrUnsupported, "deepening a shallow clone")
+}
+
+func (g *GoGitBackend) Config(ctx context.Context, dir, user, email string) error {
+	repo, err := gogit.PlainOpen(dir)
+	if err != nil {
+		return err
+	}
+	conf, err := repo.Config()
+	if err != nil {
+		return err
+	}
+	conf.User.Name = user
+	conf.User.Email = email
+	return errors.Wrap(repo.SetConfig(conf), "setting git config")
+}
+
+func (g *GoGitBackend) Fetch(ctx context.Context, dir, upstream string, creds Credentials, refspec ...string) error {
+	repo, err := gogit.PlainOpen(dir)
+	if err != nil {
+		return err
+	}
+	r, auth, err := g.remote(ctx, repo, upstream, creds)
+	if err != nil {
+		return err
+	}
+	opts := &gogit.FetchOptions{RemoteName: r.Config().Name, Auth: auth, Tags: gogit.AllTags}
+	for _, spec := range refspec {
+		opts.RefSpecs = append(opts.RefSpecs, gitconfig.RefSpec(strings.Trim(spec, "'")))
+	}
+	err = classifyGoGitError(r.FetchContext(ctx, opts))
+	if err != nil && err != gogit.NoErrAlreadyUpToDate && !errors.Is(err, ErrRefNotFound) {
+		return errors.Wrap(err, fmt.Sprintf("git fetch --tags %s %s", upstream, refspec))
+	}
+	return nil
+}
+
+func (g *GoGitBackend) push(ctx context.Context, repo *gogit.Repository, upstream string, creds Credentials, refspecs ...gitconfig.RefSpec) error {
+	r, auth, err := g.remote(ctx, repo, upstream, creds)
+	if err != nil {
+		return err
+	}
+	err = r.PushContext(ctx, &gogit.PushOptions{RemoteName: r.Config().Name, RefSpecs: refspecs, Auth: auth})
+	if err == gogit.NoErrAlreadyUpToDate {
+		return nil
+	}
+	return classifyGoGitError(err)
+}
+
+func (g *GoGitBackend) CheckPush(ctx context.Context, dir, upstream string, creds Credentials, branch string) error {
+	repo, err := gogit.PlainOpen(dir)
+	if err != nil {
+		return err
+	}
+	// we need to pseudo randomize the tag we use for the write check
+	// as multiple Flux instances can perform the check simultaneously
+	// for different branches, causing commit reference conflicts
+	b := make([]byte, 5)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	tag := fmt.Sprintf("%s-%x", CheckPushTagPrefix, b)
+	rev := "HEAD"
+	if branch != "" {
+		rev = branch
+	}
+	hash, err := repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return errors.Wrap(classifyGoGitError(err), "tag for write check")
+	}
+	if _, err := repo.CreateTag(tag, *hash, nil); err != nil {
+		return errors.Wrap(err, "tag for write check")
+	}
+	tagRef := plumbing.NewTagReferenceName(tag)
+	if err := g.push(ctx, repo, upstream, creds, gitconfig.RefSpec(tagRef+":"+tagRef)); err != nil {
+		return errors.Wrap(err, "attempt to push tag")
+	}
+	return g.push(ctx, repo, upstream, creds, gitconfig.RefSpec(":"+tagRef))
+}
+
+func (g *GoGitBackend) DeleteTag(ctx context.Context, dir, tag, upstream string, creds Credentials) error {
+	repo, err := gogit.PlainOpen(dir)
+	if err != nil {
+		return err
+	}
+	return g.push(ctx, repo, upstream, creds, gitconfig.RefSpec(":"+plumbing.NewTagReferenceName(tag)))
+}
+
+func (g *GoGitBackend) Checkout(ctx context.Context, dir, ref string) error {
+	repo, err := gogit.PlainOpen(dir)
+	if err != nil {
+		return err
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	// As with `git checkout`, a branch name means switching to the
+	// branch; anything else means detaching HEAD at the commit.
+	branch := plumbing.NewBranchReferenceName(ref)
+	if _, err := repo.Reference(branch, false); err == nil {
+		return w.Checkout(&gogit.CheckoutOptions{Branch: branch})
+	}
+	hash, err := repo.ResolveRevision(plumbing.Revision(ref))
+	if err != nil {
+		return errors.Wrap(classifyGoGitError(err), "checking out "+ref)
+	}
+	return w.Checkout(&gogit.CheckoutOptions{Hash: *hash})
+}
+
+func (g *GoGitBackend) Add(ctx context.Context, dir, path string) error {
+	repo, err := gogit.PlainOpen(dir)
+	if err != nil {
+		return err
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	if filepath.Clean(path) == "." {
+		return w.AddWithOptions(&gogit.AddOptions{All: true})
+	}
+	_, err = w.Add(path)
+	return err
+}
+
+func (g *GoGitBackend) HasChanges(ctx context.Context, dir string, paths []string, all bool) bool {
+	repo, err := gogit.PlainOpen(dir)
+	if err != nil {
+		return false
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		return false
+	}
+	status, err := w.Status()
+	if err != nil {
+		return false
+	}
+	for file, s := range status {
+		if all {
+			if s.Staging != gogit.Unmodified && s.Staging != gogit.Untracked ||
+				s.Worktree != gogit.Unmodified && s.Worktree != gogit.Untracked {
+				return true
+			}
+			continue
+		}
+		if s.Worktree != gogit.Unmodified && s.Worktree != gogit.Untracked && inPaths(file, paths) {
+			return true
+		}
+	}
+	return false
+}
+
+var authorRegexp = regexp.MustCompile(`^(.*?)\s*<([^>]*)>$`)
+
+// signatures returns the author and committer for a commit (or
+// tagger for a tag), taking them from the repo config unless an
+// author is given.
+func signatures(repo *gogit.Repository, author string) (*object.Signature, *object.Signature, error) {
+	conf, err := repo.ConfigScoped(gitconfig.SystemScope)
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	committer := &object.Signature{Name: conf.User.Name, Email: conf.User.Email, When: now}
+	if author == "" {
+		return committer, committer, nil
+	}
+	if m := authorRegexp.FindStringSubmatch(author); m != nil {
+		return &object.Signature{Name: m[1], Email: m[2], When: now}, committer, nil
+	}
+	return &object.Signature{Name: author, Email: conf.User.Email, When: now}, committer, nil
+}
+
+// signingKey finds the private key identified by key, which may be a
+// key ID, a fingerprint, or (part of) a user ID.
+func (g *GoGitBackend) signingKey(key string) (*openpgp.Entity, error) {
+	if key == "" {
+		return nil, nil
+	}
+	want := strings.ToUpper(strings.TrimPrefix(key, "0x"))
+	for _, e := range g.KeyRing {
+		if e.PrivateKey == nil {
+			continue
+		}
+		if strings.HasSuffix(fmt.Sprintf("%X", e.PrimaryKey.Fingerprint), want) {
+			return e, nil
+		}
+		for name := range e.Identities {
+			if strings.Contains(name, key) {
+				return e, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no private key for %q in the keyring", key)
+}
+
+func (g *GoGitBackend) Commit(ctx context.Context, dir string, action CommitAction) error {
+	repo, err := gogit.PlainOpen(dir)
+	if err != nil {
+		return err
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	author, committer, err := signatures(repo, action.Author)
+	if err != nil {
+		return err
+	}
+	if action.SigningFormat == SigningFormatSigstore {
+		return errors.Wrap(ErrUnsupported, "signing with Sigstore")
+	}
+	var key *openpgp.Entity
+	if action.SigningFormat != SigningFormatSSH {
+		if key, err = g.signingKey(action.SigningKey); err != nil {
+			return errors.Wrap(err, "git commit")
+		}
+	}
+	hash, err := w.Commit(action.Message, &gogit.CommitOptions{
+		All:       true,
+		Author:    author,
+		Committer: committer,
+		SignKey:   key,
+	})
+	if err != nil {
+		return errors.Wrap(err, "git commit")
+	}
+	if action.SigningFormat == SigningFormatSSH && action.SigningKey != "" {
+		return errors.Wrap(sshSignCommit(repo, hash, action.SigningKey), "git commit")
+	}
+	return nil
+}
+
+// sshSignCommit replaces the commit given, which must be HEAD, with
+// the same commit signed with the SSH key at the path given. go-git
+// can only sign with OpenPGP keys itself.
+func sshSignCommit(repo *gogit.Repository, hash plumbing.Hash, keyPath string) error {
+	signer, err := readSSHSigner(keyPath)
+	if err != nil {
+		return err
+	}
+	c, err := repo.CommitObject(hash)
+	if err != nil {
+		return err
+	}
+	signed, err := sshSignObject(repo, c.EncodeWithoutSignature, signer, func(sig string) { c.PGPSignature = sig }, c.Encode)
+	if err != nil {
+		return err
+	}
+	head, err := repo.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return err
+	}
+	name := plumbing.HEAD
+	if head.Type() == plumbing.SymbolicReference {
+		name = head.Target()
+	}
+	return repo.Storer.SetReference(plumbing.NewHashReference(name, signed))
+}
+
+// sshSignObject signs the encoding of an object without its
+// signature, then stores the object with the signature.
+func sshSignObject(repo *gogit.Repository, encodeUnsigned func(plumbing.EncodedObject) error, signer ssh.Signer,
+	setSignature func(string), encode func(plumbing.EncodedObject) error) (plumbing.Hash, error) {
+	unsigned := &plumbing.MemoryObject{}
+	if err := encodeUnsigned(unsigned); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	r, err := unsigned.Reader()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	defer r.Close()
+	message, err := ioutil.ReadAll(r)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	sig, err := signSSH(signer, message)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	setSignature(sig)
+	encoded := repo.Storer.NewEncodedObject()
+	if err := encode(encoded); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return repo.Storer.SetEncodedObject(encoded)
+}
+
+// fullRefName gives the full name of a ref given as it would be to
+// `git push`; i.e., either a full ref name, or a branch name.
+func fullRefName(ref string) plumbing.ReferenceName {
+	if strings.HasPrefix(ref, "refs/") {
+		return plumbing.ReferenceName(ref)
+	}
+	return plumbing.NewBranchReferenceName(ref)
+}
+
+func (g *GoGitBackend) Push(ctx context.Context, dir, upstream string, creds Credentials, refs []string) error {
+	repo, err := gogit.PlainOpen(dir)
+	if err != nil {
+		return err
+	}
+	var specs []gitconfig.RefSpec
+	for _, ref := range refs {
+		name := fullRefName(ref)
+		specs = append(specs, gitconfig.RefSpec(name+":"+name))
+	}
+	if err := g.push(ctx, repo, upstream, creds, specs...); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("git push %s %s", upstream, refs))
+	}
+	return nil
+}
+
+func (g *GoGitBackend) RefExists(ctx context.Context, dir, ref string) (bool, error) {
+	repo, err := gogit.PlainOpen(dir)
+	if err != nil {
+		return false, err
+	}
+	if _, err := repo.ResolveRevision(plumbing.Revision(ref)); err != nil {
+		if err = classifyGoGitError(err); errors.Is(err, ErrRefNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (g *GoGitBackend) IsAncestor(ctx context.Context, dir, ancestor, ref string) (bool, error) {
+	repo, err := gogit.PlainOpen(dir)
+	if err != nil {
+		return false, err
+	}
+	var commits []*object.Commit
+	for _, rev := range []string{ancestor, ref} {
+		hash, err := repo.ResolveRevision(plumbing.Revision(rev))
+		if err != nil {
+			return false, errors.Wrap(classifyGoGitError(err), "resolving "+rev)
+		}
+		c, err := repo.CommitObject(*hash)
+		if err != nil {
+			return false, err
+		}
+		commits = append(commits, c)
+	}
+	return commits[0].IsAncestor(commits[1])
+}
+
+func (g *GoGitBackend) RefRevision(ctx context.Context, dir, ref string) (string, error) {
+	repo, err := gogit.PlainOpen(dir)
+	if err != nil {
+		return "", err
+	}
+	hash, err := repo.ResolveRevision(plumbing.Revision(ref))
+	if err != nil {
+		return "", errors.Wrap(classifyGoGitError(err), "resolving "+ref)
+	}
+	return hash.String(), nil
+}
+
+// cleanPaths makes paths relative to the root of the repo, as git
+// would given them as pathspecs.
+func cleanPaths(paths []string) ([]string, error) {
+	var cleaned []string
+	for _, p := range paths {
+		if filepath.IsAbs(p) {
+			return nil, fmt.Errorf("%s: is outside repository", p)
+		}
+		p = filepath.ToSlash(filepath.Clean(p))
+		if p == "." {
+			return nil, nil
+		}
+		cleaned = append(cleaned, p)
+	}
+	return cleaned, nil
+}
+
+// inPaths says whether file is at or under any of the (cleaned)
+// paths; an empty list of paths includes everything.
+func inPaths(file string, paths []string) bool {
+	if len(paths) == 0 {
+		return true
+	}
+	for _, p := range paths {
+		if p == "." || file == p || strings.HasPrefix(file, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// pathHashes gives the hash of each path in the commit's tree (or
+// the zero hash, for those not present), so that commits can be
+// compared for changes to the paths.
+func pathHashes(c *object.Commit, paths []string) ([]plumbing.Hash, error) {
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return []plumbing.Hash{tree.Hash}, nil
+	}
+	hashes := make([]plumbing.Hash, len(paths))
+	for i, p := range paths {
+		entry, err := tree.FindEntry(p)
+		switch {
+		case err == object.ErrEntryNotFound || err == object.ErrDirectoryNotFound:
+			continue
+		case err != nil:
+			return nil, err
+		}
+		hashes[i] = entry.Hash
+	}
+	return hashes, nil
+}
+
+func sameHashes(a, b []plumbing.Hash) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func noHashes(hashes []plumbing.Hash) bool {
+	for _, h := range hashes {
+		if !h.IsZero() {
+			return false
+		}
+	}
+	return true
+}
+
+// commitQueue orders commits most recent first, as `git log` does.
+type commitQueue []*object.Commit
+
+func (q commitQueue) Len() int            { return len(q) }
+func (q commitQueue) Less(i, j int) bool  { return q[i].Committer.When.After(q[j].Committer.When) }
+func (q commitQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *commitQueue) Push(x interface{}) { *q = append(*q, x.(*object.Commit)) }
+func (q *commitQueue) Pop() interface{} {
+	old := *q
+	c := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return c
+}
+
+func (g *GoGitBackend) Log(ctx context.Context, dir, refspec string, paths []string, firstParent bool, allowedSigners string) ([]Commit, error) {
+	repo, err := gogit.PlainOpen(dir)
+	if err != nil {
+		return nil, err
+	}
+	paths, err = cleanPaths(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	// Everything reachable from the bottom of a range is excluded.
+	from, to := "", refspec
+	if i := strings.Index(refspec, ".."); i >= 0 {
+		from, to = refspec[:i], refspec[i+2:]
+	}
+	excluded := map[plumbing.Hash]bool{}
+	if from != "" {
+		hash, err := repo.ResolveRevision(plumbing.Revision(from))
+		if err != nil {
+			return nil, errors.Wrap(classifyGoGitError(err), "resolving "+from)
+		}
+		c, err := repo.CommitObject(*hash)
+		if err != nil {
+			return nil, err
+		}
+		err = object.NewCommitPreorderIter(c, nil, nil).ForEach(func(c *object.Commit) error {
+			excluded[c.Hash] = true
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	hash, err := repo.ResolveRevision(plumbing.Revision(to))
+	if err != nil {
+		return nil, errors.Wrap(classifyGoGitError(err), "resolving "+to)
+	}
+	tip, err := repo.CommitObject(*hash)
+	if err != nil {
+		return nil, err
+	}
+
+	hashesOf := map[plumbing.Hash][]plumbing.Hash{}
+	hashes := func(c *object.Commit) ([]plumbing.Hash, error) {
+		if h, ok := hashesOf[c.Hash]; ok {
+			return h, nil
+		}
+		h, err := pathHashes(c, paths)
+		hashesOf[c.Hash] = h
+		return h, err
+	}
+
+	// This follows git's default history simplification: a commit
+	// that's the same as one of its parents, for the paths given, is
+	// not shown, and only that parent is followed.
+	var commits []Commit
+	queue := &commitQueue{tip}
+	seen := map[plumbing.Hash]bool{tip.Hash: true}
+	for queue.Len() > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		c := heap.Pop(queue).(*object.Commit)
+		if excluded[c.Hash] {
+			continue
+		}
+		parents := c.ParentHashes
+		if firstParent && len(parents) > 1 {
+			parents = parents[:1]
+		}
+		show, follow := true, parents
+		if len(paths) > 0 {
+			mine, err := hashes(c)
+			if err != nil {
+				return nil, err
+			}
+			show = len(parents) > 0 || !noHashes(mine)
+			for _, p := range parents {
+				parent, err := repo.CommitObject(p)
+				if err != nil {
+					return nil, err
+				}
+				theirs, err := hashes(parent)
+				if err != nil {
+					return nil, err
+				}
+				if sameHashes(mine, theirs) {
+					show, follow = false, []plumbing.Hash{p}
+					break
+				}
+			}
+		}
+		if show {
+			commits = append(commits, Commit{
+				Signature: g.signature(ctx, c, allowedSigners),
+				Revision:  c.Hash.String(),
+				Author:    c.Author.Name,
+				Time:      time.Unix(c.Author.When.Unix(), 0).UTC(),
+				Message:   subject(c.Message),
+			})
+		}
+		for _, p := range follow {
+			if seen[p] {
+				continue
+			}
+			seen[p] = true
+			parent, err := repo.CommitObject(p)
+			if err != nil {
+				return nil, err
+			}
+			heap.Push(queue, parent)
+		}
+	}
+	return commits, nil
+}
+
+// subject gives the first paragraph of a commit message as one line,
+// as with `git log --format=%s`.
+func subject(message string) string {
+	message = strings.TrimLeft(message, "\n")
+	if i := strings.Index(message, "\n\n"); i >= 0 {
+		message = message[:i]
+	}
+	return strings.Join(strings.Fields(strings.ReplaceAll(message, "\n", " ")), " ")
+}
+
+// checkSignature verifies an armored signature of the encoded object
+// given, made at the time given, and reports the result as `git log`
+// would with `%GK`, `%G?` and `%GS`. OpenPGP signatures are checked
+// against the keyring, and SSH signatures against the allowed
+// signers file given.
+func (g *GoGitBackend) checkSignature(ctx context.Context, signed plumbing.EncodedObject, signature string, when time.Time, allowedSigners string) Signature {
+	if signature == "" {
+		return Signature{Status: "N"}
+	}
+	r, err := signed.Reader()
+	if err != nil {
+		return Signature{Status: "E"}
+	}
+	defer r.Close()
+
+	if isSSHSignature(signature) {
+		message, err := ioutil.ReadAll(r)
+		if err != nil {
+			return Signature{KeyType: KeyTypeSSH, Status: "E"}
+		}
+		var signers []AllowedSigner
+		if allowedSigners != "" {
+			// if the file can't be read, no key is trusted
+			signers, _ = ReadAllowedSigners(allowedSigners)
+		}
+		return checkSSHSignature(signature, message, when, signers)
+	}
+
+	sig := Signature{Key: signatureKeyID(signature), KeyType: KeyTypeGPG}
+	signer, err := openpgp.CheckArmoredDetachedSignature(g.KeyRing, r, strings.NewReader(signature), nil)
+	switch {
+	case err == nil:
+		sig.Status = "G"
+		if id := signer.PrimaryIdentity(); id != nil {
+			sig.Principal = id.Name
+		}
+	case err == pgperrors.ErrUnknownIssuer:
+		sig.Status = "E"
+	default:
+		sig.Status = "B"
+	}
+	return sig
+}
+
+func signatureKeyID(armored string) string {
+	block, err := armor.Decode(strings.NewReader(armored))
+	if err != nil {
+		return ""
+	}
+	p, err := packet.Read(block.Body)
+	if err != nil {
+		return ""
+	}
+	if sig, ok := p.(*packet.Signature); ok && sig.IssuerKeyId != nil {
+		return fmt.Sprintf("%016X", *sig.IssuerKeyId)
+	}
+	return ""
+}
+
+func (g *GoGitBackend) signature(ctx context.Context, c *object.Commit, allowedSigners string) Signature {
+	encoded := &plumbing.MemoryObject{}
+	if err := c.EncodeWithoutSignature(encoded); err != nil {
+		return Signature{Status: "E"}
+	}
+	return g.checkSignature(ctx, encoded, c.PGPSignature, c.Committer.When, allowedSigners)
+}
+
+func (g *GoGitBackend) Changed(ctx context.Context, dir, ref string, paths []string) ([]string, error) {
+	repo, err := gogit.PlainOpen(dir)
+	if err != nil {
+		return nil, err
+	}
+	paths, err = cleanPaths(paths)
+	if err != nil {
+		return nil, err
+	}
+	files := map[string]plumbing.Hash{}
+	for _, rev := range []string{ref, "HEAD"} {
+		hash, err := repo.ResolveRevision(plumbing.Revision(rev))
+		if err != nil {
+			return nil, errors.Wrap(classifyGoGitError(err), "resolving "+rev)
+		}
+		c, err := repo.CommitObject(*hash)
+		if err != nil {
+			return nil, err
+		}
+		tree, err := c.Tree()
+		if err != nil {
+			return nil, err
+		}
+		if rev == ref {
+			err = tree.Files().ForEach(func(f *object.File) error {
+				files[f.Name] = f.Hash
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		// Files in HEAD that are new or different since ref, then
+		// anything changed in the working directory since HEAD.
+		changed := map[string]bool{}
+		err = tree.Files().ForEach(func(f *object.File) error {
+			if was, ok := files[f.Name]; (!ok || was != f.Hash) && f.Mode != filemode.Submodule {
+				changed[f.Name] = true
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		w, err := repo.Worktree()
+		if err != nil {
+			return nil, err
+		}
+		status, err := w.Status()
+		if err != nil {
+			return nil, err
+		}
+		for file, s := range status {
+			switch s.Worktree {
+			case gogit.Deleted:
+				delete(changed, file)
+			case gogit.Modified, gogit.Added, gogit.Renamed, gogit.Copied:
+				changed[file] = true
+			}
+			switch s.Staging {
+			case gogit.Added, gogit.Modified, gogit.Renamed, gogit.Copied:
+				changed[file] = true
+			}
+		}
+		var list []string
+		for file := range changed {
+			if inPaths(file, paths) {
+				list = append(list, file)
+			}
+		}
+		sort.Strings(list)
+		return list, nil
+	}
+	return nil, nil
+}
+
+// NotesRef expands the ref given as `git notes --ref` does.
+func (g *GoGitBackend) NotesRef(ctx context.Context, dir, ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, "refs/"):
+		return ref, nil
+	case strings.HasPrefix(ref, "notes/"):
+		return "refs/" + ref, nil
+	}
+	return "refs/notes/" + ref, nil
+}
+
+// notes reads the notes under notesRef, returning the blob for each
+// annotated object, and the commit at the tip of the ref (or nil if
+// there are no notes).
+func (g *GoGitBackend) notes(repo *gogit.Repository, notesRef string) (map[string]plumbing.Hash, *object.Commit, error) {
+	notes := map[string]plumbing.Hash{}
+	ref, err := repo.Reference(plumbing.ReferenceName(notesRef), true)
+	if err == plumbing.ErrReferenceNotFound {
+		return notes, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err := repo.CommitObject(ref.Hash())
+	if err != nil {
+		return nil, nil, err
+	}
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, nil, err
+	}
+	// Notes are named for the object they annotate; git may fan them
+	// out into directories named for the leading digits.
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+	for {
+		name, entry, err := walker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		name = strings.Replace(name, "/", "", -1)
+		if entry.Mode.IsFile() && plumbing.IsHash(name) {
+			notes[name] = entry.Hash
+		}
+	}
+	return notes, c, nil
+}
+
+func storeObject(repo *gogit.Repository, o interface {
+	Encode(plumbing.EncodedObject) error
+}) (plumbing.Hash, error) {
+	encoded := repo.Storer.NewEncodedObject()
+	if err := o.Encode(encoded); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return repo.Storer.SetEncodedObject(encoded)
+}
+
+func (g *GoGitBackend) AddNote(ctx context.Context, dir, rev, notesRef string, note interface{}) error {
+	b, err := json.Marshal(note)
+	if err != nil {
+		return err
+	}
+	repo, err := gogit.PlainOpen(dir)
+	if err != nil {
+		return err
+	}
+	notesRef, _ = g.NotesRef(ctx, dir, notesRef)
+	hash, err := repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return classifyGoGitError(err)
+	}
+	notes, parent, err := g.notes(repo, notesRef)
+	if err != nil {
+		return err
+	}
+	if _, ok := notes[hash.String()]; ok {
+		return fmt.Errorf("Cannot add notes. Found existing notes for object %s.", hash)
+	}
+
+	blob := repo.Storer.NewEncodedObject()
+	blob.SetType(plumbing.BlobObject)
+	w, err := blob.Writer()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if notes[hash.String()], err = repo.Storer.SetEncodedObject(blob); err != nil {
+		return err
+	}
+
+	tree := &object.Tree{}
+	for name, h := range notes {
+		tree.Entries = append(tree.Entries, object.TreeEntry{Name: name, Mode: filemode.Regular, Hash: h})
+	}
+	sort.Slice(tree.Entries, func(i, j int) bool { return tree.Entries[i].Name < tree.Entries[j].Name })
+	treeHash, err := storeObject(repo, tree)
+	if err != nil {
+		return err
+	}
+
+	author, committer, err := signatures(repo, "")
+	if err != nil {
+		return err
+	}
+	commit := &object.Commit{
+		Author:    *author,
+		Committer: *committer,
+		Message:   "Notes added by 'git notes add'\n",
+		TreeHash:  treeHash,
+	}
+	if parent != nil {
+		commit.ParentHashes = []plumbing.Hash{parent.Hash}
+	}
+	commitHash, err := storeObject(repo, commit)
+	if err != nil {
+		return err
+	}
+	return repo.Storer.SetReference(plumbing.NewHashReference(plumbing.ReferenceName(notesRef), commitHash))
+}
+
+func (g *GoGitBackend) GetNote(ctx context.Context, dir, notesRef, rev string, note interface{}) (bool, error) {
+	repo, err := gogit.PlainOpen(dir)
+	if err != nil {
+		return false, err
+	}
+	notesRef, _ = g.NotesRef(ctx, dir, notesRef)
+	hash, err := repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return false, classifyGoGitError(err)
+	}
+	notes, _, err := g.notes(repo, notesRef)
+	if err != nil {
+		return false, err
+	}
+	blobHash, ok := notes[hash.String()]
+	if !ok {
+		return false, nil
+	}
+	blob, err := repo.BlobObject(blobHash)
+	if err != nil {
+		return false, err
+	}
+	r, err := blob.Reader()
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+	if err := json.NewDecoder(r).Decode(note); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (g *GoGitBackend) NoteRevList(ctx context.Context, dir, notesRef string) (map[string]struct{}, error) {
+	repo, err := gogit.PlainOpen(dir)
+	if err != nil {
+		return nil, err
+	}
+	notesRef, _ = g.NotesRef(ctx, dir, notesRef)
+	notes, _, err := g.notes(repo, notesRef)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]struct{}, len(notes))
+	for rev := range notes {
+		result[rev] = struct{}{}
+	}
+	return result, nil
+}
+
+func (g *GoGitBackend) MoveTagAndPush(ctx context.Context, dir, upstream string, creds Credentials, action TagAction) error {
+	repo, err := gogit.PlainOpen(dir)
+	if err != nil {
+		return err
+	}
+	hash, err := repo.ResolveRevision(plumbing.Revision(action.Revision))
+	if err != nil {
+		return errors.Wrap(classifyGoGitError(err), "moving tag "+action.Tag)
+	}
+	tagger, _, err := signatures(repo, "")
+	if err != nil {
+		return err
+	}
+	if action.SigningFormat == SigningFormatSigstore {
+		return errors.Wrap(ErrUnsupported, "signing with Sigstore")
+	}
+	var key *openpgp.Entity
+	if action.SigningFormat != SigningFormatSSH {
+		if key, err = g.signingKey(action.SigningKey); err != nil {
+			return errors.Wrap(err, "moving tag "+action.Tag)
+		}
+	}
+	if err := repo.DeleteTag(action.Tag); err != nil && err != gogit.ErrTagNotFound {
+		return errors.Wrap(err, "moving tag "+action.Tag)
+	}
+	ref, err := repo.CreateTag(action.Tag, *hash, &gogit.CreateTagOptions{
+		Tagger:  tagger,
+		Message: action.Message,
+		SignKey: key,
+	})
+	if err != nil {
+		return errors.Wrap(err, "moving tag "+action.Tag)
+	}
+	if action.SigningFormat == SigningFormatSSH && action.SigningKey != "" {
+		if err := sshSignTag(repo, ref, action.SigningKey); err != nil {
+			return errors.Wrap(err, "signing tag "+action.Tag)
+		}
+	}
+	tagRef := plumbing.NewTagReferenceName(action.Tag)
+	if err := g.push(ctx, repo, upstream, creds, gitconfig.RefSpec("+"+tagRef+":"+tagRef)); err != nil {
+		return errors.Wrap(err, "pushing tag to origin")
+	}
+	return nil
+}
+
+// sshSignTag replaces the annotated tag given with the same tag
+// signed with the SSH key at the path given.
+func sshSignTag(repo *gogit.Repository, ref *plumbing.Reference, keyPath string) error {
+	signer, err := readSSHSigner(keyPath)
+	if err != nil {
+		return err
+	}
+	t, err := repo.TagObject(ref.Hash())
+	if err != nil {
+		return err
+	}
+	signed, err := sshSignObject(repo, t.EncodeWithoutSignature, signer, func(sig string) { t.PGPSignature = sig }, t.Encode)
+	if err != nil {
+		return err
+	}
+	return repo.Storer.SetReference(plumbing.NewHashReference(ref.Name(), signed))
+}
+
+func (g *GoGitBackend) VerifyTag(ctx context.Context, dir, tag, allowedSigners string) (string, error) {
+	repo, err := gogit.PlainOpen(dir)
+	if err != nil {
+		return "", err
+	}
+	ref, err := repo.Tag(tag)
+	if err != nil {
+		return "", errors.Wrap(classifyGoGitError(err), "verifying tag "+tag)
+	}
+	t, err := repo.TagObject(ref.Hash())
+	if err != nil {
+		return "", errors.Wrap(err, "verifying tag "+tag)
+	}
+	// go-git only separates OpenPGP signatures from the message
+	if t.PGPSignature == "" {
+		if i := strings.Index(t.Message, sshSignatureArmorStart); i >= 0 {
+			t.Message, t.PGPSignature = t.Message[:i], t.Message[i:]
+		}
+	}
+	encoded := &plumbing.MemoryObject{}
+	if err := t.EncodeWithoutSignature(encoded); err != nil {
+		return "", err
+	}
+	if sig := g.checkSignature(ctx, encoded, t.PGPSignature, t.Tagger.When, allowedSigners); !sig.Valid() {
+		return "", fmt.Errorf("verifying tag %s: no valid signature", tag)
+	}
+	return t.Target.String(), nil
+}
+
+func (g *GoGitBackend) VerifyCommit(ctx context.Context, dir, commit, allowedSigners string) error {
+	repo, err := gogit.PlainOpen(dir)
+	if err != nil {
+		return err
+	}
+	hash, err := repo.ResolveRevision(plumbing.Revision(commit))
+	if err != nil {
+		return fmt.Errorf("failed to verify commit %s", commit)
+	}
+	c, err := repo.CommitObject(*hash)
+	if err != nil {
+		return fmt.Errorf("failed to verify commit %s", commit)
+	}
+	if sig := g.signature(ctx, c, allowedSigners); !sig.Valid() {
+		return fmt.Errorf("failed to verify commit %s", commit)
+	}
+	return nil
+}
+
+func (g *GoGitBackend) SecretUnseal(ctx context.Context, dir string) error {
+	return errors.Wrap(ErrUnsupported, "git secret reveal")
+}
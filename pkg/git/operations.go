@@ -11,8 +11,11 @@ import (
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -42,6 +45,9 @@ var allowedEnvVars = []string{
 	// when container is running in hardened Openshift environments and user id is not found in /etc/passwd
 	// for usage flux must be wrapped using https://cwrap.org/nss_wrapper.html library
 	"NSS_WRAPPER_PASSWD", "NSS_WRAPPER_GROUP", "LD_PRELOAD",
+	// these configure gitsign, for signing with Sigstore
+	"GITSIGN_FULCIO_URL", "GITSIGN_REKOR_URL", "GITSIGN_OIDC_ISSUER", "GITSIGN_OIDC_CLIENT_ID",
+	"GITSIGN_CONNECTOR_ID", "GITSIGN_TOKEN_PROVIDER", "GITSIGN_LOG", "SIGSTORE_ID_TOKEN",
 	// variables used by the AWS CodeCommit helper to get temporary git credentials when using Kubernetes
 	// service account IAM role integration
 	"AWS_WEB_IDENTITY_TOKEN_FILE", "AWS_ROLE_ARN",
@@ -51,6 +57,9 @@ type gitCmdConfig struct {
 	dir string
 	env []string
 	out io.Writer
+	// the remote or URL contacted, and the credentials to use for it
+	upstream    string
+	credentials Credentials
 }
 
 func config(ctx context.Context, workingDir, user, email string) error {
@@ -66,29 +75,91 @@ func config(ctx context.Context, workingDir, user, email string) error {
 	return nil
 }
 
-func clone(ctx context.Context, workingDir, repoURL, repoBranch string) (path string, err error) {
+func clone(ctx context.Context, workingDir, repoURL, repoBranch string, sparsePaths []string) (path string, err error) {
 	repoPath := workingDir
 	args := []string{"clone"}
 	if repoBranch != "" {
 		args = append(args, "--branch", repoBranch)
 	}
+	patterns := sparseCheckoutPatterns(sparsePaths)
+	if len(patterns) > 0 {
+		args = append(args, "--no-checkout")
+	}
 	args = append(args, repoURL, repoPath)
 	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir}); err != nil {
 		return "", errors.Wrap(err, "git clone")
 	}
+	if len(patterns) > 0 {
+		if err := sparseCheckout(ctx, repoPath, patterns); err != nil {
+			return "", err
+		}
+	}
 	return repoPath, nil
 }
 
-func mirror(ctx context.Context, workingDir, repoURL string) (path string, err error) {
+// sparseCheckout populates a clone made with `--no-checkout` with
+// only the files matching the patterns given. This uses
+// `core.sparseCheckout` directly rather than `git sparse-checkout`,
+// so that older versions of git will do.
+func sparseCheckout(ctx context.Context, workingDir string, patterns []string) error {
+	if err := execGitCmd(ctx, []string{"config", "core.sparseCheckout", "true"}, gitCmdConfig{dir: workingDir}); err != nil {
+		return errors.Wrap(err, "enabling sparse checkout")
+	}
+	infoDir := filepath.Join(workingDir, ".git", "info")
+	if err := os.MkdirAll(infoDir, 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(infoDir, "sparse-checkout"), []byte(strings.Join(patterns, "\n")+"\n"), 0644); err != nil {
+		return errors.Wrap(err, "writing sparse checkout patterns")
+	}
+	if err := execGitCmd(ctx, []string{"read-tree", "-mu", "HEAD"}, gitCmdConfig{dir: workingDir}); err != nil {
+		return errors.Wrap(err, "git read-tree")
+	}
+	return nil
+}
+
+func mirror(ctx context.Context, workingDir, repoURL string, creds Credentials, depth int) (path string, err error) {
 	repoPath := workingDir
 	args := []string{"clone", "--mirror"}
+	if depth > 0 {
+		// `--depth` would otherwise imply `--single-branch`
+		args = append(args, "--depth", strconv.Itoa(depth), "--no-single-branch")
+	}
 	args = append(args, repoURL, repoPath)
-	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir}); err != nil {
+	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir, upstream: repoURL, credentials: creds}); err != nil {
 		return "", errors.Wrap(err, "git clone --mirror")
 	}
 	return repoPath, nil
 }
 
+// deepen fetches more of the history of a shallow repo: depth more
+// commits back from each shallow boundary, or all of it if depth is
+// zero.
+func deepen(ctx context.Context, workingDir, upstream string, creds Credentials, depth int) error {
+	args := []string{"fetch", "--tags", "--unshallow", upstream}
+	if depth > 0 {
+		args = []string{"fetch", "--tags", "--deepen=" + strconv.Itoa(depth), upstream}
+	}
+	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir, upstream: upstream, credentials: creds}); err != nil {
+		return errors.Wrap(err, "deepening shallow repo")
+	}
+	return nil
+}
+
+func isAncestor(ctx context.Context, workingDir, ancestor, ref string) (bool, error) {
+	args := []string{"merge-base", "--is-ancestor", ancestor, ref}
+	err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir})
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == 1:
+		// exits with 1, and no output, if it's not an ancestor
+		return false, nil
+	}
+	return false, err
+}
+
 func checkout(ctx context.Context, workingDir, ref string) error {
 	args := []string{"checkout", ref, "--"}
 	err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir})
@@ -106,7 +177,7 @@ func add(ctx context.Context, workingDir, path string) error {
 // checkPush sanity-checks that we can write to the upstream repo
 // (being able to `clone` is an adequate check that we can read the
 // upstream).
-func checkPush(ctx context.Context, workingDir, upstream, branch string) error {
+func checkPush(ctx context.Context, workingDir, upstream string, creds Credentials, branch string) error {
 	// we need to pseudo randomize the tag we use for the write check
 	// as multiple Flux instances can perform the check simultaneously
 	// for different branches, causing commit reference conflicts
@@ -123,17 +194,17 @@ func checkPush(ctx context.Context, workingDir, upstream, branch string) error {
 		return errors.Wrap(err, "tag for write check")
 	}
 	args = []string{"push", upstream, "tag", pseudoRandPushTag}
-	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir}); err != nil {
+	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir, upstream: upstream, credentials: creds}); err != nil {
 		return errors.Wrap(err, "attempt to push tag")
 	}
-	return deleteTag(ctx, workingDir, pseudoRandPushTag, upstream)
+	return deleteTag(ctx, workingDir, pseudoRandPushTag, upstream, creds)
 }
 
 // deleteTag deletes the given git tag
 // See https://git-scm.com/docs/git-tag and https://git-scm.com/docs/git-push for more info.
-func deleteTag(ctx context.Context, workingDir, tag, upstream string) error {
+func deleteTag(ctx context.Context, workingDir, tag, upstream string, creds Credentials) error {
 	args := []string{"push", "--delete", upstream, "tag", tag}
-	return execGitCmd(ctx, args, gitCmdConfig{dir: workingDir})
+	return execGitCmd(ctx, args, gitCmdConfig{dir: workingDir, upstream: upstream, credentials: creds})
 }
 
 func secretUnseal(ctx context.Context, workingDir string) error {
@@ -154,13 +225,16 @@ func commit(ctx context.Context, workingDir string, commitAction CommitAction) e
 		return err
 	}
 
-	args := []string{"commit", "--no-verify", "-a", "--file", message.Name()}
+	args := append(signingConfigArgs(commitAction.SigningFormat), "commit", "--no-verify", "-a", "--file", message.Name())
 	var env []string
 	if commitAction.Author != "" {
 		args = append(args, "--author", commitAction.Author)
 	}
 	if commitAction.SigningKey != "" {
 		args = append(args, fmt.Sprintf("--gpg-sign=%s", commitAction.SigningKey))
+	} else if commitAction.SigningFormat == SigningFormatSigstore {
+		// keyless, so there's no key to give
+		args = append(args, "--gpg-sign")
 	}
 	args = append(args, "--")
 	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir, env: env}); err != nil {
@@ -170,23 +244,19 @@ func commit(ctx context.Context, workingDir string, commitAction CommitAction) e
 }
 
 // push the refs given to the upstream repo
-func push(ctx context.Context, workingDir, upstream string, refs []string) error {
+func push(ctx context.Context, workingDir, upstream string, creds Credentials, refs []string) error {
 	args := append([]string{"push", upstream}, refs...)
-	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir}); err != nil {
+	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir, upstream: upstream, credentials: creds}); err != nil {
 		return errors.Wrap(err, fmt.Sprintf("git push %s %s", upstream, refs))
 	}
 	return nil
 }
 
 // fetch updates refs from the upstream.
-func fetch(ctx context.Context, workingDir, upstream string, refspec ...string) error {
+func fetch(ctx context.Context, workingDir, upstream string, creds Credentials, refspec ...string) error {
 	args := append([]string{"fetch", "--tags", upstream}, refspec...)
-	// In git <=2.20 the error started with an uppercase, in 2.21 this
-	// was changed to be consistent with all other die() and error()
-	// messages, cast to lowercase to support both versions.
-	// Ref: https://github.com/git/git/commit/0b9c3afdbfb62936337efc52b4007a446939b96b
-	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir}); err != nil &&
-		!strings.Contains(strings.ToLower(err.Error()), "couldn't find remote ref") {
+	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir, upstream: upstream, credentials: creds}); err != nil &&
+		!errors.Is(err, ErrRefNotFound) {
 		return errors.Wrap(err, fmt.Sprintf("git fetch --tags %s %s", upstream, refspec))
 	}
 	return nil
@@ -195,7 +265,7 @@ func fetch(ctx context.Context, workingDir, upstream string, refspec ...string)
 func refExists(ctx context.Context, workingDir, ref string) (bool, error) {
 	args := []string{"rev-list", ref, "--"}
 	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir}); err != nil {
-		if strings.Contains(err.Error(), "bad revision") {
+		if errors.Is(err, ErrRefNotFound) {
 			return false, nil
 		}
 		return false, err
@@ -236,7 +306,7 @@ func getNote(ctx context.Context, workingDir, notesRef, rev string, note interfa
 	out := &bytes.Buffer{}
 	args := []string{"notes", "--ref", notesRef, "show", rev}
 	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir, out: out}); err != nil {
-		if strings.Contains(strings.ToLower(err.Error()), "no note found for object") {
+		if errors.Is(err, ErrNoteNotFound) {
 			return false, nil
 		}
 		return false, err
@@ -278,9 +348,9 @@ func refRevision(ctx context.Context, workingDir, ref string) (string, error) {
 }
 
 // Return the revisions and one-line log commit messages
-func onelinelog(ctx context.Context, workingDir, refspec string, subdirs []string, firstParent bool) ([]Commit, error) {
+func onelinelog(ctx context.Context, workingDir, refspec string, subdirs []string, firstParent bool, allowedSigners string) ([]Commit, error) {
 	out := &bytes.Buffer{}
-	args := []string{"log", "--pretty=format:%GK|%G?|%H|%s"}
+	args := append(allowedSignersArgs(allowedSigners), "log", "--pretty=format:%GK%x00%G?%x00%GS%x00%H%x00%at%x00%an%x00%s")
 
 	if firstParent {
 		args = append(args, "--first-parent")
@@ -299,17 +369,31 @@ func onelinelog(ctx context.Context, workingDir, refspec string, subdirs []strin
 	return splitLog(out.String())
 }
 
+// splitLog parses the output of onelinelog. The fields are separated
+// by NUL, since any of them but the revision and time can contain
+// other punctuation.
 func splitLog(s string) ([]Commit, error) {
 	lines := splitList(s)
 	commits := make([]Commit, len(lines))
 	for i, m := range lines {
-		parts := strings.SplitN(m, "|", 4)
+		parts := strings.SplitN(m, "\x00", 7)
+		if len(parts) != 7 {
+			return nil, fmt.Errorf("unexpected git log output %q", m)
+		}
 		commits[i].Signature = Signature{
-			Key:    parts[0],
-			Status: parts[1],
+			Key:       parts[0],
+			KeyType:   signatureKeyType(parts[0], parts[1]),
+			Principal: parts[2],
+			Status:    parts[1],
+		}
+		commits[i].Revision = parts[3]
+		timestamp, err := strconv.ParseInt(parts[4], 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing commit time for %s", parts[3])
 		}
-		commits[i].Revision = parts[2]
-		commits[i].Message = parts[3]
+		commits[i].Time = time.Unix(timestamp, 0).UTC()
+		commits[i].Author = parts[5]
+		commits[i].Message = parts[6]
 	}
 	return commits, nil
 }
@@ -323,27 +407,29 @@ func splitList(s string) []string {
 }
 
 // Move the tag to the ref given and push that tag upstream
-func moveTagAndPush(ctx context.Context, workingDir, upstream string, action TagAction) error {
-	args := []string{"tag", "--force", "-a", "-m", action.Message}
+func moveTagAndPush(ctx context.Context, workingDir, upstream string, creds Credentials, action TagAction) error {
+	args := append(signingConfigArgs(action.SigningFormat), "tag", "--force", "-a", "-m", action.Message)
 	var env []string
 	if action.SigningKey != "" {
 		args = append(args, fmt.Sprintf("--local-user=%s", action.SigningKey))
+	} else if action.SigningFormat == SigningFormatSigstore {
+		args = append(args, "--sign")
 	}
 	args = append(args, action.Tag, action.Revision)
 	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir, env: env}); err != nil {
 		return errors.Wrap(err, "moving tag "+action.Tag)
 	}
 	args = []string{"push", "--force", upstream, "tag", action.Tag}
-	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir}); err != nil {
+	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir, upstream: upstream, credentials: creds}); err != nil {
 		return errors.Wrap(err, "pushing tag to origin")
 	}
 	return nil
 }
 
 // Verify tag signature and return the revision it points to
-func verifyTag(ctx context.Context, workingDir, tag string) (string, error) {
+func verifyTag(ctx context.Context, workingDir, tag, allowedSigners string) (string, error) {
 	out := &bytes.Buffer{}
-	args := []string{"verify-tag", "--format", "%(object)", tag}
+	args := append(allowedSignersArgs(allowedSigners), "verify-tag", "--format", "%(object)", tag)
 	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir, out: out}); err != nil {
 		return "", errors.Wrap(err, "verifying tag "+tag)
 	}
@@ -351,8 +437,8 @@ func verifyTag(ctx context.Context, workingDir, tag string) (string, error) {
 }
 
 // Verify commit signature
-func verifyCommit(ctx context.Context, workingDir, commit string) error {
-	args := []string{"verify-commit", commit}
+func verifyCommit(ctx context.Context, workingDir, commit, allowedSigners string) error {
+	args := append(allowedSignersArgs(allowedSigners), "verify-commit", commit)
 	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir}); err != nil {
 		return fmt.Errorf("failed to verify commit %s", commit)
 	}
@@ -432,6 +518,20 @@ func (b *threadSafeBuffer) String() string {
 	return b.buf.String()
 }
 
+// remoteURL gives the URL of upstream, which may be the name of a
+// remote configured in the repo at workingDir, or a URL already.
+func remoteURL(ctx context.Context, workingDir, upstream string) (string, error) {
+	if strings.Contains(upstream, "://") {
+		return upstream, nil
+	}
+	out := &bytes.Buffer{}
+	args := []string{"remote", "get-url", upstream}
+	if err := execGitCmd(ctx, args, gitCmdConfig{dir: workingDir, out: out}); err != nil {
+		return "", errors.Wrap(err, "getting URL of remote "+upstream)
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
 // execGitCmd runs a `git` command with the supplied arguments.
 func execGitCmd(ctx context.Context, args []string, config gitCmdConfig) error {
 	c := exec.CommandContext(ctx, "git", args...)
@@ -440,6 +540,17 @@ func execGitCmd(ctx context.Context, args []string, config gitCmdConfig) error {
 		c.Dir = config.dir
 	}
 	c.Env = append(env(), config.env...)
+	if creds := config.credentials; creds != nil && isNetworkCommand(args) {
+		url, err := remoteURL(ctx, config.dir, config.upstream)
+		if err != nil {
+			return err
+		}
+		username, password, err := creds.Get(ctx)
+		if err != nil {
+			return err
+		}
+		c.Env = append(c.Env, credentialsEnv(c.Env, url, username, password)...)
+	}
 	stdOutAndStdErr := &threadSafeBuffer{}
 	c.Stdout = stdOutAndStdErr
 	c.Stderr = stdOutAndStdErr
@@ -450,11 +561,15 @@ func execGitCmd(ctx context.Context, args []string, config gitCmdConfig) error {
 	err := c.Run()
 	if err != nil {
 		if len(stdOutAndStdErr.Bytes()) > 0 {
-			err = errors.New(stdOutAndStdErr.String())
+			output := stdOutAndStdErr.String()
+			err = errors.New(output)
 			msg := findErrorMessage(stdOutAndStdErr)
 			if msg != "" {
 				err = fmt.Errorf("%s, full output:\n %s", msg, err.Error())
 			}
+			if kind := classifyOutput(output); kind != nil {
+				err = &gitError{kind: kind, err: err}
+			}
 		}
 	}
 
@@ -482,6 +597,19 @@ func env() []string {
 		}
 	}
 
+	// include any git config given in the environment; credentials
+	// are added after it
+	if count, ok := os.LookupEnv("GIT_CONFIG_COUNT"); ok {
+		env = append(env, "GIT_CONFIG_COUNT="+count)
+		n, _ := strconv.Atoi(count)
+		for i := 0; i < n; i++ {
+			for _, k := range []string{"GIT_CONFIG_KEY_", "GIT_CONFIG_VALUE_"} {
+				k += strconv.Itoa(i)
+				env = append(env, k+"="+os.Getenv(k))
+			}
+		}
+	}
+
 	return env
 }
 
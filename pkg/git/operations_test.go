@@ -192,7 +192,7 @@ func TestOnelinelog_NoGitpath(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	commits, err := onelinelog(context.Background(), newDir, "HEAD~2..HEAD", nil, false)
+	commits, err := onelinelog(context.Background(), newDir, "HEAD~2..HEAD", nil, false, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -229,7 +229,7 @@ func TestOnelinelog_NoGitpath_Merged(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	commits, err := onelinelog(context.Background(), newDir, "HEAD", nil, false)
+	commits, err := onelinelog(context.Background(), newDir, "HEAD", nil, false, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -238,7 +238,7 @@ func TestOnelinelog_NoGitpath_Merged(t *testing.T) {
 		t.Fatal(commits)
 	}
 
-	commits, err = onelinelog(context.Background(), newDir, "HEAD", nil, true)
+	commits, err = onelinelog(context.Background(), newDir, "HEAD", nil, true, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -266,7 +266,7 @@ func TestOnelinelog_WithGitpath(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	commits, err := onelinelog(context.Background(), newDir, "HEAD~2..HEAD", []string{"dev"}, false)
+	commits, err := onelinelog(context.Background(), newDir, "HEAD~2..HEAD", []string{"dev"}, false, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -304,7 +304,7 @@ func TestOnelinelog_WithGitpath_Merged(t *testing.T) {
 	}
 
 	// show the 2 update commits as well as init commit
-	commits, err := onelinelog(context.Background(), newDir, "HEAD", []string{"prod"}, false)
+	commits, err := onelinelog(context.Background(), newDir, "HEAD", []string{"prod"}, false, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -314,7 +314,7 @@ func TestOnelinelog_WithGitpath_Merged(t *testing.T) {
 	}
 
 	// show the merge commit as well as init commit
-	commits, err = onelinelog(context.Background(), newDir, "HEAD", []string{"prod"}, true)
+	commits, err = onelinelog(context.Background(), newDir, "HEAD", []string{"prod"}, true, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -324,6 +324,62 @@ func TestOnelinelog_WithGitpath_Merged(t *testing.T) {
 	}
 }
 
+func TestOnelinelog_AuthorAndTime(t *testing.T) {
+	newDir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+
+	if err := createRepo(newDir, []string{"dev"}); err != nil {
+		t.Fatal(err)
+	}
+
+	before := time.Now().Add(-time.Minute)
+	commits, err := onelinelog(context.Background(), newDir, "HEAD", nil, false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) == 0 {
+		t.Fatal("expected at least one commit")
+	}
+	if commits[0].Author != "operations_test_user" {
+		t.Errorf("expected author %q, got %q", "operations_test_user", commits[0].Author)
+	}
+	if commits[0].Time.Before(before) {
+		t.Errorf("expected a recent commit time, got %s", commits[0].Time)
+	}
+}
+
+func TestSplitLog(t *testing.T) {
+	commits, err := splitLog("KEY\x00G\x00Jane Doe <jane@example.com>\x00abc123\x001600000000\x00Jane | Doe\x00Subject with | in it\n" +
+		"SHA256:abcdef\x00G\x00jane@example.com\x00def456\x001600000000\x00Jane Doe\x00SSH signed\n" +
+		"\x00N\x00\x00ghi789\x001600000000\x00Jane Doe\x00Unsigned\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 3 {
+		t.Fatalf("expected three commits, got %d", len(commits))
+	}
+	c := commits[0]
+	if c.Revision != "abc123" || c.Author != "Jane | Doe" || c.Message != "Subject with | in it" {
+		t.Errorf("unexpected commit %+v", c)
+	}
+	if !c.Time.Equal(time.Unix(1600000000, 0)) {
+		t.Errorf("unexpected time %s", c.Time)
+	}
+	if c.Signature != (Signature{Key: "KEY", KeyType: KeyTypeGPG, Principal: "Jane Doe <jane@example.com>", Status: "G"}) {
+		t.Errorf("unexpected signature %+v", c.Signature)
+	}
+	if sig := commits[1].Signature; sig.KeyType != KeyTypeSSH || sig.Principal != "jane@example.com" {
+		t.Errorf("unexpected signature %+v", sig)
+	}
+	if sig := commits[2].Signature; sig.KeyType != "" {
+		t.Errorf("unexpected signature %+v", sig)
+	}
+
+	if _, err := splitLog("not\x00enough\x00fields"); err == nil {
+		t.Error("expected an error for malformed log output")
+	}
+}
+
 func TestCheckPush(t *testing.T) {
 	upstreamDir, upstreamCleanup := testfiles.TempDir(t)
 	defer upstreamCleanup()
@@ -334,11 +390,11 @@ func TestCheckPush(t *testing.T) {
 	cloneDir, cloneCleanup := testfiles.TempDir(t)
 	defer cloneCleanup()
 
-	working, err := clone(context.Background(), cloneDir, upstreamDir, "master")
+	working, err := clone(context.Background(), cloneDir, upstreamDir, "master", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
-	err = checkPush(context.Background(), working, upstreamDir, "")
+	err = checkPush(context.Background(), working, upstreamDir, nil, "")
 	if err != nil {
 		t.Fatal(err)
 	}
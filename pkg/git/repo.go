@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
-	"strings"
 	"sync"
 
 	"context"
@@ -51,11 +50,19 @@ const (
 
 type Repo struct {
 	// As supplied to constructor
-	origin   Remote
-	branch   string
-	interval time.Duration
-	timeout  time.Duration
-	readonly bool
+	origin      Remote
+	branch      string
+	interval    time.Duration
+	timeout     time.Duration
+	readonly    bool
+	backend     Backend
+	credentials Credentials
+	// path to the allowed signers file for SSH signatures
+	allowedSigners string
+	// how much history to fetch at first; zero means all of it
+	depth int
+	// paths to which working clones are restricted
+	sparsePaths []string
 
 	// State
 	mu     sync.RWMutex
@@ -103,6 +110,50 @@ func (ro IsReadOnly) apply(r *Repo) {
 
 var ReadOnly IsReadOnly = true
 
+// WithCredentials supplies credentials for an HTTPS origin.
+func WithCredentials(c Credentials) Option {
+	return optionFunc(func(r *Repo) {
+		r.credentials = c
+	})
+}
+
+// WithAllowedSigners gives the path of an allowed signers file (see
+// ssh-keygen(1)) against which to verify SSH signatures on commits and
+// tags. The file is read each time a signature is checked, so it can
+// be updated while fluxd runs.
+func WithAllowedSigners(path string) Option {
+	return optionFunc(func(r *Repo) {
+		r.allowedSigners = path
+	})
+}
+
+// WithDepth makes the repo fetch only the most recent commits, up to
+// the depth given, when first mirroring the upstream. More history
+// is fetched as needed to list the commits between two revisions, or
+// to verify a commit.
+func WithDepth(depth int) Option {
+	return optionFunc(func(r *Repo) {
+		r.depth = depth
+	})
+}
+
+// WithSparseCheckout restricts the files checked out in working
+// clones and exports to those under the paths given, relative to the
+// top of the repo, plus any .flux.yaml files above them.
+func WithSparseCheckout(paths []string) Option {
+	return optionFunc(func(r *Repo) {
+		r.sparsePaths = paths
+	})
+}
+
+// WithBackend makes the repo use the backend given for git
+// operations, rather than running the git executable.
+func WithBackend(b Backend) Option {
+	return optionFunc(func(r *Repo) {
+		r.backend = b
+	})
+}
+
 // NewRepo constructs a repo mirror which will sync itself.
 func NewRepo(origin Remote, opts ...Option) *Repo {
 	status := RepoNew
@@ -114,6 +165,7 @@ func NewRepo(origin Remote, opts ...Option) *Repo {
 		status:   status,
 		interval: defaultInterval,
 		timeout:  defaultTimeout,
+		backend:  execBackend{},
 		err:      ErrNotCloned,
 		notify:   make(chan struct{}, 1), // `1` so that Notify doesn't block
 		C:        make(chan struct{}, 1), // `1` so we don't block on completing a refresh
@@ -170,7 +222,7 @@ func (r *Repo) setUnready(s GitRepoStatus, err error) {
 	metricGitReady.Set(MetricRepoUnready)
 	r.mu.Lock()
 	r.status = s
-	r.err = err
+	r.err = r.origin.RedactError(err)
 	r.mu.Unlock()
 }
 
@@ -221,7 +273,7 @@ func (r *Repo) Revision(ctx context.Context, ref string) (string, error) {
 	if err := r.errorIfNotReady(); err != nil {
 		return "", err
 	}
-	return refRevision(ctx, r.dir, ref)
+	return r.backend.RefRevision(ctx, r.dir, ref)
 }
 
 // BranchHead returns the HEAD revision (SHA1) of the configured branch
@@ -231,7 +283,7 @@ func (r *Repo) BranchHead(ctx context.Context) (string, error) {
 	if err := r.errorIfNotReady(); err != nil {
 		return "", err
 	}
-	return refRevision(ctx, r.dir, "heads/"+r.branch)
+	return r.backend.RefRevision(ctx, r.dir, "heads/"+r.branch)
 }
 
 func (r *Repo) CommitsBefore(ctx context.Context, ref string, firstParent bool, paths ...string) ([]Commit, error) {
@@ -240,16 +292,19 @@ func (r *Repo) CommitsBefore(ctx context.Context, ref string, firstParent bool,
 	if err := r.errorIfNotReady(); err != nil {
 		return nil, err
 	}
-	return onelinelog(ctx, r.dir, ref, paths, firstParent)
+	return r.backend.Log(ctx, r.dir, ref, paths, firstParent, r.allowedSigners)
 }
 
 func (r *Repo) CommitsBetween(ctx context.Context, ref1, ref2 string, firstParent bool, paths ...string) ([]Commit, error) {
+	if err := r.ensureHistory(ctx, ref1, ref2); err != nil {
+		return nil, err
+	}
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 	if err := r.errorIfNotReady(); err != nil {
 		return nil, err
 	}
-	return onelinelog(ctx, r.dir, ref1+".."+ref2, paths, firstParent)
+	return r.backend.Log(ctx, r.dir, ref1+".."+ref2, paths, firstParent, r.allowedSigners)
 }
 
 func (r *Repo) VerifyTag(ctx context.Context, tag string) (string, error) {
@@ -258,16 +313,19 @@ func (r *Repo) VerifyTag(ctx context.Context, tag string) (string, error) {
 	if err := r.errorIfNotReady(); err != nil {
 		return "", err
 	}
-	return verifyTag(ctx, r.dir, tag)
+	return r.backend.VerifyTag(ctx, r.dir, tag, r.allowedSigners)
 }
 
 func (r *Repo) VerifyCommit(ctx context.Context, commit string) error {
+	if err := r.ensureHistory(ctx, commit, ""); err != nil {
+		return err
+	}
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 	if err := r.errorIfNotReady(); err != nil {
 		return err
 	}
-	return verifyCommit(ctx, r.dir, commit)
+	return r.backend.VerifyCommit(ctx, r.dir, commit, r.allowedSigners)
 }
 
 func (r *Repo) DeleteTag(ctx context.Context, tag string) error {
@@ -276,16 +334,17 @@ func (r *Repo) DeleteTag(ctx context.Context, tag string) error {
 	if err := r.errorIfNotReady(); err != nil {
 		return err
 	}
-	return deleteTag(ctx, r.dir, tag, r.origin.URL)
+	err := r.backend.DeleteTag(ctx, r.dir, tag, r.origin.URL, r.credentials)
+	return r.origin.RedactError(err)
 }
 
 func (r *Repo) NoteRevList(ctx context.Context, notesRef string) (map[string]struct{}, error) {
-	return noteRevList(ctx, r.Dir(), notesRef)
+	return r.backend.NoteRevList(ctx, r.Dir(), notesRef)
 }
 
 // GetNote gets a note for the revision specified, or nil if there is no such note.
 func (r *Repo) GetNote(ctx context.Context, rev, notesRef string, note interface{}) (bool, error) {
-	return getNote(ctx, r.Dir(), notesRef, rev, note)
+	return r.backend.GetNote(ctx, r.Dir(), notesRef, rev, note)
 }
 
 // step attempts to advance the repo state machine, and returns `true`
@@ -311,7 +370,7 @@ func (r *Repo) step(bg context.Context) bool {
 		}
 
 		ctx, cancel := context.WithTimeout(bg, r.timeout)
-		dir, err = mirror(ctx, rootdir, url)
+		dir, err = r.backend.Mirror(ctx, rootdir, url, r.credentials, r.depth)
 		cancel()
 		if err == nil {
 			r.mu.Lock()
@@ -327,7 +386,7 @@ func (r *Repo) step(bg context.Context) bool {
 		}
 		dir = ""
 		os.RemoveAll(rootdir)
-		if strings.Contains(strings.ToLower(err.Error()), "could not resolve hostname") {
+		if errors.Is(err, ErrHostUnreachable) {
 			r.setUnready(RepoUnreachable, err)
 			return false
 		}
@@ -350,7 +409,7 @@ func (r *Repo) step(bg context.Context) bool {
 				return false
 			}
 
-			ok, err := refExists(ctx, dir, "refs/heads/"+r.branch)
+			ok, err := r.backend.RefExists(ctx, dir, "refs/heads/"+r.branch)
 			if err != nil {
 				r.setUnready(RepoCloned, err)
 				return false
@@ -362,7 +421,7 @@ func (r *Repo) step(bg context.Context) bool {
 		}
 
 		if !r.readonly {
-			err := checkPush(ctx, dir, url, r.branch)
+			err := r.backend.CheckPush(ctx, dir, url, r.credentials, r.branch)
 			if err != nil {
 				r.setUnready(RepoCloned, err)
 				return false
@@ -476,12 +535,57 @@ func (r *Repo) refreshLoop(shutdown <-chan struct{}) error {
 
 // fetch gets updated refs, and associated objects, from the upstream.
 func (r *Repo) fetch(ctx context.Context) error {
-	if err := fetch(ctx, r.dir, "origin"); err != nil {
+	if err := r.backend.Fetch(ctx, r.dir, "origin", r.credentials); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ensureHistory makes sure a shallow mirror has the history from ref
+// back to rev (or just rev, if ref is empty), deepening it if not,
+// so that logs and verification that start from rev see all they
+// should. Each time it deepens by twice as much, until either the
+// history is there or all of it has been fetched.
+func (r *Repo) ensureHistory(ctx context.Context, rev, ref string) error {
+	if r.depth == 0 {
+		return nil
+	}
+	r.mu.RLock()
+	complete, err := r.hasHistory(ctx, rev, ref)
+	r.mu.RUnlock()
+	if err != nil || complete {
 		return err
 	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for depth := r.depth; !complete; depth *= 2 {
+		if err := r.backend.Deepen(ctx, r.dir, "origin", r.credentials, depth); err != nil {
+			return r.origin.RedactError(err)
+		}
+		if complete, err = r.hasHistory(ctx, rev, ref); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// hasHistory reports whether there's no need to deepen the mirror to
+// get the history from ref back to rev: either because it's there,
+// or because the mirror isn't (or is no longer) shallow.
+func (r *Repo) hasHistory(ctx context.Context, rev, ref string) (bool, error) {
+	if r.errorIfNotReady() != nil || !isShallow(r.dir) {
+		return true, nil
+	}
+	if ok, err := r.backend.RefExists(ctx, r.dir, rev); err != nil || !ok {
+		return false, err
+	}
+	if ref == "" {
+		return true, nil
+	}
+	return r.backend.IsAncestor(ctx, r.dir, rev, ref)
+}
+
 // workingClone makes a non-bare clone, at `ref` (probably a branch),
 // and returns the filesystem path to it.
 func (r *Repo) workingClone(ctx context.Context, ref string) (string, error) {
@@ -494,7 +598,7 @@ func (r *Repo) workingClone(ctx context.Context, ref string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	path, err := clone(ctx, working, r.dir, ref)
+	path, err := r.backend.Clone(ctx, working, r.dir, ref, r.sparsePaths)
 	if err != nil {
 		os.RemoveAll(working)
 	}
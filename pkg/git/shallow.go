@@ -0,0 +1,48 @@
+package git
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// sparseCheckoutPatterns gives the patterns, in the format of
+// `.git/info/sparse-checkout`, that select the paths given, and any
+// .flux.yaml files in the directories above them, since manifest
+// generation looks for those.
+func sparseCheckoutPatterns(paths []string) []string {
+	seen := map[string]bool{}
+	var patterns []string
+	add := func(p string) {
+		if !seen[p] {
+			seen[p] = true
+			patterns = append(patterns, p)
+		}
+	}
+	for _, p := range paths {
+		p = path.Clean("/" + filepath.ToSlash(p))
+		if p == "/" {
+			// the whole repo is wanted, so there's no point
+			return nil
+		}
+		add(p)
+		for dir := path.Dir(p); ; dir = path.Dir(dir) {
+			add(strings.TrimSuffix(dir, "/") + "/.flux.yaml")
+			if dir == "/" {
+				break
+			}
+		}
+	}
+	return patterns
+}
+
+// isShallow reports whether the repo in dir has only part of the
+// history, as recorded by git in the `shallow` file.
+func isShallow(dir string) bool {
+	if dir == "" {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(dir, "shallow"))
+	return err == nil
+}
@@ -0,0 +1,91 @@
+package git
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fluxcd/flux/pkg/cluster/kubernetes/testfiles"
+)
+
+func TestSparseCheckoutPatterns(t *testing.T) {
+	assert.Equal(t, []string{"/dev", "/.flux.yaml"}, sparseCheckoutPatterns([]string{"dev"}))
+	assert.Equal(t, []string{
+		"/clusters/prod", "/clusters/.flux.yaml", "/.flux.yaml",
+		"/clusters/dev", "/base",
+	}, sparseCheckoutPatterns([]string{"clusters/prod/", "./clusters/dev", "base"}))
+	assert.Nil(t, sparseCheckoutPatterns([]string{"dev", "."}))
+	assert.Nil(t, sparseCheckoutPatterns(nil))
+}
+
+func TestShallowSparseRepo(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("no git executable found")
+	}
+	dir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+	upstream, revs := upstreamRepo(t, dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// --depth is ignored for clones from a path, so use a URL
+	repo := NewRepo(Remote{URL: "file://" + upstream}, Branch("master"), WithDepth(1), WithSparseCheckout([]string{"dev"}))
+	require.NoError(t, repo.Ready(ctx))
+	defer repo.Clean()
+	assert.True(t, isShallow(repo.Dir()))
+
+	head, err := repo.BranchHead(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, revs[2], head)
+	ok, err := repo.backend.RefExists(ctx, repo.Dir(), revs[0])
+	require.NoError(t, err)
+	assert.False(t, ok, "expected only the most recent commit to be fetched")
+
+	// the commits between need more history, so the mirror is deepened
+	commits, err := repo.CommitsBetween(ctx, revs[0], head, false)
+	require.NoError(t, err)
+	if assert.Len(t, commits, 2) {
+		assert.Equal(t, revs[2], commits[0].Revision)
+		assert.Equal(t, revs[1], commits[1].Revision)
+	}
+	assert.Error(t, repo.VerifyCommit(ctx, revs[0]), "expected an unsigned commit to fail verification")
+
+	export, err := repo.Export(ctx, head)
+	require.NoError(t, err)
+	defer export.Clean()
+	_, err = os.Stat(filepath.Join(export.Dir(), "dev", "app.yaml"))
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(export.Dir(), "prod"))
+	assert.True(t, os.IsNotExist(err), "expected prod not to be checked out")
+
+	checkout, err := repo.Clone(ctx, Config{
+		Branch:    "master",
+		NotesRef:  "flux",
+		UserName:  "flux",
+		UserEmail: "flux@example.com",
+		Paths:     []string{"dev"},
+	})
+	require.NoError(t, err)
+	defer checkout.Clean()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(checkout.Dir(), "dev", "app.yaml"), []byte("v3"), 0644))
+	require.NoError(t, checkout.CommitAndPush(ctx, CommitAction{Message: "Update dev"}, nil, false))
+	newHead, err := checkout.HeadRevision(ctx)
+	require.NoError(t, err)
+
+	// the files outside the sparse paths are left as they were
+	require.NoError(t, repo.Refresh(ctx))
+	changed, err := repo.backend.Changed(ctx, checkout.Dir(), head, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dev/app.yaml"}, changed)
+	head, err = repo.BranchHead(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, newHead, head)
+}
@@ -1,9 +1,59 @@
 package git
 
-// Signature holds information about a GPG signature.
+import (
+	"context"
+	"strings"
+)
+
+const (
+	KeyTypeGPG = "gpg"
+	KeyTypeSSH = "ssh"
+)
+
+// The formats in which flux can sign the commits and tags it makes.
+const (
+	SigningFormatGPG = "gpg"
+	// signed with an SSH private key, given by its path
+	SigningFormatSSH = "ssh"
+	// signed without a long-lived key, using Sigstore's gitsign
+	SigningFormatSigstore = "sigstore"
+)
+
+// Signing and verifying with SSH keys needs gpg.format=ssh, which was
+// introduced in git 2.34.
+const minSSHSigningGitMajor, minSSHSigningGitMinor = 2, 34
+
+// CheckSSHSigningSupport checks that the git executable is recent
+// enough to sign with, and verify, SSH keys.
+func CheckSSHSigningSupport(ctx context.Context) error {
+	return checkGitVersion(ctx, minSSHSigningGitMajor, minSSHSigningGitMinor, "to sign and verify with SSH keys")
+}
+
+// signingConfigArgs gives the arguments for git to sign in the format
+// given.
+func signingConfigArgs(format string) []string {
+	switch format {
+	case SigningFormatSSH:
+		return []string{"-c", "gpg.format=ssh"}
+	case SigningFormatSigstore:
+		return []string{"-c", "gpg.format=x509", "-c", "gpg.x509.program=gitsign"}
+	}
+	return nil
+}
+
+// Signature holds information about a GPG or SSH signature.
 type Signature struct {
-	Key    string
-	Status string
+	// Key is the ID of a GPG key, or the SHA256 fingerprint of an
+	// SSH key.
+	Key string
+	// KeyType is KeyTypeGPG or KeyTypeSSH; it's empty if the commit
+	// isn't signed.
+	KeyType string
+	// Principal is who signed: the user ID of a GPG key, or the
+	// principals given for an SSH key in the allowed signers file.
+	// It's empty if the signer isn't known.
+	Principal string
+	Status    string
 }
 
 // Valid returns true if the signature is _G_ood (valid).
@@ -11,3 +61,16 @@ type Signature struct {
 func (s *Signature) Valid() bool {
 	return s.Status == "G"
 }
+
+// signatureKeyType tells from the key git reports with `%GK` which
+// kind of key it is.
+func signatureKeyType(key, status string) string {
+	switch {
+	case status == "N":
+		return ""
+	case strings.HasPrefix(key, "SHA256:"):
+		return KeyTypeSSH
+	default:
+		return KeyTypeGPG
+	}
+}
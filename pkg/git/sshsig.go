@@ -0,0 +1,359 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+// The namespace git uses when making and checking SSH signatures.
+const sshSignatureNamespace = "git"
+
+// AllowedSigner is an entry in an allowed signers file, as described
+// in ssh-keygen(1): a key, the principals it belongs to, and the
+// limits on what it is trusted to sign.
+type AllowedSigner struct {
+	// Principals is the principals field as written, e.g.,
+	// `alice@example.com,alice@example.org`
+	Principals string
+	Key        ssh.PublicKey
+	// Namespaces restricts which signature namespaces the key is
+	// trusted for; if empty, any are.
+	Namespaces []string
+	// ValidAfter and ValidBefore bound the times at which signatures
+	// made by the key are trusted; the zero time means no bound.
+	ValidAfter  time.Time
+	ValidBefore time.Time
+	// CertAuthority marks the key as a CA for certificates
+	CertAuthority bool
+}
+
+// ReadAllowedSigners reads the allowed signers file at the path given.
+func ReadAllowedSigners(p string) ([]AllowedSigner, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading allowed signers")
+	}
+	defer f.Close()
+	signers, err := ParseAllowedSigners(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing allowed signers file %s", p)
+	}
+	return signers, nil
+}
+
+// ParseAllowedSigners parses the contents of an allowed signers file.
+func ParseAllowedSigners(r io.Reader) ([]AllowedSigner, error) {
+	var signers []AllowedSigner
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		signer, err := parseAllowedSigner(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+		signers = append(signers, signer)
+	}
+	return signers, scanner.Err()
+}
+
+func parseAllowedSigner(line string) (AllowedSigner, error) {
+	var signer AllowedSigner
+	fields := splitAllowedSignerFields(line)
+	if len(fields) < 3 {
+		return signer, errors.New("expected principals, key type and key")
+	}
+	signer.Principals, fields = fields[0], fields[1:]
+	// the options are optional, so tell them apart from the key type
+	if !isSSHKeyType(fields[0]) {
+		if err := signer.parseOptions(fields[0]); err != nil {
+			return signer, err
+		}
+		fields = fields[1:]
+	}
+	if len(fields) < 2 {
+		return signer, errors.New("expected key type and key")
+	}
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(fields[0] + " " + fields[1]))
+	if err != nil {
+		return signer, err
+	}
+	signer.Key = key
+	return signer, nil
+}
+
+// splitAllowedSignerFields splits a line on whitespace, except where
+// the whitespace is within double quotes, as it may be in options.
+func splitAllowedSignerFields(line string) []string {
+	var fields []string
+	var field strings.Builder
+	quoted := false
+	for _, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			field.WriteRune(r)
+		case (r == ' ' || r == '\t') && !quoted:
+			if field.Len() > 0 {
+				fields = append(fields, field.String())
+				field.Reset()
+			}
+		default:
+			field.WriteRune(r)
+		}
+	}
+	if field.Len() > 0 {
+		fields = append(fields, field.String())
+	}
+	return fields
+}
+
+func isSSHKeyType(s string) bool {
+	return strings.HasPrefix(s, "ssh-") || strings.HasPrefix(s, "ecdsa-") || strings.HasPrefix(s, "sk-")
+}
+
+func (s *AllowedSigner) parseOptions(options string) error {
+	for _, opt := range splitOptions(options) {
+		name, value := opt, ""
+		if i := strings.Index(opt, "="); i >= 0 {
+			name, value = opt[:i], strings.Trim(opt[i+1:], `"`)
+		}
+		var err error
+		switch strings.ToLower(name) {
+		case "cert-authority":
+			s.CertAuthority = true
+		case "namespaces":
+			s.Namespaces = strings.Split(value, ",")
+		case "valid-after":
+			s.ValidAfter, err = parseSignerTime(value)
+		case "valid-before":
+			s.ValidBefore, err = parseSignerTime(value)
+		default:
+			err = fmt.Errorf("unknown option %q", name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitOptions splits options on commas, except those within quotes.
+func splitOptions(options string) []string {
+	var opts []string
+	start, quoted := 0, false
+	for i, r := range options {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ',' && !quoted:
+			opts = append(opts, options[start:i])
+			start = i + 1
+		}
+	}
+	return append(opts, options[start:])
+}
+
+// parseSignerTime parses a time as given in valid-after and
+// valid-before options: YYYYMMDD[HHMM[SS]], in local time unless
+// suffixed with Z.
+func parseSignerTime(s string) (time.Time, error) {
+	loc := time.Local
+	if strings.HasSuffix(s, "Z") || strings.HasSuffix(s, "z") {
+		s, loc = s[:len(s)-1], time.UTC
+	}
+	layouts := map[int]string{8: "20060102", 12: "200601021504", 14: "20060102150405"}
+	layout, ok := layouts[len(s)]
+	if !ok {
+		return time.Time{}, fmt.Errorf("invalid time %q", s)
+	}
+	return time.ParseInLocation(layout, s, loc)
+}
+
+// trusts says whether the signer is trusted to have signed in the
+// namespace given at the time given.
+func (s AllowedSigner) trusts(namespace string, when time.Time) bool {
+	if s.CertAuthority {
+		// certificates aren't supported; see checkSSHSignature
+		return false
+	}
+	if len(s.Namespaces) > 0 {
+		var matched bool
+		for _, pattern := range s.Namespaces {
+			if ok, _ := path.Match(strings.TrimSpace(pattern), namespace); ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if !s.ValidAfter.IsZero() && when.Before(s.ValidAfter) {
+		return false
+	}
+	if !s.ValidBefore.IsZero() && !when.Before(s.ValidBefore) {
+		return false
+	}
+	return true
+}
+
+// allowedSignersArgs gives the arguments for git to check SSH
+// signatures against the allowed signers file given, if there is one.
+func allowedSignersArgs(path string) []string {
+	if path != "" {
+		return []string{"-c", "gpg.ssh.allowedSignersFile=" + path}
+	}
+	return nil
+}
+
+const (
+	sshSignatureArmorStart = "-----BEGIN SSH SIGNATURE-----"
+	sshSignatureArmorEnd   = "-----END SSH SIGNATURE-----"
+	sshSignatureMagic      = "SSHSIG"
+)
+
+func isSSHSignature(armored string) bool {
+	return strings.HasPrefix(strings.TrimSpace(armored), sshSignatureArmorStart)
+}
+
+// checkSSHSignature checks an armored SSH signature (see PROTOCOL.sshsig
+// in OpenSSH) of the message given, made at the time given, against
+// the allowed signers, and reports the result as `git log` would with
+// `%G?`, `%GK` and `%GS`. Signatures made with certificates are
+// reported as untrusted.
+func checkSSHSignature(armored string, message []byte, when time.Time, signers []AllowedSigner) Signature {
+	sig := Signature{KeyType: KeyTypeSSH, Status: "E"}
+	blob := strings.TrimSpace(armored)
+	blob = strings.TrimPrefix(blob, sshSignatureArmorStart)
+	blob = strings.TrimSuffix(blob, sshSignatureArmorEnd)
+	raw, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(blob), ""))
+	if err != nil || !bytes.HasPrefix(raw, []byte(sshSignatureMagic)) {
+		return sig
+	}
+	var envelope struct {
+		Version       uint32
+		PublicKey     []byte
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Signature     []byte
+	}
+	if err := ssh.Unmarshal(raw[len(sshSignatureMagic):], &envelope); err != nil || envelope.Version != 1 {
+		return sig
+	}
+	key, err := ssh.ParsePublicKey(envelope.PublicKey)
+	if err != nil {
+		return sig
+	}
+	sig.Key = ssh.FingerprintSHA256(key)
+
+	var h hash.Hash
+	switch envelope.HashAlgorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return sig
+	}
+	h.Write(message)
+	signed := append([]byte(sshSignatureMagic), ssh.Marshal(struct {
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Hash          []byte
+	}{envelope.Namespace, envelope.Reserved, envelope.HashAlgorithm, h.Sum(nil)})...)
+	var s ssh.Signature
+	if err := ssh.Unmarshal(envelope.Signature, &s); err != nil {
+		return sig
+	}
+	if envelope.Namespace != sshSignatureNamespace || key.Verify(signed, &s) != nil {
+		sig.Status = "B"
+		return sig
+	}
+
+	// A good signature; whether it can be trusted depends on whether
+	// the key is an allowed signer.
+	sig.Status = "U"
+	for _, signer := range signers {
+		if bytes.Equal(signer.Key.Marshal(), key.Marshal()) && signer.trusts(envelope.Namespace, when) {
+			sig.Status, sig.Principal = "G", signer.Principals
+			break
+		}
+	}
+	return sig
+}
+
+// readSSHSigner reads the (unencrypted) SSH private key at the path
+// given, e.g., fluxd's deploy key.
+func readSSHSigner(path string) (ssh.Signer, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading SSH signing key")
+	}
+	signer, err := ssh.ParsePrivateKey(b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing SSH signing key %s", path)
+	}
+	return signer, nil
+}
+
+// signSSH makes an armored SSH signature of the message given, as
+// `ssh-keygen -Y sign -n git` (and therefore git) would.
+func signSSH(signer ssh.Signer, message []byte) (string, error) {
+	digest := sha512.Sum512(message)
+	signed := append([]byte(sshSignatureMagic), ssh.Marshal(struct {
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Hash          []byte
+	}{sshSignatureNamespace, "", "sha512", digest[:]})...)
+
+	var sig *ssh.Signature
+	var err error
+	// the default for RSA keys is SHA-1, which ssh-keygen won't accept
+	if as, ok := signer.(ssh.AlgorithmSigner); ok && signer.PublicKey().Type() == ssh.KeyAlgoRSA {
+		sig, err = as.SignWithAlgorithm(rand.Reader, signed, ssh.KeyAlgoRSASHA512)
+	} else {
+		sig, err = signer.Sign(rand.Reader, signed)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	blob := append([]byte(sshSignatureMagic), ssh.Marshal(struct {
+		Version       uint32
+		PublicKey     []byte
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Signature     []byte
+	}{1, signer.PublicKey().Marshal(), sshSignatureNamespace, "", "sha512", ssh.Marshal(sig)})...)
+	encoded := base64.StdEncoding.EncodeToString(blob)
+	armored := &strings.Builder{}
+	armored.WriteString(sshSignatureArmorStart + "\n")
+	for len(encoded) > 70 {
+		armored.WriteString(encoded[:70] + "\n")
+		encoded = encoded[70:]
+	}
+	armored.WriteString(encoded + "\n" + sshSignatureArmorEnd + "\n")
+	return armored.String(), nil
+}
@@ -0,0 +1,265 @@
+package git
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/fluxcd/flux/pkg/cluster/kubernetes/testfiles"
+)
+
+func newSSHSigner(t *testing.T) ssh.Signer {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+	return signer
+}
+
+// sshSign makes an armored SSH signature of the message, as
+// `ssh-keygen -Y sign` would.
+func sshSign(t *testing.T, signer ssh.Signer, namespace string, message []byte) string {
+	digest := sha512.Sum512(message)
+	signed := append([]byte(sshSignatureMagic), ssh.Marshal(struct {
+		Namespace, Reserved, HashAlgorithm string
+		Hash                               []byte
+	}{namespace, "", "sha512", digest[:]})...)
+	sig, err := signer.Sign(rand.Reader, signed)
+	require.NoError(t, err)
+	blob := append([]byte(sshSignatureMagic), ssh.Marshal(struct {
+		Version                            uint32
+		PublicKey                          []byte
+		Namespace, Reserved, HashAlgorithm string
+		Signature                          []byte
+	}{1, signer.PublicKey().Marshal(), namespace, "", "sha512", ssh.Marshal(sig)})...)
+	encoded := base64.StdEncoding.EncodeToString(blob)
+	var lines []string
+	for len(encoded) > 70 {
+		lines, encoded = append(lines, encoded[:70]), encoded[70:]
+	}
+	lines = append(lines, encoded)
+	return sshSignatureArmorStart + "\n" + strings.Join(lines, "\n") + "\n" + sshSignatureArmorEnd + "\n"
+}
+
+func allowedSignerLine(principals, options string, key ssh.PublicKey) string {
+	line := principals + " "
+	if options != "" {
+		line += options + " "
+	}
+	return line + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+}
+
+func TestParseAllowedSigners(t *testing.T) {
+	key := newSSHSigner(t).PublicKey()
+	signers, err := ParseAllowedSigners(strings.NewReader(strings.Join([]string{
+		"# a comment",
+		"",
+		allowedSignerLine("alice@example.com", "", key) + " alice's laptop",
+		allowedSignerLine("bob@example.com,*@example.org", `namespaces="git,file",valid-after="20200101",valid-before="202101021504Z"`, key),
+		allowedSignerLine("*@example.com", "cert-authority", key),
+	}, "\n")))
+	require.NoError(t, err)
+	require.Len(t, signers, 3)
+
+	assert.Equal(t, "alice@example.com", signers[0].Principals)
+	assert.Equal(t, key.Marshal(), signers[0].Key.Marshal())
+	assert.Empty(t, signers[0].Namespaces)
+
+	assert.Equal(t, "bob@example.com,*@example.org", signers[1].Principals)
+	assert.Equal(t, []string{"git", "file"}, signers[1].Namespaces)
+	assert.Equal(t, time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local), signers[1].ValidAfter)
+	assert.Equal(t, time.Date(2021, 1, 2, 15, 4, 0, 0, time.UTC), signers[1].ValidBefore)
+
+	assert.True(t, signers[2].CertAuthority)
+
+	_, err = ParseAllowedSigners(strings.NewReader("alice@example.com unknown-option ssh-ed25519"))
+	assert.Error(t, err)
+	_, err = ParseAllowedSigners(strings.NewReader(allowedSignerLine("alice@example.com", "bogus", key)))
+	assert.Error(t, err)
+}
+
+func TestCheckSSHSignature(t *testing.T) {
+	signer := newSSHSigner(t)
+	key := signer.PublicKey()
+	fingerprint := ssh.FingerprintSHA256(key)
+	message := []byte("tree abc\n\nA commit\n")
+	armored := sshSign(t, signer, "git", message)
+	when := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	allowed := func(options string) []AllowedSigner {
+		signers, err := ParseAllowedSigners(strings.NewReader(allowedSignerLine("flux@example.com", options, key)))
+		require.NoError(t, err)
+		return signers
+	}
+
+	assert.Equal(t, Signature{Key: fingerprint, KeyType: KeyTypeSSH, Principal: "flux@example.com", Status: "G"},
+		checkSSHSignature(armored, message, when, allowed("")))
+	assert.Equal(t, "G", checkSSHSignature(armored, message, when, allowed(`namespaces="g*"`)).Status)
+	assert.Equal(t, "G", checkSSHSignature(armored, message, when, allowed(`valid-after="20200101Z",valid-before="20210101Z"`)).Status)
+
+	// good signatures from keys not trusted are reported as such
+	assert.Equal(t, Signature{Key: fingerprint, KeyType: KeyTypeSSH, Status: "U"},
+		checkSSHSignature(armored, message, when, nil))
+	assert.Equal(t, "U", checkSSHSignature(armored, message, when, allowed(`namespaces="file"`)).Status)
+	assert.Equal(t, "U", checkSSHSignature(armored, message, when, allowed(`valid-after="20200701Z"`)).Status)
+	assert.Equal(t, "U", checkSSHSignature(armored, message, when, allowed(`valid-before="20200101Z"`)).Status)
+
+	assert.Equal(t, "B", checkSSHSignature(armored, []byte("something else"), when, allowed("")).Status)
+	assert.Equal(t, "B", checkSSHSignature(sshSign(t, signer, "file", message), message, when, allowed("")).Status)
+	assert.Equal(t, "E", checkSSHSignature(sshSignatureArmorStart+"\nbm90IGEgc2lnbmF0dXJl\n"+sshSignatureArmorEnd, message, when, allowed("")).Status)
+}
+
+// sshSignedCommit adds a commit signed with the SSH key given on top
+// of master in the repo at the path given, and returns its revision.
+func sshSignedCommit(t *testing.T, repoPath string, signer ssh.Signer) string {
+	repo, err := gogit.PlainOpen(repoPath)
+	require.NoError(t, err)
+	head, err := repo.Reference(plumbing.NewBranchReferenceName("master"), true)
+	require.NoError(t, err)
+	parent, err := repo.CommitObject(head.Hash())
+	require.NoError(t, err)
+
+	sig := object.Signature{Name: "flux", Email: "flux@example.com", When: time.Now().Truncate(time.Second)}
+	commit := &object.Commit{
+		Author:       sig,
+		Committer:    sig,
+		Message:      "SSH signed\n",
+		TreeHash:     parent.TreeHash,
+		ParentHashes: []plumbing.Hash{parent.Hash},
+	}
+	unsigned := &plumbing.MemoryObject{}
+	require.NoError(t, commit.EncodeWithoutSignature(unsigned))
+	r, err := unsigned.Reader()
+	require.NoError(t, err)
+	message, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	commit.PGPSignature = sshSign(t, signer, "git", message)
+
+	encoded := repo.Storer.NewEncodedObject()
+	require.NoError(t, commit.Encode(encoded))
+	hash, err := repo.Storer.SetEncodedObject(encoded)
+	require.NoError(t, err)
+	require.NoError(t, repo.Storer.SetReference(plumbing.NewHashReference(head.Name(), hash)))
+	return hash.String()
+}
+
+func TestBackends_SSHSignatures(t *testing.T) {
+	for name, backend := range backends(t) {
+		if _, err := exec.LookPath("ssh-keygen"); err != nil && name == "exec" {
+			t.Log("no ssh-keygen executable found; skipping the exec backend")
+			continue
+		}
+		t.Run(name, func(t *testing.T) {
+			dir, cleanup := testfiles.TempDir(t)
+			defer cleanup()
+			upstream, _ := upstreamRepo(t, dir)
+			signer, other := newSSHSigner(t), newSSHSigner(t)
+			rev := sshSignedCommit(t, upstream, signer)
+
+			allowedSigners := filepath.Join(dir, "allowed_signers")
+			require.NoError(t, ioutil.WriteFile(allowedSigners, []byte(allowedSignerLine("flux@example.com", "", signer.PublicKey())+"\n"), 0600))
+
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			repo := NewRepo(Remote{URL: upstream}, Branch("master"), WithBackend(backend), WithAllowedSigners(allowedSigners))
+			require.NoError(t, repo.Ready(ctx))
+			defer repo.Clean()
+
+			assert.NoError(t, repo.VerifyCommit(ctx, rev))
+			commits, err := repo.CommitsBefore(ctx, rev, false)
+			require.NoError(t, err)
+			assert.Equal(t, Signature{
+				Key:       ssh.FingerprintSHA256(signer.PublicKey()),
+				KeyType:   KeyTypeSSH,
+				Principal: "flux@example.com",
+				Status:    "G",
+			}, commits[0].Signature)
+
+			// Since the file is read each time, replacing the key
+			// revokes trust in the commit.
+			require.NoError(t, ioutil.WriteFile(allowedSigners, []byte(allowedSignerLine("flux@example.com", "", other.PublicKey())+"\n"), 0600))
+			assert.Error(t, repo.VerifyCommit(ctx, rev))
+			commits, err = repo.CommitsBefore(ctx, rev, false)
+			require.NoError(t, err)
+			assert.Equal(t, "U", commits[0].Signature.Status)
+			assert.Equal(t, "", commits[0].Signature.Principal)
+		})
+	}
+}
+
+func TestBackends_SSHSigning(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("no ssh-keygen executable found")
+	}
+	for name, backend := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			dir, cleanup := testfiles.TempDir(t)
+			defer cleanup()
+			upstream, _ := upstreamRepo(t, dir)
+
+			// An RSA key, since both ssh-keygen and x/crypto/ssh can
+			// read PKCS#1 keys
+			key, err := rsa.GenerateKey(rand.Reader, 2048)
+			require.NoError(t, err)
+			keyPath := filepath.Join(dir, "identity")
+			require.NoError(t, ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0600))
+			signer, err := ssh.NewSignerFromKey(key)
+			require.NoError(t, err)
+			// ssh-keygen can't get the public key from a PEM private key
+			require.NoError(t, ioutil.WriteFile(keyPath+".pub", ssh.MarshalAuthorizedKey(signer.PublicKey()), 0600))
+			allowedSigners := filepath.Join(dir, "allowed_signers")
+			require.NoError(t, ioutil.WriteFile(allowedSigners, []byte(allowedSignerLine("flux@example.com", "", signer.PublicKey())+"\n"), 0600))
+
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			repo := NewRepo(Remote{URL: upstream}, Branch("master"), WithBackend(backend))
+			require.NoError(t, repo.Ready(ctx))
+			defer repo.Clean()
+
+			checkout, err := repo.Clone(ctx, Config{
+				Branch:        "master",
+				NotesRef:      "flux",
+				UserName:      "flux",
+				UserEmail:     "flux@example.com",
+				SigningKey:    keyPath,
+				SigningFormat: SigningFormatSSH,
+			})
+			require.NoError(t, err)
+			defer checkout.Clean()
+			require.NoError(t, ioutil.WriteFile(filepath.Join(checkout.Dir(), "dev", "app.yaml"), []byte("v3"), 0644))
+			require.NoError(t, checkout.CommitAndPush(ctx, CommitAction{Message: "Signed"}, nil, false))
+			head, err := checkout.HeadRevision(ctx)
+			require.NoError(t, err)
+			require.NoError(t, checkout.MoveTagAndPush(ctx, TagAction{Tag: "flux-sync", Revision: head, Message: "Sync pointer"}))
+
+			// Whichever backend signed, both should be able to verify
+			for verifierName, verifier := range backends(t) {
+				verifying := NewRepo(Remote{URL: upstream}, Branch("master"), WithBackend(verifier), WithAllowedSigners(allowedSigners))
+				require.NoError(t, verifying.Ready(ctx))
+				defer verifying.Clean()
+				assert.NoError(t, verifying.VerifyCommit(ctx, head), "verifying commit with %s", verifierName)
+				tagged, err := verifying.VerifyTag(ctx, "flux-sync")
+				assert.NoError(t, err, "verifying tag with %s", verifierName)
+				assert.Equal(t, head, tagged)
+			}
+		})
+	}
+}
@@ -14,17 +14,63 @@ type Remote struct {
 	URL string `json:"url"`
 }
 
+// SafeURL returns the URL with any credentials removed, so that it
+// can be logged or shown to users. With HTTP(S) URLs, the username is
+// removed as well, since a token is often given in its place.
 func (r Remote) SafeURL() string {
 	u, err := giturls.Parse(r.URL)
 	if err != nil {
 		return fmt.Sprintf("<unparseable: %s>", r.URL)
 	}
 	if u.User != nil {
-		u.User = url.User(u.User.Username())
+		switch u.Scheme {
+		case "http", "https":
+			u.User = nil
+		default:
+			u.User = url.User(u.User.Username())
+		}
 	}
 	return u.String()
 }
 
+// RedactError returns an error with any credentials from the URL
+// removed from its message; e.g., when git has included the URL in
+// its output. It can still be examined with `errors.Is` and
+// `errors.As`.
+func (r Remote) RedactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	u, parseErr := giturls.Parse(r.URL)
+	if parseErr != nil || u.User == nil {
+		return err
+	}
+	msg := strings.Replace(err.Error(), r.URL, r.SafeURL(), -1)
+	if password, ok := u.User.Password(); ok && password != "" {
+		msg = strings.Replace(msg, password, "<redacted>", -1)
+	} else if u.Scheme == "http" || u.Scheme == "https" {
+		// the username may be a token
+		msg = strings.Replace(msg, u.User.Username()+"@", "<redacted>@", -1)
+	}
+	if msg == err.Error() {
+		return err
+	}
+	return &redactedError{err: err, msg: msg}
+}
+
+type redactedError struct {
+	err error
+	msg string
+}
+
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
 // Equivalent compares the given URL with the remote URL without taking
 // protocols or `.git` suffixes into account.
 func (r Remote) Equivalent(u string) bool {
@@ -1,9 +1,12 @@
 package git
 
 import (
-	"github.com/stretchr/testify/assert"
+	"errors"
+	"fmt"
 	"strings"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestSafeURL(t *testing.T) {
@@ -12,6 +15,7 @@ func TestSafeURL(t *testing.T) {
 		"git@github.com:fluxcd/flux",
 		"https://user@example.com:5050/repo.git",
 		"https://user:" + password + "@example.com:5050/repo.git",
+		"https://" + password + "@example.com:5050/repo.git",
 	} {
 		u := Remote{url}
 		if strings.Contains(u.SafeURL(), password) {
@@ -20,6 +24,24 @@ func TestSafeURL(t *testing.T) {
 	}
 }
 
+func TestRedactError(t *testing.T) {
+	const password = "abc123"
+	for _, url := range []string{
+		"https://user:" + password + "@example.com/repo.git",
+		"https://" + password + "@example.com/repo.git",
+	} {
+		u := Remote{url}
+		err := u.RedactError(fmt.Errorf("pushing: %w", &gitError{
+			kind: ErrNonFastForward,
+			err:  fmt.Errorf("failed to push to '%s'", url),
+		}))
+		assert.NotContains(t, err.Error(), password)
+		assert.Contains(t, err.Error(), "example.com/repo.git")
+		assert.True(t, errors.Is(err, ErrNonFastForward))
+	}
+	assert.Nil(t, Remote{"https://example.com/repo.git"}.RedactError(nil))
+}
+
 func TestEquivalent(t *testing.T) {
 	urls := []struct {
 		remote     string
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 var (
@@ -22,6 +23,10 @@ type Config struct {
 	SigningKey  string
 	SetAuthor   bool
 	SkipMessage string
+
+	// SigningFormat is one of the SigningFormat constants; if empty,
+	// GPG is assumed
+	SigningFormat string
 }
 
 // Checkout is a local working clone of the remote repo. It is
@@ -31,28 +36,33 @@ type Checkout struct {
 	*Export
 	config       Config
 	upstream     Remote
+	credentials  Credentials
 	realNotesRef string // cache the notes ref, since we use it to push as well
 }
 
 type Commit struct {
 	Signature Signature
 	Revision  string
+	Author    string
+	Time      time.Time
 	Message   string
 }
 
 // CommitAction is a struct holding commit information
 type CommitAction struct {
-	Author     string
-	Message    string
-	SigningKey string
+	Author        string
+	Message       string
+	SigningKey    string
+	SigningFormat string
 }
 
 // TagAction is a struct holding tag parameters
 type TagAction struct {
-	Tag        string
-	Revision   string
-	Message    string
-	SigningKey string
+	Tag           string
+	Revision      string
+	Message       string
+	SigningKey    string
+	SigningFormat string
 }
 
 // Clone returns a local working clone of the sync'ed `*Repo`, using
@@ -67,14 +77,14 @@ func (r *Repo) Clone(ctx context.Context, conf Config) (*Checkout, error) {
 		return nil, err
 	}
 
-	if err := config(ctx, repoDir, conf.UserName, conf.UserEmail); err != nil {
+	if err := r.backend.Config(ctx, repoDir, conf.UserName, conf.UserEmail); err != nil {
 		os.RemoveAll(repoDir)
 		return nil, err
 	}
 
 	// We'll need the notes ref for pushing it, so make sure we have
 	// it. This assumes we're syncing it (otherwise we'll likely get conflicts)
-	realNotesRef, err := getNotesRef(ctx, repoDir, conf.NotesRef)
+	realNotesRef, err := r.backend.NotesRef(ctx, repoDir, conf.NotesRef)
 	if err != nil {
 		os.RemoveAll(repoDir)
 		return nil, err
@@ -88,12 +98,12 @@ func (r *Repo) Clone(ctx context.Context, conf Config) (*Checkout, error) {
 	//
 	// NB: do this before any other fetch actions, as otherwise we may
 	// get an 'existing tag clobber' error back.
-	if err := fetch(ctx, repoDir, r.dir, `'+refs/tags/*:refs/tags/*'`); err != nil {
+	if err := r.backend.Fetch(ctx, repoDir, r.dir, nil, `'+refs/tags/*:refs/tags/*'`); err != nil {
 		os.RemoveAll(repoDir)
 		r.mu.RUnlock()
 		return nil, err
 	}
-	if err := fetch(ctx, repoDir, r.dir, realNotesRef+":"+realNotesRef); err != nil {
+	if err := r.backend.Fetch(ctx, repoDir, r.dir, nil, realNotesRef+":"+realNotesRef); err != nil {
 		os.RemoveAll(repoDir)
 		r.mu.RUnlock()
 		return nil, err
@@ -101,8 +111,9 @@ func (r *Repo) Clone(ctx context.Context, conf Config) (*Checkout, error) {
 	r.mu.RUnlock()
 
 	return &Checkout{
-		Export:       &Export{dir: repoDir},
+		Export:       &Export{dir: repoDir, backend: r.backend},
 		upstream:     upstream,
+		credentials:  r.credentials,
 		realNotesRef: realNotesRef,
 		config:       conf,
 	}, nil
@@ -134,12 +145,12 @@ func (c *Checkout) AbsolutePaths() []string {
 // extra data as a note, and pushes the commit and note to the remote repo.
 func (c *Checkout) CommitAndPush(ctx context.Context, commitAction CommitAction, note interface{}, addUntracked bool) error {
 	if addUntracked {
-		if err := add(ctx, c.Dir(), "."); err != nil {
+		if err := c.backend.Add(ctx, c.Dir(), "."); err != nil {
 			return err
 		}
 	}
 
-	if !check(ctx, c.Dir(), c.config.Paths, addUntracked) {
+	if !c.backend.HasChanges(ctx, c.Dir(), c.config.Paths, addUntracked) {
 		return ErrNoChanges
 	}
 
@@ -147,8 +158,11 @@ func (c *Checkout) CommitAndPush(ctx context.Context, commitAction CommitAction,
 	if commitAction.SigningKey == "" {
 		commitAction.SigningKey = c.config.SigningKey
 	}
+	if commitAction.SigningFormat == "" {
+		commitAction.SigningFormat = c.config.SigningFormat
+	}
 
-	if err := commit(ctx, c.Dir(), commitAction); err != nil {
+	if err := c.backend.Commit(ctx, c.Dir(), commitAction); err != nil {
 		return err
 	}
 
@@ -157,40 +171,44 @@ func (c *Checkout) CommitAndPush(ctx context.Context, commitAction CommitAction,
 		if err != nil {
 			return err
 		}
-		if err := addNote(ctx, c.Dir(), rev, c.realNotesRef, note); err != nil {
+		if err := c.backend.AddNote(ctx, c.Dir(), rev, c.realNotesRef, note); err != nil {
 			return err
 		}
 	}
 
 	refs := []string{c.config.Branch}
-	ok, err := refExists(ctx, c.Dir(), c.realNotesRef)
+	ok, err := c.backend.RefExists(ctx, c.Dir(), c.realNotesRef)
 	if ok {
 		refs = append(refs, c.realNotesRef)
 	} else if err != nil {
 		return err
 	}
 
-	if err := push(ctx, c.Dir(), c.upstream.URL, refs); err != nil {
-		return PushError(c.upstream.URL, err)
+	if err := c.backend.Push(ctx, c.Dir(), c.upstream.URL, c.credentials, refs); err != nil {
+		return PushError(c.upstream.SafeURL(), c.upstream.RedactError(err))
 	}
 	return nil
 }
 
 func (c *Checkout) HeadRevision(ctx context.Context) (string, error) {
-	return refRevision(ctx, c.Dir(), "HEAD")
+	return c.backend.RefRevision(ctx, c.Dir(), "HEAD")
 }
 
 func (c *Checkout) MoveTagAndPush(ctx context.Context, tagAction TagAction) error {
 	if tagAction.SigningKey == "" {
 		tagAction.SigningKey = c.config.SigningKey
 	}
-	return moveTagAndPush(ctx, c.Dir(), c.upstream.URL, tagAction)
+	if tagAction.SigningFormat == "" {
+		tagAction.SigningFormat = c.config.SigningFormat
+	}
+	err := c.backend.MoveTagAndPush(ctx, c.Dir(), c.upstream.URL, c.credentials, tagAction)
+	return c.upstream.RedactError(err)
 }
 
 func (c *Checkout) Checkout(ctx context.Context, rev string) error {
-	return checkout(ctx, c.Dir(), rev)
+	return c.backend.Checkout(ctx, c.Dir(), rev)
 }
 
 func (c *Checkout) Add(ctx context.Context, path string) error {
-	return add(ctx, c.Dir(), path)
+	return c.backend.Add(ctx, c.Dir(), path)
 }
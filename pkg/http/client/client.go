@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/gorilla/mux"
@@ -15,6 +16,7 @@ import (
 	"github.com/fluxcd/flux/pkg/api"
 	"github.com/fluxcd/flux/pkg/api/v10"
 	"github.com/fluxcd/flux/pkg/api/v11"
+	"github.com/fluxcd/flux/pkg/api/v12"
 	"github.com/fluxcd/flux/pkg/api/v6"
 	"github.com/fluxcd/flux/pkg/api/v9"
 	fluxerr "github.com/fluxcd/flux/pkg/errors"
@@ -130,6 +132,24 @@ func (c *Client) GitRepoConfig(ctx context.Context, regenerate bool) (v6.GitConf
 	return res, err
 }
 
+func (c *Client) WorkloadHistory(ctx context.Context, opts v12.WorkloadHistoryOptions) (v12.WorkloadHistory, error) {
+	var res v12.WorkloadHistory
+	err := c.Get(ctx, &res, transport.WorkloadHistory, "workload", opts.Workload.String(), "before", opts.Before, "limit", strconv.Itoa(opts.Limit))
+	return res, err
+}
+
+func (c *Client) DriftStatus(ctx context.Context) (v12.DriftStatus, error) {
+	var res v12.DriftStatus
+	err := c.Get(ctx, &res, transport.DriftStatus)
+	return res, err
+}
+
+func (c *Client) Rollback(ctx context.Context, opts v12.RollbackOptions) (job.ID, error) {
+	var res job.ID
+	err := c.methodWithResp(ctx, "POST", &res, transport.Rollback, opts)
+	return res, err
+}
+
 // --- Request helpers
 
 // Post is a simple query-param only post request
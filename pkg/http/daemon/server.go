@@ -3,6 +3,7 @@ package daemon
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/gorilla/mux"
@@ -12,6 +13,7 @@ import (
 	"github.com/fluxcd/flux/pkg/api"
 	"github.com/fluxcd/flux/pkg/api/v10"
 	"github.com/fluxcd/flux/pkg/api/v11"
+	"github.com/fluxcd/flux/pkg/api/v12"
 	"github.com/fluxcd/flux/pkg/api/v9"
 	transport "github.com/fluxcd/flux/pkg/http"
 	"github.com/fluxcd/flux/pkg/job"
@@ -65,6 +67,11 @@ func NewHandler(s api.Server, r *mux.Router) http.Handler {
 	r.Get(transport.Export).HandlerFunc(handle.Export)
 	r.Get(transport.GitRepoConfig).HandlerFunc(handle.GitRepoConfig)
 
+	// v12 handlers
+	r.Get(transport.WorkloadHistory).HandlerFunc(handle.WorkloadHistory)
+	r.Get(transport.DriftStatus).HandlerFunc(handle.DriftStatus)
+	r.Get(transport.Rollback).HandlerFunc(handle.Rollback)
+
 	// These handlers persist to support requests from older fluxctls. In general we
 	// should avoid adding references to them so that they can eventually be removed.
 	r.Get(transport.UpdateImages).HandlerFunc(handle.UpdateImages)
@@ -231,6 +238,56 @@ func (s HTTPServer) GitRepoConfig(w http.ResponseWriter, r *http.Request) {
 	transport.JSONResponse(w, r, res)
 }
 
+func (s HTTPServer) WorkloadHistory(w http.ResponseWriter, r *http.Request) {
+	var opts v12.WorkloadHistoryOptions
+	workload := mux.Vars(r)["workload"]
+	id, err := resource.ParseID(workload)
+	if err != nil {
+		transport.WriteError(w, r, http.StatusBadRequest, errors.Wrapf(err, "parsing workload %q", workload))
+		return
+	}
+	opts.Workload = id
+	opts.Before = r.URL.Query().Get("before")
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		opts.Limit, err = strconv.Atoi(limit)
+		if err != nil {
+			transport.WriteError(w, r, http.StatusBadRequest, errors.Wrapf(err, "parsing limit %q", limit))
+			return
+		}
+	}
+
+	res, err := s.server.WorkloadHistory(r.Context(), opts)
+	if err != nil {
+		transport.ErrorResponse(w, r, err)
+		return
+	}
+	transport.JSONResponse(w, r, res)
+}
+
+func (s HTTPServer) DriftStatus(w http.ResponseWriter, r *http.Request) {
+	res, err := s.server.DriftStatus(r.Context())
+	if err != nil {
+		transport.ErrorResponse(w, r, err)
+		return
+	}
+	transport.JSONResponse(w, r, res)
+}
+
+func (s HTTPServer) Rollback(w http.ResponseWriter, r *http.Request) {
+	var opts v12.RollbackOptions
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		transport.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	jobID, err := s.server.Rollback(r.Context(), opts)
+	if err != nil {
+		transport.ErrorResponse(w, r, err)
+		return
+	}
+	transport.JSONResponse(w, r, jobID)
+}
+
 // --- handlers supporting deprecated requests
 
 func (s HTTPServer) UpdateImages(w http.ResponseWriter, r *http.Request) {
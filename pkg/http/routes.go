@@ -15,6 +15,9 @@ const (
 	SyncStatus              = "SyncStatus"
 	Export                  = "Export"
 	GitRepoConfig           = "GitRepoConfig"
+	WorkloadHistory         = "WorkloadHistory"
+	DriftStatus             = "DriftStatus"
+	Rollback                = "Rollback"
 
 	UpdateImages           = "UpdateImages"
 	UpdatePolicies         = "UpdatePolicies"
@@ -43,6 +43,9 @@ func NewAPIRouter() *mux.Router {
 	r.NewRoute().Name(SyncStatus).Methods("GET").Path("/v6/sync").Queries("ref", "{ref}")
 	r.NewRoute().Name(Export).Methods("HEAD", "GET").Path("/v6/export")
 	r.NewRoute().Name(GitRepoConfig).Methods("POST").Path("/v9/git-repo-config")
+	r.NewRoute().Name(WorkloadHistory).Methods("GET").Path("/v12/history").Queries("workload", "{workload}")
+	r.NewRoute().Name(DriftStatus).Methods("GET").Path("/v12/drift")
+	r.NewRoute().Name(Rollback).Methods("POST").Path("/v12/rollback")
 
 	// These routes persist to support requests from older fluxctls. In general we
 	// should avoid adding references to them so that they can eventually be removed.
@@ -0,0 +1,15 @@
+package webhook
+
+import (
+	"github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	webhookRequests = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "flux",
+		Subsystem: "webhook",
+		Name:      "requests_total",
+		Help:      "Number of webhook requests received, by provider and response status.",
+	}, []string{"provider", "status"})
+)
@@ -0,0 +1,348 @@
+// Package webhook receives push events from git hosts, so that fluxd
+// can fetch new commits as soon as they are pushed, rather than
+// waiting for the next poll.
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/fluxcd/flux/pkg/api/v9"
+)
+
+// Payloads bigger than this are refused; GitHub caps its payloads at
+// 25MB, and a push big enough to get near that will be truncated
+// anyway.
+const maxPayloadSize = 25 << 20
+
+// Notifier is told when a relevant push has happened; the API server
+// satisfies this, so that with leader election, the notification is
+// forwarded to the leader, which is the replica that syncs.
+type Notifier interface {
+	NotifyChange(ctx context.Context, change v9.Change) error
+}
+
+// Receiver is an http.Handler for push webhooks from GitHub, GitLab,
+// Bitbucket (Cloud and Server) and Gitea. It checks each request is
+// signed with (or, for GitLab, carries) the shared secret, then
+// notifies if the push was to the branch given and touched any of the
+// paths given.
+type Receiver struct {
+	Notifier Notifier
+	Secret   []byte
+	Branch   string
+	// URL is the git URL of the repo, passed on in the notification.
+	URL string
+	// Paths within the repo that fluxd cares about; if empty, a push
+	// to any path is relevant.
+	Paths  []string
+	Logger log.Logger
+}
+
+// push is what's common to the push payloads of all the providers.
+type push struct {
+	// branches pushed to, without the `refs/heads/` prefix
+	branches []string
+	// files added, modified or removed; only meaningful if
+	// filesKnown is true, since some providers don't include them,
+	// or truncate them for big pushes.
+	files      []string
+	filesKnown bool
+}
+
+type provider struct {
+	name string
+	// eventHeader names the header saying which event was sent
+	eventHeader string
+	// isPush says whether the event is a push, given the header value
+	isPush func(event string) bool
+	verify func(r *http.Request, body, secret []byte) bool
+	parse  func(body []byte) (push, error)
+}
+
+// providers is in the order in which to try them; Gitea sends
+// GitHub's headers as well as its own, so must come before GitHub.
+var providers = []provider{
+	{
+		name:        "gitea",
+		eventHeader: "X-Gitea-Event",
+		isPush:      equals("push"),
+		verify:      hmacHeader("X-Gitea-Signature", "", sha256.New),
+		parse:       parseGitHub,
+	},
+	{
+		name:        "github",
+		eventHeader: "X-GitHub-Event",
+		isPush:      equals("push"),
+		verify: func(r *http.Request, body, secret []byte) bool {
+			if r.Header.Get("X-Hub-Signature-256") != "" {
+				return hmacHeader("X-Hub-Signature-256", "sha256=", sha256.New)(r, body, secret)
+			}
+			return hmacHeader("X-Hub-Signature", "sha1=", sha1.New)(r, body, secret)
+		},
+		parse: parseGitHub,
+	},
+	{
+		name:        "gitlab",
+		eventHeader: "X-Gitlab-Event",
+		isPush:      equals("Push Hook"),
+		verify: func(r *http.Request, _, secret []byte) bool {
+			return subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Gitlab-Token")), secret) == 1
+		},
+		parse: parseGitLab,
+	},
+	{
+		name:        "bitbucket",
+		eventHeader: "X-Event-Key",
+		// repo:push is from Bitbucket Cloud, repo:refs_changed from
+		// Bitbucket Server
+		isPush: func(event string) bool { return event == "repo:push" || event == "repo:refs_changed" },
+		verify: hmacHeader("X-Hub-Signature", "sha256=", sha256.New),
+		parse:  parseBitbucket,
+	},
+}
+
+func equals(want string) func(string) bool {
+	return func(got string) bool { return got == want }
+}
+
+// hmacHeader verifies a request by checking the header given holds
+// the hex-encoded HMAC of the body, after the prefix given.
+func hmacHeader(header, prefix string, h func() hash.Hash) func(*http.Request, []byte, []byte) bool {
+	return func(r *http.Request, body, secret []byte) bool {
+		sig := r.Header.Get(header)
+		if !strings.HasPrefix(sig, prefix) {
+			return false
+		}
+		got, err := hex.DecodeString(strings.TrimPrefix(sig, prefix))
+		if err != nil {
+			return false
+		}
+		mac := hmac.New(h, secret)
+		mac.Write(body)
+		return hmac.Equal(got, mac.Sum(nil))
+	}
+}
+
+func (rcv *Receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var p *provider
+	for i := range providers {
+		if r.Header.Get(providers[i].eventHeader) != "" {
+			p = &providers[i]
+			break
+		}
+	}
+	if p == nil {
+		rcv.respond(w, "unknown", http.StatusBadRequest, "unrecognised webhook; expected one from GitHub, GitLab, Bitbucket or Gitea")
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxPayloadSize))
+	if err != nil {
+		rcv.respond(w, p.name, http.StatusBadRequest, "reading payload: "+err.Error())
+		return
+	}
+	if len(rcv.Secret) == 0 || !p.verify(r, body, rcv.Secret) {
+		rcv.respond(w, p.name, http.StatusUnauthorized, "signature or token does not match")
+		return
+	}
+
+	event := r.Header.Get(p.eventHeader)
+	if !p.isPush(event) {
+		// e.g., the ping GitHub sends when a webhook is created
+		rcv.respond(w, p.name, http.StatusOK, fmt.Sprintf("ignored %q event", event))
+		return
+	}
+
+	pushed, err := p.parse(body)
+	if err != nil {
+		rcv.respond(w, p.name, http.StatusBadRequest, "parsing payload: "+err.Error())
+		return
+	}
+	if !rcv.branchMatches(pushed) {
+		rcv.respond(w, p.name, http.StatusOK, fmt.Sprintf("ignored push to %s; not branch %s", strings.Join(pushed.branches, ", "), rcv.Branch))
+		return
+	}
+	if !rcv.pathsMatch(pushed) {
+		rcv.respond(w, p.name, http.StatusOK, "ignored push; no changes under "+strings.Join(rcv.Paths, ", "))
+		return
+	}
+
+	change := v9.Change{
+		Kind:   v9.GitChange,
+		Source: v9.GitUpdate{URL: rcv.URL, Branch: rcv.Branch},
+	}
+	if err := rcv.Notifier.NotifyChange(r.Context(), change); err != nil {
+		rcv.respond(w, p.name, http.StatusServiceUnavailable, "notifying of push: "+err.Error())
+		return
+	}
+	rcv.respond(w, p.name, http.StatusAccepted, "refreshing git repo")
+}
+
+func (rcv *Receiver) respond(w http.ResponseWriter, provider string, status int, msg string) {
+	webhookRequests.With("provider", provider, "status", fmt.Sprint(status)).Add(1)
+	if rcv.Logger != nil {
+		rcv.Logger.Log("provider", provider, "status", status, "msg", msg)
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	fmt.Fprintln(w, msg)
+}
+
+func (rcv *Receiver) branchMatches(p push) bool {
+	for _, b := range p.branches {
+		if b == rcv.Branch {
+			return true
+		}
+	}
+	return false
+}
+
+func (rcv *Receiver) pathsMatch(p push) bool {
+	if len(rcv.Paths) == 0 || !p.filesKnown {
+		return true
+	}
+	for _, f := range p.files {
+		for _, dir := range rcv.Paths {
+			dir = path.Clean(strings.Trim(dir, "/"))
+			if dir == "." || f == dir || strings.HasPrefix(f, dir+"/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func branchFromRef(ref string) (string, bool) {
+	if !strings.HasPrefix(ref, "refs/heads/") {
+		return "", false
+	}
+	return strings.TrimPrefix(ref, "refs/heads/"), true
+}
+
+type commitFiles struct {
+	Added    []string `json:"added"`
+	Modified []string `json:"modified"`
+	Removed  []string `json:"removed"`
+}
+
+// filesOf collects the files changed by the commits given. The files
+// are only known if each commit lists them (older versions of Gitea
+// don't), and if the payload has all the commits in the push.
+func filesOf(commits []commitFiles, complete bool) ([]string, bool) {
+	if !complete || len(commits) == 0 {
+		return nil, false
+	}
+	var files []string
+	for _, c := range commits {
+		if c.Added == nil && c.Modified == nil && c.Removed == nil {
+			return nil, false
+		}
+		files = append(files, c.Added...)
+		files = append(files, c.Modified...)
+		files = append(files, c.Removed...)
+	}
+	return files, true
+}
+
+// GitHub only includes the first 20 commits of a push.
+const githubMaxCommits = 20
+
+func parseGitHub(body []byte) (push, error) {
+	var payload struct {
+		Ref     string        `json:"ref"`
+		Deleted bool          `json:"deleted"`
+		Commits []commitFiles `json:"commits"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return push{}, err
+	}
+	var p push
+	if branch, ok := branchFromRef(payload.Ref); ok {
+		p.branches = []string{branch}
+	}
+	// A deleted branch, or a force-push, may have no commits listed
+	// and still matter.
+	if !payload.Deleted && len(payload.Commits) < githubMaxCommits {
+		p.files, p.filesKnown = filesOf(payload.Commits, true)
+	}
+	return p, nil
+}
+
+func parseGitLab(body []byte) (push, error) {
+	var payload struct {
+		Ref          string        `json:"ref"`
+		TotalCommits int           `json:"total_commits_count"`
+		Commits      []commitFiles `json:"commits"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return push{}, err
+	}
+	var p push
+	if branch, ok := branchFromRef(payload.Ref); ok {
+		p.branches = []string{branch}
+	}
+	p.files, p.filesKnown = filesOf(payload.Commits, payload.TotalCommits == len(payload.Commits))
+	return p, nil
+}
+
+// Neither flavour of Bitbucket says which files were changed, so any
+// push to the branch counts.
+func parseBitbucket(body []byte) (push, error) {
+	var payload struct {
+		// Bitbucket Cloud
+		Push struct {
+			Changes []struct {
+				New *struct {
+					Type string `json:"type"`
+					Name string `json:"name"`
+				} `json:"new"`
+				Old *struct {
+					Type string `json:"type"`
+					Name string `json:"name"`
+				} `json:"old"`
+			} `json:"changes"`
+		} `json:"push"`
+		// Bitbucket Server
+		Changes []struct {
+			RefID string `json:"refId"`
+		} `json:"changes"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return push{}, err
+	}
+	var p push
+	for _, c := range payload.Push.Changes {
+		// a deleted branch has only old, a new branch only new
+		switch {
+		case c.New != nil && c.New.Type == "branch":
+			p.branches = append(p.branches, c.New.Name)
+		case c.Old != nil && c.Old.Type == "branch":
+			p.branches = append(p.branches, c.Old.Name)
+		}
+	}
+	for _, c := range payload.Changes {
+		if branch, ok := branchFromRef(c.RefID); ok {
+			p.branches = append(p.branches, branch)
+		}
+	}
+	return p, nil
+}
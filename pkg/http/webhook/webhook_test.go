@@ -0,0 +1,189 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fluxcd/flux/pkg/api/v9"
+)
+
+const secret = "s3cr3t"
+
+type notifier struct {
+	count  int
+	change v9.Change
+	err    error
+}
+
+func (n *notifier) NotifyChange(_ context.Context, change v9.Change) error {
+	n.count++
+	n.change = change
+	return n.err
+}
+
+func sign(h func() hash.Hash, body string) string {
+	mac := hmac.New(h, []byte(secret))
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+const (
+	githubPush = `{"ref":"refs/heads/master","commits":[{"added":[],"modified":["deploy/app.yaml"],"removed":[]}]}`
+	gitlabPush = `{"ref":"refs/heads/master","total_commits_count":1,"commits":[{"added":["docs/README.md"],"modified":[],"removed":[]}]}`
+	cloudPush  = `{"push":{"changes":[{"new":{"type":"branch","name":"master"},"old":{"type":"branch","name":"master"}}]}}`
+	serverPush = `{"changes":[{"refId":"refs/heads/dev","type":"UPDATE"}]}`
+)
+
+func TestReceiver(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		headers map[string]string
+		body    string
+		status  int
+	}{
+		{
+			name:    "github push",
+			headers: map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": "sha256=" + sign(sha256.New, githubPush)},
+			body:    githubPush,
+			status:  http.StatusAccepted,
+		},
+		{
+			name:    "github push with sha1 signature",
+			headers: map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature": "sha1=" + sign(sha1.New, githubPush)},
+			body:    githubPush,
+			status:  http.StatusAccepted,
+		},
+		{
+			name:    "github bad signature",
+			headers: map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": "sha256=" + sign(sha256.New, "something else")},
+			body:    githubPush,
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:    "github unsigned",
+			headers: map[string]string{"X-GitHub-Event": "push"},
+			body:    githubPush,
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:    "github ping",
+			headers: map[string]string{"X-GitHub-Event": "ping", "X-Hub-Signature-256": "sha256=" + sign(sha256.New, "{}")},
+			body:    "{}",
+			status:  http.StatusOK,
+		},
+		{
+			name:    "gitea push",
+			headers: map[string]string{"X-Gitea-Event": "push", "X-GitHub-Event": "push", "X-Gitea-Signature": sign(sha256.New, githubPush)},
+			body:    githubPush,
+			status:  http.StatusAccepted,
+		},
+		{
+			name:    "gitlab push outside paths",
+			headers: map[string]string{"X-Gitlab-Event": "Push Hook", "X-Gitlab-Token": secret},
+			body:    gitlabPush,
+			status:  http.StatusOK,
+		},
+		{
+			name:    "gitlab bad token",
+			headers: map[string]string{"X-Gitlab-Event": "Push Hook", "X-Gitlab-Token": "wrong"},
+			body:    gitlabPush,
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:    "bitbucket cloud push",
+			headers: map[string]string{"X-Event-Key": "repo:push", "X-Hub-Signature": "sha256=" + sign(sha256.New, cloudPush)},
+			body:    cloudPush,
+			status:  http.StatusAccepted,
+		},
+		{
+			name:    "bitbucket server push to other branch",
+			headers: map[string]string{"X-Event-Key": "repo:refs_changed", "X-Hub-Signature": "sha256=" + sign(sha256.New, serverPush)},
+			body:    serverPush,
+			status:  http.StatusOK,
+		},
+		{
+			name:   "unknown provider",
+			body:   githubPush,
+			status: http.StatusBadRequest,
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			n := &notifier{}
+			rcv := &Receiver{Notifier: n, Secret: []byte(secret), Branch: "master", Paths: []string{"deploy/"}}
+			req := httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(c.body))
+			for k, v := range c.headers {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			rcv.ServeHTTP(w, req)
+			assert.Equal(t, c.status, w.Code, w.Body.String())
+			if c.status == http.StatusAccepted {
+				assert.Equal(t, 1, n.count)
+			} else {
+				assert.Equal(t, 0, n.count)
+			}
+		})
+	}
+}
+
+func TestReceiver_NotifyChange(t *testing.T) {
+	n := &notifier{}
+	rcv := &Receiver{Notifier: n, Secret: []byte(secret), URL: "git@github.com:org/repo", Branch: "master"}
+	post := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(githubPush))
+		req.Header.Set("X-GitHub-Event", "push")
+		req.Header.Set("X-Hub-Signature-256", "sha256="+sign(sha256.New, githubPush))
+		w := httptest.NewRecorder()
+		rcv.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusAccepted, post())
+	assert.Equal(t, v9.Change{
+		Kind:   v9.GitChange,
+		Source: v9.GitUpdate{URL: "git@github.com:org/repo", Branch: "master"},
+	}, n.change)
+
+	// e.g., when the leader can't be reached to forward the
+	// notification to, the git host is told it failed
+	n.err = errors.New("no leader has been elected")
+	assert.Equal(t, http.StatusServiceUnavailable, post())
+}
+
+func TestReceiver_Paths(t *testing.T) {
+	for _, c := range []struct {
+		paths []string
+		push  push
+		want  bool
+	}{
+		{nil, push{files: []string{"anything"}, filesKnown: true}, true},
+		{[]string{"deploy"}, push{files: []string{"deploy/app.yaml"}, filesKnown: true}, true},
+		{[]string{"deploy"}, push{files: []string{"deployment/app.yaml"}, filesKnown: true}, false},
+		{[]string{"deploy", "base"}, push{files: []string{"base"}, filesKnown: true}, true},
+		{[]string{"./"}, push{files: []string{"app.yaml"}, filesKnown: true}, true},
+		// when the files aren't known, assume the push is relevant
+		{[]string{"deploy"}, push{}, true},
+	} {
+		rcv := &Receiver{Paths: c.paths}
+		assert.Equal(t, c.want, rcv.pathsMatch(c.push), "paths %v, files %v", c.paths, c.push.files)
+	}
+}
+
+func TestParseGitHub_Truncated(t *testing.T) {
+	body := `{"ref":"refs/heads/master","commits":[` + strings.TrimSuffix(strings.Repeat(`{"added":[],"modified":["a"],"removed":[]},`, githubMaxCommits), ",") + `]}`
+	p, err := parseGitHub([]byte(body))
+	assert.NoError(t, err)
+	assert.False(t, p.filesKnown)
+	assert.Equal(t, []string{"master"}, p.branches)
+}
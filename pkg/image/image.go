@@ -325,6 +325,9 @@ type Info struct {
 	CreatedAt time.Time `json:",omitempty"`
 	// the last time this image manifest was fetched
 	LastFetched time.Time `json:",omitempty"`
+	// the first time the image pointed at was fetched, i.e., roughly
+	// when it was pushed, if the registry has been scanned since
+	FirstSeen time.Time `json:",omitempty"`
 }
 
 // MarshalJSON returns the Info value in JSON (as bytes). It is
@@ -333,18 +336,22 @@ type Info struct {
 // detect.
 func (im Info) MarshalJSON() ([]byte, error) {
 	type InfoAlias Info // alias to shed existing MarshalJSON implementation
-	var ca, lf string
+	var ca, lf, fs string
 	if !im.CreatedAt.IsZero() {
 		ca = im.CreatedAt.UTC().Format(time.RFC3339Nano)
 	}
 	if !im.LastFetched.IsZero() {
 		lf = im.LastFetched.UTC().Format(time.RFC3339Nano)
 	}
+	if !im.FirstSeen.IsZero() {
+		fs = im.FirstSeen.UTC().Format(time.RFC3339Nano)
+	}
 	encode := struct {
 		InfoAlias
 		CreatedAt   string `json:",omitempty"`
 		LastFetched string `json:",omitempty"`
-	}{InfoAlias(im), ca, lf}
+		FirstSeen   string `json:",omitempty"`
+	}{InfoAlias(im), ca, lf, fs}
 	return json.Marshal(encode)
 }
 
@@ -356,13 +363,16 @@ func (im *Info) UnmarshalJSON(b []byte) error {
 		InfoAlias
 		CreatedAt   string `json:",omitempty"`
 		LastFetched string `json:",omitempty"`
+		FirstSeen   string `json:",omitempty"`
 	}{}
 	json.Unmarshal(b, &unencode)
 	*im = Info(unencode.InfoAlias)
 
 	var err error
 	if err = decodeTime(unencode.CreatedAt, &im.CreatedAt); err == nil {
-		err = decodeTime(unencode.LastFetched, &im.LastFetched)
+		if err = decodeTime(unencode.LastFetched, &im.LastFetched); err == nil {
+			err = decodeTime(unencode.FirstSeen, &im.FirstSeen)
+		}
 	}
 	return err
 }
@@ -427,10 +437,13 @@ func NewerByCreated(lhs, rhs *Info) bool {
 }
 
 // NewerBySemver returns true if lhs image should be sorted
-// before rhs with regard to their semver order descending.
+// before rhs with regard to their semver order descending. Build
+// metadata has no bearing on precedence, so images whose versions
+// differ only in their build metadata are ordered by when they were
+// created.
 func NewerBySemver(lhs, rhs *Info) bool {
-	lv, lerr := semver.NewVersion(lhs.ID.Tag)
-	rv, rerr := semver.NewVersion(rhs.ID.Tag)
+	lv, lerr := ParseSemver(lhs.ID.Tag)
+	rv, rerr := ParseSemver(rhs.ID.Tag)
 	if (lerr != nil && rerr != nil) || (lv == rv) {
 		return lhs.ID.String() < rhs.ID.String()
 	}
@@ -441,6 +454,9 @@ func NewerBySemver(lhs, rhs *Info) bool {
 		return true
 	}
 	cmp := lv.Compare(rv)
+	if cmp == 0 && lv.Metadata() != rv.Metadata() && !lhs.CreatedAt.Equal(rhs.CreatedAt) {
+		return lhs.CreatedAt.After(rhs.CreatedAt)
+	}
 	// In semver, `1.10` and `1.10.0` is the same but in favor of explicitness
 	// we should consider the latter newer.
 	if cmp == 0 {
@@ -449,6 +465,15 @@ func NewerBySemver(lhs, rhs *Info) bool {
 	return cmp > 0
 }
 
+// ParseSemver parses the version in a tag, which may have a `v` or
+// `V` prefix.
+func ParseSemver(tag string) (*semver.Version, error) {
+	if strings.HasPrefix(tag, "V") {
+		tag = "v" + tag[1:]
+	}
+	return semver.NewVersion(tag)
+}
+
 // Sort orders the given image infos according to `newer` func.
 func Sort(infos []Info, newer func(a, b *Info) bool) {
 	if newer == nil {
@@ -208,6 +208,7 @@ func TestImageInfoSerialisation(t *testing.T) {
 	info.Digest = "sha256:digest"
 	info.ImageID = "sha256:layerID"
 	info.LastFetched = t1
+	info.FirstSeen = t0.Add(time.Minute)
 	bytes, err := json.Marshal(info)
 	if err != nil {
 		t.Fatal(err)
@@ -0,0 +1,246 @@
+// Package leader lets several replicas of fluxd run at once, by
+// electing one of them, using a Lease in the cluster, to do the work
+// that must only be done once: syncing, running jobs, and scanning
+// image registries. The others serve read-only API calls themselves
+// and forward the rest to the leader.
+package leader
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const (
+	DefaultLeaseDuration = 15 * time.Second
+	DefaultRenewDeadline = 10 * time.Second
+	DefaultRetryPeriod   = 2 * time.Second
+)
+
+// Config says which Lease to use, and how this replica identifies
+// itself when holding it.
+type Config struct {
+	Namespace string
+	LeaseName string
+	// ID names this replica, e.g., with its pod name.
+	ID string
+	// Address is the host:port at which other replicas can reach
+	// this replica's API, so they can forward calls to it when it's
+	// the leader.
+	Address string
+
+	LeaseDuration time.Duration
+	RenewDeadline time.Duration
+	RetryPeriod   time.Duration
+}
+
+// holderIdentity is what's recorded in the Lease: the ID, so people
+// can see which replica leads, and the address, so the other
+// replicas can reach it.
+func (c Config) holderIdentity() string {
+	return c.ID + "@" + c.Address
+}
+
+func addressOf(identity string) (string, bool) {
+	i := strings.LastIndex(identity, "@")
+	if i < 0 || i == len(identity)-1 {
+		return "", false
+	}
+	return identity[i+1:], true
+}
+
+// Elector campaigns for, and keeps track of, the leadership.
+type Elector struct {
+	config  Config
+	elector *leaderelection.LeaderElector
+	logger  log.Logger
+
+	lead func(stop <-chan struct{}, wg *sync.WaitGroup)
+	lost func()
+
+	mu       sync.RWMutex
+	leader   string
+	leading  bool
+	stopped  bool
+	stop     chan struct{}
+	leaderWg sync.WaitGroup
+	// shuttingDown is set when Run is told to shut down, so that
+	// giving up the lease then isn't taken as losing it.
+	shuttingDown bool
+}
+
+func NewElector(client kubernetes.Interface, config Config, logger log.Logger) (*Elector, error) {
+	if config.ID == "" || config.Address == "" {
+		return nil, fmt.Errorf("leader election needs an ID and an address for this replica")
+	}
+	if strings.Contains(config.Address, "@") {
+		return nil, fmt.Errorf("address %q for leader election must not contain '@'", config.Address)
+	}
+	if config.LeaseDuration == 0 {
+		config.LeaseDuration = DefaultLeaseDuration
+	}
+	if config.RenewDeadline == 0 {
+		config.RenewDeadline = DefaultRenewDeadline
+	}
+	if config.RetryPeriod == 0 {
+		config.RetryPeriod = DefaultRetryPeriod
+	}
+
+	e := &Elector{
+		config: config,
+		logger: logger,
+		stop:   make(chan struct{}),
+	}
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta: metav1.ObjectMeta{
+				Namespace: config.Namespace,
+				Name:      config.LeaseName,
+			},
+			Client: client.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{
+				Identity: config.holderIdentity(),
+			},
+		},
+		LeaseDuration: config.LeaseDuration,
+		RenewDeadline: config.RenewDeadline,
+		RetryPeriod:   config.RetryPeriod,
+		// Give up the lease when shutting down, so another replica
+		// can take over straight away rather than waiting for it to
+		// expire.
+		ReleaseOnCancel: true,
+		Name:            config.LeaseName,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: e.startedLeading,
+			OnStoppedLeading: e.stoppedLeading,
+			OnNewLeader:      e.newLeader,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	e.elector = elector
+	return e, nil
+}
+
+// Run campaigns for the leadership until shutdown is closed. When
+// this replica becomes the leader, lead is called; it should start
+// whatever only the leader does, stopping it when stop is closed, and
+// register it with the WaitGroup it is given. The lease is not
+// released until all of that has finished, so that the next leader
+// does not overlap with this one.
+//
+// If the leadership is lost other than by shutting down, lost is
+// called straight away, without waiting for what lead started to
+// finish, since another replica may already hold the lease. It's
+// expected to exit the process (which will be restarted as a
+// follower), so that a sync or job in flight doesn't overlap with
+// the new leader's.
+func (e *Elector) Run(shutdown <-chan struct{}, wg *sync.WaitGroup, lead func(stop <-chan struct{}, wg *sync.WaitGroup), lost func()) {
+	defer wg.Done()
+	e.lead, e.lost = lead, lost
+	leading.Set(0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-shutdown:
+			e.mu.Lock()
+			e.shuttingDown = true
+			e.mu.Unlock()
+		case <-ctx.Done():
+		}
+		e.stopLeading()
+		e.leaderWg.Wait()
+		cancel()
+	}()
+
+	e.logger.Log("info", "campaigning for leadership", "lease", e.config.Namespace+"/"+e.config.LeaseName, "identity", e.config.holderIdentity())
+	e.elector.Run(ctx)
+}
+
+// IsLeader says whether this replica currently holds the leadership.
+func (e *Elector) IsLeader() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.leading && !e.stopped
+}
+
+// LeaderAddress returns the address of the leader's API, or false if
+// no leader is known.
+func (e *Elector) LeaderAddress() (string, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return addressOf(e.leader)
+}
+
+func (e *Elector) startedLeading(context.Context) {
+	e.mu.Lock()
+	if e.stopped {
+		e.mu.Unlock()
+		return
+	}
+	e.leading = true
+	e.leaderWg.Add(1)
+	e.mu.Unlock()
+	defer e.leaderWg.Done()
+
+	leading.Set(1)
+	e.logger.Log("info", "became the leader")
+	if e.lead != nil {
+		e.lead(e.stop, &e.leaderWg)
+	}
+}
+
+func (e *Elector) stoppedLeading() {
+	e.mu.RLock()
+	wasLeading, shuttingDown := e.leading, e.shuttingDown
+	e.mu.RUnlock()
+	if wasLeading && !shuttingDown {
+		// The lease couldn't be renewed, so another replica may hold
+		// it already; don't wait for the work in flight to finish.
+		e.stopLeading()
+		leading.Set(0)
+		e.logger.Log("warning", "lost the leadership")
+		if e.lost != nil {
+			e.lost()
+		}
+		return
+	}
+	e.stopLeading()
+	e.leaderWg.Wait()
+	leading.Set(0)
+	if wasLeading {
+		e.logger.Log("info", "stopped leading")
+	}
+}
+
+// stopLeading closes the channel given to lead, once. It's done with
+// the lock held, so that startedLeading either sees it's closed, or
+// adds to the WaitGroup before anyone waits on it.
+func (e *Elector) stopLeading() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.stopped {
+		e.stopped = true
+		close(e.stop)
+	}
+}
+
+func (e *Elector) newLeader(identity string) {
+	e.mu.Lock()
+	e.leader = identity
+	e.mu.Unlock()
+	if identity != e.config.holderIdentity() {
+		e.logger.Log("info", "new leader", "identity", identity)
+	}
+}
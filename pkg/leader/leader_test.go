@@ -0,0 +1,224 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/fluxcd/flux/pkg/api"
+	fluxerr "github.com/fluxcd/flux/pkg/errors"
+	daemonhttp "github.com/fluxcd/flux/pkg/http/daemon"
+	"github.com/fluxcd/flux/pkg/job"
+	"github.com/fluxcd/flux/pkg/remote"
+	"github.com/fluxcd/flux/pkg/update"
+)
+
+func testElector(t *testing.T, client *fake.Clientset, id string) *Elector {
+	e, err := NewElector(client, Config{
+		Namespace:     "flux",
+		LeaseName:     "flux-leader",
+		ID:            id,
+		Address:       id + ":3030",
+		LeaseDuration: time.Second,
+		RenewDeadline: 500 * time.Millisecond,
+		RetryPeriod:   100 * time.Millisecond,
+	}, log.NewNopLogger())
+	require.NoError(t, err)
+	return e
+}
+
+func TestElector_Failover(t *testing.T) {
+	client := fake.NewSimpleClientset()
+
+	// counts the replicas doing the leader's work, which should
+	// never be more than one
+	var active, overlapped int32
+	lead := func(stop <-chan struct{}, wg *sync.WaitGroup) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if atomic.AddInt32(&active, 1) > 1 {
+				atomic.StoreInt32(&overlapped, 1)
+			}
+			<-stop
+			// take a while to finish, as a sync might
+			time.Sleep(200 * time.Millisecond)
+			atomic.AddInt32(&active, -1)
+		}()
+	}
+	lost := func() {
+		t.Error("leadership lost other than by shutting down")
+	}
+
+	first, second := testElector(t, client, "first"), testElector(t, client, "second")
+	shutdownFirst, shutdownSecond := make(chan struct{}), make(chan struct{})
+	firstWg, secondWg := &sync.WaitGroup{}, &sync.WaitGroup{}
+	firstWg.Add(1)
+	go first.Run(shutdownFirst, firstWg, lead, lost)
+	assert.Eventually(t, first.IsLeader, 5*time.Second, 10*time.Millisecond)
+
+	secondWg.Add(1)
+	go second.Run(shutdownSecond, secondWg, lead, lost)
+	assert.Eventually(t, func() bool {
+		address, ok := second.LeaderAddress()
+		return ok && address == "first:3030"
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.False(t, second.IsLeader())
+
+	// the lease is released on shutdown, so the second takes over
+	// well before it would have expired
+	close(shutdownFirst)
+	firstWg.Wait()
+	assert.False(t, first.IsLeader())
+	assert.Eventually(t, second.IsLeader, 500*time.Millisecond, 10*time.Millisecond)
+	address, _ := second.LeaderAddress()
+	assert.Equal(t, "second:3030", address)
+
+	close(shutdownSecond)
+	secondWg.Wait()
+	assert.Equal(t, int32(0), atomic.LoadInt32(&active))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&overlapped), "expected only one replica to lead at a time")
+}
+
+func TestElector_Lost(t *testing.T) {
+	client := fake.NewSimpleClientset()
+
+	var active int32
+	finish := make(chan struct{})
+	lead := func(stop <-chan struct{}, wg *sync.WaitGroup) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			atomic.AddInt32(&active, 1)
+			<-stop
+			// a sync in flight, which isn't waited for
+			<-finish
+			atomic.AddInt32(&active, -1)
+		}()
+	}
+	lost := make(chan int32, 1)
+	var unavailable int32
+	client.PrependReactor("update", "leases", func(k8stesting.Action) (bool, runtime.Object, error) {
+		if atomic.LoadInt32(&unavailable) == 1 {
+			return true, nil, errors.New("API server unavailable")
+		}
+		return false, nil, nil
+	})
+
+	e := testElector(t, client, "first")
+	shutdown := make(chan struct{})
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go e.Run(shutdown, wg, lead, func() {
+		lost <- atomic.LoadInt32(&active)
+	})
+	assert.Eventually(t, e.IsLeader, 5*time.Second, 10*time.Millisecond)
+
+	// the lease can no longer be renewed
+	atomic.StoreInt32(&unavailable, 1)
+	select {
+	case stillActive := <-lost:
+		assert.Equal(t, int32(1), stillActive, "expected lost to be called without waiting for the leader's work")
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the leadership to be lost")
+	}
+	assert.False(t, e.IsLeader())
+
+	close(finish)
+	close(shutdown)
+	wg.Wait()
+}
+
+func TestNewElector_Address(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	_, err := NewElector(client, Config{Namespace: "flux", LeaseName: "flux-leader", ID: "flux"}, log.NewNopLogger())
+	assert.Error(t, err)
+	_, err = NewElector(client, Config{Namespace: "flux", LeaseName: "flux-leader", ID: "flux", Address: "user@host:3030"}, log.NewNopLogger())
+	assert.Error(t, err)
+}
+
+type fixedLeadership struct {
+	leader  bool
+	address string
+}
+
+func (l fixedLeadership) IsLeader() bool {
+	return l.leader
+}
+
+func (l fixedLeadership) LeaderAddress() (string, bool) {
+	return l.address, l.address != ""
+}
+
+// serve serves the API as fluxd does, returning its address.
+func serve(s api.Server) (string, func()) {
+	mux := http.NewServeMux()
+	mux.Handle("/api/flux/", http.StripPrefix("/api/flux", Handler(daemonhttp.NewHandler(s, daemonhttp.NewRouter()))))
+	server := httptest.NewServer(mux)
+	return strings.TrimPrefix(server.URL, "http://"), server.Close
+}
+
+func TestServer(t *testing.T) {
+	local := &remote.MockServer{
+		UpdateManifestsAnswer: job.ID("local"),
+		ExportAnswer:          []byte("local"),
+	}
+	leader := &remote.MockServer{
+		UpdateManifestsAnswer: job.ID("leader"),
+		ExportAnswer:          []byte("leader"),
+	}
+	leaderAddress, closeLeader := serve(leader)
+	defer closeLeader()
+
+	s := NewServer(local, nil, time.Second)
+	ctx := context.Background()
+	spec := update.Spec{Type: update.Sync, Spec: update.ManualSync{}}
+
+	// a follower forwards calls that need the leader
+	s.leadership = fixedLeadership{address: leaderAddress}
+	id, err := s.UpdateManifests(ctx, spec)
+	require.NoError(t, err)
+	assert.Equal(t, job.ID("leader"), id)
+	exported, err := s.Export(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "local", string(exported))
+
+	// the leader serves them itself
+	s.leadership = fixedLeadership{leader: true, address: "elsewhere:3030"}
+	id, err = s.UpdateManifests(ctx, spec)
+	require.NoError(t, err)
+	assert.Equal(t, job.ID("local"), id)
+
+	// with no leader, they fail
+	s.leadership = fixedLeadership{}
+	_, err = s.UpdateManifests(ctx, spec)
+	if assert.Error(t, err) {
+		assert.Equal(t, fluxerr.Server, err.(*fluxerr.Error).Type)
+	}
+	_, err = s.Export(ctx)
+	assert.NoError(t, err)
+
+	// calls that have been forwarded once are not forwarded again
+	follower := NewServer(&remote.MockServer{}, nil, time.Second)
+	follower.leadership = fixedLeadership{address: "elsewhere:3030"}
+	followerAddress, closeFollower := serve(follower)
+	defer closeFollower()
+	s.leadership = fixedLeadership{address: followerAddress}
+	_, err = s.UpdateManifests(ctx, spec)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "not the leader")
+	}
+}
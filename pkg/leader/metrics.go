@@ -0,0 +1,24 @@
+package leader
+
+import (
+	"github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+
+	fluxmetrics "github.com/fluxcd/flux/pkg/metrics"
+)
+
+var (
+	leading = prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+		Namespace: "flux",
+		Subsystem: "leader_election",
+		Name:      "leader",
+		Help:      "1 if this replica is the leader, 0 otherwise.",
+	}, []string{})
+
+	forwardedRequests = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "flux",
+		Subsystem: "leader_election",
+		Name:      "forwarded_requests_total",
+		Help:      "Number of API calls forwarded to the leader.",
+	}, []string{fluxmetrics.LabelMethod, fluxmetrics.LabelSuccess})
+)
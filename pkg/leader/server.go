@@ -0,0 +1,238 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/fluxcd/flux/pkg/api"
+	"github.com/fluxcd/flux/pkg/api/v10"
+	"github.com/fluxcd/flux/pkg/api/v11"
+	"github.com/fluxcd/flux/pkg/api/v12"
+	"github.com/fluxcd/flux/pkg/api/v6"
+	"github.com/fluxcd/flux/pkg/api/v9"
+	fluxerr "github.com/fluxcd/flux/pkg/errors"
+	transport "github.com/fluxcd/flux/pkg/http"
+	"github.com/fluxcd/flux/pkg/http/client"
+	"github.com/fluxcd/flux/pkg/job"
+	fluxmetrics "github.com/fluxcd/flux/pkg/metrics"
+	"github.com/fluxcd/flux/pkg/update"
+)
+
+// forwardedHeader marks a request as having been forwarded by another
+// replica, so it's not forwarded again if the replicas disagree about
+// who is the leader.
+const forwardedHeader = "X-Flux-Forwarded"
+
+type forwardedKey struct{}
+
+type leadership interface {
+	IsLeader() bool
+	LeaderAddress() (string, bool)
+}
+
+var _ api.Server = &Server{}
+
+// Server serves the API calls that only read from the cluster or the
+// image registry itself, and forwards the others to the leader (or
+// serves them itself, if this replica is the leader).
+type Server struct {
+	local      api.Server
+	leadership leadership
+	dial       func(address string) api.Server
+
+	mu     sync.Mutex
+	remote map[string]api.Server
+}
+
+// NewServer wraps the daemon given as local. Calls forwarded to the
+// leader time out after the given duration.
+func NewServer(local api.Server, e *Elector, timeout time.Duration) *Server {
+	httpClient := &http.Client{
+		Timeout:   timeout,
+		Transport: forwardingTransport{http.DefaultTransport},
+	}
+	return &Server{
+		local:      local,
+		leadership: e,
+		dial: func(address string) api.Server {
+			return client.New(httpClient, transport.NewAPIRouter(), "http://"+address+"/api/flux", "")
+		},
+		remote: map[string]api.Server{},
+	}
+}
+
+// Handler marks requests that have been forwarded by another replica,
+// so that they are served here or refused, but not forwarded again.
+func Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(forwardedHeader) != "" {
+			r = r.WithContext(context.WithValue(r.Context(), forwardedKey{}, true))
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+type forwardingTransport struct {
+	http.RoundTripper
+}
+
+func (t forwardingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set(forwardedHeader, "true")
+	return t.RoundTripper.RoundTrip(r)
+}
+
+func notLeaderError(err error) error {
+	return &fluxerr.Error{
+		Type: fluxerr.Server,
+		Err:  err,
+		Help: `This call has to be served by the leader of the fluxd replicas, and
+there isn't one at the moment. This usually means the leader has just
+stopped, and another will take over shortly; try again in a few seconds.
+`,
+	}
+}
+
+// leader returns the server to serve a call that must go to the
+// leader, and a func to call with its outcome.
+func (s *Server) leader(ctx context.Context, method string) (api.Server, func(error), error) {
+	if s.leadership.IsLeader() {
+		return s.local, func(error) {}, nil
+	}
+	done := func(err error) {
+		forwardedRequests.With(
+			fluxmetrics.LabelMethod, method,
+			fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+		).Add(1)
+	}
+	if forwarded, _ := ctx.Value(forwardedKey{}).(bool); forwarded {
+		err := notLeaderError(errors.New("call was forwarded to a replica that is not the leader"))
+		done(err)
+		return nil, nil, err
+	}
+	address, ok := s.leadership.LeaderAddress()
+	if !ok {
+		err := notLeaderError(errors.New("no leader has been elected"))
+		done(err)
+		return nil, nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	remote, ok := s.remote[address]
+	if !ok {
+		// only the current leader is worth keeping a client for
+		s.remote = map[string]api.Server{}
+		remote = s.dial(address)
+		s.remote[address] = remote
+	}
+	return remote, done, nil
+}
+
+// Served by any replica
+
+func (s *Server) Ping(ctx context.Context) error {
+	return s.local.Ping(ctx)
+}
+
+func (s *Server) Version(ctx context.Context) (string, error) {
+	return s.local.Version(ctx)
+}
+
+func (s *Server) Export(ctx context.Context) ([]byte, error) {
+	return s.local.Export(ctx)
+}
+
+func (s *Server) ListServices(ctx context.Context, namespace string) ([]v6.ControllerStatus, error) {
+	return s.local.ListServices(ctx, namespace)
+}
+
+func (s *Server) ListServicesWithOptions(ctx context.Context, opts v11.ListServicesOptions) ([]v6.ControllerStatus, error) {
+	return s.local.ListServicesWithOptions(ctx, opts)
+}
+
+func (s *Server) ListImages(ctx context.Context, spec update.ResourceSpec) ([]v6.ImageStatus, error) {
+	return s.local.ListImages(ctx, spec)
+}
+
+func (s *Server) ListImagesWithOptions(ctx context.Context, opts v10.ListImagesOptions) ([]v6.ImageStatus, error) {
+	return s.local.ListImagesWithOptions(ctx, opts)
+}
+
+// Served by the leader
+
+func (s *Server) UpdateManifests(ctx context.Context, spec update.Spec) (_ job.ID, err error) {
+	server, done, err := s.leader(ctx, "UpdateManifests")
+	if err != nil {
+		return "", err
+	}
+	defer func() { done(err) }()
+	return server.UpdateManifests(ctx, spec)
+}
+
+func (s *Server) NotifyChange(ctx context.Context, change v9.Change) (err error) {
+	server, done, err := s.leader(ctx, "NotifyChange")
+	if err != nil {
+		return err
+	}
+	defer func() { done(err) }()
+	return server.NotifyChange(ctx, change)
+}
+
+func (s *Server) JobStatus(ctx context.Context, id job.ID) (_ job.Status, err error) {
+	server, done, err := s.leader(ctx, "JobStatus")
+	if err != nil {
+		return job.Status{}, err
+	}
+	defer func() { done(err) }()
+	return server.JobStatus(ctx, id)
+}
+
+func (s *Server) SyncStatus(ctx context.Context, ref string) (_ []string, err error) {
+	server, done, err := s.leader(ctx, "SyncStatus")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { done(err) }()
+	return server.SyncStatus(ctx, ref)
+}
+
+func (s *Server) GitRepoConfig(ctx context.Context, regenerate bool) (_ v6.GitConfig, err error) {
+	server, done, err := s.leader(ctx, "GitRepoConfig")
+	if err != nil {
+		return v6.GitConfig{}, err
+	}
+	defer func() { done(err) }()
+	return server.GitRepoConfig(ctx, regenerate)
+}
+
+func (s *Server) WorkloadHistory(ctx context.Context, opts v12.WorkloadHistoryOptions) (_ v12.WorkloadHistory, err error) {
+	server, done, err := s.leader(ctx, "WorkloadHistory")
+	if err != nil {
+		return v12.WorkloadHistory{}, err
+	}
+	defer func() { done(err) }()
+	return server.WorkloadHistory(ctx, opts)
+}
+
+func (s *Server) DriftStatus(ctx context.Context) (_ v12.DriftStatus, err error) {
+	server, done, err := s.leader(ctx, "DriftStatus")
+	if err != nil {
+		return v12.DriftStatus{}, err
+	}
+	defer func() { done(err) }()
+	return server.DriftStatus(ctx)
+}
+
+func (s *Server) Rollback(ctx context.Context, opts v12.RollbackOptions) (_ job.ID, err error) {
+	server, done, err := s.leader(ctx, "Rollback")
+	if err != nil {
+		return "", err
+	}
+	defer func() { done(err) }()
+	return server.Rollback(ctx, opts)
+}
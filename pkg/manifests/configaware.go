@@ -168,6 +168,18 @@ func (ca *configAware) UpdateWorkloadPolicies(ctx context.Context, resourceID re
 	if !ok {
 		return false, ErrResourceNotFound(resourceID.String())
 	}
+	resources := make(map[string]resource.Resource, len(resourcesByID))
+	for id, r := range resourcesByID {
+		resources[id] = r.resource
+	}
+	repoPolicies, err := ReadRepoPolicies(ca.baseDir)
+	if err != nil {
+		return false, err
+	}
+	update, err = overrideInherited(resources, repoPolicies, resourceID, update)
+	if err != nil {
+		return false, err
+	}
 	var changed bool
 	if resWithOrigin.configFile == nil {
 		changed, err = ca.rawFiles.updateManifestWorkloadPolicies(resWithOrigin.resource, update)
@@ -192,7 +204,11 @@ func (ca *configAware) GetAllResourcesByID(ctx context.Context) (map[string]reso
 	for id, resourceWithOrigin := range resourcesByID {
 		result[id] = resourceWithOrigin.resource
 	}
-	return result, nil
+	repoPolicies, err := ReadRepoPolicies(ca.baseDir)
+	if err != nil {
+		return nil, err
+	}
+	return inheritPolicies(result, repoPolicies), nil
 }
 
 func (ca *configAware) getResourcesByID(ctx context.Context) (map[string]resourceWithOrigin, error) {
@@ -206,7 +222,7 @@ func (ca *configAware) getResourcesByID(ctx context.Context) (map[string]resourc
 
 	resourcesByID := map[string]resourceWithOrigin{}
 
-	rawResourcesByID, err := ca.rawFiles.GetAllResourcesByID(ctx)
+	rawResourcesByID, err := ca.rawFiles.loadResources()
 	if err != nil {
 		return nil, err
 	}
@@ -17,6 +17,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/fluxcd/flux/pkg/image"
+	"github.com/fluxcd/flux/pkg/policy"
 	"github.com/fluxcd/flux/pkg/resource"
 )
 
@@ -36,11 +37,17 @@ definitions:
       timeout: { type: string }
     additionalProperties: false
   version: { const: 1 }
+  policies:
+    type: object
+    propertyNames:
+      pattern: '^(automated|locked|locked_user|locked_msg|tag_all|tag\..+|reject)$'
+    additionalProperties: { type: string }
 type: object
 oneOf:
 - required: ['version', 'commandUpdated']
   properties:
     version: { '$ref': '#/definitions/version' }
+    policies: { '$ref': '#/definitions/policies' }
     commandUpdated:
       required: ['generators']
       properties:
@@ -58,6 +65,7 @@ oneOf:
 - required: ['version', 'patchUpdated']
   properties:
     version: { '$ref': '#/definitions/version' }
+    policies: { '$ref': '#/definitions/policies' }
     patchUpdated:
       required: ['generators', 'patchFile']
       properties:
@@ -69,9 +77,15 @@ oneOf:
 - required: ['version', 'scanForFiles']
   properties:
     version: { '$ref': '#/definitions/version' }
+    policies: { '$ref': '#/definitions/policies' }
     scanForFiles:
       additionalProperties: false
   additionalProperties: false
+- required: ['version', 'policies']
+  properties:
+    version: { '$ref': '#/definitions/version' }
+    policies: { '$ref': '#/definitions/policies' }
+  additionalProperties: false
 `
 
 func mustCompileConfigSchema() *jsonschema.Schema {
@@ -102,6 +116,10 @@ type ConfigFile struct {
 	PatchUpdated   *PatchUpdated   `json:"patchUpdated,omitempty"`
 	ScanForFiles   *ScanForFiles   `json:"scanForFiles,omitempty"`
 
+	// Policies are inherited by all the workloads in the repo, when
+	// given in the .flux.yaml at its top; see inheritPolicies.
+	Policies policy.Set `json:"policies,omitempty"`
+
 	// These are supplied, and can't be calculated from each other
 	configPath         string // the absolute path to the .flux.yaml
 	workingDir         string // the absolute path to the dir in which to run commands or find a patch file
@@ -154,9 +172,10 @@ type ScanForFiles struct {
 // directory should be treated as containing YAML files (i.e., should
 // act as though there was no config file in operation). This can be
 // used to reset the directive given by a .flux.yaml higher in the
-// directory structure.
+// directory structure. A config file that only gives policies is
+// treated the same way.
 func (cf *ConfigFile) IsScanForFiles() bool {
-	return cf.ScanForFiles != nil
+	return cf.ScanForFiles != nil || (cf.CommandUpdated == nil && cf.PatchUpdated == nil)
 }
 
 func ParseConfigFile(fileBytes []byte, result *ConfigFile) error {
@@ -0,0 +1,283 @@
+package manifests
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/ghodss/yaml"
+	yamlv3 "gopkg.in/yaml.v3"
+
+	"github.com/fluxcd/flux/pkg/policy"
+	"github.com/fluxcd/flux/pkg/resource"
+)
+
+// inheritable says whether a policy given on a namespace, or in the
+// .flux.yaml at the top of the repo, is passed on to workloads.
+// Policies that are about how a resource is synced (e.g., ignore,
+// prune) are not; they apply only to the resource they're given on.
+func inheritable(p policy.Policy) bool {
+	switch p {
+	case policy.Automated, policy.Locked, policy.LockedUser, policy.LockedMsg, policy.TagAll, policy.Reject:
+		return true
+	}
+	return policy.Tag(p)
+}
+
+// ReadRepoPolicies returns the policies given in the .flux.yaml at
+// the top of the repo, if there is one. Only the `policies` section
+// is looked at: the file is read whether or not manifest generation
+// is enabled, and when it's not, the rest of the file was never
+// checked, so needn't be valid.
+func ReadRepoPolicies(baseDir string) (policy.Set, error) {
+	bytes, err := ioutil.ReadFile(filepath.Join(baseDir, ConfigFilename))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cf struct {
+		Policies policy.Set `json:"policies"`
+	}
+	if err := yaml.Unmarshal(bytes, &cf); err != nil {
+		return nil, fmt.Errorf("cannot parse policies in %s: %s", ConfigFilename, err)
+	}
+	return cf.Policies, nil
+}
+
+// SetRepoPolicy sets a policy in the .flux.yaml at the top of the
+// repo, creating the file if there isn't one; or, given an empty
+// value, removes the policy. The rest of the file, including comments,
+// is left as it was. If the file would be left with only its version,
+// it's removed.
+func SetRepoPolicy(baseDir string, p policy.Policy, value string) error {
+	path := filepath.Join(baseDir, ConfigFilename)
+	original, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		if value == "" {
+			return nil
+		}
+		original = []byte("version: 1\n")
+	} else if err != nil {
+		return err
+	}
+
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(original, &doc); err != nil {
+		return fmt.Errorf("cannot parse %s: %s", ConfigFilename, err)
+	}
+	if len(doc.Content) != 1 || doc.Content[0].Kind != yamlv3.MappingNode {
+		return fmt.Errorf("%s is not a mapping", ConfigFilename)
+	}
+	root := doc.Content[0]
+
+	policies := mappingValue(root, "policies")
+	if policies == nil {
+		if value == "" {
+			return nil
+		}
+		policies = &yamlv3.Node{Kind: yamlv3.MappingNode, Tag: "!!map"}
+		root.Content = append(root.Content, &yamlv3.Node{Kind: yamlv3.ScalarNode, Value: "policies"}, policies)
+	}
+	if value == "" {
+		removeMappingKey(policies, string(p))
+	} else if v := mappingValue(policies, string(p)); v != nil {
+		v.Kind, v.Tag, v.Style, v.Value = yamlv3.ScalarNode, "!!str", 0, value
+	} else {
+		policies.Content = append(policies.Content,
+			&yamlv3.Node{Kind: yamlv3.ScalarNode, Value: string(p)},
+			&yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: "!!str", Value: value})
+	}
+	if len(policies.Content) == 0 {
+		removeMappingKey(root, "policies")
+		if len(root.Content) == 2 && root.Content[0].Value == "version" {
+			return os.Remove(path)
+		}
+	}
+
+	var buf bytes.Buffer
+	enc := yamlv3.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	var cf ConfigFile
+	if err := ParseConfigFile(buf.Bytes(), &cf); err != nil {
+		return fmt.Errorf("%s would not be valid: %s", ConfigFilename, err)
+	}
+	return ioutil.WriteFile(path, buf.Bytes(), 0666)
+}
+
+// mappingValue returns the value for the key given in a YAML mapping,
+// or nil if it's not there.
+func mappingValue(mapping *yamlv3.Node, key string) *yamlv3.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func removeMappingKey(mapping *yamlv3.Node, key string) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+			return
+		}
+	}
+}
+
+type policyLayer struct {
+	policies policy.Set
+	source   string
+}
+
+// inheritPolicies gives each workload the policies of the namespace
+// it's in, if that's among the resources, and those given in the
+// .flux.yaml at the top of the repo. A workload's own policies take
+// precedence over its namespace's, which take precedence over the
+// repo's. Since the containers of a workload can't be known
+// elsewhere, `tag_all` is how a namespace or the repo gives a tag
+// filter for every container.
+func inheritPolicies(resources map[string]resource.Resource, repoPolicies policy.Set) map[string]resource.Resource {
+	namespaces := namespacesIn(resources)
+	if len(namespaces) == 0 && len(repoPolicies) == 0 {
+		return resources
+	}
+
+	result := make(map[string]resource.Resource, len(resources))
+	for id, res := range resources {
+		workload, ok := res.(resource.Workload)
+		if !ok {
+			result[id] = res
+			continue
+		}
+		result[id] = inherit(workload, policyLayers(workload, namespaces, repoPolicies))
+	}
+	return result
+}
+
+func namespacesIn(resources map[string]resource.Resource) map[string]resource.Resource {
+	namespaces := map[string]resource.Resource{}
+	for _, res := range resources {
+		if _, kind, name := res.ResourceID().Components(); kind == "namespace" {
+			namespaces[name] = res
+		}
+	}
+	return namespaces
+}
+
+// policyLayers gives the layers of policies a workload inherits, from
+// the repo's and then its namespace's.
+func policyLayers(workload resource.Workload, namespaces map[string]resource.Resource, repoPolicies policy.Set) []policyLayer {
+	layers := []policyLayer{{repoPolicies, ConfigFilename}}
+	ns, _, _ := workload.ResourceID().Components()
+	if nsRes, ok := namespaces[ns]; ok {
+		layers = append(layers, policyLayer{nsRes.Policies(), nsRes.ResourceID().String()})
+	}
+	return layers
+}
+
+// inherit applies the layers of policies given, each overriding the
+// last, then the workload's own. The exception is `reject`, for which
+// the images rejected by each layer are added together.
+func inherit(workload resource.Workload, layers []policyLayer) resource.Resource {
+	policies, sources := layered(workload, layers)
+	for p, v := range workload.Policies() {
+		if _, ok := sources[p]; ok && p == policy.Reject {
+			policies[p] = policy.AddRejected(policies[p], policy.SplitRejected(v)...)
+			continue
+		}
+		policies[p] = v
+		delete(sources, p)
+	}
+	if len(sources) == 0 {
+		return workload
+	}
+	return &inheritingWorkload{Workload: workload, policies: policies, sources: sources}
+}
+
+// layered gives the policies a workload gets from the layers given,
+// leaving aside its own, and which layer each came from.
+func layered(workload resource.Workload, layers []policyLayer) (policy.Set, map[policy.Policy]string) {
+	policies := policy.Set{}
+	sources := map[policy.Policy]string{}
+	for _, layer := range layers {
+		if pattern, ok := layer.policies.Get(policy.TagAll); ok {
+			for _, c := range workload.Containers() {
+				policies[policy.TagPrefix(c.Name)] = pattern
+				sources[policy.TagPrefix(c.Name)] = layer.source
+			}
+		}
+		for p, v := range layer.policies {
+			if p == policy.TagAll || !inheritable(p) {
+				continue
+			}
+			if p == policy.Reject {
+				v = policy.AddRejected(policies[p], policy.SplitRejected(v)...)
+			}
+			policies[p] = v
+			sources[p] = layer.source
+		}
+	}
+	return policies, sources
+}
+
+// overrideInherited adjusts an update to the policies of a workload
+// so that removing a policy it would still inherit has an effect.
+// Removing `automated` or `locked` sets it to "false" on the workload
+// instead; removing any other such policy is an error, since there's
+// no value that turns it off.
+func overrideInherited(resources map[string]resource.Resource, repoPolicies policy.Set, id resource.ID, update resource.PolicyUpdate) (resource.PolicyUpdate, error) {
+	workload, ok := resources[id.String()].(resource.Workload)
+	if !ok || len(update.Remove) == 0 {
+		return update, nil
+	}
+	inherited, sources := layered(workload, policyLayers(workload, namespacesIn(resources), repoPolicies))
+	result := resource.PolicyUpdate{Add: update.Add, Remove: policy.Set{}}
+	for p, v := range update.Remove {
+		source, ok := sources[p]
+		switch {
+		case !ok:
+			result.Remove[p] = v
+		case policy.Boolean(p):
+			if inherited.Has(p) {
+				result.Add = result.Add.Set(p, "false")
+			} else {
+				result.Remove[p] = v
+			}
+		case p == policy.LockedUser || p == policy.LockedMsg:
+			// these only say who locked the workload and why, so can
+			// be left as they are
+			result.Remove[p] = v
+		default:
+			return update, fmt.Errorf("policy %s of %s is inherited from %s, so cannot be removed from the workload", p, id, source)
+		}
+	}
+	return result, nil
+}
+
+// inheritingWorkload is a workload with policies inherited from
+// elsewhere, as well as its own.
+type inheritingWorkload struct {
+	resource.Workload
+	policies policy.Set
+	sources  map[policy.Policy]string
+}
+
+var _ resource.InheritedPolicies = &inheritingWorkload{}
+
+func (w *inheritingWorkload) Policies() policy.Set {
+	return w.policies
+}
+
+func (w *inheritingWorkload) PolicySources() map[policy.Policy]string {
+	return w.sources
+}
@@ -0,0 +1,334 @@
+package manifests
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fluxcd/flux/pkg/cluster/kubernetes"
+	kresource "github.com/fluxcd/flux/pkg/cluster/kubernetes/resource"
+	"github.com/fluxcd/flux/pkg/cluster/kubernetes/testfiles"
+	"github.com/fluxcd/flux/pkg/policy"
+	"github.com/fluxcd/flux/pkg/resource"
+)
+
+const policiesNamespace = `---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: team-a
+  annotations:
+    fluxcd.io/automated: "true"
+    fluxcd.io/tag_all: semver:~1
+    fluxcd.io/ignore: "true"
+`
+
+const policiesWorkloads = `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: inherits
+  namespace: team-a
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        image: app:1.0.0
+      - name: sidecar
+        image: sidecar:1.0.0
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: overrides
+  namespace: team-a
+  annotations:
+    fluxcd.io/automated: "false"
+    fluxcd.io/tag.app: glob:master-*
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        image: app:master-abc
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: elsewhere
+  namespace: team-b
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        image: app:1.0.0
+`
+
+const policiesFluxYAML = `version: 1
+policies:
+  locked: "true"
+  locked_msg: frozen
+  tag_all: glob:*
+`
+
+// manifestNamespacer takes the namespace from the manifest, as the
+// namespacer used by fluxd would for the manifests here.
+type manifestNamespacer struct{}
+
+func (manifestNamespacer) EffectiveNamespace(m kresource.KubeManifest, _ kubernetes.ResourceScopes) (string, error) {
+	if m.GetKind() == "Namespace" {
+		return kresource.ClusterScope, nil
+	}
+	return m.GetNamespace(), nil
+}
+
+func writeFile(t *testing.T, path, content string) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0777))
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+}
+
+func TestInheritPolicies(t *testing.T) {
+	baseDir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+	writeFile(t, filepath.Join(baseDir, "namespace.yaml"), policiesNamespace)
+	writeFile(t, filepath.Join(baseDir, "workloads.yaml"), policiesWorkloads)
+
+	manifests := kubernetes.NewManifests(manifestNamespacer{}, log.NewNopLogger())
+	store := NewRawFiles(baseDir, []string{baseDir}, manifests)
+
+	nsID := resource.MakeID(kresource.ClusterScope, "Namespace", "team-a").String()
+	inheritsID := resource.MakeID("team-a", "Deployment", "inherits").String()
+	overridesID := resource.MakeID("team-a", "Deployment", "overrides").String()
+	elsewhereID := resource.MakeID("team-b", "Deployment", "elsewhere").String()
+
+	resources, err := store.GetAllResourcesByID(context.Background())
+	require.NoError(t, err)
+
+	// from the namespace, with tag_all given for each container,
+	// and ignore not inherited
+	inherits := resources[inheritsID]
+	assert.Equal(t, policy.Set{
+		policy.Automated:            "true",
+		policy.TagPrefix("app"):     "semver:~1",
+		policy.TagPrefix("sidecar"): "semver:~1",
+	}, inherits.Policies())
+	assert.Equal(t, map[policy.Policy]string{
+		policy.Automated:            nsID,
+		policy.TagPrefix("app"):     nsID,
+		policy.TagPrefix("sidecar"): nsID,
+	}, inherits.(resource.InheritedPolicies).PolicySources())
+	_, ok := inherits.(resource.Workload)
+	assert.True(t, ok, "expected a resource with inherited policies to still be a workload")
+
+	// the workload's own annotations override the namespace's
+	overrides := resources[overridesID]
+	assert.Equal(t, policy.Set{
+		policy.Automated:        "false",
+		policy.TagPrefix("app"): "glob:master-*",
+	}, overrides.Policies())
+	_, ok = overrides.(resource.InheritedPolicies)
+	assert.False(t, ok, "expected a workload with only its own policies to be returned as is")
+
+	// with no namespace manifest, nothing is inherited
+	assert.Empty(t, resources[elsewhereID].Policies())
+
+	// the repo's .flux.yaml gives policies to every workload, with
+	// the namespace's taking precedence
+	writeFile(t, filepath.Join(baseDir, ConfigFilename), policiesFluxYAML)
+	resources, err = store.GetAllResourcesByID(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, policy.Set{
+		policy.Automated:            "true",
+		policy.Locked:               "true",
+		policy.LockedMsg:            "frozen",
+		policy.TagPrefix("app"):     "semver:~1",
+		policy.TagPrefix("sidecar"): "semver:~1",
+	}, resources[inheritsID].Policies())
+	assert.Equal(t, policy.Set{
+		policy.Locked:           "true",
+		policy.LockedMsg:        "frozen",
+		policy.TagPrefix("app"): "glob:*",
+	}, resources[elsewhereID].Policies())
+	assert.Equal(t, ConfigFilename, resources[elsewhereID].(resource.InheritedPolicies).PolicySources()[policy.Locked])
+
+	// the same goes when the .flux.yaml is used to find manifests
+	ca, err := NewConfigAware(baseDir, []string{baseDir}, manifests, 0)
+	require.NoError(t, err)
+	resources, err = ca.GetAllResourcesByID(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "frozen", resources[inheritsID].Policies()[policy.LockedMsg])
+}
+
+func TestUpdateWorkloadPolicies_Inherited(t *testing.T) {
+	baseDir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+	writeFile(t, filepath.Join(baseDir, "namespace.yaml"), policiesNamespace)
+	writeFile(t, filepath.Join(baseDir, "workloads.yaml"), policiesWorkloads)
+	writeFile(t, filepath.Join(baseDir, ConfigFilename), policiesFluxYAML)
+
+	manifests := kubernetes.NewManifests(manifestNamespacer{}, log.NewNopLogger())
+	store := NewRawFiles(baseDir, []string{baseDir}, manifests)
+	ctx := context.Background()
+
+	nsID := resource.MakeID(kresource.ClusterScope, "Namespace", "team-a")
+	inheritsID := resource.MakeID("team-a", "Deployment", "inherits")
+	elsewhereID := resource.MakeID("team-b", "Deployment", "elsewhere")
+
+	// removing an inherited automated or locked policy overrides it
+	// on the workload
+	changed, err := store.UpdateWorkloadPolicies(ctx, inheritsID, resource.PolicyUpdate{Remove: policy.Set{}.Add(policy.Automated)})
+	require.NoError(t, err)
+	assert.True(t, changed)
+	unlock := resource.PolicyUpdate{Remove: policy.Set{}.Add(policy.Locked, policy.LockedMsg, policy.LockedUser)}
+	changed, err = store.UpdateWorkloadPolicies(ctx, elsewhereID, unlock)
+	require.NoError(t, err)
+	assert.True(t, changed)
+
+	resources, err := store.GetAllResourcesByID(ctx)
+	require.NoError(t, err)
+	inherits := resources[inheritsID.String()]
+	assert.False(t, inherits.Policies().Has(policy.Automated))
+	assert.NotContains(t, inherits.(resource.InheritedPolicies).PolicySources(), policy.Automated)
+	assert.False(t, resources[elsewhereID.String()].Policies().Has(policy.Locked))
+
+	// doing so again changes nothing
+	changed, err = store.UpdateWorkloadPolicies(ctx, elsewhereID, unlock)
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	// other inherited policies can't be removed from the workload
+	_, err = store.UpdateWorkloadPolicies(ctx, inheritsID, resource.PolicyUpdate{Remove: policy.Set{}.Add(policy.TagPrefix("app"))})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), nsID.String())
+}
+
+func TestParseConfigFile_Policies(t *testing.T) {
+	for _, invalid := range []string{
+		"version: 1\npolicies:\n  ignore: \"true\"\n",
+		"version: 1\npolicies:\n  automated: true\n",
+		"version: 1\npolicies:\n  automated: \"true\"\nfoo: bar\n",
+	} {
+		var cf ConfigFile
+		assert.Error(t, ParseConfigFile([]byte(invalid), &cf), invalid)
+	}
+
+	var cf ConfigFile
+	require.NoError(t, ParseConfigFile([]byte("version: 1\nscanForFiles: {}\npolicies:\n  tag.app: glob:*\n"), &cf))
+	assert.True(t, cf.IsScanForFiles())
+	assert.Equal(t, policy.Set{policy.TagPrefix("app"): "glob:*"}, cf.Policies)
+
+	cf = ConfigFile{}
+	require.NoError(t, ParseConfigFile([]byte(policiesFluxYAML), &cf))
+	assert.True(t, cf.IsScanForFiles())
+}
+
+func TestInheritPolicies_Reject(t *testing.T) {
+	baseDir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+	writeFile(t, filepath.Join(baseDir, "namespace.yaml"), `---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: team-a
+  annotations:
+    fluxcd.io/reject: app:1.2.0
+`)
+	writeFile(t, filepath.Join(baseDir, "workload.yaml"), `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: rejects
+  namespace: team-a
+  annotations:
+    fluxcd.io/reject: sidecar:2.0.0
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        image: app:1.0.0
+`)
+	writeFile(t, filepath.Join(baseDir, ConfigFilename), "version: 1\npolicies:\n  reject: sha256:abc\n")
+
+	manifests := kubernetes.NewManifests(manifestNamespacer{}, log.NewNopLogger())
+	store := NewRawFiles(baseDir, []string{baseDir}, manifests)
+	resources, err := store.GetAllResourcesByID(context.Background())
+	require.NoError(t, err)
+
+	// images rejected anywhere are rejected for the workload
+	rejects := resources[resource.MakeID("team-a", "Deployment", "rejects").String()]
+	assert.Equal(t, "app:1.2.0,sha256:abc,sidecar:2.0.0", rejects.Policies()[policy.Reject])
+}
+
+func TestReadRepoPolicies(t *testing.T) {
+	baseDir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+	path := filepath.Join(baseDir, ConfigFilename)
+
+	policies, err := ReadRepoPolicies(baseDir)
+	require.NoError(t, err)
+	assert.Nil(t, policies)
+
+	// the rest of the file needn't be valid, since it's used only
+	// when generating manifests
+	writeFile(t, path, "version: 2\nfoo: bar\npolicies:\n  automated: \"true\"\n")
+	policies, err = ReadRepoPolicies(baseDir)
+	require.NoError(t, err)
+	assert.Equal(t, policy.Set{policy.Automated: "true"}, policies)
+
+	writeFile(t, path, "version: 1\npolicies:\n  automated: [true]\n")
+	_, err = ReadRepoPolicies(baseDir)
+	assert.Error(t, err)
+}
+
+func TestSetRepoPolicy(t *testing.T) {
+	baseDir, cleanup := testfiles.TempDir(t)
+	defer cleanup()
+	path := filepath.Join(baseDir, ConfigFilename)
+	read := func() string {
+		bytes, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		return string(bytes)
+	}
+
+	// the file is created if need be
+	require.NoError(t, SetRepoPolicy(baseDir, policy.Reject, "app:1.2.0"))
+	assert.Equal(t, "version: 1\npolicies:\n  reject: app:1.2.0\n", read())
+
+	// and removed once it has nothing left in it
+	require.NoError(t, SetRepoPolicy(baseDir, policy.Reject, ""))
+	_, err := os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	// otherwise, the rest of the file is left alone
+	writeFile(t, path, `version: 1
+# found by scanning
+scanForFiles: {}
+policies:
+  automated: "true" # everything
+`)
+	require.NoError(t, SetRepoPolicy(baseDir, policy.Reject, "app:1.2.0"))
+	assert.Equal(t, `version: 1
+# found by scanning
+scanForFiles: {}
+policies:
+  automated: "true" # everything
+  reject: app:1.2.0
+`, read())
+	require.NoError(t, SetRepoPolicy(baseDir, policy.Automated, ""))
+	require.NoError(t, SetRepoPolicy(baseDir, policy.Reject, ""))
+	assert.Equal(t, "version: 1\n# found by scanning\nscanForFiles: {}\n", read())
+
+	// and nothing invalid is written
+	assert.Error(t, SetRepoPolicy(baseDir, policy.Ignore, "true"))
+	assert.Equal(t, "version: 1\n# found by scanning\nscanForFiles: {}\n", read())
+}
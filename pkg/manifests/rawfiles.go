@@ -29,7 +29,7 @@ func NewRawFiles(baseDir string, paths []string, manifests Manifests) *rawFiles
 
 // Set the container image of a resource in the store
 func (f *rawFiles) SetWorkloadContainerImage(ctx context.Context, id resource.ID, container string, newImageID image.Ref) error {
-	resourcesByID, err := f.GetAllResourcesByID(ctx)
+	resourcesByID, err := f.loadResources()
 	if err != nil {
 		return err
 	}
@@ -60,7 +60,7 @@ func (f *rawFiles) setManifestWorkloadContainerImage(r resource.Resource, contai
 // UpdateWorkloadPolicies modifies a resource in the store to apply the policy-update specified.
 // It returns whether a change in the resource was actually made as a result of the change
 func (f *rawFiles) UpdateWorkloadPolicies(ctx context.Context, id resource.ID, update resource.PolicyUpdate) (bool, error) {
-	resourcesByID, err := f.GetAllResourcesByID(ctx)
+	resourcesByID, err := f.loadResources()
 	if err != nil {
 		return false, err
 	}
@@ -68,6 +68,14 @@ func (f *rawFiles) UpdateWorkloadPolicies(ctx context.Context, id resource.ID, u
 	if !ok {
 		return false, ErrResourceNotFound(id.String())
 	}
+	repoPolicies, err := ReadRepoPolicies(f.baseDir)
+	if err != nil {
+		return false, err
+	}
+	update, err = overrideInherited(resourcesByID, repoPolicies, id, update)
+	if err != nil {
+		return false, err
+	}
 	return f.updateManifestWorkloadPolicies(r, update)
 }
 
@@ -93,5 +101,19 @@ func (f *rawFiles) updateManifestWorkloadPolicies(r resource.Resource, update re
 
 // Load all the resources in the store. The returned map is indexed by the resource IDs
 func (f *rawFiles) GetAllResourcesByID(_ context.Context) (map[string]resource.Resource, error) {
+	resources, err := f.loadResources()
+	if err != nil {
+		return nil, err
+	}
+	repoPolicies, err := ReadRepoPolicies(f.baseDir)
+	if err != nil {
+		return nil, err
+	}
+	return inheritPolicies(resources, repoPolicies), nil
+}
+
+// loadResources loads the resources as they are in the files, without
+// any inherited policies.
+func (f *rawFiles) loadResources() (map[string]resource.Resource, error) {
 	return f.manifests.LoadManifests(f.baseDir, f.paths)
 }
@@ -14,4 +14,23 @@ const (
 	LabelReleaseType = "release_type"
 	LabelReleaseKind = "release_kind"
 	LabelStage       = "stage"
+
+	// Labels for drift metrics
+	LabelReason = "reason"
+
+	// Labels for readiness metrics
+	LabelKind   = "kind"
+	LabelStatus = "status"
+
+	// Labels for cluster cache metrics
+	LabelResource = "resource"
+
+	// Labels for tenant metrics
+	LabelTenant = "tenant"
+
+	// Labels for sync hook metrics
+	LabelPhase = "phase"
+
+	// Labels for canary metrics
+	LabelOutcome = "outcome"
 )
@@ -38,11 +38,13 @@ type Pattern interface {
 
 type GlobPattern string
 
-// SemverPattern matches by semantic versioning.
+// SemverPattern matches by semantic versioning. Besides the version
+// constraint, it may have options; see parseSemverPattern.
 // See https://semver.org/
 type SemverPattern struct {
 	pattern     string // pattern without prefix
 	constraints *semver.Constraints
+	options     *semverOptions
 }
 
 // RegexpPattern matches by regular expression.
@@ -57,9 +59,7 @@ type RegexpPattern struct {
 func NewPattern(pattern string) Pattern {
 	switch {
 	case strings.HasPrefix(pattern, semverPrefix):
-		pattern = strings.TrimPrefix(pattern, semverPrefix)
-		c, _ := semver.NewConstraint(pattern)
-		return SemverPattern{pattern, c}
+		return parseSemverPattern(strings.TrimPrefix(pattern, semverPrefix))
 	case strings.HasPrefix(pattern, regexpPrefix):
 		pattern = strings.TrimPrefix(pattern, regexpPrefix)
 		r, _ := regexp.Compile(pattern)
@@ -94,7 +94,7 @@ func (g GlobPattern) RequiresTimestamp() bool {
 }
 
 func (s SemverPattern) Matches(tag string) bool {
-	v, err := semver.NewVersion(tag)
+	v, err := image.ParseSemver(tag)
 	if err != nil {
 		return false
 	}
@@ -102,6 +102,16 @@ func (s SemverPattern) Matches(tag string) bool {
 		// Invalid constraints match anything
 		return true
 	}
+	if s.options.excludes(v) {
+		return false
+	}
+	if v.Prerelease() != "" && s.options.inChannel(v) {
+		// The constraint is checked against the version being
+		// released, since prereleases would otherwise only match
+		// constraints that mention one.
+		release, _ := v.SetPrerelease("")
+		return s.constraints.Check(&release)
+	}
 	return s.constraints.Check(v)
 }
 
@@ -114,7 +124,7 @@ func (s SemverPattern) Newer(a, b *image.Info) bool {
 }
 
 func (s SemverPattern) Valid() bool {
-	return s.constraints != nil
+	return s.constraints != nil && s.options != nil
 }
 
 func (s SemverPattern) RequiresTimestamp() bool {
@@ -3,8 +3,11 @@ package policy
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/fluxcd/flux/pkg/image"
 )
 
 func TestGlobPattern_Matches(t *testing.T) {
@@ -71,9 +74,47 @@ func TestSemverPattern_Matches(t *testing.T) {
 			true:    []string{"2.0.1-alpha.1"},
 			false:   []string{"2.0.1"},
 		},
+		{
+			name:    "no channel",
+			pattern: "semver:~1.2",
+			true:    []string{"1.2.3", "1.2.3+build5"},
+			false:   []string{"1.2.4-rc.1", "1.2.4-rc.1+build5"},
+		},
+		{
+			name:    "channel",
+			pattern: "semver:~1.2 channel:rc",
+			true:    []string{"1.2.3", "1.2.4-rc.1", "v1.2.4-rc1", "1.2.4-RC.2", "v1.2.4-rc.1+build5"},
+			false:   []string{"1.2.4-beta.1", "1.2.4-rcx.1", "1.3.0-rc.1", "1.3.0"},
+		},
+		{
+			name:    "channels",
+			pattern: "semver:>=1.0 channel:rc,beta",
+			true:    []string{"1.1.0-beta.1", "1.1.0-rc.2", "2.0.0"},
+			false:   []string{"1.1.0-alpha.1", "0.9.0-rc.1"},
+		},
+		{
+			name:    "constraint with spaces",
+			pattern: "semver: >= 1.0.0, < 1.1.0 channel:rc",
+			true:    []string{"1.0.1-rc.1", "1.0.1"},
+			false:   []string{"1.1.0-rc.1", "0.9.0"},
+		},
+		{
+			name:    "exclude",
+			pattern: "semver:~1.2 exclude:1.2.4,v1.2.5+build7",
+			true:    []string{"1.2.3", "1.2.5", "1.2.5+build8"},
+			false:   []string{"1.2.4", "v1.2.4", "1.2.4+build1", "1.2.5+build7"},
+		},
+		{
+			name:    "v prefix",
+			pattern: "semver:~v1.2",
+			true:    []string{"1.2.3", "v1.2.3", "V1.2.3"},
+			false:   []string{"v1.3.0", "V1.3.0"},
+		},
 	} {
 		pattern := NewPattern(tt.pattern)
 		assert.IsType(t, SemverPattern{}, pattern)
+		assert.True(t, pattern.Valid(), tt.pattern)
+		assert.Equal(t, tt.pattern, pattern.String())
 		for _, tag := range tt.true {
 			t.Run(fmt.Sprintf("%s[%q]", tt.name, tag), func(t *testing.T) {
 				assert.True(t, pattern.Matches(tag))
@@ -87,6 +128,34 @@ func TestSemverPattern_Matches(t *testing.T) {
 	}
 }
 
+func TestSemverPattern_Valid(t *testing.T) {
+	for _, invalid := range []string{
+		"semver:not-a-version",
+		"semver:~1.2 exclude:not-a-version",
+		"semver:~1.2 colour:red",
+	} {
+		assert.False(t, NewPattern(invalid).Valid(), invalid)
+	}
+}
+
+func TestSemverPattern_Newer(t *testing.T) {
+	pattern := NewPattern("semver:~1.2 channel:rc")
+	now := time.Now()
+	info := func(tag string, created time.Time) *image.Info {
+		ref, err := image.ParseRef("org/app:" + tag)
+		assert.NoError(t, err)
+		return &image.Info{ID: ref, CreatedAt: created}
+	}
+
+	assert.True(t, pattern.Newer(info("1.2.4-rc.1", now), info("1.2.3", now)))
+	assert.True(t, pattern.Newer(info("1.2.4", now), info("v1.2.4-rc.2", now)))
+	assert.True(t, pattern.Newer(info("V1.2.5", now), info("v1.2.4", now)))
+	// build metadata doesn't make one version newer than another, so
+	// the most recently built image is
+	assert.True(t, pattern.Newer(info("1.2.4+build5", now), info("1.2.4+build12", now.Add(-time.Hour))))
+	assert.False(t, pattern.Newer(info("1.2.4+build5", now.Add(-time.Hour)), info("1.2.4+build12", now)))
+}
+
 func TestRegexpPattern_Matches(t *testing.T) {
 	for _, tt := range []struct {
 		name    string
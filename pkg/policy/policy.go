@@ -2,7 +2,10 @@ package policy
 
 import (
 	"encoding/json"
+	"fmt"
+	"sort"
 	"strings"
+	"time"
 )
 
 const (
@@ -12,10 +15,39 @@ const (
 	LockedMsg  = Policy("locked_msg")
 	Automated  = Policy("automated")
 	TagAll     = Policy("tag_all")
+	Drift      = Policy("drift")
+	Prune      = Policy("prune")
+	Hook       = Policy("hook")
+	Canary     = Policy("canary")
+	Reject     = Policy("reject")
 )
 
 const IgnoreSyncOnly = "sync_only"
 
+// Values for the Drift policy, saying whether changes made to a
+// resource in the cluster are corrected as soon as they're noticed,
+// or only reported (and corrected at the next scheduled sync).
+const (
+	DriftCorrect = "correct"
+	DriftReport  = "report"
+)
+
+// Values for the Prune policy, saying whether garbage collection may
+// delete a resource. Resources of some kinds (e.g., namespaces) are
+// only deleted if they have the policy enabled.
+const (
+	PruneEnabled  = "enabled"
+	PruneDisabled = "disabled"
+)
+
+// Values for the Hook policy, saying that a Job or Pod is run before
+// or after the other resources are applied, and waited on, rather
+// than being synced along with them.
+const (
+	HookPreSync  = "pre-sync"
+	HookPostSync = "post-sync"
+)
+
 // Policy is an string, denoting the current deployment policy of a service,
 // e.g. automated, or locked.
 type Policy string
@@ -47,6 +79,86 @@ func GetTagPattern(policies Set, container string) Pattern {
 	return NewPattern(pattern)
 }
 
+// MinAgePrefix gives the policy saying how old an image must be
+// before automation releases it to the container, as a duration
+// (e.g., `30m`).
+func MinAgePrefix(container string) Policy {
+	return Policy("min-age." + container)
+}
+
+// GetMinAge returns the minimum age of images released by automation
+// to the container given, or zero if there isn't one.
+func GetMinAge(policies Set, container string) (time.Duration, error) {
+	value, ok := policies.Get(MinAgePrefix(container))
+	if !ok {
+		return 0, nil
+	}
+	minAge, err := time.ParseDuration(strings.TrimSpace(value))
+	if err == nil && minAge < 0 {
+		err = fmt.Errorf("duration is negative")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s policy %q: %s", MinAgePrefix(container), value, err)
+	}
+	return minAge, nil
+}
+
+// RejectPrefix gives the policy listing the images of a container
+// that have been rejected, e.g., by failing canary analysis, so that
+// they are passed over by automation and releases. The images are
+// given as tags, image refs, or digests, separated by commas.
+func RejectPrefix(container string) Policy {
+	return Policy("reject." + container)
+}
+
+// GetRejected returns the images rejected for the container given;
+// those in its own reject policy, and those in the Reject policy,
+// which is for all containers and lists only image refs and digests.
+func GetRejected(policies Set, container string) []string {
+	rejected := SplitRejected(policies[RejectPrefix(container)])
+	return append(rejected, SplitRejected(policies[Reject])...)
+}
+
+// SplitRejected parses the value of a reject policy.
+func SplitRejected(value string) []string {
+	var images []string
+	for _, im := range strings.Split(value, ",") {
+		if im = strings.TrimSpace(im); im != "" {
+			images = append(images, im)
+		}
+	}
+	return images
+}
+
+// AddRejected returns the value of a reject policy with the images
+// given added to it.
+func AddRejected(value string, images ...string) string {
+	return joinRejected(append(SplitRejected(value), images...), nil)
+}
+
+// RemoveRejected returns the value of a reject policy with the
+// images given taken out of it; if none are left, it's empty.
+func RemoveRejected(value string, images ...string) string {
+	remove := map[string]bool{}
+	for _, im := range images {
+		remove[im] = true
+	}
+	return joinRejected(SplitRejected(value), remove)
+}
+
+func joinRejected(images []string, omit map[string]bool) string {
+	seen := map[string]bool{}
+	var list []string
+	for _, im := range images {
+		if !seen[im] && !omit[im] {
+			seen[im] = true
+			list = append(list, im)
+		}
+	}
+	sort.Strings(list)
+	return strings.Join(list, ",")
+}
+
 type Set map[Policy]string
 
 // We used to specify a set of policies as []Policy, and in some places
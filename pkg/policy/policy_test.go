@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -88,3 +89,37 @@ func Test_GetTagPattern(t *testing.T) {
 		})
 	}
 }
+
+func Test_Rejected(t *testing.T) {
+	policies := Set{
+		RejectPrefix("app"): "1.2.0, 1.3.0,",
+		Reject:              "org/other:1.0,sha256:abc",
+	}
+	assert.Equal(t, []string{"1.2.0", "1.3.0", "org/other:1.0", "sha256:abc"}, GetRejected(policies, "app"))
+	assert.Equal(t, []string{"org/other:1.0", "sha256:abc"}, GetRejected(policies, "sidecar"))
+	assert.Empty(t, GetRejected(nil, "app"))
+
+	assert.Equal(t, "1.2.0,1.3.0,1.4.0", AddRejected("1.3.0,1.2.0", "1.4.0", "1.2.0"))
+	assert.Equal(t, "1.2.0", RemoveRejected("1.3.0,1.2.0", "1.3.0", "1.5.0"))
+	assert.Equal(t, "", RemoveRejected("1.3.0", "1.3.0"))
+}
+
+func Test_GetMinAge(t *testing.T) {
+	policies := Set{
+		MinAgePrefix("app"):     "30m",
+		MinAgePrefix("sidecar"): "soon",
+		MinAgePrefix("db"):      "-1h",
+	}
+	minAge, err := GetMinAge(policies, "app")
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Minute, minAge)
+
+	minAge, err = GetMinAge(policies, "other")
+	assert.NoError(t, err)
+	assert.Zero(t, minAge)
+
+	_, err = GetMinAge(policies, "sidecar")
+	assert.Error(t, err)
+	_, err = GetMinAge(policies, "db")
+	assert.Error(t, err)
+}
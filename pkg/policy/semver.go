@@ -0,0 +1,98 @@
+package policy
+
+import (
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+
+	"github.com/fluxcd/flux/pkg/image"
+)
+
+// Options that can follow the constraint in a semver pattern, e.g.,
+// `semver:~1.2 channel:rc exclude:1.2.4`.
+const (
+	// channelOption gives prerelease channels, separated by commas.
+	// Prereleases in those channels (e.g., `1.2.3-rc.1` for `rc`)
+	// match if the version being released matches the constraint,
+	// whether or not the constraint mentions a prerelease.
+	channelOption = "channel:"
+	// excludeOption gives versions that never match, separated by
+	// commas. A version without build metadata excludes that version
+	// whatever its build metadata.
+	excludeOption = "exclude:"
+)
+
+type semverOptions struct {
+	channels []string
+	exclude  []*semver.Version
+}
+
+// parseSemverPattern parses the constraint and options of a semver
+// pattern. If either can't be parsed, the pattern is not valid.
+func parseSemverPattern(pattern string) SemverPattern {
+	var constraint []string
+	options := &semverOptions{}
+	for _, field := range strings.Fields(pattern) {
+		switch {
+		case strings.HasPrefix(field, channelOption):
+			for _, channel := range splitOption(strings.TrimPrefix(field, channelOption)) {
+				options.channels = append(options.channels, strings.ToLower(channel))
+			}
+		case strings.HasPrefix(field, excludeOption):
+			for _, version := range splitOption(strings.TrimPrefix(field, excludeOption)) {
+				v, err := image.ParseSemver(version)
+				if err != nil {
+					options = nil
+					break
+				}
+				options.exclude = append(options.exclude, v)
+			}
+		default:
+			constraint = append(constraint, field)
+		}
+		if options == nil {
+			break
+		}
+	}
+	c, _ := semver.NewConstraint(strings.Join(constraint, " "))
+	return SemverPattern{pattern, c, options}
+}
+
+func splitOption(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// inChannel says whether a prerelease is in one of the channels; that
+// is, whether its first identifier is the name of a channel, perhaps
+// followed by a number (e.g., `rc.1` or `rc1` for `rc`).
+func (o *semverOptions) inChannel(v *semver.Version) bool {
+	if o == nil {
+		return false
+	}
+	id := strings.ToLower(strings.SplitN(v.Prerelease(), ".", 2)[0])
+	id = strings.TrimRight(id, "0123456789")
+	for _, channel := range o.channels {
+		if id == channel {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *semverOptions) excludes(v *semver.Version) bool {
+	if o == nil {
+		return false
+	}
+	for _, ex := range o.exclude {
+		if ex.Equal(v) && (ex.Metadata() == "" || ex.Metadata() == v.Metadata()) {
+			return true
+		}
+	}
+	return false
+}
@@ -20,6 +20,9 @@ type imageToUpdate struct {
 	ref             image.Ref
 	previousDigest  string
 	previousRefresh time.Duration
+	// when the image was first fetched, so it can be kept if the
+	// digest is the same
+	previousFirstSeen time.Time
 }
 
 // repoCacheManager handles cache operations for a container image repository
@@ -146,7 +149,7 @@ func (c *repoCacheManager) fetchImages(tags []string) (fetchImagesResult, error)
 						if !lastFetched.IsZero() {
 							previousRefresh = deadline.Sub(lastFetched)
 						}
-						toUpdate = append(toUpdate, imageToUpdate{ref: newID, previousRefresh: previousRefresh, previousDigest: entry.Info.Digest})
+						toUpdate = append(toUpdate, imageToUpdate{ref: newID, previousRefresh: previousRefresh, previousDigest: entry.Info.Digest, previousFirstSeen: entry.Info.FirstSeen})
 						refresh++
 					}
 				} else {
@@ -269,14 +272,20 @@ func (c *repoCacheManager) updateImage(ctx context.Context, update imageToUpdate
 		reason = "image is excluded"
 	case update.previousDigest == "":
 		entry.Info.LastFetched = c.now
+		entry.Info.FirstSeen = c.now
 		refresh = update.previousRefresh
 		reason = "no prior cache entry for image"
 	case entry.Info.Digest == update.previousDigest:
 		entry.Info.LastFetched = c.now
+		entry.Info.FirstSeen = update.previousFirstSeen
+		if entry.Info.FirstSeen.IsZero() { // cached before first-seen times were recorded
+			entry.Info.FirstSeen = c.now
+		}
 		refresh = clipRefresh(refresh * 2)
 		reason = "image digest is same"
 	default: // i.e., not excluded, but the digests differ -> the tag was moved
 		entry.Info.LastFetched = c.now
+		entry.Info.FirstSeen = c.now
 		refresh = clipRefresh(refresh / 2)
 		reason = "image digest is different"
 	}
@@ -156,6 +156,37 @@ func TestRefreshDeadline(t *testing.T) {
 	assert.True(t, deadline1.Sub(now1) > deadline2.Sub(now2), "%s > %s", deadline1.Sub(now1), deadline2.Sub(now2))
 }
 
+func TestFirstSeen(t *testing.T) {
+	digest := "abc"
+	warmer, cache := setup(t, &digest)
+	logger := log.NewNopLogger()
+	reader := &Cache{Reader: cache}
+	firstSeen := func() time.Time {
+		repoInfo, err := reader.GetImageRepositoryMetadata(ref.Name)
+		assert.NoError(t, err)
+		return repoInfo.Images["tag"].FirstSeen
+	}
+
+	now0 := time.Now()
+	warmer.warm(context.TODO(), now0, logger, repo, registry.NoCredentials())
+	assert.True(t, now0.Equal(firstSeen()))
+
+	// Refreshing the same image keeps the time it was first seen
+	k := NewManifestKey(ref.CanonicalRef())
+	_, deadline0, err := cache.GetKey(k)
+	assert.NoError(t, err)
+	warmer.warm(context.TODO(), deadline0.Add(time.Minute), logger, repo, registry.NoCredentials())
+	assert.True(t, now0.Equal(firstSeen()))
+
+	// but when the tag is moved to another image, that's new
+	_, deadline1, err := cache.GetKey(k)
+	assert.NoError(t, err)
+	digest = "cba"
+	now2 := deadline1.Add(time.Minute)
+	warmer.warm(context.TODO(), now2, logger, repo, registry.NoCredentials())
+	assert.True(t, now2.Equal(firstSeen()))
+}
+
 func setup(t *testing.T, digest *string) (*Warmer, Client) {
 	client := &mock.Client{
 		TagsFn: func() ([]string, error) {
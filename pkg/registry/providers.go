@@ -0,0 +1,388 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// How long to use credentials that come without an expiry (e.g.,
+	// from a credential helper, or a Vault secret without a lease)
+	// before getting them again.
+	defaultProviderRefresh = 15 * time.Minute
+	// How long before the expiry of credentials to refresh them, as a
+	// fraction of their lifetime.
+	providerRefreshFraction = 0.2
+	// How long a provider is given to get credentials.
+	providerTimeout = time.Minute
+)
+
+// CredentialsProvider supplies registry credentials from outside the
+// cluster, e.g., from a secrets store.
+type CredentialsProvider interface {
+	// Name says which provider this is, for logging.
+	Name() string
+	// Credentials returns credentials for (at least) those of the
+	// registry hosts given that the provider knows about, and when
+	// they expire. A zero expiry means they're good until asked for
+	// again.
+	Credentials(ctx context.Context, hosts []string) (Credentials, time.Time, error)
+}
+
+// ImageCredsWithProviders wraps an image credentials lookup so that
+// the credentials from each of the providers are used for the images'
+// registries, unless the lookup already has credentials for the
+// registry (e.g., from an image pull secret). Providers given later
+// take precedence over those given earlier. The credentials are
+// refreshed when they are near to expiring, or when there's an image
+// from a registry not seen before.
+func ImageCredsWithProviders(lookup func() ImageCreds, logger log.Logger, providers ...CredentialsProvider) func() ImageCreds {
+	var mu sync.Mutex
+	states := make([]*providerState, len(providers))
+	for i, p := range providers {
+		states[i] = &providerState{provider: p, creds: NoCredentials(), hosts: map[string]bool{}}
+	}
+
+	return func() ImageCreds {
+		imageCreds := lookup()
+
+		hostSet := map[string]bool{}
+		for name := range imageCreds {
+			hostSet[name.Registry()] = true
+		}
+		var hosts []string
+		for host := range hostSet {
+			hosts = append(hosts, host)
+		}
+		sort.Strings(hosts)
+
+		mu.Lock()
+		now := time.Now()
+		providerCreds := NoCredentials()
+		for _, s := range states {
+			s.ensureCreds(hosts, now, log.With(logger, "provider", s.provider.Name()))
+			if s.expiry.IsZero() || s.expiry.After(now) {
+				providerCreds.Merge(s.creds)
+			}
+		}
+		mu.Unlock()
+
+		for name, creds := range imageCreds {
+			newCreds := NoCredentials()
+			newCreds.Merge(providerCreds)
+			newCreds.Merge(creds)
+			imageCreds[name] = newCreds
+		}
+		return imageCreds
+	}
+}
+
+// providerState keeps the credentials last got from a provider, and
+// when to get them again.
+type providerState struct {
+	provider  CredentialsProvider
+	creds     Credentials
+	hosts     map[string]bool // the hosts the provider has been asked about
+	expiry    time.Time
+	refreshAt time.Time
+	// if getting credentials fails, don't try again until this time,
+	// to avoid spamming the log (and the provider)
+	embargo time.Time
+}
+
+func (s *providerState) ensureCreds(hosts []string, now time.Time, logger log.Logger) {
+	if s.embargo.After(now) {
+		return
+	}
+	due := s.refreshAt.IsZero() || !s.refreshAt.After(now)
+	for _, host := range hosts {
+		if !s.hosts[host] {
+			due = true
+			break
+		}
+	}
+	if !due {
+		return
+	}
+
+	// ask about the hosts asked about before, too, so that
+	// credentials for images no longer in use are kept only until
+	// they would have been refreshed anyway
+	for _, host := range hosts {
+		s.hosts[host] = true
+	}
+	var asked []string
+	for host := range s.hosts {
+		asked = append(asked, host)
+	}
+	sort.Strings(asked)
+
+	ctx, cancel := context.WithTimeout(context.Background(), providerTimeout)
+	defer cancel()
+	creds, expiry, err := s.provider.Credentials(ctx, asked)
+	if err != nil {
+		// keep any credentials that could be got, alongside those
+		// from before, which can be used until they expire
+		s.creds.Merge(creds)
+		s.embargo = now.Add(embargoDuration)
+		logger.Log("error", "fetching registry credentials", "err", err, "embargo", embargoDuration)
+		return
+	}
+	s.creds, s.expiry = creds, expiry
+	if expiry.IsZero() {
+		s.refreshAt = now.Add(defaultProviderRefresh)
+	} else {
+		s.refreshAt = expiry.Add(-time.Duration(float64(expiry.Sub(now)) * providerRefreshFraction))
+	}
+	logger.Log("info", "refreshed registry credentials", "hosts", strings.Join(creds.Hosts(), ", "), "refresh", s.refreshAt.Format(time.RFC3339))
+}
+
+// ---
+
+// CredentialHelpers gets credentials by running docker credential
+// helpers, i.e., executables named `docker-credential-<helper>` on
+// the path, as the `credHelpers` of a docker config do.
+type CredentialHelpers struct {
+	// Helpers is the name of the helper to use for each registry
+	// host. A helper for the host `*` is used for any host without
+	// its own.
+	Helpers map[string]string
+}
+
+// ParseCredentialHelpers parses `<host>=<helper>` pairs, e.g.,
+// `123456789012.dkr.ecr.eu-west-1.amazonaws.com=ecr-login`.
+func ParseCredentialHelpers(specs []string) (CredentialHelpers, error) {
+	helpers := map[string]string{}
+	for _, spec := range specs {
+		bits := strings.SplitN(spec, "=", 2)
+		if len(bits) != 2 || bits[0] == "" || bits[1] == "" {
+			return CredentialHelpers{}, fmt.Errorf("credential helper %q not in the form <host>=<helper>", spec)
+		}
+		helpers[bits[0]] = bits[1]
+	}
+	return CredentialHelpers{Helpers: helpers}, nil
+}
+
+func (h CredentialHelpers) Name() string {
+	return "credential-helpers"
+}
+
+func (h CredentialHelpers) helperFor(host string) string {
+	if helper, ok := h.Helpers[host]; ok {
+		return helper
+	}
+	return h.Helpers["*"]
+}
+
+// Credentials runs the helper for each of the hosts given, that has
+// one. If any fails, the error is returned with the credentials that
+// could be got.
+func (h CredentialHelpers) Credentials(ctx context.Context, hosts []string) (Credentials, time.Time, error) {
+	m := map[string]creds{}
+	var failed []string
+	for _, host := range hosts {
+		helper := h.helperFor(host)
+		if helper == "" {
+			continue
+		}
+		c, err := runCredentialHelper(ctx, helper, host)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", host, err))
+			continue
+		}
+		m[host] = c
+	}
+	var err error
+	if len(failed) > 0 {
+		err = errors.New(strings.Join(failed, "; "))
+	}
+	return Credentials{m: m}, time.Time{}, err
+}
+
+func runCredentialHelper(ctx context.Context, helper, host string) (creds, error) {
+	program := "docker-credential-" + helper
+	cmd := exec.CommandContext(ctx, program, "get")
+	cmd.Stdin = strings.NewReader(host)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = strings.TrimSpace(stdout.String())
+		}
+		if msg != "" {
+			return creds{}, errors.Wrapf(err, "running %s: %s", program, msg)
+		}
+		return creds{}, errors.Wrapf(err, "running %s", program)
+	}
+	var out struct {
+		Username string
+		Secret   string
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		return creds{}, errors.Wrapf(err, "parsing output of %s", program)
+	}
+	return creds{
+		username:   out.Username,
+		password:   out.Secret,
+		registry:   host,
+		provenance: program,
+	}, nil
+}
+
+// ---
+
+// Vault reads credentials from a secret in Vault, or anything serving
+// the same HTTP API. The secret's data is either a docker config
+// (i.e., has `auths`), or has the fields `registry`, `username` and
+// `password`. Secrets from the KV version 2 engine, which nests the
+// data, can be read too.
+type Vault struct {
+	// Address is the base URL of the Vault server,
+	// e.g. `https://vault.example.com:8200`
+	Address string
+	// Path is the path of the secret, e.g., `secret/data/registry`
+	Path string
+	// TokenFile is a file holding the token to authenticate with,
+	// read each time the secret is, so that it can be renewed (e.g.,
+	// by a Vault agent).
+	TokenFile string
+	Client    *http.Client
+}
+
+func (v Vault) Name() string {
+	return "vault"
+}
+
+func (v Vault) secretURL() string {
+	return strings.TrimSuffix(v.Address, "/") + "/v1/" + strings.TrimPrefix(v.Path, "/")
+}
+
+// Credentials reads the secret, and returns the credentials in it,
+// which expire at the end of the secret's lease, if it has one.
+func (v Vault) Credentials(ctx context.Context, _ []string) (Credentials, time.Time, error) {
+	req, err := http.NewRequest("GET", v.secretURL(), nil)
+	if err != nil {
+		return Credentials{}, time.Time{}, err
+	}
+	if v.TokenFile != "" {
+		token, err := ioutil.ReadFile(v.TokenFile)
+		if err != nil {
+			return Credentials{}, time.Time{}, errors.Wrap(err, "reading Vault token")
+		}
+		req.Header.Set("X-Vault-Token", strings.TrimSpace(string(token)))
+	}
+	client := v.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	now := time.Now()
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return Credentials{}, time.Time{}, errors.Wrap(err, "reading secret from Vault")
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return Credentials{}, time.Time{}, errors.Wrap(err, "reading secret from Vault")
+	}
+	if res.StatusCode != http.StatusOK {
+		var vaultErr struct {
+			Errors []string
+		}
+		if json.Unmarshal(body, &vaultErr) == nil && len(vaultErr.Errors) > 0 {
+			return Credentials{}, time.Time{}, fmt.Errorf("reading secret from Vault: %s: %s", res.Status, strings.Join(vaultErr.Errors, "; "))
+		}
+		return Credentials{}, time.Time{}, fmt.Errorf("reading secret from Vault: %s", res.Status)
+	}
+
+	creds, lease, err := parseVaultSecret(v.secretURL(), body)
+	if err != nil {
+		return Credentials{}, time.Time{}, err
+	}
+	var expiry time.Time
+	if lease > 0 {
+		expiry = now.Add(lease)
+	}
+	return creds, expiry, nil
+}
+
+func parseVaultSecret(from string, body []byte) (Credentials, time.Duration, error) {
+	var secret struct {
+		LeaseDuration int             `json:"lease_duration"`
+		Data          json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &secret); err != nil {
+		return Credentials{}, 0, errors.Wrap(err, "parsing Vault secret")
+	}
+	if len(secret.Data) == 0 || string(secret.Data) == "null" {
+		return Credentials{}, 0, errors.New("Vault secret has no data")
+	}
+
+	var data struct {
+		Data     json.RawMessage `json:"data"`
+		Metadata json.RawMessage `json:"metadata"`
+		Auths    json.RawMessage `json:"auths"`
+		Registry string          `json:"registry"`
+		Username string          `json:"username"`
+		Password string          `json:"password"`
+	}
+	raw := secret.Data
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return Credentials{}, 0, errors.Wrap(err, "parsing Vault secret")
+	}
+	// the KV version 2 engine puts the secret in data.data, with
+	// data.metadata alongside
+	if len(data.Data) > 0 && len(data.Metadata) > 0 {
+		raw = data.Data
+		data.Registry, data.Username, data.Password, data.Auths = "", "", "", nil
+		if err := json.Unmarshal(raw, &data); err != nil {
+			return Credentials{}, 0, errors.Wrap(err, "parsing Vault secret")
+		}
+	}
+	lease := time.Duration(secret.LeaseDuration) * time.Second
+
+	if data.Auths == nil {
+		if data.Registry == "" || data.Username == "" {
+			return Credentials{}, 0, errors.New("Vault secret has neither auths, nor registry and username")
+		}
+		host := registryHost(data.Registry)
+		c := creds{
+			username:   data.Username,
+			password:   data.Password,
+			registry:   host,
+			provenance: from,
+		}
+		return Credentials{m: map[string]creds{host: c}}, lease, nil
+	}
+	creds, err := ParseCredentials(from, raw)
+	if err != nil {
+		return Credentials{}, 0, errors.Wrap(err, "parsing docker config in Vault secret")
+	}
+	return creds, lease, nil
+}
+
+// registryHost strips any scheme and path from a registry given as a
+// URL, e.g., `https://registry.example.com/v2/`.
+func registryHost(registry string) string {
+	host := registry
+	if i := strings.Index(host, "://"); i >= 0 {
+		host = host[i+3:]
+	}
+	if i := strings.Index(host, "/"); i >= 0 {
+		host = host[:i]
+	}
+	return host
+}
@@ -0,0 +1,175 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fluxcd/flux/pkg/image"
+)
+
+func TestCredentialHelpers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flux-cred-helper")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	script := `#!/bin/sh
+read host
+if [ "$host" = "broken.example.com" ]; then
+  echo "credentials not found in native keychain" >&2
+  exit 1
+fi
+echo "{\"ServerURL\":\"$host\",\"Username\":\"AWS\",\"Secret\":\"token-for-$host\"}"
+`
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "docker-credential-fake"), []byte(script), 0755))
+	path := os.Getenv("PATH")
+	defer os.Setenv("PATH", path)
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+
+	helpers, err := ParseCredentialHelpers([]string{"registry.example.com=fake", "broken.example.com=fake"})
+	require.NoError(t, err)
+	creds, expiry, err := helpers.Credentials(context.Background(), []string{"registry.example.com", "docker.io"})
+	require.NoError(t, err)
+	assert.True(t, expiry.IsZero())
+	assert.Equal(t, []string{"registry.example.com"}, creds.Hosts())
+	c := creds.credsFor("registry.example.com")
+	assert.Equal(t, "AWS", c.username)
+	assert.Equal(t, "token-for-registry.example.com", c.password)
+
+	creds, _, err = helpers.Credentials(context.Background(), []string{"registry.example.com", "broken.example.com"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "credentials not found")
+	assert.Equal(t, []string{"registry.example.com"}, creds.Hosts())
+
+	_, err = ParseCredentialHelpers([]string{"registry.example.com"})
+	assert.Error(t, err)
+}
+
+func TestVault(t *testing.T) {
+	for name, body := range map[string]string{
+		"single": `{"lease_duration": 3600, "data": {"registry": "https://registry.example.com/v2/", "username": "user", "password": "pass"}}`,
+		"kv-v2":  `{"lease_duration": 0, "data": {"data": {"registry": "registry.example.com", "username": "user", "password": "pass"}, "metadata": {"version": 3}}}`,
+		"auths":  fmt.Sprintf(`{"lease_duration": 3600, "data": {"auths": {"registry.example.com": {"auth": %q}}}}`, okCreds),
+	} {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("X-Vault-Token") != "s.token" {
+					w.WriteHeader(http.StatusForbidden)
+					fmt.Fprint(w, `{"errors": ["permission denied"]}`)
+					return
+				}
+				assert.Equal(t, "/v1/secret/data/registry", r.URL.Path)
+				fmt.Fprint(w, body)
+			}))
+			defer server.Close()
+
+			tokenFile, err := ioutil.TempFile("", "vault-token")
+			require.NoError(t, err)
+			defer os.Remove(tokenFile.Name())
+			fmt.Fprintln(tokenFile, "s.token")
+			tokenFile.Close()
+
+			v := Vault{Address: server.URL + "/", Path: "/secret/data/registry", TokenFile: tokenFile.Name()}
+			creds, expiry, err := v.Credentials(context.Background(), nil)
+			require.NoError(t, err)
+			if name == "kv-v2" {
+				assert.True(t, expiry.IsZero())
+			} else {
+				assert.WithinDuration(t, time.Now().Add(time.Hour), expiry, time.Minute)
+			}
+			assert.Equal(t, []string{"registry.example.com"}, creds.Hosts())
+			c := creds.credsFor("registry.example.com")
+			assert.Equal(t, user, c.username)
+			assert.Equal(t, pass, c.password)
+
+			v.TokenFile = ""
+			_, _, err = v.Credentials(context.Background(), nil)
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), "permission denied")
+		})
+	}
+}
+
+// stubProvider gives credentials for the registry host it's asked
+// about, which expire after the lease given.
+type stubProvider struct {
+	calls [][]string
+	lease time.Duration
+	err   error
+}
+
+func (p *stubProvider) Name() string {
+	return "stub"
+}
+
+func (p *stubProvider) Credentials(_ context.Context, hosts []string) (Credentials, time.Time, error) {
+	p.calls = append(p.calls, hosts)
+	if p.err != nil {
+		return Credentials{}, time.Time{}, p.err
+	}
+	m := map[string]creds{}
+	for _, host := range hosts {
+		m[host] = creds{username: "provided", password: fmt.Sprint(len(p.calls)), registry: host, provenance: "stub"}
+	}
+	return Credentials{m: m}, time.Now().Add(p.lease), nil
+}
+
+func TestImageCredsWithProviders(t *testing.T) {
+	fromSecret, err := image.ParseRef("registry.example.com/app:1.0")
+	require.NoError(t, err)
+	fromProvider, err := image.ParseRef("other.example.com/app:1.0")
+	require.NoError(t, err)
+	secretCreds, err := ParseCredentials("secret", []byte(fmt.Sprintf(tmpl, "registry.example.com", okCreds)))
+	require.NoError(t, err)
+
+	imageCreds := ImageCreds{fromSecret.Name: secretCreds}
+	lookup := func() ImageCreds {
+		result := ImageCreds{}
+		for name, creds := range imageCreds {
+			result[name] = creds
+		}
+		return result
+	}
+	provider := &stubProvider{lease: time.Hour}
+	lookupWithProviders := ImageCredsWithProviders(lookup, log.NewNopLogger(), provider)
+
+	// the image pull secret takes precedence over the provider
+	result := lookupWithProviders()
+	assert.Equal(t, user, result[fromSecret.Name].credsFor("registry.example.com").username)
+	assert.Len(t, provider.calls, 1)
+
+	// the credentials aren't got again while they're fresh
+	lookupWithProviders()
+	assert.Len(t, provider.calls, 1)
+
+	// but are, for a registry not asked about before
+	imageCreds[fromProvider.Name] = NoCredentials()
+	result = lookupWithProviders()
+	assert.Equal(t, [][]string{{"registry.example.com"}, {"other.example.com", "registry.example.com"}}, provider.calls)
+	assert.Equal(t, creds{username: "provided", password: "2", registry: "other.example.com", provenance: "stub"}, result[fromProvider.Name].credsFor("other.example.com"))
+
+	// and before they expire
+	provider.lease = time.Millisecond
+	provider.calls = nil
+	lookupWithProviders = ImageCredsWithProviders(lookup, log.NewNopLogger(), provider)
+	lookupWithProviders()
+	time.Sleep(time.Millisecond)
+	provider.err = errors.New("unavailable")
+	result = lookupWithProviders()
+	assert.Len(t, provider.calls, 2)
+	// expired credentials aren't used, and after an error, the
+	// provider's not asked again until the embargo is over
+	assert.Equal(t, creds{}, result[fromProvider.Name].credsFor("other.example.com"))
+	lookupWithProviders()
+	assert.Len(t, provider.calls, 2)
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/fluxcd/flux/pkg/api"
 	"github.com/fluxcd/flux/pkg/api/v10"
 	"github.com/fluxcd/flux/pkg/api/v11"
+	"github.com/fluxcd/flux/pkg/api/v12"
 	"github.com/fluxcd/flux/pkg/api/v6"
 	"github.com/fluxcd/flux/pkg/api/v9"
 	"github.com/fluxcd/flux/pkg/job"
@@ -53,6 +54,33 @@ func (p *ErrorLoggingServer) ListServicesWithOptions(ctx context.Context, opts v
 	return p.server.ListServicesWithOptions(ctx, opts)
 }
 
+func (p *ErrorLoggingServer) WorkloadHistory(ctx context.Context, opts v12.WorkloadHistoryOptions) (_ v12.WorkloadHistory, err error) {
+	defer func() {
+		if err != nil {
+			p.logger.Log("method", "WorkloadHistory", "error", err)
+		}
+	}()
+	return p.server.WorkloadHistory(ctx, opts)
+}
+
+func (p *ErrorLoggingServer) DriftStatus(ctx context.Context) (_ v12.DriftStatus, err error) {
+	defer func() {
+		if err != nil {
+			p.logger.Log("method", "DriftStatus", "error", err)
+		}
+	}()
+	return p.server.DriftStatus(ctx)
+}
+
+func (p *ErrorLoggingServer) Rollback(ctx context.Context, opts v12.RollbackOptions) (_ job.ID, err error) {
+	defer func() {
+		if err != nil {
+			p.logger.Log("method", "Rollback", "error", err)
+		}
+	}()
+	return p.server.Rollback(ctx, opts)
+}
+
 func (p *ErrorLoggingServer) ListImages(ctx context.Context, spec update.ResourceSpec) (_ []v6.ImageStatus, err error) {
 	defer func() {
 		if err != nil {
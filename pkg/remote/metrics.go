@@ -11,6 +11,7 @@ import (
 	"github.com/fluxcd/flux/pkg/api"
 	"github.com/fluxcd/flux/pkg/api/v10"
 	"github.com/fluxcd/flux/pkg/api/v11"
+	"github.com/fluxcd/flux/pkg/api/v12"
 	"github.com/fluxcd/flux/pkg/api/v6"
 	"github.com/fluxcd/flux/pkg/api/v9"
 	"github.com/fluxcd/flux/pkg/job"
@@ -68,6 +69,36 @@ func (i *instrumentedServer) ListServicesWithOptions(ctx context.Context, opts v
 	return i.s.ListServicesWithOptions(ctx, opts)
 }
 
+func (i *instrumentedServer) WorkloadHistory(ctx context.Context, opts v12.WorkloadHistoryOptions) (_ v12.WorkloadHistory, err error) {
+	defer func(begin time.Time) {
+		requestDuration.With(
+			fluxmetrics.LabelMethod, "WorkloadHistory",
+			fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+		).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return i.s.WorkloadHistory(ctx, opts)
+}
+
+func (i *instrumentedServer) DriftStatus(ctx context.Context) (_ v12.DriftStatus, err error) {
+	defer func(begin time.Time) {
+		requestDuration.With(
+			fluxmetrics.LabelMethod, "DriftStatus",
+			fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+		).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return i.s.DriftStatus(ctx)
+}
+
+func (i *instrumentedServer) Rollback(ctx context.Context, opts v12.RollbackOptions) (_ job.ID, err error) {
+	defer func(begin time.Time) {
+		requestDuration.With(
+			fluxmetrics.LabelMethod, "Rollback",
+			fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+		).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return i.s.Rollback(ctx, opts)
+}
+
 func (i *instrumentedServer) ListImages(ctx context.Context, spec update.ResourceSpec) (_ []v6.ImageStatus, err error) {
 	defer func(begin time.Time) {
 		requestDuration.With(
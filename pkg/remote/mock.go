@@ -11,6 +11,7 @@ import (
 	"github.com/fluxcd/flux/pkg/api"
 	"github.com/fluxcd/flux/pkg/api/v10"
 	"github.com/fluxcd/flux/pkg/api/v11"
+	"github.com/fluxcd/flux/pkg/api/v12"
 	"github.com/fluxcd/flux/pkg/api/v6"
 	"github.com/fluxcd/flux/pkg/api/v9"
 	"github.com/fluxcd/flux/pkg/guid"
@@ -49,6 +50,15 @@ type MockServer struct {
 
 	GitRepoConfigAnswer v6.GitConfig
 	GitRepoConfigError  error
+
+	WorkloadHistoryAnswer v12.WorkloadHistory
+	WorkloadHistoryError  error
+
+	DriftStatusAnswer v12.DriftStatus
+	DriftStatusError  error
+
+	RollbackAnswer job.ID
+	RollbackError  error
 }
 
 func (p *MockServer) Ping(ctx context.Context) error {
@@ -104,6 +114,18 @@ func (p *MockServer) GitRepoConfig(ctx context.Context, regenerate bool) (v6.Git
 	return p.GitRepoConfigAnswer, p.GitRepoConfigError
 }
 
+func (p *MockServer) WorkloadHistory(context.Context, v12.WorkloadHistoryOptions) (v12.WorkloadHistory, error) {
+	return p.WorkloadHistoryAnswer, p.WorkloadHistoryError
+}
+
+func (p *MockServer) DriftStatus(context.Context) (v12.DriftStatus, error) {
+	return p.DriftStatusAnswer, p.DriftStatusError
+}
+
+func (p *MockServer) Rollback(context.Context, v12.RollbackOptions) (job.ID, error) {
+	return p.RollbackAnswer, p.RollbackError
+}
+
 var _ api.Server = &MockServer{}
 
 // -- Battery of tests for an api.Server implementation. Since these
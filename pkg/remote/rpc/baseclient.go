@@ -8,6 +8,7 @@ import (
 	"github.com/fluxcd/flux/pkg/api"
 	"github.com/fluxcd/flux/pkg/api/v10"
 	"github.com/fluxcd/flux/pkg/api/v11"
+	"github.com/fluxcd/flux/pkg/api/v12"
 	"github.com/fluxcd/flux/pkg/api/v6"
 	"github.com/fluxcd/flux/pkg/api/v9"
 	"github.com/fluxcd/flux/pkg/job"
@@ -67,3 +68,15 @@ func (bc baseClient) SyncStatus(context.Context, string) ([]string, error) {
 func (bc baseClient) GitRepoConfig(context.Context, bool) (v6.GitConfig, error) {
 	return v6.GitConfig{}, remote.UpgradeNeededError(errors.New("GitRepoConfig method not implemented"))
 }
+
+func (bc baseClient) WorkloadHistory(context.Context, v12.WorkloadHistoryOptions) (v12.WorkloadHistory, error) {
+	return v12.WorkloadHistory{}, remote.UpgradeNeededError(errors.New("WorkloadHistory method not implemented"))
+}
+
+func (bc baseClient) DriftStatus(context.Context) (v12.DriftStatus, error) {
+	return v12.DriftStatus{}, remote.UpgradeNeededError(errors.New("DriftStatus method not implemented"))
+}
+
+func (bc baseClient) Rollback(context.Context, v12.RollbackOptions) (job.ID, error) {
+	return "", remote.UpgradeNeededError(errors.New("Rollback method not implemented"))
+}
@@ -13,6 +13,15 @@ type Resource interface {
 	Bytes() []byte        // the definition, for sending to cluster.Sync
 }
 
+// InheritedPolicies is implemented by resources that have policies
+// given elsewhere (e.g., on their namespace) as well as in their own
+// definition.
+type InheritedPolicies interface {
+	// PolicySources says where each of the inherited policies came
+	// from; policies not mentioned are the resource's own.
+	PolicySources() map[policy.Policy]string
+}
+
 type Container struct {
 	Name  string
 	Image image.Ref
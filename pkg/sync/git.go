@@ -2,7 +2,7 @@ package sync
 
 import (
 	"context"
-	"strings"
+	"errors"
 
 	"github.com/fluxcd/flux/pkg/git"
 )
@@ -51,7 +51,7 @@ func (p GitTagSyncProvider) GetRevision(ctx context.Context) (string, error) {
 		if _, err := p.repo.VerifyTag(ctx, p.syncTag); err != nil {
 			// if the revision wasn't found, don't treat this as an
 			// error -- but don't supply a revision, either.
-			if strings.Contains(err.Error(), "not found.") {
+			if errors.Is(err, git.ErrRefNotFound) {
 				return "", nil
 			}
 			return "", err
@@ -81,7 +81,5 @@ func (p GitTagSyncProvider) DeleteMarker(ctx context.Context) error {
 }
 
 func isUnknownRevision(err error) bool {
-	return err != nil &&
-		(strings.Contains(err.Error(), "unknown revision or path not in the working tree.") ||
-			strings.Contains(err.Error(), "bad revision"))
+	return errors.Is(err, git.ErrRefNotFound)
 }
@@ -10,9 +10,12 @@ type Syncer interface {
 	Sync(cluster.SyncSet) error
 }
 
-// Sync synchronises the cluster to the files under a directory.
-func Sync(setName string, repoResources map[string]resource.Resource, clus Syncer) error {
+// Sync synchronises the cluster to the files under a directory. The
+// errors given are for resources in the repo that couldn't be
+// included, and are reported along with any from the sync.
+func Sync(setName string, repoResources map[string]resource.Resource, repoErrors cluster.SyncError, clus Syncer) error {
 	set := makeSet(setName, repoResources)
+	set.Errors = repoErrors
 	if err := clus.Sync(set); err != nil {
 		return err
 	}
@@ -33,7 +33,7 @@ func TestSync(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if err := Sync("synctest", resources, clus); err != nil {
+	if err := Sync("synctest", resources, nil, clus); err != nil {
 		t.Fatal(err)
 	}
 	checkClusterMatchesFiles(t, rs, clus.resources, checkout.Dir(), dirs)
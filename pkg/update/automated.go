@@ -8,6 +8,7 @@ import (
 	"github.com/go-kit/kit/log"
 
 	"github.com/fluxcd/flux/pkg/image"
+	"github.com/fluxcd/flux/pkg/policy"
 	"github.com/fluxcd/flux/pkg/resource"
 )
 
@@ -96,6 +97,7 @@ func (a *Automated) calculateImageUpdates(rc ReleaseContext, candidates []*Workl
 		containers := u.Resource.Containers()
 		changes := workloadMap[u.ResourceID]
 		containerUpdates := []ContainerUpdate{}
+		var rejected bool
 		for _, container := range containers {
 			currentImageID := container.Image
 			for _, change := range changes {
@@ -108,6 +110,13 @@ func (a *Automated) calculateImageUpdates(rc ReleaseContext, candidates []*Workl
 					continue
 				}
 
+				// The image may have been rejected since the change
+				// was worked out
+				if Rejected(policy.GetRejected(u.Resource.Policies(), container.Name), image.Info{ID: change.ImageID}) {
+					rejected = true
+					continue
+				}
+
 				// We transplant the tag here, to make sure we keep
 				// the format of the image name as it is in the
 				// resource (e.g., to avoid canonicalising it)
@@ -127,6 +136,11 @@ func (a *Automated) calculateImageUpdates(rc ReleaseContext, candidates []*Workl
 				Status:       ReleaseStatusSuccess,
 				PerContainer: containerUpdates,
 			}
+		} else if rejected {
+			result[u.ResourceID] = WorkloadResult{
+				Status: ReleaseStatusSkipped,
+				Error:  ImageRejected,
+			}
 		} else {
 			result[u.ResourceID] = WorkloadResult{
 				Status: ReleaseStatusSkipped,
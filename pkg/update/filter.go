@@ -16,6 +16,7 @@ const (
 	NotInRepo              = "not found in repository"
 	ImageNotFound          = "cannot find one or more images"
 	ImageUpToDate          = "image(s) up to date"
+	ImageRejected          = "image(s) rejected"
 	DoesNotUseImage        = "does not use image(s)"
 	ContainerNotFound      = "container(s) not found: %s"
 	ContainerTagMismatch   = "container(s) tag mismatch: %s"
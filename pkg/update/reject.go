@@ -0,0 +1,154 @@
+package update
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/fluxcd/flux/pkg/image"
+	"github.com/fluxcd/flux/pkg/policy"
+	"github.com/fluxcd/flux/pkg/resource"
+)
+
+// RejectSpec is the spec for rejecting images, so that automation
+// and releases pass over them, or (with Remove) for letting them be
+// used again.
+type RejectSpec struct {
+	// Workload, if given, is the workload the images are rejected
+	// for; otherwise they are rejected for all workloads.
+	Workload resource.ID
+	// Container, if given, is the container of the workload the
+	// images are rejected for. Without it, the images are rejected
+	// for each container using the same image repository.
+	Container string
+	// Images are image refs (e.g., `org/app:1.2.0`), or digests
+	// (`sha256:...`, or `org/app@sha256:...`). Plain tags can be
+	// given for a container.
+	Images []string
+	Remove bool
+}
+
+// Validate checks that the images are given in a form that can be
+// matched for the workload and container given, if any.
+func (r RejectSpec) Validate() error {
+	if len(r.Images) == 0 {
+		return errors.New("no images given to reject")
+	}
+	if r.Container != "" && r.Workload == (resource.ID{}) {
+		return errors.New("a container can only be given with a workload")
+	}
+	for _, im := range r.Images {
+		if strings.Contains(im, ",") {
+			return fmt.Errorf("image %q cannot contain a comma", im)
+		}
+		if isRejectedTag(im) && r.Container == "" {
+			return fmt.Errorf("%q is a tag, which can only be rejected for a container; give an image ref or digest instead", im)
+		}
+	}
+	return nil
+}
+
+// isRejectedTag says whether an entry in a reject policy is a plain
+// tag, rather than an image ref or digest.
+func isRejectedTag(entry string) bool {
+	if strings.HasPrefix(entry, "sha256:") {
+		return false
+	}
+	ref, err := image.ParseRef(entry)
+	return err == nil && ref.Tag == "" && ref.SHA == "" && !strings.Contains(entry, "/")
+}
+
+// Rejected says whether the image given is any of those rejected, as
+// returned by policy.GetRejected.
+func Rejected(rejected []string, info image.Info) bool {
+	for _, entry := range rejected {
+		switch {
+		case strings.HasPrefix(entry, "sha256:"):
+			if entry == info.Digest || entry == info.ImageID || entry == "sha256:"+info.ID.SHA {
+				return true
+			}
+		case isRejectedTag(entry):
+			if entry == info.ID.Tag {
+				return true
+			}
+		default:
+			ref, err := image.ParseRef(entry)
+			if err != nil || ref.CanonicalName() != info.ID.CanonicalName() {
+				continue
+			}
+			if ref.SHA != "" && ("sha256:"+ref.SHA == info.Digest || ref.SHA == info.ID.SHA) {
+				return true
+			}
+			if ref.Tag != "" && ref.Tag == info.ID.Tag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WithoutRejected returns the images that aren't rejected, still in
+// order.
+func (sii SortedImageInfos) WithoutRejected(rejected []string) SortedImageInfos {
+	if len(rejected) == 0 {
+		return sii
+	}
+	var filtered SortedImageInfos
+	for _, im := range sii {
+		if !Rejected(rejected, im) {
+			filtered = append(filtered, im)
+		}
+	}
+	return filtered
+}
+
+// RejectedFor returns those of the images in the spec that apply to
+// the container given.
+func (r RejectSpec) RejectedFor(container resource.Container) []string {
+	if r.Container != "" {
+		if container.Name != r.Container {
+			return nil
+		}
+		return r.Images
+	}
+	var images []string
+	for _, im := range r.Images {
+		if strings.HasPrefix(im, "sha256:") {
+			images = append(images, im)
+			continue
+		}
+		if ref, err := image.ParseRef(im); err == nil && ref.CanonicalName() == container.Image.CanonicalName() {
+			images = append(images, im)
+		}
+	}
+	return images
+}
+
+// RejectPolicyUpdate returns the changes to the reject policies of
+// the workload given, to carry out the spec.
+func (r RejectSpec) RejectPolicyUpdate(workload resource.Workload) resource.PolicyUpdate {
+	u := resource.PolicyUpdate{Add: policy.Set{}, Remove: policy.Set{}}
+	policies := workload.Policies()
+	for _, c := range workload.Containers() {
+		images := r.RejectedFor(c)
+		if len(images) == 0 {
+			continue
+		}
+		p := policy.RejectPrefix(c.Name)
+		var value string
+		if r.Remove {
+			value = policy.RemoveRejected(policies[p], images...)
+		} else {
+			value = policy.AddRejected(policies[p], images...)
+		}
+		if value == policies[p] {
+			continue
+		}
+		if value == "" {
+			u.Remove = u.Remove.Add(p)
+		} else {
+			u.Add = u.Add.Set(p, value)
+		}
+	}
+	return u
+}
@@ -0,0 +1,109 @@
+package update
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fluxcd/flux/pkg/image"
+	"github.com/fluxcd/flux/pkg/policy"
+	"github.com/fluxcd/flux/pkg/resource"
+)
+
+// rejectWorkload is just enough of a workload to have its reject
+// policies updated.
+type rejectWorkload struct {
+	resource.Workload
+	policies   policy.Set
+	containers []resource.Container
+}
+
+func (w rejectWorkload) Policies() policy.Set             { return w.policies }
+func (w rejectWorkload) Containers() []resource.Container { return w.containers }
+
+func TestRejectSpec_Validate(t *testing.T) {
+	id := resource.MustParseID("default:deployment/app")
+	for _, spec := range []RejectSpec{
+		{Workload: id, Container: "app", Images: []string{"1.2.0", "org/app:1.2.0", "sha256:abc"}},
+		{Workload: id, Images: []string{"org/app:1.2.0", "org/app@sha256:abc"}},
+		{Images: []string{"org/app:1.2.0", "sha256:abc"}},
+	} {
+		assert.NoError(t, spec.Validate(), "%+v", spec)
+	}
+	for _, spec := range []RejectSpec{
+		{Workload: id},
+		{Container: "app", Images: []string{"1.2.0"}},
+		{Workload: id, Images: []string{"1.2.0"}},
+		{Images: []string{"1.2.0"}},
+		{Workload: id, Container: "app", Images: []string{"1.2.0,1.2.1"}},
+	} {
+		assert.Error(t, spec.Validate(), "%+v", spec)
+	}
+}
+
+func TestRejected(t *testing.T) {
+	info := image.Info{
+		ID:     mustParseRef("docker.io/org/app:1.2.0"),
+		Digest: "sha256:abc",
+	}
+	for _, rejected := range [][]string{
+		{"1.2.0"},
+		{"org/app:1.2.0"},
+		{"index.docker.io/org/app:1.2.0"},
+		{"sha256:abc"},
+		{"org/app@sha256:abc"},
+		{"1.1.0", "sha256:abc"},
+	} {
+		assert.True(t, Rejected(rejected, info), "%v", rejected)
+	}
+	for _, rejected := range [][]string{
+		nil,
+		{"1.2.1"},
+		{"org/other:1.2.0"},
+		{"org/app:1.2.1"},
+		{"sha256:def"},
+		{"org/other@sha256:abc"},
+	} {
+		assert.False(t, Rejected(rejected, info), "%v", rejected)
+	}
+
+	images := SortedImageInfos{
+		{ID: mustParseRef("org/app:1.2.1")},
+		info,
+		{ID: mustParseRef("org/app:1.1.0")},
+	}
+	assert.Equal(t, SortedImageInfos{images[0], images[2]}, images.WithoutRejected([]string{"sha256:abc"}))
+}
+
+func TestRejectPolicyUpdate(t *testing.T) {
+	id := resource.MustParseID("default:deployment/app")
+	workload := rejectWorkload{
+		policies: policy.Set{policy.RejectPrefix("app"): "1.1.0"},
+		containers: []resource.Container{
+			{Name: "app", Image: mustParseRef("org/app:1.0.0")},
+			{Name: "sidecar", Image: mustParseRef("org/sidecar:1.0.0")},
+		},
+	}
+
+	// without a container, images go to the containers using them
+	u := RejectSpec{Workload: id, Images: []string{"org/sidecar:2.0.0", "org/app:1.2.0"}}.RejectPolicyUpdate(workload)
+	assert.Equal(t, policy.Set{
+		policy.RejectPrefix("app"):     "1.1.0,org/app:1.2.0",
+		policy.RejectPrefix("sidecar"): "org/sidecar:2.0.0",
+	}, u.Add)
+	assert.Empty(t, u.Remove)
+
+	// digests go to every container
+	u = RejectSpec{Workload: id, Images: []string{"sha256:abc"}}.RejectPolicyUpdate(workload)
+	assert.Len(t, u.Add, 2)
+
+	// removing the last image removes the policy
+	u = RejectSpec{Workload: id, Container: "app", Images: []string{"1.1.0"}, Remove: true}.RejectPolicyUpdate(workload)
+	assert.Empty(t, u.Add)
+	assert.Equal(t, policy.Set{policy.RejectPrefix("app"): "true"}, u.Remove)
+
+	// nothing to do
+	u = RejectSpec{Workload: id, Container: "app", Images: []string{"1.1.0"}}.RejectPolicyUpdate(workload)
+	assert.Empty(t, u.Add)
+	assert.Empty(t, u.Remove)
+}
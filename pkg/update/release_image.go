@@ -224,6 +224,7 @@ func (s ReleaseImageSpec) calculateImageUpdates(rc ReleaseContext, candidates []
 		// we're skipping it rather than ignoring it. This is mainly
 		// for the purpose of filtering the output.
 		ignoredOrSkipped := ReleaseStatusIgnored
+		var anyRejected bool
 		var containerUpdates []ContainerUpdate
 
 		for _, container := range containers {
@@ -245,6 +246,18 @@ func (s ReleaseImageSpec) calculateImageUpdates(rc ReleaseContext, candidates []
 				ignoredOrSkipped = ReleaseStatusUnknown
 				continue
 			}
+			// Rejected images are passed over in the same way as
+			// tags not matching the container's filter
+			if !s.Force || s.ImageSpec == ImageSpecLatest {
+				rejected := policy.GetRejected(u.Resource.Policies(), container.Name)
+				if latest, ok := sortedImages.Latest(); ok && Rejected(rejected, latest) {
+					sortedImages = sortedImages.WithoutRejected(rejected)
+					if next, ok := sortedImages.Latest(); !ok || next.ID == currentImageID {
+						anyRejected = true
+						continue
+					}
+				}
+			}
 			latestImage, ok := sortedImages.Latest()
 			if !ok {
 				if currentImageID.CanonicalName() != singleRepo {
@@ -279,6 +292,11 @@ func (s ReleaseImageSpec) calculateImageUpdates(rc ReleaseContext, candidates []
 				Status:       ReleaseStatusSuccess,
 				PerContainer: containerUpdates,
 			}
+		case anyRejected:
+			results[u.ResourceID] = WorkloadResult{
+				Status: ReleaseStatusSkipped,
+				Error:  ImageRejected,
+			}
 		case ignoredOrSkipped == ReleaseStatusSkipped:
 			results[u.ResourceID] = WorkloadResult{
 				Status: ReleaseStatusSkipped,
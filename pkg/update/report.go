@@ -0,0 +1,72 @@
+package update
+
+import (
+	"sort"
+
+	"github.com/fluxcd/flux/pkg/resource"
+)
+
+// ReportVersion identifies the schema of Report. It is bumped only
+// when a field is removed or changes meaning, so that scripts
+// consuming the output can rely on it.
+const ReportVersion = "v1"
+
+// Report is the stable, machine-readable representation of a
+// Result. Unlike Result, which is a map keyed by resource ID, a
+// Report lists workloads in a deterministic order and uses plain
+// strings throughout, so it encodes the same way every time.
+type Report struct {
+	Version   string           `json:"version"`
+	Workloads []WorkloadReport `json:"workloads"`
+}
+
+// WorkloadReport describes what happened to a single workload.
+type WorkloadReport struct {
+	ID         string            `json:"id"`
+	Status     string            `json:"status"`
+	Error      string            `json:"error,omitempty"`
+	Containers []ContainerReport `json:"containers,omitempty"`
+}
+
+// ContainerReport describes the image change for a single container.
+type ContainerReport struct {
+	Name    string `json:"name"`
+	Current string `json:"current"`
+	Target  string `json:"target"`
+}
+
+// NewReport converts a Result into a Report, ordering workloads by
+// ID. A nil or empty Result gives a Report with no workloads.
+func NewReport(result Result) Report {
+	report := Report{
+		Version:   ReportVersion,
+		Workloads: []WorkloadReport{},
+	}
+	ids := make([]resource.ID, 0, len(result))
+	for id := range result {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].String() < ids[j].String()
+	})
+	for _, id := range ids {
+		workloadResult := result[id]
+		workload := WorkloadReport{
+			ID:     id.String(),
+			Status: string(workloadResult.Status),
+			Error:  workloadResult.Error,
+		}
+		for _, c := range workloadResult.PerContainer {
+			workload.Containers = append(workload.Containers, ContainerReport{
+				Name:    c.Container,
+				Current: c.Current.String(),
+				Target:  c.Target.String(),
+			})
+		}
+		sort.Slice(workload.Containers, func(i, j int) bool {
+			return workload.Containers[i].Name < workload.Containers[j].Name
+		})
+		report.Workloads = append(report.Workloads, workload)
+	}
+	return report
+}
@@ -0,0 +1,62 @@
+package update
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fluxcd/flux/pkg/resource"
+)
+
+func TestNewReport(t *testing.T) {
+	result := Result{
+		resource.MustParseID("default:deployment/b"): WorkloadResult{
+			Status: ReleaseStatusFailed,
+			Error:  "not found",
+		},
+		resource.MustParseID("default:deployment/a"): WorkloadResult{
+			Status: ReleaseStatusSuccess,
+			PerContainer: []ContainerUpdate{
+				{
+					Container: "web",
+					Current:   mustParseRef("quay.io/example/web:1.0"),
+					Target:    mustParseRef("quay.io/example/web:1.1"),
+				},
+				{
+					Container: "sidecar",
+					Current:   mustParseRef("quay.io/example/sidecar:1.0"),
+					Target:    mustParseRef("quay.io/example/sidecar:2.0"),
+				},
+			},
+		},
+	}
+
+	report := NewReport(result)
+	bytes, err := json.Marshal(report)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+  "version": "v1",
+  "workloads": [
+    {
+      "id": "default:deployment/a",
+      "status": "success",
+      "containers": [
+        {"name": "sidecar", "current": "quay.io/example/sidecar:1.0", "target": "quay.io/example/sidecar:2.0"},
+        {"name": "web", "current": "quay.io/example/web:1.0", "target": "quay.io/example/web:1.1"}
+      ]
+    },
+    {
+      "id": "default:deployment/b",
+      "status": "failed",
+      "error": "not found"
+    }
+  ]
+}`, string(bytes))
+}
+
+func TestNewReport_Empty(t *testing.T) {
+	bytes, err := json.Marshal(NewReport(nil))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"version": "v1", "workloads": []}`, string(bytes))
+}
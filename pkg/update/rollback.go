@@ -0,0 +1,40 @@
+package update
+
+import (
+	"errors"
+
+	"github.com/fluxcd/flux/pkg/resource"
+)
+
+// RollbackSpec is the spec for reverting a workload's images to those it
+// had before one or more earlier image changes, and locking it so
+// that automation does not immediately undo the rollback.
+type RollbackSpec struct {
+	Workload resource.ID
+	// ToRevision, if given, rolls back to the images the workload
+	// had as of this revision.
+	ToRevision string
+	// Steps is the number of image changes to undo, when ToRevision
+	// is not given. Zero is treated as one.
+	Steps int
+}
+
+// Validate checks that the spec asks for exactly one kind of
+// rollback.
+func (r RollbackSpec) Validate() error {
+	switch {
+	case r.ToRevision != "" && r.Steps != 0:
+		return errors.New("cannot give both a revision and a number of steps to roll back")
+	case r.Steps < 0:
+		return errors.New("the number of steps to roll back cannot be negative")
+	}
+	return nil
+}
+
+// StepsOrDefault returns the number of image changes to undo.
+func (r RollbackSpec) StepsOrDefault() int {
+	if r.Steps == 0 {
+		return 1
+	}
+	return r.Steps
+}